@@ -1,11 +1,13 @@
 package app
 
 import (
+	"database/sql"
 	"github.com/astaxie/beego"
 	"github.com/astaxie/beego/logs"
 	"github.com/astaxie/beego/orm"
 	"github.com/astaxie/beego/plugins/cors"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"reflect"
 	"strings"
 	"sync"
@@ -13,12 +15,30 @@ import (
 	"tongserver.dataserver/datasource"
 	"tongserver.dataserver/mgr"
 	"tongserver.dataserver/routers"
+	"tongserver.dataserver/service"
 	"tongserver.dataserver/utils"
-	//	_ "github.com/mattn/go-oci8"
 )
 
 var mu sync.Mutex
 
+// dbDrivers 数据库类型与驱动名称的对应关系，Oracle驱动需要使用oracle标签编译
+var dbDrivers = map[string]string{
+	datasource.DbTypeMySQL:      "mysql",
+	datasource.DbTypePostgreSQL: "postgres",
+	datasource.DbTypeSQLite:     sqliteDriver,
+	datasource.DbTypeOracle:     "oci8",
+}
+
+// driverRegistered 判断驱动是否已经注册
+func driverRegistered(driver string) bool {
+	for _, d := range sql.Drivers() {
+		if d == driver {
+			return true
+		}
+	}
+	return false
+}
+
 // 注册数据源
 func reloadDBUrl() error {
 	ids := datasource.CreateTableDataSource("DBURL", "default", "G_DATABASEURL")
@@ -32,12 +52,19 @@ func reloadDBUrl() error {
 		username := row[rs.Fields["USERNAME"].Index].(string)
 		pwd := row[rs.Fields["PWD"].Index].(string)
 		alias := row[rs.Fields["DBALIAS"].Index].(string)
-		if dbtype == datasource.DbTypeMySQL {
+		if dbtype == "sqlite" {
+			dbtype = datasource.DbTypeSQLite
+		}
+		if driver, ok := dbDrivers[dbtype]; ok {
+			if !driverRegistered(driver) {
+				logs.Error("\t%s 没有编译%s数据库的驱动%s", alias, dbtype, driver)
+				continue
+			}
 			dburl := row[rs.Fields["DBURL"].Index].(string)
 			logs.Info("\t%s  user:%s", dburl, username)
 			dburl = strings.ReplaceAll(dburl, "{username}", username)
 			dburl = strings.ReplaceAll(dburl, "{password}", pwd)
-			err := orm.RegisterDataBase(alias, dbtype, dburl, 30)
+			err := orm.RegisterDataBase(alias, driver, dburl, 30)
 			datasource.DBAlias2DBTypeContainer[alias] = dbtype
 			if err != nil {
 				return err
@@ -81,7 +108,47 @@ func CreateIDSCreator() {
 	})
 	// CreateWriteableTableDataSource
 	datasource.AddIdsCreator("CreateWriteableTableDataSource", func(p datasource.IDSContainerParam) interface{} {
-		return datasource.CreateWriteableTableDataSource(p["name"].(string), p["dbalias"].(string), p["tablename"].(string))
+		ids := datasource.CreateWriteableTableDataSource(p["name"].(string), p["dbalias"].(string), p["tablename"].(string))
+		// versionfield 乐观并发控制使用的版本字段
+		if v, ok := p["versionfield"].(string); ok {
+			ids.VersionField = v
+		}
+		// softdelete 软删除定义
+		if v, ok := p["softdelete"]; ok {
+			sd, err := datasource.CreateSoftDeleteDefine(v)
+			if err != nil {
+				logs.Error("数据源%s的softdelete定义错误：%s", p["name"], err.Error())
+			} else {
+				ids.SoftDelete = sd
+			}
+		}
+		return ids
+	})
+	// CreateRestDataSource url、method、headers、rowspath、fields等定义见datasource.CreateRestDataSource
+	datasource.AddIdsCreator("CreateRestDataSource", func(p datasource.IDSContainerParam) interface{} {
+		ids, err := datasource.CreateRestDataSource(p["name"].(string), p)
+		if err != nil {
+			logs.Error("数据源%s的定义错误：%s", p["name"], err.Error())
+			return nil
+		}
+		return ids
+	})
+	// CreateCSVDataSource、CreateJSONDataSource file、fields等定义见datasource.CreateCSVDataSource和datasource.CreateJSONDataSource
+	datasource.AddIdsCreator("CreateCSVDataSource", func(p datasource.IDSContainerParam) interface{} {
+		ids, err := datasource.CreateCSVDataSource(p["name"].(string), p)
+		if err != nil {
+			logs.Error("数据源%s的定义错误：%s", p["name"], err.Error())
+			return nil
+		}
+		return ids
+	})
+	datasource.AddIdsCreator("CreateJSONDataSource", func(p datasource.IDSContainerParam) interface{} {
+		ids, err := datasource.CreateJSONDataSource(p["name"].(string), p)
+		if err != nil {
+			logs.Error("数据源%s的定义错误：%s", p["name"], err.Error())
+			return nil
+		}
+		return ids
 	})
 	datasource.AddIdsCreator("CreateSQLDataSource", func(p datasource.IDSContainerParam) interface{} {
 		v := p["fields"]
@@ -141,7 +208,18 @@ func ReadCfg() {
 			panic(err)
 		}
 	}
+	// SQLite数据库，db.default.file为数据库文件的路径，元数据同样保存在该文件中，不需要外部的数据库服务
+	if dbtype == "sqlite" || dbtype == datasource.DbTypeSQLite {
+		dburl := beego.AppConfig.String("db.default.file")
+		err := orm.RegisterDataBase("default", dbDrivers[datasource.DbTypeSQLite], dburl, 30)
+		datasource.DBAlias2DBTypeContainer["default"] = datasource.DbTypeSQLite
+		if err != nil {
+			panic(err)
+		}
+	}
 
+	service.AuditIds = beego.AppConfig.String("audit.ids")
+	setMsgLogSink()
 	mgr.AddMetaFuns("dbalias", reloadDBUrl)
 	mgr.AddMetaFuns("ids", reloadIds)
 	err := mgr.ReloadMetaData()
@@ -149,6 +227,22 @@ func ReadCfg() {
 		panic(err)
 	}
 }
+
+// setMsgLogSink 根据配置文件中的msglog.sink设定消息日志的输出，可以为ring、file或db，默认为ring
+func setMsgLogSink() {
+	switch beego.AppConfig.DefaultString("msglog.sink", "ring") {
+	case "file":
+		sink, err := service.NewFileMsgLogSink(beego.AppConfig.DefaultString("msglog.file", `{"filename":"logs/msg.log","daily":true,"maxdays":7}`))
+		if err != nil {
+			panic(err)
+		}
+		service.SetMsgLogSink(sink)
+	case "db":
+		service.SetMsgLogSink(&service.DBMsgLogSink{Ids: beego.AppConfig.String("msglog.ids")})
+	default:
+		service.SetMsgLogSink(service.NewRingMsgLogSink(beego.AppConfig.DefaultInt("msglog.size", 1000)))
+	}
+}
 func RunApp() {
 	ReadCfg()
 	CreateIDSCreator()
@@ -157,8 +251,8 @@ func RunApp() {
 	beego.InsertFilter("*", beego.BeforeRouter, cors.Allow(&cors.Options{
 		AllowOrigins:     []string{"http://localhost:8080"},
 		AllowMethods:     []string{"PUT", "PATCH", "GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", service.HeaderIfMatch},
+		ExposeHeaders:    []string{"Content-Length", service.HeaderETag},
 		AllowCredentials: true}))
 	beego.Run()
 }
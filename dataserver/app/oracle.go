@@ -0,0 +1,7 @@
+//go:build oracle
+// +build oracle
+
+package app
+
+// Oracle驱动依赖Oracle Instant Client，使用 go build -tags oracle 编译时才引入
+import _ "github.com/mattn/go-oci8"
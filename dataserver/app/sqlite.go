@@ -0,0 +1,24 @@
+package app
+
+import (
+	"database/sql"
+	"github.com/astaxie/beego/orm"
+	"github.com/mattn/go-sqlite3"
+	"regexp"
+)
+
+// sqliteDriver 注册了regexp函数的SQLite驱动名称，SQLite本身没有实现REGEXP操作符使用的regexp函数
+const sqliteDriver = "sqlite3_regexp"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", func(re, s string) (bool, error) {
+				return regexp.MatchString(re, s)
+			}, true)
+		},
+	})
+	if err := orm.RegisterDriver(sqliteDriver, orm.DRSqlite); err != nil {
+		panic(err)
+	}
+}
@@ -55,11 +55,74 @@ func (c *BaseCriteria) OrCriteria(propertyname, operation string, value interfac
 	return c.addCriteria(propertyname, operation, CompOr, value)
 }
 
+// AddCriteriaGroup 添加一个条件组，条件组生成带括号的子条件，not为true时对条件组取反
+func (c *BaseCriteria) AddCriteriaGroup(complex string, not bool, children []*SQLCriteria) IFilterAdder {
+	if c.filter == nil {
+		c.filter = make([]*TDFilter, 0, 10)
+		complex = CompNone
+	}
+	c.filter = append(c.filter, &TDFilter{
+		Complex:  complex,
+		Not:      not,
+		Children: children,
+	})
+	return c
+}
+
+// fillSQLBuilderCriteria 将查询条件添加到SQL构造器
+func (c *BaseCriteria) fillSQLBuilderCriteria(sqlb ISQLBuilder) {
+	for _, item := range c.filter {
+		if item.Children != nil {
+			sqlb.AddCriteriaGroup(item.Complex, item.Not, item.Children)
+		} else {
+			sqlb.AddCriteria(item.PropertyName, item.Operation, item.Complex, item.Value)
+		}
+	}
+}
+
+// fillSQLBuilderCriteriaAnd 将查询条件与extra中的条件以与的关系添加到SQL构造器
+// 查询条件作为一个条件组，避免其中的或条件与extra中的条件组合错误
+func (c *BaseCriteria) fillSQLBuilderCriteriaAnd(sqlb ISQLBuilder, extra []*SQLCriteria) {
+	if len(extra) == 0 {
+		c.fillSQLBuilderCriteria(sqlb)
+		return
+	}
+	if len(c.filter) != 0 {
+		children := make([]*SQLCriteria, len(c.filter), len(c.filter))
+		for i, item := range c.filter {
+			children[i] = (*SQLCriteria)(item)
+		}
+		sqlb.AddCriteriaGroup(CompNone, false, children)
+	}
+	for _, cr := range extra {
+		if cr.Children != nil {
+			sqlb.AddCriteriaGroup(CompAnd, cr.Not, cr.Children)
+		} else {
+			sqlb.AddCriteria(cr.PropertyName, cr.Operation, CompAnd, cr.Value)
+		}
+	}
+}
+
 // TableDataSourceCriteria TableDataSource的条件,在基本条件上增加了聚合条件
 type TableDataSourceCriteria struct {
 	BaseCriteria
 	//OutFields []string
 	aggre map[string]*AggreType //key为聚合后返回的字段名
+	// groupby 聚合时的分组字段，为nil时按数据源的全部字段分组
+	groupby []string
+}
+
+// SetGroupBy 设定聚合时的分组字段，fields为空数组时不分组
+func (c *TableDataSourceCriteria) SetGroupBy(fields []string) {
+	c.groupby = fields
+}
+
+// selectColumns 返回查询的字段，有聚合并且设定了分组字段时只查询分组字段
+func (c *TableDataSourceCriteria) selectColumns(cols []string) []string {
+	if len(c.aggre) != 0 && c.groupby != nil {
+		return c.groupby
+	}
+	return cols
 }
 
 // AddAggre 添加一个聚合条件
@@ -8,6 +8,7 @@ import (
 // KeyStringSource Key-String类型的数据源
 type KeyStringSource struct {
 	DataSource
+	BaseCriteria
 	fields   FieldDescType
 	valueMap map[string]string
 }
@@ -86,14 +87,25 @@ func (c *KeyStringSource) Init() error {
 func (c *KeyStringSource) GetAllData() (*DataResultSet, error) {
 	var result = &DataResultSet{}
 	result.Fields = c.fields
-	result.Data = make([][]interface{}, len(c.valueMap), len(c.valueMap))
-	i := 0
+	result.Data = make([][]interface{}, 0, len(c.valueMap))
 	for k, v := range c.valueMap {
 		item := make([]interface{}, 2, 2)
 		item[0] = k
 		item[1] = v
-		result.Data[i] = item
-		i++
+		//存在查询条件时只返回满足条件的数据
+		ok, err := c.matchRecord(func(field string) (interface{}, error) {
+			f, ok := c.fields[field]
+			if !ok {
+				return nil, fmt.Errorf("KeyStringSource没有字段" + field)
+			}
+			return item[f.Index], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result.Data = append(result.Data, item)
+		}
 	}
 	return result, nil
 }
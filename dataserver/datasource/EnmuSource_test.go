@@ -21,3 +21,14 @@ func TestEnmuSource(t *testing.T) {
 	}
 	printRS(rs)
 }
+
+func TestEnmuSourceCriteria(t *testing.T) {
+	ks := &KeyStringSource{}
+	ks.Init()
+	ks.SetValueMap(map[string]string{"1": "北京", "2": "北海", "3": "上海"})
+	ks.AddCriteria("VALUE", OperStartsWith, "北").AndCriteria("KEY", OperNotIn, []string{"2"})
+	rs, err := ks.GetAllData()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][0] != "1" {
+		t.Errorf("unexpected result %v %v", rs, err)
+	}
+}
@@ -0,0 +1,126 @@
+package datasource
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OracleSQLBuilder Oracle的SQL构造器
+// 标识符转换为大写并使用双引号，参数占位符为:n，分页使用OFFSET … FETCH NEXT（Oracle 12c及以上版本）
+type OracleSQLBuilder struct {
+	SQLBuilder
+}
+
+// quoteName Oracle标识符转换为大写并使用双引号
+func (c *OracleSQLBuilder) quoteName(name string) string {
+	return quoteNameWith(name, `"`, strings.ToUpper)
+}
+
+// bindVars 将?占位符转换为:n
+func (c *OracleSQLBuilder) bindVars(sql string) string {
+	return rebindSQL(sql, func(index int) string {
+		return ":" + strconv.Itoa(index)
+	})
+}
+
+// createLimitSubStr 生成Oracle的分页子句
+func (c *OracleSQLBuilder) createLimitSubStr(offset, limit int) (string, []interface{}) {
+	return " OFFSET " + strconv.Itoa(offset) + " ROWS FETCH NEXT " + strconv.Itoa(limit) + " ROWS ONLY", nil
+}
+
+// createObjectTableSubStr 生成Oracle的抽象表子句，Oracle的表别名前不能使用AS
+func (c *OracleSQLBuilder) createObjectTableSubStr(objectTable, tableName string) string {
+	return "(" + objectTable + ") " + tableName
+}
+
+// createRegexSubStr 生成Oracle的正则匹配表达式
+func (c *OracleSQLBuilder) createRegexSubStr(fieldname string) string {
+	return "REGEXP_LIKE(" + fieldname + ",?)"
+}
+
+// createKeysetSubStr 生成Oracle的游标分页条件，Oracle不支持行值的大小比较，展开为多个条件
+func (c *OracleSQLBuilder) createKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	return createExpandedKeysetSubStr(fields, op, values)
+}
+
+// maxBindVars Oracle一条语句最多65535个参数
+func (c *OracleSQLBuilder) maxBindVars() int {
+	return 65535
+}
+
+// createUpsertSQL Oracle不支持ON CONFLICT，使用MERGE语句
+func (c *OracleSQLBuilder) createUpsertSQL(fields []string, keys []string) string {
+	src := make([]string, len(fields), len(fields))
+	cols := make([]string, len(fields), len(fields))
+	vals := make([]string, len(fields), len(fields))
+	for i, f := range fields {
+		src[i] = "? AS " + c.quote(f)
+		cols[i] = c.quote(f)
+		vals[i] = "s." + c.quote(f)
+	}
+	on := make([]string, len(keys), len(keys))
+	for i, k := range keys {
+		on[i] = "t." + c.quote(k) + "=s." + c.quote(k)
+	}
+	sql := "MERGE INTO " + c.quote(c.tableName) + " t USING (SELECT " + strings.Join(src, ",") + " FROM DUAL) s ON (" +
+		strings.Join(on, " AND ") + ")"
+	sets := make([]string, 0, len(fields))
+	for _, f := range nonKeyFields(fields, keys) {
+		sets = append(sets, "t."+c.quote(f)+"=s."+c.quote(f))
+	}
+	if len(sets) > 0 {
+		sql += " WHEN MATCHED THEN UPDATE SET " + strings.Join(sets, ",")
+	}
+	return sql + " WHEN NOT MATCHED THEN INSERT (" + strings.Join(cols, ",") + ") VALUES (" + strings.Join(vals, ",") + ")"
+}
+
+// CreateBulkInsertSQL Oracle不支持VALUES后跟多行数据，使用INSERT ALL插入多行
+func (c *OracleSQLBuilder) CreateBulkInsertSQL(fields []string, rows [][]interface{}) (string, []interface{}) {
+	params := make([]interface{}, 0, len(fields)*len(rows))
+	cols := make([]string, len(fields), len(fields))
+	for i, f := range fields {
+		cols[i] = c.quote(f)
+	}
+	into := " INTO " + c.quote(c.tableName) + " (" + strings.Join(cols, ",") + ") VALUES (" +
+		strings.TrimSuffix(strings.Repeat("?,", len(fields)), ",") + ")"
+	sql := "INSERT ALL"
+	for _, row := range rows {
+		sql += into
+		params = append(params, row...)
+	}
+	sql += " SELECT 1 FROM DUAL"
+	return c.bindVars(sql), params
+}
+
+// ownerCondition 返回查询数据字典时所有者和表名的条件，表名中没有所有者时使用当前模式
+func (c *OracleSQLBuilder) ownerCondition(alias string) string {
+	owner := "SYS_CONTEXT('USERENV','CURRENT_SCHEMA')"
+	table := strings.ToUpper(c.tableName)
+	if i := strings.LastIndex(table, "."); i != -1 {
+		owner = "'" + strings.ReplaceAll(table[:i], "'", "''") + "'"
+		table = table[i+1:]
+	}
+	return alias + ".OWNER=" + owner + " AND " + alias + ".TABLE_NAME='" + strings.ReplaceAll(table, "'", "''") + "'"
+}
+
+// oracleDataType 返回字段类型的表达式，小数位数为0的NUMBER类型作为整数类型
+const oracleDataType = "CASE WHEN b.DATA_TYPE='NUMBER' AND b.DATA_SCALE=0 THEN 'INTEGER' ELSE b.DATA_TYPE END"
+
+// CreateKeyFieldsSQL 返回查询数据库表主键信息的SQL语句
+func (c *OracleSQLBuilder) CreateKeyFieldsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT a.COLUMN_NAME," + oracleDataType + " AS DATA_TYPE FROM ALL_CONS_COLUMNS a" +
+			" INNER JOIN ALL_CONSTRAINTS t ON a.OWNER=t.OWNER AND a.CONSTRAINT_NAME=t.CONSTRAINT_NAME" +
+			" INNER JOIN ALL_TAB_COLUMNS b ON a.OWNER=b.OWNER AND a.TABLE_NAME=b.TABLE_NAME AND a.COLUMN_NAME=b.COLUMN_NAME" +
+			" WHERE " + c.ownerCondition("a") + " AND t.CONSTRAINT_TYPE='P' ORDER BY a.POSITION"
+	}
+	return ""
+}
+
+// CreateGetColsSQL 返回获取数据库表全部字段的SQL语句
+func (c *OracleSQLBuilder) CreateGetColsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT b.COLUMN_NAME," + oracleDataType + " AS DATA_TYPE FROM ALL_TAB_COLUMNS b WHERE " + c.ownerCondition("b") + " ORDER BY b.COLUMN_ID"
+	}
+	return ""
+}
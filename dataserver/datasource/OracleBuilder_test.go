@@ -0,0 +1,120 @@
+package datasource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOracleBuilderSelect(t *testing.T) {
+	sqlb, err := CreateSQLBuileder2(DbTypeOracle, "jeda_user", []string{"user_id", "USER_NAME"}, []string{"USER_ID desc"}, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlb.AddCriteria("ORG_ID", OperEq, CompAnd, "001")
+	sqlb.AddCriteria("USER_TEL", OperBetween, CompOr, []string{"1", "9"})
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID","USER_NAME" FROM "JEDA_USER" WHERE  "JEDA_USER"."ORG_ID"=:1 or "JEDA_USER"."USER_TEL" BETWEEN :2 and :3 ORDER BY "USER_ID" DESC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`
+	if sql != want {
+		t.Errorf("select sql:\n got %s\nwant %s", sql, want)
+	}
+	if !reflect.DeepEqual(ps, []interface{}{"001", "1", "9"}) {
+		t.Errorf("select params: %v", ps)
+	}
+}
+
+func TestOracleBuilderWrite(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeOracle, "JEDA_USER")
+	sql, _ := sqlb.CreateInsertSQLByMap(map[string]interface{}{"user_id": "112123"})
+	if sql != `INSERT INTO "JEDA_USER" ("USER_ID") VALUES (:1)` {
+		t.Errorf("insert sql: %s", sql)
+	}
+	sqlb.AddCriteria("USER_ID", OperEq, CompAnd, "112123")
+	sql, ps := sqlb.CreateUpdateSQL(map[string]interface{}{"ORG_ID": 13001})
+	if sql != `UPDATE "JEDA_USER" SET "ORG_ID"=:1 WHERE  "JEDA_USER"."USER_ID"=:2` || len(ps) != 2 {
+		t.Errorf("update sql: %s %v", sql, ps)
+	}
+	sql, _ = sqlb.CreateDeleteSQL()
+	if sql != `DELETE FROM "JEDA_USER" WHERE  "JEDA_USER"."USER_ID"=:1` {
+		t.Errorf("delete sql: %s", sql)
+	}
+}
+
+func TestOracleBuilderObjectTable(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2ObjectTable(DbTypeOracle, "select * from T where A=?", "t1", []string{"A"}, nil, 0, 0)
+	sqlb.AddAggre("cnt", &AggreType{Predicate: AggCount, ColName: "B"})
+	sql, _ := sqlb.CreateSelectSQL()
+	want := `SELECT "T1"."A",COUNT("T1"."B") as "CNT" FROM (select * from T where A=:1) "T1" GROUP BY "T1"."A"`
+	if sql != want {
+		t.Errorf("object table sql:\n got %s\nwant %s", sql, want)
+	}
+}
+
+func TestOracleBuilderMeta(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeOracle, "idb.jeda_user")
+	want := "SELECT b.COLUMN_NAME,CASE WHEN b.DATA_TYPE='NUMBER' AND b.DATA_SCALE=0 THEN 'INTEGER' ELSE b.DATA_TYPE END AS DATA_TYPE" +
+		" FROM ALL_TAB_COLUMNS b WHERE b.OWNER='IDB' AND b.TABLE_NAME='JEDA_USER' ORDER BY b.COLUMN_ID"
+	if sql := sqlb.CreateGetColsSQL(); sql != want {
+		t.Errorf("cols sql:\n got %s\nwant %s", sql, want)
+	}
+	types := map[string]string{
+		"VARCHAR2":                    PropertyDatatypeStr,
+		"INTEGER":                     PropertyDatatypeInt,
+		"NUMBER":                      PropertyDatatypeDou,
+		"DATE":                        PropertyDatatypeDate,
+		"TIMESTAMP(6) WITH TIME ZONE": PropertyDatatypeTime,
+		"SQLT_AFC":                    PropertyDatatypeStr,
+		"NUMBER(10":                   PropertyDatatypeDou,
+		"VARCHAR2)(":                  PropertyDatatypeUnkn,
+	}
+	for k, v := range types {
+		if r := ConvertDBType2CommonType(DbTypeOracle, k); r != v {
+			t.Errorf("ConvertOracleType2CommonType(%s)=%s,want %s", k, r, v)
+		}
+	}
+}
+
+func TestOracleBuilderRegex(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypeOracle, "JEDA_USER", []string{"USER_ID"}, nil, 0, 0)
+	sqlb.AddCriteria("USER_ID", OperRegex, CompNone, "^u")
+	sql, _ := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID" FROM "JEDA_USER" WHERE  REGEXP_LIKE("JEDA_USER"."USER_ID",:1)`
+	if sql != want {
+		t.Errorf("regex sql error\n got:%s\nwant:%s", sql, want)
+	}
+}
+
+func TestOracleBuilderBulkInsert(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeOracle, "JEDA_USER")
+	sql, ps := sqlb.CreateBulkInsertSQL([]string{"user_id", "USER_NAME"}, [][]interface{}{{"1", "a"}, {"2", "b"}})
+	want := `INSERT ALL INTO "JEDA_USER" ("USER_ID","USER_NAME") VALUES (:1,:2) INTO "JEDA_USER" ("USER_ID","USER_NAME") VALUES (:3,:4) SELECT 1 FROM DUAL`
+	if sql != want {
+		t.Errorf("bulk insert sql:\n got %s\nwant %s", sql, want)
+	}
+	if !reflect.DeepEqual(ps, []interface{}{"1", "a", "2", "b"}) {
+		t.Errorf("bulk insert params: %v", ps)
+	}
+}
+
+func TestOracleBuilderUpsert(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeOracle, "JEDA_ORG")
+	sql, ps := sqlb.CreateUpsertSQL([]string{"ORG_ID"}, map[string]interface{}{"ORG_NAME": "a", "ORG_ID": "1"})
+	want := `MERGE INTO "JEDA_ORG" t USING (SELECT :1 AS "ORG_ID",:2 AS "ORG_NAME" FROM DUAL) s ON (t."ORG_ID"=s."ORG_ID")` +
+		` WHEN MATCHED THEN UPDATE SET t."ORG_NAME"=s."ORG_NAME" WHEN NOT MATCHED THEN INSERT ("ORG_ID","ORG_NAME") VALUES (s."ORG_ID",s."ORG_NAME")`
+	if sql != want || !reflect.DeepEqual(ps, []interface{}{"1", "a"}) {
+		t.Errorf("upsert sql:\n got %s %v\nwant %s", sql, ps, want)
+	}
+}
+
+// TestOracleBuilderKeyset Oracle不支持行值的大小比较，游标条件展开为多个条件
+func TestOracleBuilderKeyset(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypeOracle, "JEDA_USER", []string{"USER_ID"}, nil, 0, 0)
+	sqlb.AddCriteria("", OperKeyset, CompNone, &KeysetValue{Fields: []string{"ORG_ID", "USER_ID"}, Values: []interface{}{1, "u1"}, Desc: true})
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID" FROM "JEDA_USER" WHERE  (("JEDA_USER"."ORG_ID"<:1) or ("JEDA_USER"."ORG_ID"=:2 and "JEDA_USER"."USER_ID"<:3))`
+	if sql != want {
+		t.Errorf("keyset sql:\n got %s\nwant %s", sql, want)
+	}
+	if !reflect.DeepEqual(ps, []interface{}{1, 1, "u1"}) {
+		t.Errorf("keyset params: %v", ps)
+	}
+}
@@ -0,0 +1,84 @@
+package datasource
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PostgreSQLSQLBuilder PostgreSQL的SQL构造器
+// 标识符使用双引号，参数占位符为$n，分页使用LIMIT/OFFSET
+type PostgreSQLSQLBuilder struct {
+	SQLBuilder
+}
+
+// quoteName PostgreSQL标识符使用双引号，保留表名、字段名的大小写
+func (c *PostgreSQLSQLBuilder) quoteName(name string) string {
+	return quoteNameWith(name, `"`, nil)
+}
+
+// bindVars 将?占位符转换为$n
+func (c *PostgreSQLSQLBuilder) bindVars(sql string) string {
+	return rebindSQL(sql, func(index int) string {
+		return "$" + strconv.Itoa(index)
+	})
+}
+
+// createLimitSubStr 生成PostgreSQL的分页子句
+func (c *PostgreSQLSQLBuilder) createLimitSubStr(offset, limit int) (string, []interface{}) {
+	return " LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset), nil
+}
+
+// createObjectTableSubStr 生成PostgreSQL的抽象表子句
+func (c *PostgreSQLSQLBuilder) createObjectTableSubStr(objectTable, tableName string) string {
+	return "(" + objectTable + ") AS " + tableName
+}
+
+// createRegexSubStr 生成PostgreSQL的正则匹配表达式，使用POSIX正则操作符~
+func (c *PostgreSQLSQLBuilder) createRegexSubStr(fieldname string) string {
+	return fieldname + " ~ ?"
+}
+
+// createKeysetSubStr 生成PostgreSQL的游标分页条件，使用行值比较
+func (c *PostgreSQLSQLBuilder) createKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	return createRowValueSubStr(fields, op, values)
+}
+
+// maxBindVars PostgreSQL一条语句最多65535个参数
+func (c *PostgreSQLSQLBuilder) maxBindVars() int {
+	return 65535
+}
+
+// createUpsertSQL 生成PostgreSQL的INSERT … ON CONFLICT语句
+func (c *PostgreSQLSQLBuilder) createUpsertSQL(fields []string, keys []string) string {
+	return c.createOnConflictUpsertSQL(fields, keys)
+}
+
+// schemaCondition 返回查询information_schema时模式和表名的条件，表名中没有模式时使用当前模式
+func (c *PostgreSQLSQLBuilder) schemaCondition(alias string) string {
+	schema := "current_schema()"
+	table := c.tableName
+	if i := strings.LastIndex(table, "."); i != -1 {
+		schema = "'" + strings.ReplaceAll(table[:i], "'", "''") + "'"
+		table = table[i+1:]
+	}
+	return alias + ".table_schema=" + schema + " AND " + alias + ".table_name='" + strings.ReplaceAll(table, "'", "''") + "'"
+}
+
+// CreateKeyFieldsSQL 返回查询数据库表主键信息的SQL语句
+func (c *PostgreSQLSQLBuilder) CreateKeyFieldsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT a.column_name,b.data_type FROM information_schema.key_column_usage a" +
+			" inner join information_schema.table_constraints t on a.constraint_schema=t.constraint_schema and a.constraint_name=t.constraint_name" +
+			" inner join information_schema.columns b on a.table_schema=b.table_schema and a.table_name=b.table_name and a.column_name=b.column_name" +
+			" WHERE " + c.schemaCondition("a") + " AND t.constraint_type='PRIMARY KEY' ORDER BY a.ordinal_position"
+	}
+	return ""
+}
+
+// CreateGetColsSQL 返回获取数据库表全部字段的SQL语句
+func (c *PostgreSQLSQLBuilder) CreateGetColsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT column_name,data_type FROM information_schema.columns c WHERE " + c.schemaCondition("c") + " ORDER BY ordinal_position"
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package datasource
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPostgreSQLBuilderSelect(t *testing.T) {
+	sqlb, err := CreateSQLBuileder2(DbTypePostgreSQL, "JEDA_USER", []string{"USER_ID", "USER_NAME"}, []string{"USER_ID DESC"}, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlb.AddCriteria("ORG_ID", OperEq, CompAnd, "001")
+	sqlb.AddCriteria("USER_ID", OperIn, CompAnd, []string{"a", "b"})
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID","USER_NAME" FROM "JEDA_USER" WHERE  "JEDA_USER"."ORG_ID"=$1 and "JEDA_USER"."USER_ID" in ($2,$3) ORDER BY "USER_ID" DESC LIMIT 10 OFFSET 20`
+	if sql != want {
+		t.Errorf("select sql:\n got %s\nwant %s", sql, want)
+	}
+	if !reflect.DeepEqual(ps, []interface{}{"001", "a", "b"}) {
+		t.Errorf("select params: %v", ps)
+	}
+}
+
+func TestPostgreSQLBuilderAggre(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypePostgreSQL, "ST_RIVER_R", []string{"STCD"}, nil, 0, 0)
+	sqlb.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "Z"})
+	sql, _ := sqlb.CreateSelectSQL()
+	want := `SELECT "ST_RIVER_R"."STCD",COUNT("ST_RIVER_R"."Z") as "CNT" FROM "ST_RIVER_R" GROUP BY "ST_RIVER_R"."STCD"`
+	if sql != want {
+		t.Errorf("aggre sql:\n got %s\nwant %s", sql, want)
+	}
+}
+
+func TestPostgreSQLBuilderWrite(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypePostgreSQL, "JEDA_USER")
+	sql, ps := sqlb.CreateInsertSQLByMap(map[string]interface{}{"USER_ID": "112123"})
+	if sql != `INSERT INTO "JEDA_USER" ("USER_ID") VALUES ($1)` || len(ps) != 1 {
+		t.Errorf("insert sql: %s %v", sql, ps)
+	}
+	sqlb.AddCriteria("USER_ID", OperEq, CompAnd, "112123")
+	sql, ps = sqlb.CreateUpdateSQL(map[string]interface{}{"ORG_ID": 13001})
+	if sql != `UPDATE "JEDA_USER" SET "ORG_ID"=$1 WHERE  "JEDA_USER"."USER_ID"=$2` || !reflect.DeepEqual(ps, []interface{}{13001, "112123"}) {
+		t.Errorf("update sql: %s %v", sql, ps)
+	}
+	sql, ps = sqlb.CreateDeleteSQL()
+	if sql != `DELETE FROM "JEDA_USER" WHERE  "JEDA_USER"."USER_ID"=$1` || len(ps) != 1 {
+		t.Errorf("delete sql: %s %v", sql, ps)
+	}
+}
+
+func TestPostgreSQLBuilderObjectTable(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2ObjectTable(DbTypePostgreSQL, "select * from t where a=? and b='?'", "T1", nil, nil, 5, 0)
+	sqlb.AddCriteria("C", OperGt, CompAnd, 1)
+	sql, _ := sqlb.CreateSelectSQL()
+	want := `SELECT "T1".*  FROM (select * from t where a=$1 and b='?') AS "T1" WHERE  "T1"."C">$2 LIMIT 5 OFFSET 0`
+	if sql != want {
+		t.Errorf("object table sql:\n got %s\nwant %s", sql, want)
+	}
+}
+
+func TestPostgreSQLBuilderMeta(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypePostgreSQL, "public.JEDA_USER")
+	want := "SELECT column_name,data_type FROM information_schema.columns c WHERE c.table_schema='public' AND c.table_name='JEDA_USER' ORDER BY ordinal_position"
+	if sql := sqlb.CreateGetColsSQL(); sql != want {
+		t.Errorf("cols sql:\n got %s\nwant %s", sql, want)
+	}
+	if ConvertDBType2CommonType(DbTypePostgreSQL, "CHARACTER VARYING") != PropertyDatatypeStr ||
+		ConvertDBType2CommonType(DbTypePostgreSQL, "INT8") != PropertyDatatypeInt ||
+		ConvertDBType2CommonType(DbTypePostgreSQL, "TIMESTAMPTZ") != PropertyDatatypeTime {
+		t.Error("ConvertPostgreSQLType2CommonType")
+	}
+}
+
+func TestPostgreSQLBuilderRegex(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypePostgreSQL, "JEDA_USER", []string{"USER_ID"}, nil, 0, 0)
+	sqlb.AddCriteria("USER_ID", OperRegex, CompNone, "^u")
+	sqlb.AddCriteria("USER_NAME", OperEndsWith, CompAnd, "!")
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID" FROM "JEDA_USER" WHERE  "JEDA_USER"."USER_ID" ~ $1 and "JEDA_USER"."USER_NAME" LIKE $2 ESCAPE '!'`
+	if sql != want {
+		t.Errorf("regex sql error\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[^u %!!]" {
+		t.Errorf("regex params error %v", ps)
+	}
+}
+
+func TestPostgreSQLBuilderUpsert(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypePostgreSQL, "jeda_org")
+	sql, _ := sqlb.CreateUpsertSQL([]string{"org_id"}, map[string]interface{}{"org_name": "a", "org_id": "1", "org_order": 1})
+	want := `INSERT INTO "jeda_org" ("org_id","org_name","org_order") VALUES ($1,$2,$3) ON CONFLICT ("org_id") DO UPDATE SET "org_name"=excluded."org_name","org_order"=excluded."org_order"`
+	if sql != want {
+		t.Errorf("upsert sql:\n got %s\nwant %s", sql, want)
+	}
+	sql, _ = sqlb.CreateUpsertSQL([]string{"org_id"}, map[string]interface{}{"org_id": "1"})
+	if want = `INSERT INTO "jeda_org" ("org_id") VALUES ($1) ON CONFLICT ("org_id") DO NOTHING`; sql != want {
+		t.Errorf("upsert sql:\n got %s\nwant %s", sql, want)
+	}
+}
@@ -3,6 +3,7 @@ package datasource
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,8 +32,74 @@ const (
 	OperIsNotNull   string = "is not null"
 	OperAlwaysFalse string = "alwaysfalse"
 	OperAlwaysTrue  string = "alwaystrue"
+	// OperNotIn 不包含
+	OperNotIn string = "notin"
+	// OperLike 模糊匹配，值为LIKE模式串，%和_为通配符，!为转义字符
+	OperLike string = "like"
+	// OperNotLike 模糊不匹配
+	OperNotLike string = "notlike"
+	// OperStartsWith 以指定字符串开头，值中的%和_按普通字符处理
+	OperStartsWith string = "startswith"
+	// OperEndsWith 以指定字符串结尾
+	OperEndsWith string = "endswith"
+	// OperContains 包含指定字符串
+	OperContains string = "contains"
+	// OperRegex 正则表达式匹配，各数据库的正则语法略有差异
+	OperRegex string = "regex"
+	// OperKeyset 游标分页条件，值为*KeysetValue，只在数据源内部使用，不能通过报文传入
+	OperKeyset string = "keyset"
 )
 
+// operationAlias 操作符的别名
+var operationAlias = map[string]string{
+	"!=":       OperNoteq,
+	"between":  OperBetween,
+	"not in":   OperNotIn,
+	"not like": OperNotLike,
+	"regexp":   OperRegex,
+}
+
+// NormalizeOperation 规范化操作符，操作符不区分大小写，并支持not in、not like等别名
+func NormalizeOperation(operation string) string {
+	op := strings.ToLower(strings.TrimSpace(operation))
+	if a, ok := operationAlias[op]; ok {
+		return a
+	}
+	return op
+}
+
+// IsPatternOperation 判断操作符的值是否为匹配字符串，匹配字符串不需要按字段类型转换
+func IsPatternOperation(operation string) bool {
+	switch operation {
+	case OperLike, OperNotLike, OperStartsWith, OperEndsWith, OperContains, OperRegex:
+		return true
+	}
+	return false
+}
+
+// LikeEscapeChar LIKE模式串的转义字符，不使用反斜杠是因为MySQL字符串中的反斜杠本身需要转义
+const LikeEscapeChar = "!"
+
+// EscapeLikeValue 转义字符串中的LIKE通配符，使其按普通字符匹配
+func EscapeLikeValue(v string) string {
+	v = strings.ReplaceAll(v, LikeEscapeChar, LikeEscapeChar+LikeEscapeChar)
+	v = strings.ReplaceAll(v, "%", LikeEscapeChar+"%")
+	return strings.ReplaceAll(v, "_", LikeEscapeChar+"_")
+}
+
+// createLikeValue 根据操作符生成LIKE模式串
+func createLikeValue(operation string, value interface{}) interface{} {
+	switch operation {
+	case OperStartsWith:
+		return EscapeLikeValue(fmt.Sprint(value)) + "%"
+	case OperEndsWith:
+		return "%" + EscapeLikeValue(fmt.Sprint(value))
+	case OperContains:
+		return "%" + EscapeLikeValue(fmt.Sprint(value)) + "%"
+	}
+	return value
+}
+
 const (
 	// CompAnd 与
 	CompAnd string = "and"
@@ -50,6 +117,10 @@ type SQLCriteria struct {
 	Operation    string
 	Value        interface{}
 	Complex      string
+	// Not 条件取反，生成not (...)，目前只针对条件组
+	Not bool
+	// Children 条件组，不为nil时该条件为带括号的子条件，忽略PropertyName、Operation和Value属性
+	Children []*SQLCriteria
 }
 
 // AggreType 聚合类型
@@ -86,16 +157,27 @@ type IAddCriteria interface {
 type PieceJoin struct {
 	Join      string
 	TableName string
-	criteria  []*SQLCriteria
-	OutField  []string
+	// Alias 连接表在语句中的别名，为空时使用表名，同一个表连接多次时必须使用不同的别名
+	Alias    string
+	criteria []*SQLCriteria
+	OutField []string
+	// OutAlias 输出字段的别名，与OutField一一对应，为空时使用字段名
+	OutAlias []string
+	// source 连接的数据源，用于查找连接表的字段
+	source IDataSource
 }
 
 // ISQLBuilder SQL构造器接口
 type ISQLBuilder interface {
 	AddCriteria(field, operation, complex string, value interface{}) IAddCriteria
+	AddCriteriaGroup(complex string, not bool, children []*SQLCriteria)
 	AddJoin(jp *PieceJoin)
 	CreateSelectSQL() (string, []interface{})
+	CreateCountSQL() (string, []interface{})
 	CreateInsertSQLByMap(fieldvalues map[string]interface{}) (string, []interface{})
+	CreateBulkInsertSQL(fields []string, rows [][]interface{}) (string, []interface{})
+	GetMaxBindVars() int
+	CreateUpsertSQL(keyfields []string, fieldvalues map[string]interface{}) (string, []interface{})
 	CreateDeleteSQL() (string, []interface{})
 	CreateUpdateSQL(fieldvalues map[string]interface{}) (string, []interface{})
 	CreateKeyFieldsSQL() string
@@ -104,6 +186,27 @@ type ISQLBuilder interface {
 	AddAggre(outfield string, aggreType *AggreType)
 }
 
+// sqlDialect SQL方言接口，封装各数据库在标识符、参数占位符、分页等语法上的差异
+// 每一种数据库的SQL构造器都需要实现该接口，SQLBuilder通过该接口生成对应数据库的SQL语句
+type sqlDialect interface {
+	// quoteName 返回加了引号的标识符
+	quoteName(name string) string
+	// bindVars 将SQL语句中的?占位符转换为数据库支持的形式
+	bindVars(sql string) string
+	// createLimitSubStr 生成分页子句
+	createLimitSubStr(offset, limit int) (string, []interface{})
+	// createObjectTableSubStr 生成抽象表子句，相当于(objectTable) as tableName
+	createObjectTableSubStr(objectTable, tableName string) string
+	// createRegexSubStr 生成正则表达式匹配的条件表达式，参数使用?占位
+	createRegexSubStr(fieldname string) string
+	// maxBindVars 一条SQL语句中允许的最大参数个数
+	maxBindVars() int
+	// createUpsertSQL 生成主键冲突时更新数据的插入语句，fields包含keys，参数按fields的顺序使用?占位
+	createUpsertSQL(fields []string, keys []string) string
+	// createKeysetSubStr 生成游标分页的条件表达式，fields为加了引号的字段名，op为>或<
+	createKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{})
+}
+
 // SQLBuilder SQL构造器类
 type SQLBuilder struct {
 	//表名
@@ -119,6 +222,8 @@ type SQLBuilder struct {
 	rowsLimit  int
 	rowsOffset int
 	aggre      map[string]*AggreType
+	//数据库方言
+	dialect sqlDialect
 }
 
 // 条件中的特殊值，该类型的值表示引用SQL语句中其他表的字段
@@ -132,49 +237,73 @@ type MySQLSQLBuileder struct {
 	SQLBuilder
 }
 
-// CreateSQLBuileder2ObjectTable 创建SQL构造器
-func CreateSQLBuileder2ObjectTable(dbType string, objectTable string, tablename string, columns []string, orderby []string, rowslimit int, rowsoffset int) (ISQLBuilder, error) {
+// createSQLBuilderByDBType 根据数据库类型创建SQL构造器
+func createSQLBuilderByDBType(dbType string, sb SQLBuilder) (ISQLBuilder, error) {
 	switch dbType {
 	case DbTypeMySQL:
-		return &MySQLSQLBuileder{
-			SQLBuilder: SQLBuilder{
-				objectTable: objectTable,
-				tableName:   tablename,
-				columns:     columns,
-				orderBy:     orderby,
-				rowsLimit:   rowslimit,
-				rowsOffset:  rowsoffset}}, nil
+		b := &MySQLSQLBuileder{SQLBuilder: sb}
+		b.dialect = b
+		return b, nil
+	case DbTypePostgreSQL:
+		b := &PostgreSQLSQLBuilder{SQLBuilder: sb}
+		b.dialect = b
+		return b, nil
+	case DbTypeSQLite:
+		b := &SQLiteSQLBuilder{SQLBuilder: sb}
+		b.dialect = b
+		return b, nil
+	case DbTypeOracle:
+		b := &OracleSQLBuilder{SQLBuilder: sb}
+		b.dialect = b
+		return b, nil
 	}
 	return nil, fmt.Errorf("不支持的数据库类型" + dbType)
 }
 
+// CreateSQLBuileder2ObjectTable 创建SQL构造器
+func CreateSQLBuileder2ObjectTable(dbType string, objectTable string, tablename string, columns []string, orderby []string, rowslimit int, rowsoffset int) (ISQLBuilder, error) {
+	return createSQLBuilderByDBType(dbType, SQLBuilder{
+		objectTable: objectTable,
+		tableName:   tablename,
+		columns:     columns,
+		orderBy:     orderby,
+		rowsLimit:   rowslimit,
+		rowsOffset:  rowsoffset})
+}
+
 // CreateSQLBuileder2 创建SQL构造器
 func CreateSQLBuileder2(dbType string, tablename string, columns []string, orderby []string, rowslimit int, rowsoffset int) (ISQLBuilder, error) {
-	switch dbType {
-	case DbTypeMySQL:
-		return &MySQLSQLBuileder{
-			SQLBuilder: SQLBuilder{
-				tableName:  tablename,
-				columns:    columns,
-				orderBy:    orderby,
-				rowsLimit:  rowslimit,
-				rowsOffset: rowsoffset}}, nil
-	}
-	return nil, fmt.Errorf("不支持的数据库类型" + dbType)
+	return createSQLBuilderByDBType(dbType, SQLBuilder{
+		tableName:  tablename,
+		columns:    columns,
+		orderBy:    orderby,
+		rowsLimit:  rowslimit,
+		rowsOffset: rowsoffset})
 }
 
 // CreateSQLBuileder 创建SQL构造器
 func CreateSQLBuileder(dbType string, tablename string) (ISQLBuilder, error) {
-	switch dbType {
-	case DbTypeMySQL:
-		return &MySQLSQLBuileder{
-			SQLBuilder: SQLBuilder{
-				tableName: tablename}}, nil
+	return createSQLBuilderByDBType(dbType, SQLBuilder{
+		tableName: tablename})
+}
+
+// alias 返回连接表在语句中使用的名称
+func (c *PieceJoin) alias() string {
+	if c.Alias != "" {
+		return c.Alias
 	}
-	return nil, fmt.Errorf("不支持的数据库类型" + dbType)
+	return c.TableName
+}
+
+// outName 返回第i个输出字段在结果集中的字段名
+func (c *PieceJoin) outName(i int) string {
+	if i < len(c.OutAlias) && c.OutAlias[i] != "" {
+		return c.OutAlias[i]
+	}
+	return c.OutField[i]
 }
 
-// AddCriteria
+// AddCriteria 添加连接条件，没有指定表名的字段为连接表的字段
 func (c *PieceJoin) AddCriteria(field, operation, complex string, value interface{}) IAddCriteria {
 	c.criteria = append(c.criteria, &SQLCriteria{
 		PropertyName: field,
@@ -185,14 +314,105 @@ func (c *PieceJoin) AddCriteria(field, operation, complex string, value interfac
 	return c
 }
 
-// AddJoin
-func (c *MySQLSQLBuileder) AddJoin(jp *PieceJoin) {
-	mu.Lock()
-	defer mu.Unlock()
-	if c.joinpiece == nil {
-		c.joinpiece = make([]*PieceJoin, 0, 2)
+// rebindSQL 将SQL语句中的?占位符依次替换为bindVar返回的占位符，单引号字符串和双引号标识符中的?不做处理
+func rebindSQL(sql string, bindVar func(index int) string) string {
+	var sb strings.Builder
+	var quote rune
+	index := 0
+	for _, r := range sql {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			sb.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			sb.WriteRune(r)
+		case r == '?':
+			index++
+			sb.WriteString(bindVar(index))
+		default:
+			sb.WriteRune(r)
+		}
 	}
-	c.joinpiece = append(c.joinpiece, jp)
+	return sb.String()
+}
+
+// quoteNameWith 使用指定的引号处理标识符，带有.的标识符逐段处理，*和已经加过引号的段不做处理
+// 标识符中的引号会转义为两个引号，fold不为nil时对没有加引号的段进行大小写转换
+func quoteNameWith(name string, quote string, fold func(string) string) string {
+	if name == "" || name == "*" {
+		return name
+	}
+	ss := strings.Split(name, ".")
+	for i, s := range ss {
+		if s == "*" || isQuotedName(s, quote) {
+			continue
+		}
+		if fold != nil {
+			s = fold(s)
+		}
+		ss[i] = quote + strings.ReplaceAll(s, quote, quote+quote) + quote
+	}
+	return strings.Join(ss, ".")
+}
+
+// isQuotedName 判断标识符是否已经加了引号，引号内的引号必须成对出现
+func isQuotedName(s string, quote string) bool {
+	if len(s) < 2*len(quote) || !strings.HasPrefix(s, quote) || !strings.HasSuffix(s, quote) {
+		return false
+	}
+	inner := s[len(quote) : len(s)-len(quote)]
+	return !strings.Contains(strings.ReplaceAll(inner, quote+quote, ""), quote)
+}
+
+// quoteName MySQL标识符使用反引号
+func (c *MySQLSQLBuileder) quoteName(name string) string {
+	return quoteNameWith(name, "`", nil)
+}
+
+// bindVars MySQL使用?作为占位符
+func (c *MySQLSQLBuileder) bindVars(sql string) string {
+	return sql
+}
+
+// createLimitSubStr 生成MySQL的分页子句
+func (c *MySQLSQLBuileder) createLimitSubStr(offset, limit int) (string, []interface{}) {
+	return " LIMIT " + strconv.Itoa(offset) + "," + strconv.Itoa(limit), nil
+}
+
+// createObjectTableSubStr 生成MySQL的抽象表子句
+func (c *MySQLSQLBuileder) createObjectTableSubStr(objectTable, tableName string) string {
+	return "(" + objectTable + ") as " + tableName
+}
+
+// createRegexSubStr 生成MySQL的正则匹配表达式
+func (c *MySQLSQLBuileder) createRegexSubStr(fieldname string) string {
+	return fieldname + " REGEXP ?"
+}
+
+// createKeysetSubStr 生成MySQL的游标分页条件，使用行值比较
+func (c *MySQLSQLBuileder) createKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	return createRowValueSubStr(fields, op, values)
+}
+
+// maxBindVars MySQL一条语句最多65535个参数
+func (c *MySQLSQLBuileder) maxBindVars() int {
+	return 65535
+}
+
+// createUpsertSQL 生成MySQL的INSERT … ON DUPLICATE KEY UPDATE语句
+func (c *MySQLSQLBuileder) createUpsertSQL(fields []string, keys []string) string {
+	sets := make([]string, 0, len(fields))
+	for _, f := range nonKeyFields(fields, keys) {
+		sets = append(sets, c.quote(f)+"=VALUES("+c.quote(f)+")")
+	}
+	if len(sets) == 0 {
+		//只有主键字段时保持原数据不变
+		sets = append(sets, c.quote(keys[0])+"="+c.quote(keys[0]))
+	}
+	return c.createInsertPrefix(fields) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
 }
 
 // CreateKeyFieldsSQL 返回查询数据库表主键信息的SQL语句
@@ -214,13 +434,23 @@ func (c *MySQLSQLBuileder) CreateGetColsSQL() string {
 	return ""
 }
 
+// AddJoin
+func (c *SQLBuilder) AddJoin(jp *PieceJoin) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c.joinpiece == nil {
+		c.joinpiece = make([]*PieceJoin, 0, 2)
+	}
+	c.joinpiece = append(c.joinpiece, jp)
+}
+
 // ClearCriteria 清楚查询条件
-func (c *MySQLSQLBuileder) ClearCriteria() {
+func (c *SQLBuilder) ClearCriteria() {
 	c.criteria = nil
 }
 
 // AddAggre 添加聚合
-func (c *MySQLSQLBuileder) AddAggre(outfield string, aggreType *AggreType) {
+func (c *SQLBuilder) AddAggre(outfield string, aggreType *AggreType) {
 	if c.aggre == nil {
 		c.aggre = make(map[string]*AggreType)
 	}
@@ -228,7 +458,7 @@ func (c *MySQLSQLBuileder) AddAggre(outfield string, aggreType *AggreType) {
 }
 
 // AddCriteria 删除条件
-func (c *MySQLSQLBuileder) AddCriteria(field, operation, complex string, value interface{}) IAddCriteria {
+func (c *SQLBuilder) AddCriteria(field, operation, complex string, value interface{}) IAddCriteria {
 	mu.Lock()
 	defer mu.Unlock()
 	if c.criteria == nil {
@@ -243,123 +473,251 @@ func (c *MySQLSQLBuileder) AddCriteria(field, operation, complex string, value i
 	return c
 }
 
+// AddCriteriaGroup 添加条件组
+func (c *SQLBuilder) AddCriteriaGroup(complex string, not bool, children []*SQLCriteria) {
+	mu.Lock()
+	defer mu.Unlock()
+	c.criteria = append(c.criteria, &SQLCriteria{
+		Complex:  complex,
+		Not:      not,
+		Children: children,
+	})
+}
+
+// quote 根据数据库方言为标识符加引号
+func (c *SQLBuilder) quote(name string) string {
+	return c.dialect.quoteName(name)
+}
+
+// quoteField 返回带表名的字段名
+func (c *SQLBuilder) quoteField(tableName, fieldName string) string {
+	return c.quote(tableName) + "." + c.quote(fieldName)
+}
+
+// quoteColumn 返回带表名的字段名，带有.的字段名已经指定了表名
+func (c *SQLBuilder) quoteColumn(tableName, fieldName string) string {
+	if strings.Contains(fieldName, ".") {
+		return c.quote(fieldName)
+	}
+	return c.quoteField(tableName, fieldName)
+}
+
+// quoteOrderBy 处理排序字段，排序字段的形式为“字段名 排序方向”，排序方向只能为ASC或DESC，其他值忽略
+func (c *SQLBuilder) quoteOrderBy(o string) string {
+	f, dir, err := ParseOrderBy(o)
+	if err != nil {
+		ss := strings.Fields(o)
+		if len(ss) == 0 {
+			return ""
+		}
+		return c.quote(ss[0])
+	}
+	if dir == "ASC" && len(strings.Fields(o)) == 1 {
+		return c.quoteOrderField(f)
+	}
+	return c.quoteOrderField(f) + " " + dir
+}
+
+// quoteOrderField 处理排序字段名，存在连接时主表的字段需要指定表名，聚合字段和连接表的输出字段不做处理
+func (c *SQLBuilder) quoteOrderField(f string) string {
+	if len(c.joinpiece) == 0 || c.aggre[f] != nil {
+		return c.quote(f)
+	}
+	for _, jin := range c.joinpiece {
+		for i := range jin.OutField {
+			if jin.outName(i) == f {
+				return c.quote(f)
+			}
+		}
+	}
+	return c.quoteColumn(c.tableName, f)
+}
+
 // 生成条件子句
-func (c *MySQLSQLBuileder) createCriteriaSubStr(tableName string, criteria []*SQLCriteria) (string, []interface{}) {
+func (c *SQLBuilder) createCriteriaSubStr(tableName string, criteria []*SQLCriteria) (string, []interface{}) {
 	var sqlwhere string
 	param := make([]interface{}, 0, len(criteria))
 	for i, cr := range criteria {
-		fieldname := tableName + "." + cr.PropertyName
-		if strings.Contains(cr.PropertyName, ".") {
-			fieldname = cr.PropertyName
+		exp, ps := c.createOneCriteriaSubStr(tableName, cr)
+		param = append(param, ps...)
+		if i != 0 {
+			if cr.Complex == CompOr {
+				sqlwhere = fmt.Sprint(sqlwhere, " ", cr.Complex, " ", exp)
+			} else {
+				//没有指定关系的条件默认为与的关系
+				sqlwhere = fmt.Sprint(sqlwhere, " ", CompAnd, " ", exp)
+			}
+		} else {
+			sqlwhere = fmt.Sprint(sqlwhere, " ", exp)
 		}
-		var exp string
-		switch cr.Operation {
-		case OperAlwaysFalse:
-			exp = " 1=0 "
-		case OperAlwaysTrue:
-			exp = " 1=1 "
-		case OperBetween:
-			{
-				switch reflect.TypeOf(cr.Value).Kind() {
-				case reflect.Slice, reflect.Array:
-					s := reflect.ValueOf(cr.Value)
-					if s.Len() != 2 {
-						panic("the BETWEEN operation in SQLBuilder the params must be array or slice, and length must be 2")
-					}
-					if f, ok := interface{}(s.Index(0).Interface()).(*FieldNameWithTableName); ok {
-						exp = fmt.Sprint(fieldname, " BETWEEN "+f.Tablename+"."+f.Fielname+" and ")
-					} else {
-						exp = fmt.Sprint(fieldname, " BETWEEN ? and ")
-						param = append(param, s.Index(0).Interface())
-					}
-					if f, ok := interface{}(s.Index(1).Interface()).(*FieldNameWithTableName); ok {
-						exp = exp + f.Tablename + "." + f.Fielname
-					} else {
-						exp = exp + "?"
-						param = append(param, s.Index(1).Interface())
-					}
-				default:
-					{
-						panic("the BETWEEN operation in SQLBuilder the params must be array or slice, and length must be 2")
-					}
+	}
+	//sql += " WHERE " + sqlwhere
+	return sqlwhere, param
+}
+
+// 生成一个条件的表达式，条件组生成带括号的子条件
+func (c *SQLBuilder) createOneCriteriaSubStr(tableName string, cr *SQLCriteria) (string, []interface{}) {
+	param := make([]interface{}, 0, 1)
+	if cr.Children != nil {
+		exp := " 1=1 "
+		if len(cr.Children) != 0 {
+			exp, param = c.createCriteriaSubStr(tableName, cr.Children)
+		}
+		if cr.Not {
+			return fmt.Sprint(CompNot, " (", exp, " )"), param
+		}
+		return fmt.Sprint("(", exp, " )"), param
+	}
+	fieldname := c.quoteColumn(tableName, cr.PropertyName)
+	var exp string
+	switch cr.Operation {
+	case OperAlwaysFalse:
+		exp = " 1=0 "
+	case OperAlwaysTrue:
+		exp = " 1=1 "
+	case OperBetween:
+		{
+			switch reflect.TypeOf(cr.Value).Kind() {
+			case reflect.Slice, reflect.Array:
+				s := reflect.ValueOf(cr.Value)
+				if s.Len() != 2 {
+					panic("the BETWEEN operation in SQLBuilder the params must be array or slice, and length must be 2")
+				}
+				if f, ok := interface{}(s.Index(0).Interface()).(*FieldNameWithTableName); ok {
+					exp = fmt.Sprint(fieldname, " BETWEEN "+c.quoteField(f.Tablename, f.Fielname)+" and ")
+				} else {
+					exp = fmt.Sprint(fieldname, " BETWEEN ? and ")
+					param = append(param, s.Index(0).Interface())
+				}
+				if f, ok := interface{}(s.Index(1).Interface()).(*FieldNameWithTableName); ok {
+					exp = exp + c.quoteField(f.Tablename, f.Fielname)
+				} else {
+					exp = exp + "?"
+					param = append(param, s.Index(1).Interface())
+				}
+			default:
+				{
+					panic("the BETWEEN operation in SQLBuilder the params must be array or slice, and length must be 2")
 				}
 			}
-		case OperIn:
-			{
-				switch reflect.TypeOf(cr.Value).Kind() {
-				case reflect.Slice, reflect.Array:
-					s := reflect.ValueOf(cr.Value)
-					ins := ""
-					for si := 0; si < s.Len(); si++ {
-						ins = ins + "?,"
-						param = append(param, s.Index(si).Interface())
-					}
-					ins = strings.TrimRight(ins, ",")
-					exp = fmt.Sprint(fieldname, " in (", ins, ")")
-				default:
-					{
-						exp = fmt.Sprint(fieldname, " in (?)")
-						param = append(param, cr.Value)
+		}
+	case OperIn, OperNotIn:
+		{
+			in := " in ("
+			if cr.Operation == OperNotIn {
+				in = " not in ("
+			}
+			switch reflect.TypeOf(cr.Value).Kind() {
+			case reflect.Slice, reflect.Array:
+				s := reflect.ValueOf(cr.Value)
+				if s.Len() == 0 {
+					//空集合，in永远为假，not in永远为真
+					if cr.Operation == OperNotIn {
+						exp = " 1=1 "
+					} else {
+						exp = " 1=0 "
 					}
+					break
+				}
+				ins := ""
+				for si := 0; si < s.Len(); si++ {
+					ins = ins + "?,"
+					param = append(param, s.Index(si).Interface())
+				}
+				ins = strings.TrimRight(ins, ",")
+				exp = fmt.Sprint(fieldname, in, ins, ")")
+			default:
+				{
+					exp = fmt.Sprint(fieldname, in, "?)")
+					param = append(param, cr.Value)
 				}
 			}
-		case OperIsNull:
-			{
-				exp = fmt.Sprint(fieldname, " is null ")
+		}
+	case OperLike, OperStartsWith, OperEndsWith, OperContains:
+		{
+			exp = fmt.Sprint(fieldname, " LIKE ? ESCAPE '", LikeEscapeChar, "'")
+			param = append(param, createLikeValue(cr.Operation, cr.Value))
+		}
+	case OperNotLike:
+		{
+			exp = fmt.Sprint(fieldname, " NOT LIKE ? ESCAPE '", LikeEscapeChar, "'")
+			param = append(param, cr.Value)
+		}
+	case OperRegex:
+		{
+			exp = c.dialect.createRegexSubStr(fieldname)
+			param = append(param, cr.Value)
+		}
+	case OperKeyset:
+		{
+			kv, ok := cr.Value.(*KeysetValue)
+			if !ok || len(kv.Fields) == 0 || len(kv.Fields) != len(kv.Values) {
+				exp = " 1=0 "
+				break
 			}
-		case OperIsNotNull:
-			{
-				exp = fmt.Sprint(fieldname, " is not null ")
+			fields := make([]string, len(kv.Fields), len(kv.Fields))
+			for i, f := range kv.Fields {
+				fields[i] = c.quoteField(tableName, f)
 			}
-		default:
-			{
-				if f, ok := interface{}(cr.Value).(*FieldNameWithTableName); ok {
-					exp = fmt.Sprint(fieldname, cr.Operation, f.Tablename, ".", f.Fielname)
-				} else {
-					exp = fmt.Sprint(fieldname, cr.Operation, "?")
-					param = append(param, cr.Value)
-				}
+			op := OperGt
+			if kv.Desc {
+				op = OperLt
 			}
+			exp, param = c.dialect.createKeysetSubStr(fields, op, kv.Values)
 		}
-		if i != 0 {
-			if cr.Complex == CompAnd || cr.Complex == CompOr {
-				sqlwhere = fmt.Sprint(sqlwhere, " ", cr.Complex, " ", exp)
+	case OperIsNull:
+		{
+			exp = fmt.Sprint(fieldname, " is null ")
+		}
+	case OperIsNotNull:
+		{
+			exp = fmt.Sprint(fieldname, " is not null ")
+		}
+	case OperEq, OperNoteq, OperGt, OperLt, OperGtEg, OperLtEg:
+		{
+			if f, ok := interface{}(cr.Value).(*FieldNameWithTableName); ok {
+				exp = fmt.Sprint(fieldname, cr.Operation, c.quoteField(f.Tablename, f.Fielname))
+			} else {
+				exp = fmt.Sprint(fieldname, cr.Operation, "?")
+				param = append(param, cr.Value)
 			}
-		} else {
-			sqlwhere = fmt.Sprint(sqlwhere, " ", exp)
+		}
+	default:
+		{
+			//不支持的操作符不能拼接到SQL语句中，该条件永远为假
+			exp = " 1=0 "
 		}
 	}
-	//sql += " WHERE " + sqlwhere
-	return sqlwhere, param
+	return exp, param
 }
 
 // createWhereSubStr 创建查询Where语句
-func (c *MySQLSQLBuileder) createWhereSubStr() (string, []interface{}) {
+func (c *SQLBuilder) createWhereSubStr() (string, []interface{}) {
 	sqlwhere, param := c.createCriteriaSubStr(c.tableName, c.criteria)
 	return " WHERE " + sqlwhere, param
 }
 
 // CreateDeleteSQL 创建删除数据的SQL语句
-func (c *MySQLSQLBuileder) CreateDeleteSQL() (string, []interface{}) {
-	sql := "DELETE FROM " + c.tableName
+func (c *SQLBuilder) CreateDeleteSQL() (string, []interface{}) {
+	sql := "DELETE FROM " + c.quote(c.tableName)
 	if c.criteria != nil {
 		where, ps := c.createWhereSubStr()
 		sql += where
-		return sql, ps
+		return c.dialect.bindVars(sql), ps
 	}
 	return sql, nil
 }
 
 // CreateUpdateSQL 创建update语句
-func (c *MySQLSQLBuileder) CreateUpdateSQL(fieldvalues map[string]interface{}) (string, []interface{}) {
-	sql := "UPDATE " + c.tableName + " SET "
+func (c *SQLBuilder) CreateUpdateSQL(fieldvalues map[string]interface{}) (string, []interface{}) {
+	sql := "UPDATE " + c.quote(c.tableName) + " SET "
 	params := make([]interface{}, len(fieldvalues), len(fieldvalues))
 	i := 0
 	for k, v := range fieldvalues {
 		if i != 0 {
 			sql += ","
 		}
-		sql += k + "=?"
+		sql += c.quote(k) + "=?"
 		params[i] = v
 		i++
 	}
@@ -368,13 +726,13 @@ func (c *MySQLSQLBuileder) CreateUpdateSQL(fieldvalues map[string]interface{}) (
 		sql += where
 		params = append(params, ps...)
 	}
-	return sql, params
+	return c.dialect.bindVars(sql), params
 }
 
 // CreateInsertSQLByMap 创建Insert语句
-func (c *MySQLSQLBuileder) CreateInsertSQLByMap(fieldvalues map[string]interface{}) (string, []interface{}) {
+func (c *SQLBuilder) CreateInsertSQLByMap(fieldvalues map[string]interface{}) (string, []interface{}) {
 	params := make([]interface{}, len(fieldvalues), len(fieldvalues))
-	sql := "INSERT INTO " + c.tableName + " ("
+	sql := "INSERT INTO " + c.quote(c.tableName) + " ("
 	ps := ""
 	i := 0
 	for k, v := range fieldvalues {
@@ -383,37 +741,161 @@ func (c *MySQLSQLBuileder) CreateInsertSQLByMap(fieldvalues map[string]interface
 			ps += ","
 		}
 		ps += "?"
-		sql += k
+		sql += c.quote(k)
 		params[i] = v
 		i++
 	}
 	sql = sql + ") VALUES (" + ps + ")"
-	return sql, params
+	return c.dialect.bindVars(sql), params
+}
+
+// nonKeyFields 返回fields中不是主键的字段
+func nonKeyFields(fields []string, keys []string) []string {
+	r := make([]string, 0, len(fields))
+	for _, f := range fields {
+		key := false
+		for _, k := range keys {
+			if f == k {
+				key = true
+				break
+			}
+		}
+		if !key {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// createInsertPrefix 返回插入一行数据的Insert语句，参数使用?占位
+func (c *SQLBuilder) createInsertPrefix(fields []string) string {
+	cols := make([]string, len(fields), len(fields))
+	for i, f := range fields {
+		cols[i] = c.quote(f)
+	}
+	return "INSERT INTO " + c.quote(c.tableName) + " (" + strings.Join(cols, ",") + ") VALUES (" +
+		strings.TrimSuffix(strings.Repeat("?,", len(fields)), ",") + ")"
+}
+
+// createOnConflictUpsertSQL 生成INSERT … ON CONFLICT语句，PostgreSQL和SQLite使用
+func (c *SQLBuilder) createOnConflictUpsertSQL(fields []string, keys []string) string {
+	cols := make([]string, len(keys), len(keys))
+	for i, k := range keys {
+		cols[i] = c.quote(k)
+	}
+	sql := c.createInsertPrefix(fields) + " ON CONFLICT (" + strings.Join(cols, ",") + ")"
+	sets := make([]string, 0, len(fields))
+	for _, f := range nonKeyFields(fields, keys) {
+		sets = append(sets, c.quote(f)+"=excluded."+c.quote(f))
+	}
+	if len(sets) == 0 {
+		return sql + " DO NOTHING"
+	}
+	return sql + " DO UPDATE SET " + strings.Join(sets, ",")
+}
+
+// CreateUpsertSQL 创建主键冲突时更新数据的插入语句，keyfields为判断冲突的主键字段
+func (c *SQLBuilder) CreateUpsertSQL(keyfields []string, fieldvalues map[string]interface{}) (string, []interface{}) {
+	fields := make([]string, 0, len(fieldvalues))
+	for k := range fieldvalues {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	params := make([]interface{}, len(fields), len(fields))
+	for i, f := range fields {
+		params[i] = fieldvalues[f]
+	}
+	return c.dialect.bindVars(c.dialect.createUpsertSQL(fields, keyfields)), params
+}
+
+// GetMaxBindVars 返回一条SQL语句中允许的最大参数个数，批量插入时据此确定每条语句插入的行数
+func (c *SQLBuilder) GetMaxBindVars() int {
+	return c.dialect.maxBindVars()
+}
+
+// CreateBulkInsertSQL 创建一次插入多行数据的Insert语句，rows中每一行的值与fields一一对应
+func (c *SQLBuilder) CreateBulkInsertSQL(fields []string, rows [][]interface{}) (string, []interface{}) {
+	params := make([]interface{}, 0, len(fields)*len(rows))
+	cols := make([]string, len(fields), len(fields))
+	for i, f := range fields {
+		cols[i] = c.quote(f)
+	}
+	ps := "(" + strings.TrimSuffix(strings.Repeat("?,", len(fields)), ",") + ")"
+	values := make([]string, len(rows), len(rows))
+	for i, row := range rows {
+		values[i] = ps
+		params = append(params, row...)
+	}
+	sql := "INSERT INTO " + c.quote(c.tableName) + " (" + strings.Join(cols, ",") + ") VALUES " + strings.Join(values, ",")
+	return c.dialect.bindVars(sql), params
 }
 
 //处理链接
-// inner join tablename on .......
-func (c *MySQLSQLBuileder) createJoinSubStr() (string, []interface{}) {
+// inner join tablename alias on .......
+// 连接条件中没有指定表名的字段为连接表的字段，参数按连接的顺序排列在Where子句的参数之前
+func (c *SQLBuilder) createJoinSubStr() (string, []interface{}) {
 	sql := ""
 	ps := make([]interface{}, 0, 1)
 	for _, pie := range c.joinpiece {
-		if len(pie.criteria) == 0 {
-			continue
-		}
 		if pie.Join == INNER_JOIN {
-			sql += " inner join " + pie.TableName + " on "
+			sql += " inner join " + c.quote(pie.TableName)
 		} else {
-			sql += " left join " + pie.TableName + " on "
+			sql += " left join " + c.quote(pie.TableName)
+		}
+		if pie.alias() != pie.TableName {
+			sql += " " + c.quote(pie.alias())
 		}
-		sqlwhere, param := c.createCriteriaSubStr(c.tableName, pie.criteria)
-		sql += sqlwhere
-		ps = append(ps, param)
+		if len(pie.criteria) == 0 {
+			sql += " on 1=1"
+			continue
+		}
+		sqlwhere, param := c.createCriteriaSubStr(pie.alias(), pie.criteria)
+		sql += " on" + sqlwhere
+		ps = append(ps, param...)
 	}
 	return sql, ps
 }
 
+// createFromSubStr 生成Select语句中的From、Join和Where子句
+func (c *SQLBuilder) createFromSubStr() (string, []interface{}) {
+	var sql string
+	var param []interface{}
+	if c.objectTable == "" {
+		sql += " FROM " + c.quote(c.tableName)
+	} else {
+		sql += " FROM " + c.dialect.createObjectTableSubStr(c.objectTable, c.quote(c.tableName))
+	}
+
+	//处理链接
+	// inner join tablename on .......
+	if len(c.joinpiece) != 0 {
+		insql, ps := c.createJoinSubStr()
+		sql += insql
+		param = append(param, ps...)
+	}
+
+	if c.criteria != nil {
+		where, ps := c.createWhereSubStr()
+		sql += where
+		param = append(param, ps...)
+	}
+	return sql, param
+}
+
+// CreateCountSQL 创建返回满足条件的记录数的语句，忽略分页和排序，有聚合时返回分组的个数
+func (c *SQLBuilder) CreateCountSQL() (string, []interface{}) {
+	if len(c.aggre) != 0 {
+		cb := *c
+		cb.rowsLimit, cb.rowsOffset, cb.orderBy = 0, 0, nil
+		sql, param := cb.CreateSelectSQL()
+		return "SELECT COUNT(*) FROM (" + sql + ") " + c.quote("T_COUNT"), param
+	}
+	from, param := c.createFromSubStr()
+	return c.dialect.bindVars("SELECT COUNT(*)" + from), param
+}
+
 // CreateSelectSQL 创建Select语句
-func (c *MySQLSQLBuileder) CreateSelectSQL() (string, []interface{}) {
+func (c *SQLBuilder) CreateSelectSQL() (string, []interface{}) {
 	if c.objectTable != "" &&
 		len(c.criteria) == 0 &&
 		c.rowsLimit == 0 &&
@@ -422,20 +904,28 @@ func (c *MySQLSQLBuileder) CreateSelectSQL() (string, []interface{}) {
 		len(c.aggre) == 0 &&
 		(len(c.columns) == 0 || c.columns[0] == "*") {
 		//符合上面条件的时候objectTable就是一条SQL语句，直接返回
-		return c.objectTable, nil
+		return c.dialect.bindVars(c.objectTable), nil
 	}
 	var sql = "SELECT "
 	var param []interface{}
 	param = nil
 	groupFields := make([]string, 0, 10)
-	cols := c.columns
+	cols := make([]string, 0, len(c.columns))
+	for _, col := range c.columns {
+		if len(c.joinpiece) != 0 {
+			//存在连接时字段名需要指定表名，避免与连接表的字段混淆
+			cols = append(cols, c.quoteColumn(c.tableName, col))
+		} else {
+			cols = append(cols, c.quote(col))
+		}
+	}
 	if len(c.aggre) != 0 {
 		//计算 group by子句中的字段列表
 		if len(c.columns) != 0 {
 			cols = make([]string, 0, 10)
 			for _, col := range c.columns {
 				if strings.Trim(col, " ") != "*" {
-					cols = append(cols, c.tableName+"."+col)
+					cols = append(cols, c.quoteColumn(c.tableName, col))
 					groupFields = append(groupFields, col)
 				}
 			}
@@ -455,13 +945,17 @@ func (c *MySQLSQLBuileder) CreateSelectSQL() (string, []interface{}) {
 			case AggSum:
 				p = "SUM("
 			}
-			p += c.tableName + "." + aggre.ColName + ") as " + field
+			if aggre.ColName == "*" {
+				p += "*) as " + c.quote(field)
+			} else {
+				p += c.quoteColumn(c.tableName, aggre.ColName) + ") as " + c.quote(field)
+			}
 			cols = append(cols, p)
 		}
 	}
 	if len(cols) == 0 {
 		//cols长度为0，选择*
-		sql += c.tableName + ".* "
+		sql += c.quote(c.tableName) + ".* "
 	} else {
 		//生成选择的字段列表
 		for i, fs := range cols {
@@ -471,43 +965,28 @@ func (c *MySQLSQLBuileder) CreateSelectSQL() (string, []interface{}) {
 			sql += fs
 		}
 	}
-	if len(c.joinpiece) != 0 {
+	if len(c.joinpiece) != 0 && len(c.aggre) == 0 {
+		//连接表的输出字段，有聚合时只输出分组字段和聚合字段
 		for _, jin := range c.joinpiece {
-			if len(jin.OutField) == 0 {
-				continue
-			}
-			for _, of := range jin.OutField {
-				sql += "," + jin.TableName + "." + of
+			for i, of := range jin.OutField {
+				sql += "," + c.quoteField(jin.alias(), of)
+				if jin.outName(i) != of {
+					sql += " AS " + c.quote(jin.outName(i))
+				}
 			}
 		}
 	}
-	if c.objectTable == "" {
-		sql += " FROM " + c.tableName
-	} else {
-		sql += " FROM (" + c.objectTable + ") as " + c.tableName
-	}
-
-	//处理链接
-	// inner join tablename on .......
-	if len(c.joinpiece) != 0 {
-		insql, ps := c.createJoinSubStr()
-		sql += insql
-		param = append(param, ps)
-	}
-
-	if c.criteria != nil {
-		where, ps := c.createWhereSubStr()
-		sql += where
-		param = append(param, ps...)
-	}
+	from, ps := c.createFromSubStr()
+	sql += from
+	param = append(param, ps...)
 
 	if len(groupFields) != 0 {
 		var grs string
 		for index, gr := range groupFields {
 			if index != 0 {
-				grs = fmt.Sprint(",", grs)
+				grs = fmt.Sprint(grs, ",")
 			}
-			grs = fmt.Sprint(grs, c.tableName+"."+gr)
+			grs = fmt.Sprint(grs, c.quoteColumn(c.tableName, gr))
 		}
 		sql += " GROUP BY " + grs
 	}
@@ -518,15 +997,17 @@ func (c *MySQLSQLBuileder) CreateSelectSQL() (string, []interface{}) {
 			if i != 0 {
 				sql += ","
 			}
-			sql += o
+			sql += c.quoteOrderBy(o)
 		}
 	}
 
 	if c.rowsLimit != 0 {
-		sql += " LIMIT " + strconv.Itoa(c.rowsOffset) + "," + strconv.Itoa(c.rowsLimit)
+		limit, ps := c.dialect.createLimitSubStr(c.rowsOffset, c.rowsLimit)
+		sql += limit
+		param = append(param, ps...)
 	}
 
-	return sql, param
+	return c.dialect.bindVars(sql), param
 }
 
 ////
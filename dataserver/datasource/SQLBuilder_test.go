@@ -2,6 +2,8 @@ package datasource
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +45,164 @@ func TestSQLBuilder(t *testing.T) {
 	sql3, _ := sqld.CreateSelectSQL()
 	fmt.Println(sql3)
 }
+
+func TestSQLBuilderCriteriaGroup(t *testing.T) {
+	// (ORG_ID=? or ORG_ID=?) and not (USER_NAME=? and USER_ID=?)
+	sqld, _ := CreateSQLBuileder2(DbTypeMySQL, "JEDA_USER", []string{"USER_ID"}, nil, 0, 0)
+	sqld.AddCriteria("USER_ID", OperIsNotNull, CompNone, nil)
+	sqld.AddCriteriaGroup(CompAnd, false, []*SQLCriteria{
+		{PropertyName: "ORG_ID", Operation: OperEq, Complex: CompOr, Value: 1},
+		{PropertyName: "ORG_ID", Operation: OperEq, Complex: CompOr, Value: 2}})
+	sqld.AddCriteriaGroup(CompAnd, true, []*SQLCriteria{
+		{PropertyName: "USER_NAME", Operation: OperEq, Complex: CompAnd, Value: "a"},
+		{PropertyName: "USER_ID", Operation: OperEq, Complex: CompAnd, Value: "b"}})
+	sql, ps := sqld.CreateSelectSQL()
+	want := "SELECT `USER_ID` FROM `JEDA_USER` WHERE  `JEDA_USER`.`USER_ID` is not null  and ( `JEDA_USER`.`ORG_ID`=? or `JEDA_USER`.`ORG_ID`=? ) and not ( `JEDA_USER`.`USER_NAME`=? and `JEDA_USER`.`USER_ID`=? )"
+	if sql != want {
+		t.Errorf("group sql error\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[1 2 a b]" {
+		t.Errorf("group params error %v", ps)
+	}
+
+	filter := &BaseCriteria{}
+	filter.AddCriteriaGroup(CompAnd, false, []*SQLCriteria{
+		{PropertyName: "ORG_ID", Operation: OperEq, Complex: CompOr, Value: 1}})
+	if filter.filter[0].Complex != CompNone || len(filter.filter[0].Children) != 1 {
+		t.Error("BaseCriteria.AddCriteriaGroup error")
+	}
+}
+
+func TestSQLBuilderPatternOperation(t *testing.T) {
+	sqld, _ := CreateSQLBuileder2(DbTypeMySQL, "JEDA_USER", []string{"USER_ID"}, nil, 0, 0)
+	sqld.AddCriteria("USER_NAME", OperStartsWith, CompNone, "a%b_")
+	sqld.AddCriteria("USER_NAME", OperNotLike, CompAnd, "%x")
+	sqld.AddCriteria("ORG_ID", OperNotIn, CompAnd, []interface{}{1, 2})
+	sqld.AddCriteria("USER_ID", OperRegex, CompOr, "^u[0-9]+$")
+	sql, ps := sqld.CreateSelectSQL()
+	want := "SELECT `USER_ID` FROM `JEDA_USER` WHERE  `JEDA_USER`.`USER_NAME` LIKE ? ESCAPE '!' and `JEDA_USER`.`USER_NAME` NOT LIKE ? ESCAPE '!' and `JEDA_USER`.`ORG_ID` not in (?,?) or `JEDA_USER`.`USER_ID` REGEXP ?"
+	if sql != want {
+		t.Errorf("pattern sql error\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[a!%b!_% %x 1 2 ^u[0-9]+$]" {
+		t.Errorf("pattern params error %v", ps)
+	}
+
+	if NormalizeOperation(" NOT IN ") != OperNotIn || NormalizeOperation("Like") != OperLike || NormalizeOperation("between") != OperBetween {
+		t.Error("NormalizeOperation error")
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"USER_ID":               "`USER_ID`",
+		"JEDA_USER.USER_ID":     "`JEDA_USER`.`USER_ID`",
+		"`USER_ID`":             "`USER_ID`",
+		"`A` ; drop table x --": "```A`` ; drop table x --`",
+		"A`B":                   "`A``B`",
+		"*":                     "*",
+	}
+	for name, want := range cases {
+		if got := quoteNameWith(name, "`", nil); got != want {
+			t.Errorf("quote %s got %s want %s", name, got, want)
+		}
+	}
+	sqlb, _ := CreateSQLBuileder2(DbTypeMySQL, "JEDA_USER", nil, []string{"USER_ID desc;drop table x", "USER_NAME asc"}, 0, 0)
+	sqlb.AddCriteria("USER_ID", "=1 or 1=1 --", CompNone, "1")
+	sql, _ := sqlb.CreateSelectSQL()
+	want := "SELECT `JEDA_USER`.*  FROM `JEDA_USER` WHERE   1=0  ORDER BY `USER_ID`,`USER_NAME` ASC"
+	if sql != want {
+		t.Errorf("got:%s\nwant:%s", sql, want)
+	}
+	if IsValidIdentifier("USER_ID or 1=1") || !IsValidIdentifier("JEDA_USER.USER_ID") || IsValidOperation("=1 or") {
+		t.Error("identifier check error")
+	}
+}
+
+func TestMySQLBuilderUpsert(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeMySQL, "JEDA_ORG")
+	sql, ps := sqlb.CreateUpsertSQL([]string{"ORG_ID"}, map[string]interface{}{"ORG_NAME": "a", "ORG_ID": "1"})
+	want := "INSERT INTO `JEDA_ORG` (`ORG_ID`,`ORG_NAME`) VALUES (?,?) ON DUPLICATE KEY UPDATE `ORG_NAME`=VALUES(`ORG_NAME`)"
+	if sql != want || !reflect.DeepEqual(ps, []interface{}{"1", "a"}) {
+		t.Errorf("upsert sql:\n got %s %v\nwant %s", sql, ps, want)
+	}
+	sql, _ = sqlb.CreateUpsertSQL([]string{"ORG_ID"}, map[string]interface{}{"ORG_ID": "1"})
+	if want = "INSERT INTO `JEDA_ORG` (`ORG_ID`) VALUES (?) ON DUPLICATE KEY UPDATE `ORG_ID`=`ORG_ID`"; sql != want {
+		t.Errorf("upsert sql:\n got %s\nwant %s", sql, want)
+	}
+}
+
+func TestSQLBuilderKeyset(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypeMySQL, "JEDA_USER", []string{"USER_ID"}, []string{"ORG_ID ASC", "USER_ID ASC"}, 2, 0)
+	sqlb.AddCriteriaGroup(CompNone, false, []*SQLCriteria{
+		{PropertyName: "USER_NAME", Operation: OperEq, Value: "a"},
+		{PropertyName: "USER_NAME", Operation: OperEq, Complex: CompOr, Value: "b"}})
+	sqlb.AddCriteria("", OperKeyset, CompAnd, &KeysetValue{Fields: []string{"ORG_ID", "USER_ID"}, Values: []interface{}{1, "u1"}})
+	sql, ps := sqlb.CreateSelectSQL()
+	want := "SELECT `USER_ID` FROM `JEDA_USER` WHERE  ( `JEDA_USER`.`USER_NAME`=? or `JEDA_USER`.`USER_NAME`=? ) and (`JEDA_USER`.`ORG_ID`,`JEDA_USER`.`USER_ID`) > (?,?) ORDER BY `ORG_ID` ASC,`USER_ID` ASC LIMIT 0,2"
+	if sql != want {
+		t.Errorf("keyset sql\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[a b 1 u1]" {
+		t.Errorf("keyset params %v", ps)
+	}
+}
+
+func TestSQLBuilderCount(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypeMySQL, "JEDA_USER", []string{"USER_ID"}, []string{"USER_ID ASC"}, 2, 4)
+	sqlb.AddCriteria("ORG_ID", OperEq, CompAnd, "o1")
+	sql, ps := sqlb.CreateCountSQL()
+	want := "SELECT COUNT(*) FROM `JEDA_USER` WHERE  `JEDA_USER`.`ORG_ID`=?"
+	if sql != want {
+		t.Errorf("count sql\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[o1]" {
+		t.Errorf("count params %v", ps)
+	}
+	// 聚合时返回分组的个数
+	sqlb.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "*"})
+	sql, _ = sqlb.CreateCountSQL()
+	want = "SELECT COUNT(*) FROM (SELECT `JEDA_USER`.`USER_ID`,COUNT(*) as `CNT` FROM `JEDA_USER` WHERE  `JEDA_USER`.`ORG_ID`=? GROUP BY `JEDA_USER`.`USER_ID`) `T_COUNT`"
+	if sql != want {
+		t.Errorf("count aggre sql\n got:%s\nwant:%s", sql, want)
+	}
+	osqlb, _ := CreateSQLBuileder2(DbTypeOracle, "JEDA_USER", []string{"USER_ID"}, nil, 2, 4)
+	osqlb.AddCriteria("ORG_ID", OperEq, CompAnd, "o1")
+	if sql, _ = osqlb.CreateCountSQL(); sql != `SELECT COUNT(*) FROM "JEDA_USER" WHERE  "JEDA_USER"."ORG_ID"=:1` {
+		t.Errorf("oracle count sql %s", sql)
+	}
+}
+
+func TestSQLBuilderJoin(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder2(DbTypeSQLite, "JEDA_USER", []string{"USER_ID", "ORG_ID"}, []string{"P.ORG_NAME DESC", "USER_ID"}, 0, 0)
+	org := &PieceJoin{Join: INNER_JOIN, TableName: "JEDA_ORG", Alias: "O", OutField: []string{"ORG_NAME"}, OutAlias: []string{"ORG"}}
+	org.AddCriteria("ORG_ID", OperEq, CompAnd, &FieldNameWithTableName{Tablename: "JEDA_USER", Fielname: "ORG_ID"}).
+		AddCriteria("ORG_ORDER", OperGt, CompAnd, 1)
+	parent := &PieceJoin{Join: INNER_LEFT, TableName: "JEDA_ORG", Alias: "P", OutField: []string{"ORG_NAME"}, OutAlias: []string{"PARENT"}}
+	parent.AddCriteria("ORG_ID", OperEq, CompAnd, &FieldNameWithTableName{Tablename: "O", Fielname: "PARENT_ID"}).
+		AddCriteria("ORG_ORDER", OperIn, CompAnd, []interface{}{2, 3})
+	sqlb.AddJoin(org)
+	sqlb.AddJoin(parent)
+	sqlb.AddCriteria("USER_NAME", OperEq, CompAnd, "u")
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "JEDA_USER"."USER_ID","JEDA_USER"."ORG_ID","O"."ORG_NAME" AS "ORG","P"."ORG_NAME" AS "PARENT" FROM "JEDA_USER"` +
+		` inner join "JEDA_ORG" "O" on "O"."ORG_ID"="JEDA_USER"."ORG_ID" and "O"."ORG_ORDER">?` +
+		` left join "JEDA_ORG" "P" on "P"."ORG_ID"="O"."PARENT_ID" and "P"."ORG_ORDER" in (?,?)` +
+		` WHERE  "JEDA_USER"."USER_NAME"=? ORDER BY "P"."ORG_NAME" DESC,"JEDA_USER"."USER_ID"`
+	if sql != want {
+		t.Errorf("join sql\n got:%s\nwant:%s", sql, want)
+	}
+	if fmt.Sprint(ps) != "[1 2 3 u]" {
+		t.Errorf("join params %v", ps)
+	}
+	sql, ps = sqlb.CreateCountSQL()
+	if !strings.HasPrefix(sql, `SELECT COUNT(*) FROM "JEDA_USER" inner join`) || fmt.Sprint(ps) != "[1 2 3 u]" {
+		t.Errorf("join count sql %s %v", sql, ps)
+	}
+	// 聚合时不输出连接表的字段
+	sqlb.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "*"})
+	sql, _ = sqlb.CreateSelectSQL()
+	if strings.Contains(sql, `AS "ORG"`) || !strings.Contains(sql, `GROUP BY "JEDA_USER"."USER_ID","JEDA_USER"."ORG_ID"`) {
+		t.Errorf("join aggre sql %s", sql)
+	}
+}
@@ -0,0 +1,78 @@
+package datasource
+
+import (
+	"strings"
+)
+
+// SQLiteSQLBuilder SQLite的SQL构造器
+// 标识符使用双引号，参数占位符为?，分页使用LIMIT ? OFFSET ?，表结构信息通过pragma获取
+type SQLiteSQLBuilder struct {
+	SQLBuilder
+}
+
+// quoteName SQLite标识符使用双引号
+func (c *SQLiteSQLBuilder) quoteName(name string) string {
+	return quoteNameWith(name, `"`, nil)
+}
+
+// bindVars SQLite使用?作为占位符
+func (c *SQLiteSQLBuilder) bindVars(sql string) string {
+	return sql
+}
+
+// createLimitSubStr 生成SQLite的分页子句，分页参数同样使用占位符
+func (c *SQLiteSQLBuilder) createLimitSubStr(offset, limit int) (string, []interface{}) {
+	return " LIMIT ? OFFSET ?", []interface{}{limit, offset}
+}
+
+// createObjectTableSubStr 生成SQLite的抽象表子句
+func (c *SQLiteSQLBuilder) createObjectTableSubStr(objectTable, tableName string) string {
+	return "(" + objectTable + ") AS " + tableName
+}
+
+// createRegexSubStr 生成SQLite的正则匹配表达式，SQLite本身没有实现regexp函数，需要在驱动中注册
+func (c *SQLiteSQLBuilder) createRegexSubStr(fieldname string) string {
+	return fieldname + " REGEXP ?"
+}
+
+// createKeysetSubStr 生成SQLite的游标分页条件，SQLite 3.15以后的版本支持行值比较
+func (c *SQLiteSQLBuilder) createKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	return createRowValueSubStr(fields, op, values)
+}
+
+// maxBindVars SQLite 3.32以前的版本一条语句最多999个参数
+func (c *SQLiteSQLBuilder) maxBindVars() int {
+	return 999
+}
+
+// createUpsertSQL 生成SQLite的INSERT … ON CONFLICT语句，需要SQLite 3.24及以上版本
+func (c *SQLiteSQLBuilder) createUpsertSQL(fields []string, keys []string) string {
+	return c.createOnConflictUpsertSQL(fields, keys)
+}
+
+// pragmaTableInfo 返回表结构信息的pragma函数，表名中有模式时使用模式名作为pragma函数的参数
+func (c *SQLiteSQLBuilder) pragmaTableInfo() string {
+	table := c.tableName
+	schema := ""
+	if i := strings.LastIndex(table, "."); i != -1 {
+		schema = ",'" + strings.ReplaceAll(table[:i], "'", "''") + "'"
+		table = table[i+1:]
+	}
+	return "pragma_table_info('" + strings.ReplaceAll(table, "'", "''") + "'" + schema + ")"
+}
+
+// CreateKeyFieldsSQL 返回查询数据库表主键信息的SQL语句
+func (c *SQLiteSQLBuilder) CreateKeyFieldsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT name AS column_name,type AS data_type FROM " + c.pragmaTableInfo() + " WHERE pk>0 ORDER BY pk"
+	}
+	return ""
+}
+
+// CreateGetColsSQL 返回获取数据库表全部字段的SQL语句
+func (c *SQLiteSQLBuilder) CreateGetColsSQL() string {
+	if c.objectTable == "" {
+		return "SELECT name AS column_name,type AS data_type FROM " + c.pragmaTableInfo() + " ORDER BY cid"
+	}
+	return ""
+}
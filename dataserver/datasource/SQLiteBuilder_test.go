@@ -0,0 +1,284 @@
+package datasource
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/orm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// createTempDir 创建临时目录，返回的函数用于删除临时目录
+func createTempDir(tb testing.TB) (string, func()) {
+	dir, err := ioutil.TempDir("", "tongserver")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// createTestDB 创建临时的SQLite数据库并注册数据库别名，返回的函数用于删除临时文件
+func createTestDB(tb testing.TB, alias string, stmts ...string) (*sql.DB, func()) {
+	dir, clean := createTempDir(tb)
+	if err := orm.RegisterDataBase(alias, DbTypeSQLite, filepath.Join(dir, "idb.db"), 1); err != nil {
+		clean()
+		tb.Fatal(err)
+	}
+	DBAlias2DBTypeContainer[alias] = DbTypeSQLite
+	db, _ := orm.GetDB(alias)
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			clean()
+			tb.Fatal(err)
+		}
+	}
+	return db, clean
+}
+
+func TestSQLiteBuilderSelect(t *testing.T) {
+	sqlb, err := CreateSQLBuileder2(DbTypeSQLite, "JEDA_USER", []string{"USER_ID", "USER_NAME"}, []string{"USER_ID ASC"}, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlb.AddCriteria("ORG_ID", OperEq, CompAnd, "001")
+	sql, ps := sqlb.CreateSelectSQL()
+	want := `SELECT "USER_ID","USER_NAME" FROM "JEDA_USER" WHERE  "JEDA_USER"."ORG_ID"=? ORDER BY "USER_ID" ASC LIMIT ? OFFSET ?`
+	if sql != want {
+		t.Errorf("select sql:\n got %s\nwant %s", sql, want)
+	}
+	if !reflect.DeepEqual(ps, []interface{}{"001", 10, 20}) {
+		t.Errorf("select params: %v", ps)
+	}
+}
+
+func TestSQLiteBuilderMeta(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeSQLite, "JEDA_USER")
+	want := "SELECT name AS column_name,type AS data_type FROM pragma_table_info('JEDA_USER') WHERE pk>0 ORDER BY pk"
+	if sql := sqlb.CreateKeyFieldsSQL(); sql != want {
+		t.Errorf("key sql:\n got %s\nwant %s", sql, want)
+	}
+	types := map[string]string{
+		"varchar(50)":  PropertyDatatypeStr,
+		"int(11)":      PropertyDatatypeInt,
+		"timestamp":    PropertyDatatypeTime,
+		"date":         PropertyDatatypeDate,
+		"REAL":         PropertyDatatypeDou,
+		"DECIMAL(8,2)": PropertyDatatypeDou,
+	}
+	for k, v := range types {
+		if r := ConvertSQLiteType2CommonType(k); r != v {
+			t.Errorf("ConvertSQLiteType2CommonType(%s)=%s,want %s", k, r, v)
+		}
+	}
+}
+
+// TestSQLiteTableDataSource 不依赖外部数据库，在临时的SQLite文件上测试数据表数据源
+func TestSQLiteTableDataSource(t *testing.T) {
+	_, clean := createTestDB(t, "sqlitetest",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int(11),PRIMARY KEY ("ORG_ID"))`)
+	defer clean()
+	ds := CreateWriteableTableDataSource("JEDA_ORG", "sqlitetest", "JEDA_ORG")
+	if len(ds.GetKeyFields()) != 1 || ds.GetKeyFields()[0].Name != "ORG_ID" || len(ds.GetFields()) != 3 {
+		t.Fatalf("fields not filled: %v %v", ds.GetKeyFields(), ds.GetFields())
+	}
+	for i, n := range []string{"A", "B", "C"} {
+		if _, err := ds.Insert(map[string]interface{}{"ORG_ID": n, "ORG_NAME": "org" + n, "ORG_ORDER": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds.AddCriteria("ORG_ORDER", OperGt, 0)
+	ds.Orderby("ORG_ID", "DESC")
+	ds.SetRowsLimit(1)
+	rs, err := ds.DoFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "C" || rs.Data[0][rs.Fields["ORG_ORDER"].Index] != int32(2) {
+		t.Errorf("unexpected result %v", rs.Data)
+	}
+	rs, err = CreateTableDataSource("JEDA_ORG", "sqlitetest", "JEDA_ORG").QueryDataByKey("B")
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_NAME"].Index] != "orgB" {
+		t.Errorf("QueryDataByKey %v %v", rs, err)
+	}
+	// contains中的%和_按普通字符匹配
+	for _, n := range []string{"50%_off", "50xxoff"} {
+		if _, err := ds.Insert(map[string]interface{}{"ORG_ID": n, "ORG_NAME": n, "ORG_ORDER": 9}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds.ClearCriteria()
+	ds.SetRowsLimit(0)
+	ds.AddCriteria("ORG_NAME", OperContains, "%_")
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "50%_off" {
+		t.Errorf("contains %v %v", rs, err)
+	}
+	// 只按指定的字段分组
+	gds := CreateTableDataSource("JEDA_ORG", "sqlitetest", "JEDA_ORG")
+	gds.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "*"})
+	gds.SetGroupBy([]string{"ORG_ORDER"})
+	gds.Orderby("ORG_ORDER", "DESC")
+	rs, err = gds.DoFilter()
+	if err != nil || len(rs.Data) != 4 || len(rs.Fields) != 2 || rs.Data[0][rs.Fields["CNT"].Index] != int64(2) {
+		t.Errorf("group by %v %v", rs, err)
+	}
+	gds.SetGroupBy([]string{"ORG_ORDER;"})
+	if _, err = gds.DoFilter(); err == nil {
+		t.Error("invalid group by field accepted")
+	}
+}
+
+// TestTableDataSourceJoinedField 带表名的字段名必须为连接表中定义的字段
+func TestTableDataSourceJoinedField(t *testing.T) {
+	_, clean := createTestDB(t, "joinedfieldtest",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"PARENT_ID" varchar(50),"ORG_ORDER" int,PRIMARY KEY ("ORG_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('R',NULL,0),('A','R',1),('B','A',2)`)
+	defer clean()
+	query := func(f func(ds *TableDataSource)) error {
+		ds := CreateTableDataSource("JEDA_ORG", "joinedfieldtest", "JEDA_ORG")
+		p, err := ds.JoinTable(INNER_JOIN, CreateTableDataSource("JEDA_ORG", "joinedfieldtest", "JEDA_ORG"), "P", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.AddCriteria("ORG_ID", OperEq, CompNone, &FieldNameWithTableName{Tablename: "JEDA_ORG", Fielname: "PARENT_ID"})
+		f(ds)
+		_, err = ds.DoFilter()
+		return err
+	}
+	if err := query(func(ds *TableDataSource) {
+		ds.AddCriteria("P.ORG_ORDER", OperGt, 0)
+		ds.Orderby("P.ORG_ID", "ASC")
+	}); err != nil {
+		t.Errorf("joined field %v", err)
+	}
+	for name, f := range map[string]func(ds *TableDataSource){
+		"unknown alias":    func(ds *TableDataSource) { ds.AddCriteria("Q.ORG_ORDER", OperGt, 0) },
+		"unknown field":    func(ds *TableDataSource) { ds.Orderby("P.NONE", "ASC") },
+		"main table alias": func(ds *TableDataSource) { ds.AddCriteria("JEDA_ORG.NONE", OperEq, 0) },
+		"aggre field": func(ds *TableDataSource) {
+			ds.AddAggre("M", &AggreType{Predicate: AggMax, ColName: "P.NONE"})
+		},
+	} {
+		if err := query(f); err == nil || !strings.Contains(err.Error(), "没有字段") {
+			t.Errorf("%s %v", name, err)
+		}
+	}
+	// 没有连接时不能使用带表名的字段名
+	ds := CreateTableDataSource("JEDA_ORG", "joinedfieldtest", "JEDA_ORG")
+	ds.AddCriteria("P.ORG_ORDER", OperGt, 0)
+	if _, err := ds.DoFilter(); err == nil || !strings.Contains(err.Error(), "没有字段") {
+		t.Errorf("alias without join %v", err)
+	}
+}
+
+// TestSQLiteBulkInsert 插入的行数超过一条语句的参数限制时分多条语句插入
+func TestSQLiteBulkInsert(t *testing.T) {
+	sqlb, _ := CreateSQLBuileder(DbTypeSQLite, "JEDA_ORG")
+	sql, ps := sqlb.CreateBulkInsertSQL([]string{"ORG_ID", "ORG_NAME"}, [][]interface{}{{"A", "a"}, {"B", "b"}})
+	if sql != `INSERT INTO "JEDA_ORG" ("ORG_ID","ORG_NAME") VALUES (?,?),(?,?)` || len(ps) != 4 {
+		t.Errorf("bulk insert sql: %s %v", sql, ps)
+	}
+
+	db, clean := createTestDB(t, "bulktest",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int(11),PRIMARY KEY ("ORG_ID"))`)
+	defer clean()
+	ds := CreateWriteableTableDataSource("JEDA_ORG", "bulktest", "JEDA_ORG")
+	rows := make([]map[string]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		row := map[string]interface{}{"ORG_ID": fmt.Sprintf("%04d", i), "ORG_ORDER": i}
+		if i%2 == 0 {
+			row["ORG_NAME"] = "org"
+		}
+		rows = append(rows, row)
+	}
+	wr, err := ds.BulkInsert(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	db.QueryRow(`SELECT count(*) FROM "JEDA_ORG" WHERE "ORG_NAME"='org'`).Scan(&n)
+	if wr.RowsAffected != 1000 || n != 500 {
+		t.Errorf("bulk insert affected %d, named %d", wr.RowsAffected, n)
+	}
+
+	// 任何一行失败都回滚全部插入
+	rows = []map[string]interface{}{{"ORG_ID": "X"}, {"ORG_ID": "0001"}}
+	if _, err := ds.BulkInsert(rows); err == nil {
+		t.Error("bulk insert with duplicate key succeeded")
+	}
+	db.QueryRow(`SELECT count(*) FROM "JEDA_ORG"`).Scan(&n)
+	if n != 1000 {
+		t.Errorf("bulk insert not rolled back %d", n)
+	}
+}
+
+func TestSQLiteUpsert(t *testing.T) {
+	db, clean := createTestDB(t, "upserttest",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int(11),PRIMARY KEY ("ORG_ID"))`,
+		`CREATE TABLE "JEDA_USER" ("USER_ID" varchar(50) NOT NULL,"USER_NAME" varchar(100),"DELETED" int,"VER" int,PRIMARY KEY ("USER_ID"))`,
+		`INSERT INTO "JEDA_USER" VALUES ('U1','user1',1,5)`)
+	defer clean()
+	ds := CreateWriteableTableDataSource("JEDA_ORG", "upserttest", "JEDA_ORG")
+	if _, inserted, err := ds.Upsert(map[string]interface{}{"ORG_ID": "A", "ORG_NAME": "a", "ORG_ORDER": 1}); err != nil || !inserted {
+		t.Fatalf("upsert insert %v %v", inserted, err)
+	}
+	if _, inserted, err := ds.Upsert(map[string]interface{}{"ORG_ID": "A", "ORG_NAME": "b"}); err != nil || inserted {
+		t.Fatalf("upsert update %v %v", inserted, err)
+	}
+	var name string
+	var order int
+	db.QueryRow(`SELECT "ORG_NAME","ORG_ORDER" FROM "JEDA_ORG" WHERE "ORG_ID"='A'`).Scan(&name, &order)
+	if name != "b" || order != 1 {
+		t.Errorf("upsert updated %s %d", name, order)
+	}
+	if _, _, err := ds.Upsert(map[string]interface{}{"ORG_NAME": "c"}); err == nil {
+		t.Error("upsert without key succeeded")
+	}
+
+	// 已经删除的数据视为不存在，更新数据并恢复删除标记
+	uds := CreateWriteableTableDataSource("JEDA_USER", "upserttest", "JEDA_USER")
+	uds.SoftDelete = &SoftDeleteDefine{Field: "DELETED", Value: 1, RestoreValue: 0}
+	if _, inserted, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u1"}); err != nil || !inserted {
+		t.Fatalf("upsert deleted row %v %v", inserted, err)
+	}
+	var deleted int
+	db.QueryRow(`SELECT "USER_NAME","DELETED" FROM "JEDA_USER" WHERE "USER_ID"='U1'`).Scan(&name, &deleted)
+	if name != "u1" || deleted != 0 {
+		t.Errorf("upsert restored %s %d", name, deleted)
+	}
+	if _, inserted, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u2"}); err != nil || inserted {
+		t.Errorf("upsert restored row %v %v", inserted, err)
+	}
+
+	// 使用乐观并发控制时更新已有数据必须提交版本，已经删除的数据在当前版本的基础上更新版本
+	uds.VersionField = "VER"
+	if _, _, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u3"}); err == nil {
+		t.Error("upsert without version succeeded")
+	}
+	if _, _, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u3", "VER": 4}); err != ErrVersionConflict {
+		t.Errorf("upsert with old version %v", err)
+	}
+	if _, inserted, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u3", "VER": 5}); err != nil || inserted {
+		t.Errorf("upsert with version %v %v", inserted, err)
+	}
+	if _, inserted, err := uds.Upsert(map[string]interface{}{"USER_ID": "U2", "USER_NAME": "u2"}); err != nil || !inserted {
+		t.Errorf("upsert insert versioned %v %v", inserted, err)
+	}
+	db.Exec(`UPDATE "JEDA_USER" SET "DELETED"=1 WHERE "USER_ID"='U1'`)
+	if _, inserted, err := uds.Upsert(map[string]interface{}{"USER_ID": "U1", "USER_NAME": "u4"}); err != nil || !inserted {
+		t.Errorf("upsert deleted versioned row %v %v", inserted, err)
+	}
+	var ver int
+	for id, want := range map[string]int{"U1": 7, "U2": 1} {
+		db.QueryRow(`SELECT "VER","DELETED" FROM "JEDA_USER" WHERE "USER_ID"=?`, id).Scan(&ver, &deleted)
+		if ver != want || deleted != 0 {
+			t.Errorf("%s version %d deleted %d", id, ver, deleted)
+		}
+	}
+}
@@ -1,47 +1,450 @@
 package datasource
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrVersionConflict 数据的版本与期望的版本不一致，数据已经被修改或删除
+var ErrVersionConflict = fmt.Errorf("数据已经被修改或删除，请重新读取数据后再操作")
+
 // WriteableTableSource 可写的数据表数据源
 type WriteableTableSource struct {
 	TableDataSource
+	// VersionField 版本字段，不为空时使用乐观并发控制，字段类型必须为整数或时间
+	VersionField string
+}
+
+// GetVersionField 返回版本字段名
+func (c *WriteableTableSource) GetVersionField() string {
+	return c.VersionField
+}
+
+// createWriteSQLBuilder 创建更新、删除使用的SQL构造器，version不为nil时在当前条件上增加版本条件
+// 使用软删除时只处理没有删除的数据
+func (c *WriteableTableSource) createWriteSQLBuilder(version interface{}) (ISQLBuilder, error) {
+	extra := c.notDeletedCriteria()
+	if version != nil {
+		extra = append(extra, &SQLCriteria{PropertyName: c.VersionField, Operation: OperEq, Value: version})
+	}
+	return c.createWriteSQLBuilderWith(extra)
 }
 
-// Delete 删除
-func (c *WriteableTableSource) Delete() error {
+// createWriteSQLBuilderWith 创建更新、删除使用的SQL构造器，当前条件与extra中的条件为与的关系
+func (c *WriteableTableSource) createWriteSQLBuilderWith(extra []*SQLCriteria) (ISQLBuilder, error) {
+	if err := c.checkCriteria(c.filter, nil); err != nil {
+		return nil, err
+	}
 	sqlb, err := c.createSQLBuilder()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sqlb.ClearCriteria()
-	for _, item := range c.filter {
-		sqlb.AddCriteria(item.PropertyName, item.Operation, item.Complex, item.Value)
+	c.fillSQLBuilderCriteriaAnd(sqlb, extra)
+	return sqlb, nil
+}
+
+// checkVersion 使用乐观并发控制时不能直接更新和删除数据
+func (c *WriteableTableSource) checkVersion() error {
+	if c.VersionField != "" {
+		return fmt.Errorf("数据源%s使用乐观并发控制，更新和删除时必须指定数据的版本", c.Name)
+	}
+	return nil
+}
+
+// nextVersion 返回版本字段的新值，整数类型的版本加1，时间类型的版本为当前时间
+func (c *WriteableTableSource) nextVersion(version interface{}) (interface{}, error) {
+	f := c.GetFieldByName(c.VersionField)
+	if f == nil {
+		return nil, fmt.Errorf("数据源%s中没有版本字段%s", c.Name, c.VersionField)
+	}
+	switch f.DataType {
+	case PropertyDatatypeInt:
+		if version == nil {
+			return 1, nil
+		}
+		v, ok := toFloat(version)
+		if !ok {
+			return nil, fmt.Errorf("版本字段的值必须为整数：%v", version)
+		}
+		return int64(v) + 1, nil
+	case PropertyDatatypeTime, PropertyDatatypeDate:
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	return nil, fmt.Errorf("版本字段%s的类型必须为整数或时间", c.VersionField)
+}
+
+// fillInitialVersion 插入的数据中没有版本字段时填充版本的初始值
+func (c *WriteableTableSource) fillInitialVersion(values map[string]interface{}) error {
+	if c.VersionField == "" {
+		return nil
+	}
+	if _, ok := values[c.VersionField]; ok {
+		return nil
+	}
+	v, err := c.nextVersion(nil)
+	if err != nil {
+		return err
+	}
+	values[c.VersionField] = v
+	return nil
+}
+
+// Delete 删除，返回删除的行数，使用软删除时只将数据标记为已经删除
+func (c *WriteableTableSource) Delete() (*WriteResult, error) {
+	if err := c.checkVersion(); err != nil {
+		return nil, err
+	}
+	if c.SoftDelete != nil {
+		return c.softDelete(nil, nil)
+	}
+	sqlb, err := c.createWriteSQLBuilder(nil)
+	if err != nil {
+		return nil, err
 	}
 	sql, p := sqlb.CreateDeleteSQL()
-	_, err2 := c.openedDB.Exec(sql, p...)
-	return err2
+	return c.execSQL(sql, p...)
 }
 
-// Insert 插入
-func (c *WriteableTableSource) Insert(values map[string]interface{}) error {
+// DeleteVersion 删除满足条件并且版本为version的数据，没有数据被删除时返回ErrVersionConflict
+func (c *WriteableTableSource) DeleteVersion(version interface{}) (*WriteResult, error) {
+	if c.VersionField == "" {
+		return nil, fmt.Errorf("数据源%s没有设定版本字段", c.Name)
+	}
+	var r *WriteResult
+	var err error
+	if c.SoftDelete != nil {
+		//软删除同时更新版本
+		next, e := c.nextVersion(version)
+		if e != nil {
+			return nil, e
+		}
+		r, err = c.softDelete([]*SQLCriteria{{PropertyName: c.VersionField, Operation: OperEq, Value: version}},
+			map[string]interface{}{c.VersionField: next})
+	} else {
+		sqlb, e := c.createWriteSQLBuilder(version)
+		if e != nil {
+			return nil, e
+		}
+		sql, p := sqlb.CreateDeleteSQL()
+		r, err = c.execSQL(sql, p...)
+	}
+	if err == nil && r.RowsAffected == 0 {
+		return nil, ErrVersionConflict
+	}
+	return r, err
+}
+
+// Insert 插入，返回插入的行数和数据库生成的自增主键
+func (c *WriteableTableSource) Insert(values map[string]interface{}) (*WriteResult, error) {
+	if err := c.checkFieldValues(values); err != nil {
+		return nil, err
+	}
+	if err := c.fillInitialVersion(values); err != nil {
+		return nil, err
+	}
 	sqlb, err := CreateSQLBuileder(DBAlias2DBTypeContainer[c.DBAlias], c.TableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sql, ps := sqlb.CreateInsertSQLByMap(values)
-	_, err2 := c.openedDB.Exec(sql, ps...)
-	return err2
+	return c.execSQL(sql, ps...)
 }
 
-// Update 更新
-func (c *WriteableTableSource) Update(values map[string]interface{}) error {
-	sqlb, err := c.createSQLBuilder()
+// Update 更新，返回更新的行数
+func (c *WriteableTableSource) Update(values map[string]interface{}) (*WriteResult, error) {
+	if err := c.checkVersion(); err != nil {
+		return nil, err
+	}
+	if err := c.checkFieldValues(values); err != nil {
+		return nil, err
+	}
+	sqlb, err := c.createWriteSQLBuilder(nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	sqlb.ClearCriteria()
-	for _, item := range c.filter {
-		sqlb.AddCriteria(item.PropertyName, item.Operation, item.Complex, item.Value)
+	sql, ps := sqlb.CreateUpdateSQL(values)
+	return c.execSQL(sql, ps...)
+}
+
+// UpdateVersion 更新满足条件并且版本为version的数据，版本字段更新为新的版本，没有数据被更新时返回ErrVersionConflict
+func (c *WriteableTableSource) UpdateVersion(values map[string]interface{}, version interface{}) (*WriteResult, error) {
+	if c.VersionField == "" {
+		return nil, fmt.Errorf("数据源%s没有设定版本字段", c.Name)
+	}
+	if err := c.checkFieldValues(values); err != nil {
+		return nil, err
+	}
+	if _, ok := values[c.VersionField]; ok {
+		return nil, fmt.Errorf("版本字段%s由系统维护，不能直接更新", c.VersionField)
+	}
+	next, err := c.nextVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	sqlb, err := c.createWriteSQLBuilder(version)
+	if err != nil {
+		return nil, err
+	}
+	vs := make(map[string]interface{}, len(values)+1)
+	for k, v := range values {
+		vs[k] = v
+	}
+	vs[c.VersionField] = next
+	sql, ps := sqlb.CreateUpdateSQL(vs)
+	r, err := c.execSQL(sql, ps...)
+	if err == nil && r.RowsAffected == 0 {
+		return nil, ErrVersionConflict
+	}
+	return r, err
+}
+
+// bulkInsertGroup 字段相同的一组插入数据
+type bulkInsertGroup struct {
+	fields []string
+	rows   [][]interface{}
+}
+
+// groupBulkInsertRows 按字段将插入数据分组，每组数据可以使用同一条Insert语句，保持数据原有的顺序
+func groupBulkInsertRows(rows []map[string]interface{}) []*bulkInsertGroup {
+	groups := make([]*bulkInsertGroup, 0, 1)
+	index := make(map[string]*bulkInsertGroup)
+	for _, row := range rows {
+		fields := make([]string, 0, len(row))
+		for k := range row {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		key := strings.Join(fields, ",")
+		g, ok := index[key]
+		if !ok {
+			g = &bulkInsertGroup{fields: fields}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		values := make([]interface{}, len(fields), len(fields))
+		for i, f := range fields {
+			values[i] = row[f]
+		}
+		g.rows = append(g.rows, values)
+	}
+	return groups
+}
+
+// BulkInsert 批量插入，每条Insert语句插入多行数据，语句的参数个数不超过数据库的限制
+// 没有设定事务时在一个新的事务中执行，任何一条语句失败都会回滚全部插入
+func (c *WriteableTableSource) BulkInsert(rows []map[string]interface{}) (*WriteResult, error) {
+	for _, row := range rows {
+		if err := c.checkFieldValues(row); err != nil {
+			return nil, err
+		}
+		if err := c.fillInitialVersion(row); err != nil {
+			return nil, err
+		}
+	}
+	sqlb, err := CreateSQLBuileder(DBAlias2DBTypeContainer[c.DBAlias], c.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if c.tx == nil {
+		tx, err := c.BeginTx()
+		if err != nil {
+			return nil, err
+		}
+		c.SetTx(tx)
+		defer c.SetTx(nil)
+		result, err := c.bulkInsert(sqlb, rows)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return c.bulkInsert(sqlb, rows)
+}
+
+// bulkInsert 按数据库参数个数的限制分批执行插入语句
+func (c *WriteableTableSource) bulkInsert(sqlb ISQLBuilder, rows []map[string]interface{}) (*WriteResult, error) {
+	result := &WriteResult{}
+	for _, g := range groupBulkInsertRows(rows) {
+		size := len(g.rows)
+		if len(g.fields) > 0 {
+			size = sqlb.GetMaxBindVars() / len(g.fields)
+		}
+		if size < 1 {
+			size = 1
+		}
+		for start := 0; start < len(g.rows); start += size {
+			end := start + size
+			if end > len(g.rows) {
+				end = len(g.rows)
+			}
+			sql, ps := sqlb.CreateBulkInsertSQL(g.fields, g.rows[start:end])
+			wr, err := c.execSQL(sql, ps...)
+			if err != nil {
+				return nil, err
+			}
+			result.RowsAffected += wr.RowsAffected
+		}
+	}
+	return result, nil
+}
+
+// Upsert 按主键插入或更新数据，values中必须包含全部主键字段
+// 先在同一个事务中查询主键是否存在，再执行各数据库的插入或更新语句
+// 使用软删除时已经删除的数据视为不存在，更新数据并恢复删除标记，inserted为true
+// 使用乐观并发控制时values中版本字段的值为期望的版本，更新没有删除的数据时必须与数据的版本一致，版本字段自动更新
+func (c *WriteableTableSource) Upsert(values map[string]interface{}) (*WriteResult, bool, error) {
+	if err := c.checkFieldValues(values); err != nil {
+		return nil, false, err
+	}
+	kfs := c.GetKeyFields()
+	if len(kfs) == 0 {
+		return nil, false, fmt.Errorf("数据源%s没有主键，不能执行upsert操作", c.Name)
+	}
+	keys := make([]string, len(kfs), len(kfs))
+	for i, k := range kfs {
+		if _, ok := values[k.Name]; !ok {
+			return nil, false, fmt.Errorf("upsert操作的数据中没有主键字段%s", k.Name)
+		}
+		keys[i] = k.Name
+	}
+	dbType := DBAlias2DBTypeContainer[c.DBAlias]
+	if c.tx == nil {
+		tx, err := c.BeginTx()
+		if err != nil {
+			return nil, false, err
+		}
+		c.SetTx(tx)
+		defer c.SetTx(nil)
+		result, inserted, err := c.upsert(dbType, keys, values)
+		if err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, false, err
+		}
+		return result, inserted, nil
+	}
+	return c.upsert(dbType, keys, values)
+}
+
+// existsKey 查询主键对应的数据是否存在，extra为附加的条件，不排除已经删除的数据
+func (c *WriteableTableSource) existsKey(dbType string, keys []string, values map[string]interface{}, extra ...*SQLCriteria) (bool, error) {
+	qb, err := CreateSQLBuileder2(dbType, c.TableName, keys, nil, 0, 0)
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		qb.AddCriteria(k, OperEq, CompAnd, values[k])
+	}
+	for _, cr := range extra {
+		qb.AddCriteria(cr.PropertyName, cr.Operation, CompAnd, cr.Value)
+	}
+	sql, ps := qb.CreateSelectSQL()
+	return c.existsSQL(sql, ps...)
+}
+
+// upsert 查询主键是否存在并执行插入或更新语句
+func (c *WriteableTableSource) upsert(dbType string, keys []string, values map[string]interface{}) (*WriteResult, bool, error) {
+	exists, err := c.existsKey(dbType, keys, values)
+	if err != nil {
+		return nil, false, err
+	}
+	deleted := false
+	if exists && c.SoftDelete != nil {
+		if deleted, err = c.existsKey(dbType, keys, values, c.deletedCriteria()); err != nil {
+			return nil, false, err
+		}
+	}
+	vs := make(map[string]interface{}, len(values)+1)
+	for k, v := range values {
+		vs[k] = v
+	}
+	if exists && c.SoftDelete != nil {
+		vs[c.SoftDelete.Field] = c.SoftDelete.RestoreValue
+	}
+	if !exists {
+		if err := c.fillInitialVersion(vs); err != nil {
+			return nil, false, err
+		}
+	} else if c.VersionField != "" {
+		return c.upsertVersion(dbType, keys, vs, deleted)
+	}
+	sqlb, err := CreateSQLBuileder(dbType, c.TableName)
+	if err != nil {
+		return nil, false, err
+	}
+	sql, ps := sqlb.CreateUpsertSQL(keys, vs)
+	result, err := c.execSQL(sql, ps...)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, !exists || deleted, nil
+}
+
+// upsertVersion 按版本更新已经存在的数据，没有删除的数据必须提交期望的版本，没有数据被更新时返回ErrVersionConflict
+// 已经删除的数据视为不存在，不需要提交版本，版本在数据当前版本的基础上更新
+func (c *WriteableTableSource) upsertVersion(dbType string, keys []string, values map[string]interface{}, deleted bool) (*WriteResult, bool, error) {
+	sqlb, err := CreateSQLBuileder(dbType, c.TableName)
+	if err != nil {
+		return nil, false, err
 	}
+	for _, k := range keys {
+		sqlb.AddCriteria(k, OperEq, CompAnd, values[k])
+	}
+	var version interface{}
+	if deleted {
+		if version, err = c.queryKeyVersion(dbType, keys, values); err != nil {
+			return nil, false, err
+		}
+		cr := c.deletedCriteria()
+		sqlb.AddCriteria(cr.PropertyName, cr.Operation, CompAnd, cr.Value)
+	} else {
+		version = values[c.VersionField]
+		if version == nil {
+			return nil, false, fmt.Errorf("数据源%s使用乐观并发控制，更新已有数据时必须在版本字段%s中提交数据的版本", c.Name, c.VersionField)
+		}
+		sqlb.AddCriteria(c.VersionField, OperEq, CompAnd, version)
+	}
+	next, err := c.nextVersion(version)
+	if err != nil {
+		return nil, false, err
+	}
+	values[c.VersionField] = next
 	sql, ps := sqlb.CreateUpdateSQL(values)
-	_, err2 := c.openedDB.Exec(sql, ps...)
-	return err2
+	r, err := c.execSQL(sql, ps...)
+	if err == nil && r.RowsAffected == 0 {
+		return nil, false, ErrVersionConflict
+	}
+	return r, deleted, err
+}
+
+// queryKeyVersion 查询主键对应的数据的当前版本
+func (c *WriteableTableSource) queryKeyVersion(dbType string, keys []string, values map[string]interface{}) (interface{}, error) {
+	qb, err := CreateSQLBuileder2(dbType, c.TableName, []string{c.VersionField}, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		qb.AddCriteria(k, OperEq, CompAnd, values[k])
+	}
+	sql, ps := qb.CreateSelectSQL()
+	c.palesql = true
+	rs, err := c.querySQLData(sql, ps...)
+	c.palesql = false
+	if err != nil {
+		return nil, err
+	}
+	f := rs.Fields[c.VersionField]
+	if len(rs.Data) == 0 || f == nil {
+		return nil, ErrVersionConflict
+	}
+	return rs.Data[0][f.Index], nil
 }
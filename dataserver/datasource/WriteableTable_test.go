@@ -7,7 +7,7 @@ import (
 
 func TestCreateInsertSQLService(t *testing.T) {
 	ids := &WriteableTableSource{
-		TableDataSource{
+		TableDataSource: TableDataSource{
 			DBDataSource: DBDataSource{
 				DataSource: DataSource{
 					Name: "G_SERCVICE",
@@ -18,7 +18,7 @@ func TestCreateInsertSQLService(t *testing.T) {
 			TableName: "G_SERCVICE",
 		}}
 	ids.Init()
-	err := ids.Insert(map[string]interface{}{
+	_, err := ids.Insert(map[string]interface{}{
 		"ID":        "05442082-76d9-41da-b563-a19914131993",
 		"DBTYPE":    "mysql",
 		"DBURL":     "{username}:{password}@tcp(127.0.0.1:3306)/idb",
@@ -26,7 +26,7 @@ func TestCreateInsertSQLService(t *testing.T) {
 		"PWD":       "123456",
 		"PROJECTID": "",
 		"DBALIAS":   "idb"})
-	err = ids.Insert(map[string]interface{}{
+	_, err = ids.Insert(map[string]interface{}{
 		"ID":        "f903de9b-9a96-4014-a991-cb01e7d96318",
 		"DBTYPE":    "mysql",
 		"DBURL":     "{username}:{password}@tcp(127.0.0.1:3306)/pest",
@@ -40,7 +40,7 @@ func TestCreateInsertSQLService(t *testing.T) {
 
 func TestCreateInsertSQL(t *testing.T) {
 	ids := &WriteableTableSource{
-		TableDataSource{
+		TableDataSource: TableDataSource{
 			DBDataSource: DBDataSource{
 				DataSource: DataSource{
 					Name: "G_DATABASEURL",
@@ -51,7 +51,7 @@ func TestCreateInsertSQL(t *testing.T) {
 			TableName: "G_DATABASEURL",
 		}}
 	ids.Init()
-	err := ids.Insert(map[string]interface{}{
+	_, err := ids.Insert(map[string]interface{}{
 		"ID":        "05442082-76d9-41da-b563-a19914131993",
 		"DBTYPE":    "mysql",
 		"DBURL":     "{username}:{password}@tcp(127.0.0.1:3306)/idb",
@@ -59,7 +59,7 @@ func TestCreateInsertSQL(t *testing.T) {
 		"PWD":       "123456",
 		"PROJECTID": "",
 		"DBALIAS":   "idb"})
-	err = ids.Insert(map[string]interface{}{
+	_, err = ids.Insert(map[string]interface{}{
 		"ID":        "f903de9b-9a96-4014-a991-cb01e7d96318",
 		"DBTYPE":    "mysql",
 		"DBURL":     "{username}:{password}@tcp(127.0.0.1:3306)/pest",
@@ -0,0 +1,583 @@
+package datasource
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchCriteria 在内存中判断数值是否满足条件，操作符与SQLBuilder支持的操作符一致
+// 用于KeyStringSource等不通过数据库查询的数据源
+func MatchCriteria(value interface{}, operation string, criteriaValue interface{}) (bool, error) {
+	switch operation {
+	case OperAlwaysTrue:
+		return true, nil
+	case OperAlwaysFalse:
+		return false, nil
+	case OperIsNull:
+		return value == nil, nil
+	case OperIsNotNull:
+		return value != nil, nil
+	case OperIn, OperNotIn:
+		in := false
+		for _, v := range criteriaValues(criteriaValue) {
+			r, err := compareValue(value, v)
+			if err != nil {
+				return false, err
+			}
+			if r == 0 {
+				in = true
+				break
+			}
+		}
+		if operation == OperNotIn {
+			return !in, nil
+		}
+		return in, nil
+	case OperBetween:
+		vs := criteriaValues(criteriaValue)
+		if len(vs) != 2 {
+			return false, fmt.Errorf("BETWEEN操作的值必须为长度为2的数组")
+		}
+		r1, err := compareValue(value, vs[0])
+		if err != nil {
+			return false, err
+		}
+		r2, err := compareValue(value, vs[1])
+		if err != nil {
+			return false, err
+		}
+		return r1 >= 0 && r2 <= 0, nil
+	case OperLike, OperNotLike, OperStartsWith, OperEndsWith, OperContains:
+		if value == nil {
+			return false, nil
+		}
+		re, err := likePattern2Regexp(fmt.Sprint(createLikeValue(operation, criteriaValue)))
+		if err != nil {
+			return false, err
+		}
+		m := re.MatchString(fmt.Sprint(value))
+		if operation == OperNotLike {
+			return !m, nil
+		}
+		return m, nil
+	case OperRegex:
+		if value == nil {
+			return false, nil
+		}
+		return regexp.MatchString(fmt.Sprint(criteriaValue), fmt.Sprint(value))
+	}
+	if value == nil || criteriaValue == nil {
+		return false, nil
+	}
+	r, err := compareValue(value, criteriaValue)
+	if err != nil {
+		return false, err
+	}
+	switch operation {
+	case OperEq:
+		return r == 0, nil
+	case OperNoteq:
+		return r != 0, nil
+	case OperGt:
+		return r > 0, nil
+	case OperLt:
+		return r < 0, nil
+	case OperGtEg:
+		return r >= 0, nil
+	case OperLtEg:
+		return r <= 0, nil
+	}
+	return false, fmt.Errorf("不支持的操作符" + operation)
+}
+
+// matchCriteriaList 在内存中判断一条记录是否满足条件列表，getValue根据字段名返回记录中的值
+// 条件之间的优先级与SQL一致，and优先于or
+func matchCriteriaList(criteria []*SQLCriteria, getValue func(field string) (interface{}, error)) (bool, error) {
+	result := false
+	cur := true
+	for i, cr := range criteria {
+		var m bool
+		var err error
+		if cr.Children != nil {
+			m, err = matchCriteriaList(cr.Children, getValue)
+			if err != nil {
+				return false, err
+			}
+			if cr.Not {
+				m = !m
+			}
+		} else {
+			v, err := getValue(cr.PropertyName)
+			if err != nil {
+				return false, err
+			}
+			m, err = MatchCriteria(v, cr.Operation, cr.Value)
+			if err != nil {
+				return false, err
+			}
+		}
+		if i != 0 && cr.Complex == CompOr {
+			result = result || cur
+			cur = m
+		} else {
+			cur = cur && m
+		}
+	}
+	return result || cur, nil
+}
+
+// matchRecord 判断一条记录是否满足当前的查询条件，没有条件时返回true
+func (c *BaseCriteria) matchRecord(getValue func(field string) (interface{}, error)) (bool, error) {
+	if len(c.filter) == 0 {
+		return true, nil
+	}
+	return matchCriteriaList(c.sqlCriteria(), getValue)
+}
+
+// sqlCriteria 将当前的查询条件转换为SQLCriteria数组
+func (c *BaseCriteria) sqlCriteria() []*SQLCriteria {
+	criteria := make([]*SQLCriteria, len(c.filter), len(c.filter))
+	for i, item := range c.filter {
+		criteria[i] = (*SQLCriteria)(item)
+	}
+	return criteria
+}
+
+// criteriaValues 将条件的值转换为数组，值不是数组时返回只有一个元素的数组
+func criteriaValues(v interface{}) []interface{} {
+	if v == nil {
+		return []interface{}{nil}
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Slice, reflect.Array:
+		s := reflect.ValueOf(v)
+		result := make([]interface{}, s.Len(), s.Len())
+		for i := 0; i < s.Len(); i++ {
+			result[i] = s.Index(i).Interface()
+		}
+		return result
+	}
+	return []interface{}{v}
+}
+
+// likePattern2Regexp 将LIKE模式串转换为正则表达式，转义字符为LikeEscapeChar
+func likePattern2Regexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		s := string(r)
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(s))
+			escaped = false
+		case s == LikeEscapeChar:
+			escaped = true
+		case s == "%":
+			sb.WriteString(".*")
+		case s == "_":
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(s))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// toFloat 将数值或数值字符串转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareValue 比较两个数值，a小于b返回负数，相等返回0，大于返回正数
+// 两者都可以转换为数值时按数值比较，都是时间时按时间比较，否则按字符串比较
+func compareValue(a, b interface{}) (int, error) {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		if !ok {
+			return 0, fmt.Errorf("时间类型不能与%T类型比较", b)
+		}
+		switch {
+		case ta.Before(tb):
+			return -1, nil
+		case ta.After(tb):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	_, sa := a.(string)
+	_, sb := b.(string)
+	if !sa || !sb {
+		fa, oka := toFloat(a)
+		fb, okb := toFloat(b)
+		if oka && okb {
+			switch {
+			case fa < fb:
+				return -1, nil
+			case fa > fb:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), nil
+}
+
+// rowValueGetter 返回根据字段名读取一行数据中的值的函数
+func rowValueGetter(fields FieldDescType, row []interface{}) func(field string) (interface{}, error) {
+	return func(field string) (interface{}, error) {
+		f, ok := fields[field]
+		if !ok {
+			return nil, fmt.Errorf("没有字段" + field)
+		}
+		return row[f.Index], nil
+	}
+}
+
+// filterRows 返回满足条件列表的行，结果为新的数组，不修改rows
+func filterRows(fields FieldDescType, rows [][]interface{}, criteria []*SQLCriteria) ([][]interface{}, error) {
+	result := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if len(criteria) != 0 {
+			m, err := matchCriteriaList(criteria, rowValueGetter(fields, row))
+			if err != nil {
+				return nil, err
+			}
+			if !m {
+				continue
+			}
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// sortRows 按“字段名 排序方向”形式的排序字段排序，空值排在前面
+func sortRows(fields FieldDescType, rows [][]interface{}, orderlist []string) error {
+	if len(orderlist) == 0 {
+		return nil
+	}
+	type orderField struct {
+		index int
+		desc  bool
+	}
+	ofs := make([]orderField, 0, len(orderlist))
+	for _, o := range orderlist {
+		f, dir, err := ParseOrderBy(o)
+		if err != nil {
+			return err
+		}
+		fd, ok := fields[f]
+		if !ok {
+			return fmt.Errorf("排序字段不存在：" + f)
+		}
+		ofs = append(ofs, orderField{index: fd.Index, desc: dir == "DESC"})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, of := range ofs {
+			a, b := rows[i][of.index], rows[j][of.index]
+			if a == nil || b == nil {
+				if a == b {
+					continue
+				}
+				return (a == nil) != of.desc
+			}
+			r, _ := compareValue(a, b)
+			if r != 0 {
+				return (r < 0) != of.desc
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// pageRows 返回分页后的行，limit为0时不限制条数
+func pageRows(rows [][]interface{}, limit, offset int) [][]interface{} {
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	end := len(rows)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return rows[offset:end]
+}
+
+// aggregateRows 按分组字段聚合，返回分组字段和聚合输出字段组成的新结果，groupby为空数组时全部数据为一组
+// 聚合输出字段按名称排在分组字段之后，聚合时忽略空值，与SQL一致
+func aggregateRows(fields FieldDescType, rows [][]interface{}, groupby []string, aggre map[string]*AggreType) (FieldDescType, [][]interface{}, error) {
+	outfields := make(FieldDescType, len(groupby)+len(aggre))
+	gidx := make([]int, len(groupby), len(groupby))
+	for i, g := range groupby {
+		fd, ok := fields[g]
+		if !ok {
+			return nil, nil, fmt.Errorf("分组字段不存在：" + g)
+		}
+		gidx[i] = fd.Index
+		outfields[g] = &FieldDesc{FieldType: fd.FieldType, Index: i}
+	}
+	names := make([]string, 0, len(aggre))
+	for k := range aggre {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	aidx := make([]int, len(names), len(names))
+	for i, k := range names {
+		a := aggre[k]
+		aidx[i] = -1
+		ftype := ""
+		if a.ColName != "*" {
+			fd, ok := fields[a.ColName]
+			if !ok {
+				return nil, nil, fmt.Errorf("聚合字段不存在：" + a.ColName)
+			}
+			aidx[i] = fd.Index
+			ftype = fd.FieldType
+		}
+		switch a.Predicate {
+		case AggCount:
+			ftype = PropertyDatatypeInt
+		case AggAvg:
+			ftype = PropertyDatatypeDou
+		case AggSum:
+			if ftype != PropertyDatatypeInt {
+				ftype = PropertyDatatypeDou
+			}
+		}
+		outfields[k] = &FieldDesc{FieldType: ftype, Index: len(groupby) + i}
+	}
+
+	keys := make([]string, 0)
+	groups := make(map[string][][]interface{})
+	for _, row := range rows {
+		var sb strings.Builder
+		for _, i := range gidx {
+			if row[i] == nil {
+				sb.WriteString("\x00")
+			} else {
+				fmt.Fprintf(&sb, "%T:%v", row[i], row[i])
+			}
+			sb.WriteString("\x1f")
+		}
+		k := sb.String()
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], row)
+	}
+	//没有分组字段时即使没有数据也返回一行
+	if len(groupby) == 0 && len(keys) == 0 {
+		keys = append(keys, "")
+		groups[""] = nil
+	}
+	result := make([][]interface{}, 0, len(keys))
+	for _, k := range keys {
+		grows := groups[k]
+		out := make([]interface{}, len(groupby)+len(names), len(groupby)+len(names))
+		for i, idx := range gidx {
+			out[i] = grows[0][idx]
+		}
+		for i, name := range names {
+			v, err := aggregateValue(aggre[name].Predicate, aidx[i], grows)
+			if err != nil {
+				return nil, nil, fmt.Errorf("计算聚合字段%s时发生错误：%s", name, err.Error())
+			}
+			out[len(groupby)+i] = v
+		}
+		result = append(result, out)
+	}
+	return outfields, result, nil
+}
+
+// aggregateValue 计算一组数据的聚合值，index为-1时为count(*)
+func aggregateValue(predicate int, index int, rows [][]interface{}) (interface{}, error) {
+	if index < 0 {
+		return int64(len(rows)), nil
+	}
+	var count int64
+	var isum int64
+	var fsum float64
+	isInt := true
+	var value interface{}
+	for _, row := range rows {
+		v := row[index]
+		if v == nil {
+			continue
+		}
+		count++
+		switch predicate {
+		case AggSum, AggAvg:
+			if i, ok := toInt64(v); ok && isInt {
+				isum += i
+			} else {
+				isInt = false
+			}
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("%v不是数值", v)
+			}
+			fsum += f
+		case AggMax, AggMin:
+			if value == nil {
+				value = v
+				continue
+			}
+			r, err := compareValue(v, value)
+			if err != nil {
+				return nil, err
+			}
+			if (predicate == AggMax && r > 0) || (predicate == AggMin && r < 0) {
+				value = v
+			}
+		}
+	}
+	switch predicate {
+	case AggCount:
+		return count, nil
+	case AggSum:
+		if count == 0 {
+			return nil, nil
+		}
+		if isInt {
+			return isum, nil
+		}
+		return fsum, nil
+	case AggAvg:
+		if count == 0 {
+			return nil, nil
+		}
+		return fsum / float64(count), nil
+	case AggMax, AggMin:
+		return value, nil
+	}
+	return nil, fmt.Errorf("不支持的聚合类型：%d", predicate)
+}
+
+// toInt64 将整数类型的值转换为int64
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// ResultSetQuery 在内存中对结果集执行的查询
+type ResultSetQuery struct {
+	// Criteria 查询条件
+	Criteria []*SQLCriteria
+	// OrderBy 排序字段，格式为“字段名 排序方向”，有聚合时可以使用聚合的输出字段
+	OrderBy []string
+	// Aggre 聚合，key为聚合后返回的字段名
+	Aggre map[string]*AggreType
+	// GroupBy 聚合时的分组字段，为nil时按结果集的全部字段分组
+	GroupBy []string
+	// Limit 返回的数据条数，为0时不限制
+	Limit int
+	// Offset 返回数据的偏移量
+	Offset int
+}
+
+// ApplyQuery 在内存中对结果集依次处理条件、聚合、排序和分页，返回新的结果集
+// 不修改rs，没有聚合时结果集的字段描述和每一行数据与rs共享
+func ApplyQuery(rs *DataResultSet, q *ResultSetQuery) (*DataResultSet, error) {
+	fields, rows, err := q.filter(rs)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortRows(fields, rows, q.OrderBy); err != nil {
+		return nil, err
+	}
+	return &DataResultSet{Fields: fields, Data: pageRows(rows, q.Limit, q.Offset), Meta: rs.Meta}, nil
+}
+
+// CountQuery 返回结果集中满足条件的记录数，有聚合时返回分组的个数，忽略排序和分页
+func CountQuery(rs *DataResultSet, q *ResultSetQuery) (int64, error) {
+	_, rows, err := q.filter(rs)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+// filter 返回满足条件的数据，有聚合时返回聚合后的数据
+func (q *ResultSetQuery) filter(rs *DataResultSet) (FieldDescType, [][]interface{}, error) {
+	rows, err := filterRows(rs.Fields, rs.Data, q.Criteria)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(q.Aggre) == 0 {
+		return rs.Fields, rows, nil
+	}
+	groupby := q.GroupBy
+	if groupby == nil {
+		groupby = make([]string, 0, len(rs.Fields))
+		for k := range rs.Fields {
+			groupby = append(groupby, k)
+		}
+		sort.Slice(groupby, func(i, j int) bool { return rs.Fields[groupby[i]].Index < rs.Fields[groupby[j]].Index })
+	}
+	return aggregateRows(rs.Fields, rows, groupby, q.Aggre)
+}
+
+// resultSetQuery 根据当前的查询条件、排序、聚合生成内存查询
+func (c *TableDataSourceCriteria) resultSetQuery(limit, offset int) *ResultSetQuery {
+	return &ResultSetQuery{
+		Criteria: c.sqlCriteria(),
+		OrderBy:  c.orderlist,
+		Aggre:    c.aggre,
+		GroupBy:  c.groupby,
+		Limit:    limit,
+		Offset:   offset,
+	}
+}
@@ -0,0 +1,127 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchCriteria(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		value     interface{}
+		operation string
+		cv        interface{}
+		want      bool
+	}{
+		{"abc", OperEq, "abc", true},
+		{int32(10), OperGt, "9", true},
+		{"b", OperLt, "a", false},
+		{10.5, OperLtEg, 10.5, true},
+		{now, OperGt, now.Add(-time.Hour), true},
+		{int64(2), OperIn, []interface{}{1, 2}, true},
+		{"c", OperNotIn, []string{"a", "b"}, true},
+		{5, OperBetween, []interface{}{1, 5}, true},
+		{nil, OperIsNull, nil, true},
+		{"50%_off", OperContains, "%_", true},
+		{"50xxoff", OperContains, "%_", false},
+		{"hello", OperStartsWith, "he", true},
+		{"hello", OperEndsWith, "he", false},
+		{"hello", OperLike, "h_l%", true},
+		{"hello", OperNotLike, "h!_%", true},
+		{"u123", OperRegex, "^u[0-9]+$", true},
+	}
+	for i, c := range cases {
+		r, err := MatchCriteria(c.value, c.operation, c.cv)
+		if err != nil || r != c.want {
+			t.Errorf("case %d %v %s %v: got %v %v", i, c.value, c.operation, c.cv, r, err)
+		}
+	}
+}
+
+func TestMatchCriteriaList(t *testing.T) {
+	row := map[string]interface{}{"A": 1, "B": 2, "C": 3}
+	get := func(f string) (interface{}, error) { return row[f], nil }
+	// A=0 or B=2 and C=3，and优先于or
+	ok, _ := matchCriteriaList([]*SQLCriteria{
+		{PropertyName: "A", Operation: OperEq, Value: 0},
+		{PropertyName: "B", Operation: OperEq, Value: 2, Complex: CompOr},
+		{PropertyName: "C", Operation: OperEq, Value: 3, Complex: CompAnd},
+	}, get)
+	if !ok {
+		t.Error("precedence error")
+	}
+	// not (A=1 or B=0)
+	ok, _ = matchCriteriaList([]*SQLCriteria{{Not: true, Children: []*SQLCriteria{
+		{PropertyName: "A", Operation: OperEq, Value: 1},
+		{PropertyName: "B", Operation: OperEq, Value: 0, Complex: CompOr},
+	}}}, get)
+	if ok {
+		t.Error("not group error")
+	}
+}
+
+func TestApplyQuery(t *testing.T) {
+	rs := &DataResultSet{
+		Fields: FieldDescType{"ORG": {FieldType: PropertyDatatypeStr, Index: 0}, "AMOUNT": {FieldType: PropertyDatatypeInt, Index: 1}, "PRICE": {FieldType: PropertyDatatypeDou, Index: 2}},
+		Data:   [][]interface{}{{"A", int64(10), 1.5}, {"A", int64(20), nil}, {"B", nil, 3.0}, {"B", int64(40), 4.0}, {"C", int64(50), 5.0}},
+	}
+	// (ORG=A or PRICE>=4) and not AMOUNT is null
+	q := &ResultSetQuery{
+		Criteria: []*SQLCriteria{
+			{Children: []*SQLCriteria{{PropertyName: "ORG", Operation: OperEq, Value: "A"}, {PropertyName: "PRICE", Operation: OperGtEg, Value: 4, Complex: CompOr}}},
+			{Not: true, Complex: CompAnd, Children: []*SQLCriteria{{PropertyName: "AMOUNT", Operation: OperIsNull}}},
+		},
+		OrderBy: []string{"AMOUNT DESC"},
+		Limit:   2,
+		Offset:  1,
+	}
+	r, err := ApplyQuery(rs, q)
+	if err != nil || len(r.Data) != 2 || r.Data[0][1] != int64(40) || r.Data[1][1] != int64(20) {
+		t.Errorf("query %v %v", r, err)
+	}
+	if n, err := CountQuery(rs, q); err != nil || n != 4 {
+		t.Errorf("count %d %v", n, err)
+	}
+	if rs.Data[0][0] != "A" || rs.Data[4][0] != "C" {
+		t.Error("source result set modified")
+	}
+
+	// 空值排在前面，聚合时忽略空值
+	r, _ = ApplyQuery(rs, &ResultSetQuery{OrderBy: []string{"PRICE"}})
+	if r.Data[0][2] != nil {
+		t.Errorf("nil order %v", r.Data)
+	}
+	q = &ResultSetQuery{Aggre: map[string]*AggreType{"S": {Predicate: AggSum, ColName: "AMOUNT"}, "P": {Predicate: AggAvg, ColName: "PRICE"},
+		"N": {Predicate: AggCount, ColName: "AMOUNT"}, "M": {Predicate: AggMin, ColName: "PRICE"}}, GroupBy: []string{"ORG"}, OrderBy: []string{"S DESC"}}
+	r, err = ApplyQuery(rs, q)
+	if err != nil || len(r.Data) != 3 || len(r.Fields) != 5 {
+		t.Fatalf("aggregate %v %v", r, err)
+	}
+	b := r.Data[1]
+	if r.Data[0][r.Fields["ORG"].Index] != "C" || b[r.Fields["S"].Index] != int64(40) || b[r.Fields["P"].Index] != 3.5 ||
+		b[r.Fields["N"].Index] != int64(1) || b[r.Fields["M"].Index] != 3.0 || r.Fields["P"].FieldType != PropertyDatatypeDou {
+		t.Errorf("aggregate %v", r.Data)
+	}
+	// 没有分组字段时没有数据也返回一行，分组字段为nil时按全部字段分组
+	q = &ResultSetQuery{Criteria: []*SQLCriteria{{PropertyName: "ORG", Operation: OperEq, Value: "X"}},
+		Aggre: map[string]*AggreType{"CNT": {Predicate: AggCount, ColName: "*"}, "S": {Predicate: AggSum, ColName: "AMOUNT"}}, GroupBy: []string{}}
+	if r, err = ApplyQuery(rs, q); err != nil || len(r.Data) != 1 || r.Data[0][0] != int64(0) || r.Data[0][1] != nil {
+		t.Errorf("aggregate without group %v %v", r, err)
+	}
+	q = &ResultSetQuery{Aggre: map[string]*AggreType{"CNT": {Predicate: AggCount, ColName: "*"}}}
+	if r, err = ApplyQuery(rs, q); err != nil || len(r.Data) != 5 || len(r.Fields) != 4 || r.Fields["CNT"].Index != 3 {
+		t.Errorf("aggregate all fields %v %v", r, err)
+	}
+
+	for _, q := range []*ResultSetQuery{
+		{Criteria: []*SQLCriteria{{PropertyName: "NOTEXIST", Operation: OperEq, Value: 1}}},
+		{OrderBy: []string{"NOTEXIST"}},
+		{OrderBy: []string{"ORG UP"}},
+		{Aggre: map[string]*AggreType{"S": {Predicate: AggSum, ColName: "ORG"}}},
+		{Aggre: map[string]*AggreType{"S": {Predicate: AggSum, ColName: "AMOUNT"}}, GroupBy: []string{"NOTEXIST"}},
+	} {
+		if _, err := ApplyQuery(rs, q); err == nil {
+			t.Errorf("invalid query %+v accepted", q)
+		}
+	}
+}
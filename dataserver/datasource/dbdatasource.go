@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/astaxie/beego/logs"
+	"time"
 	"tongserver.dataserver/utils"
 )
 
@@ -19,6 +20,8 @@ type DBDataSource struct {
 
 	openedDB *sql.DB `json:"-"`
 	palesql  bool
+	// tx 写操作使用的事务
+	tx *sql.Tx
 }
 
 // Init 初始化
@@ -98,6 +101,94 @@ func (c *DBDataSource) GetKeyFields() []*MyProperty {
 	return c.KeyField
 }
 
+// GetDBAlias 返回数据库别名
+func (c *DBDataSource) GetDBAlias() string {
+	return c.DBAlias
+}
+
+// BeginTx 开始一个事务
+func (c *DBDataSource) BeginTx() (*sql.Tx, error) {
+	if c.openedDB == nil {
+		return nil, fmt.Errorf("OpenedDB is nil")
+	}
+	return c.openedDB.Begin()
+}
+
+// SetTx 设定写操作使用的事务，为nil时不使用事务
+func (c *DBDataSource) SetTx(tx *sql.Tx) {
+	c.tx = tx
+}
+
+// logSQL 日志级别为Trace时记录执行的SQL语句和参数
+func logSQL(sqlstr string, params []interface{}) {
+	if logs.GetBeeLogger().GetLevel() >= logs.LevelTrace {
+		logs.Debug(sqlstr)
+		for _, item := range params {
+			logs.Debug(item)
+		}
+	}
+}
+
+// execSQL 执行写操作的SQL语句，设定了事务时在事务中执行
+func (c *DBDataSource) execSQL(sqlstr string, params ...interface{}) (*WriteResult, error) {
+	logSQL(sqlstr, params)
+	var r sql.Result
+	var err error
+	if c.tx != nil {
+		r, err = c.tx.Exec(sqlstr, params...)
+	} else {
+		if c.openedDB == nil {
+			return nil, fmt.Errorf("OpenedDB is nil")
+		}
+		r, err = c.openedDB.Exec(sqlstr, params...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &WriteResult{}
+	result.RowsAffected, _ = r.RowsAffected()
+	//PostgreSQL等驱动不支持LastInsertId，此时返回0
+	result.LastInsertId, _ = r.LastInsertId()
+	return result, nil
+}
+
+// existsSQL 执行查询语句，返回是否有数据，设定了事务时在事务中执行
+func (c *DBDataSource) existsSQL(sqlstr string, params ...interface{}) (bool, error) {
+	logSQL(sqlstr, params)
+	var rows *sql.Rows
+	var err error
+	if c.tx != nil {
+		rows, err = c.tx.Query(sqlstr, params...)
+	} else {
+		if c.openedDB == nil {
+			return false, fmt.Errorf("OpenedDB is nil")
+		}
+		rows, err = c.openedDB.Query(sqlstr, params...)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// countSQL 执行返回记录数的查询语句，设定了事务时在事务中执行
+func (c *DBDataSource) countSQL(sqlstr string, params ...interface{}) (int64, error) {
+	logSQL(sqlstr, params)
+	var row *sql.Row
+	if c.tx != nil {
+		row = c.tx.QueryRow(sqlstr, params...)
+	} else {
+		if c.openedDB == nil {
+			return 0, fmt.Errorf("OpenedDB is nil")
+		}
+		row = c.openedDB.QueryRow(sqlstr, params...)
+	}
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 // convertData 将DB返回的数据转换为指定类型
 func (c *DBDataSource) convertData(value interface{}, fieldType string) interface{} {
 	var str utils.String
@@ -106,6 +197,15 @@ func (c *DBDataSource) convertData(value interface{}, fieldType string) interfac
 		str = utils.String(v)
 	case string:
 		str = utils.String(v)
+	case time.Time:
+		//PostgreSQL等驱动直接返回时间类型，无需转换
+		return v
+	case int64, float64:
+		//SQLite等驱动对表达式列不返回类型名称，此时保留驱动返回的数值类型
+		if fieldType == PropertyDatatypeUnkn {
+			return v
+		}
+		str = utils.String(fmt.Sprintf("%v", v))
 	default:
 		str = utils.String(fmt.Sprintf("%v", v))
 	}
@@ -140,9 +240,14 @@ func (c *DBDataSource) convertData(value interface{}, fieldType string) interfac
 	return item
 }
 
+// rawColumns 返回结果集是否直接使用查询结果中的字段，没有定义字段、执行内部SQL语句或者有聚合时查询结果与数据源字段不一致
+func (c *DBDataSource) rawColumns() bool {
+	return c.Field == nil || len(c.Field) == 0 || c.palesql || len(c.aggre) != 0
+}
+
 // 返回一条记录
 func (c *DBDataSource) getRecordByRef(refs []interface{}, cols []string, colsTypes *FieldDescType) ([]interface{}, []*MyProperty) {
-	if c.Field == nil || len(c.Field) == 0 || c.palesql {
+	if c.rawColumns() {
 		item := make([]interface{}, len(cols), len(cols))
 		for i, fieldname := range cols {
 			item[i] = c.convertData(*refs[i].(*interface{}), (*colsTypes)[fieldname].FieldType)
@@ -163,95 +268,95 @@ func (c *DBDataSource) getRecordByRef(refs []interface{}, cols []string, colsTyp
 
 // 根据SQL语句查询数据
 func (c *DBDataSource) querySQLData(sqlstr string, params ...interface{}) (*DataResultSet, error) {
-	var err error
-	if logs.GetBeeLogger().GetLevel() >= logs.LevelTrace {
-		logs.Debug(sqlstr)
-		for _, item := range params {
-			logs.Debug(item)
-		}
+	it, err := c.queryRows(sqlstr, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	//读取全部数据后再批量填充联接字段
+	it.deferOutJoin = true
+	var result = &DataResultSet{Fields: it.Fields()}
+	datas := make([][]interface{}, 0, 100)
+	for it.Next() {
+		datas = append(datas, it.Row())
 	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	if len(it.ofs) != 0 {
+		newOutJoinResolver(it.fields, it.ofs).fill(datas)
+	}
+	result.Data = datas
 
-	if c.openedDB == nil {
-		return nil, fmt.Errorf("OpenedDB is nil")
+	return result, nil
+}
+
+// queryRows 根据SQL语句返回逐行读取数据的迭代器
+func (c *DBDataSource) queryRows(sqlstr string, params ...interface{}) (*rowIterator, error) {
+	var err error
+	logSQL(sqlstr, params)
+
+	var rs *sql.Rows
+	if c.tx != nil {
+		//设定了事务时在事务中查询，可以读取事务中写入的数据
+		rs, err = c.tx.Query(sqlstr, params...)
+	} else {
+		if c.openedDB == nil {
+			return nil, fmt.Errorf("OpenedDB is nil")
+		}
+		rs, err = c.openedDB.Query(sqlstr, params...) //获取所有数据
 	}
-	rs, err := c.openedDB.Query(sqlstr, params...) //获取所有数据
 
 	if err != nil {
 		return nil, err
 	}
-	defer rs.Close()
 	cols, err := rs.Columns()
 	if err != nil {
+		rs.Close()
 		return nil, err
 	}
 	colsTypes, err := rs.ColumnTypes()
 	if err != nil {
+		rs.Close()
 		return nil, err
 	}
-	var result = &DataResultSet{}
-	fm := make(FieldDescType)
+	it := &rowIterator{ds: c, rows: rs, cols: cols, fm: make(FieldDescType)}
 	for i, item := range cols {
-		fm[item] = &FieldDesc{
-			FieldType: ConvertMySQLType2CommonType(colsTypes[i].DatabaseTypeName()),
+		it.fm[item] = &FieldDesc{
+			FieldType: ConvertDBType2CommonType(DBAlias2DBTypeContainer[c.DBAlias], colsTypes[i].DatabaseTypeName()),
 			Index:     i,
 		}
 	}
-	refs := make([]interface{}, len(cols))
-	for i := range refs {
+	it.refs = make([]interface{}, len(cols))
+	for i := range it.refs {
 		var ref interface{}
-		refs[i] = &ref
+		it.refs[i] = &ref
 	}
-	result.Fields = make(FieldDescType)
-	if c.palesql || c.Field == nil {
-		result.Fields = fm
+	it.fields = make(FieldDescType)
+	if c.rawColumns() {
+		it.fields = it.fm
 	} else {
 		for index, item := range c.Field {
 			var typ string
-			if fm[item.Name] != nil {
-				typ = fm[item.Name].FieldType
+			if it.fm[item.Name] != nil {
+				typ = it.fm[item.Name].FieldType
 			} else {
 				typ = item.DataType
 			}
-			result.Fields[item.Name] = &FieldDesc{
+			it.fields[item.Name] = &FieldDesc{
 				FieldType: typ,
 				Index:     index,
 			}
 		}
-	}
-	datas := make([][]interface{}, 0, 100)
-	for rs.Next() {
-		err := rs.Scan(refs...)
-		if err != nil {
-			return nil, err
-		}
-		item, Ofs := c.getRecordByRef(refs, cols, &fm)
-		if Ofs != nil {
-			//存在通过Join加载其他数据源的字段
-			for _, f := range Ofs {
-				if f.OutJoinDefine == nil {
-					continue
-				}
-				kv := item[result.Fields[f.OutJoinDefine.JoinField].Index]
-				rfs, err := f.OutJoinDefine.Source.QueryDataByKey(kv)
-				if err != nil {
-					logs.Error(err)
-					continue
-				}
-				if len(rfs.Data) == 0 {
-					continue
-				}
-				if rfs.Fields[f.OutJoinDefine.ValueField] == nil {
-					logs.Error("ValueField错误没有找到字段" + f.OutJoinDefine.ValueField)
-					continue
-				}
-				item[result.Fields[f.Name].Index] = rfs.Data[0][rfs.Fields[f.OutJoinDefine.ValueField].Index]
+		//数据源字段以外的字段，例如连接表的输出字段，添加在数据源字段之后
+		for _, col := range cols {
+			if it.fields[col] == nil {
+				it.fields[col] = &FieldDesc{FieldType: it.fm[col].FieldType, Index: len(c.Field) + len(it.extra)}
+				it.extra = append(it.extra, col)
 			}
 		}
-		datas = append(datas, item)
 	}
-	result.Data = datas
-
-	return result, nil
+	return it, nil
 }
 
 //
@@ -0,0 +1,565 @@
+package datasource
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	// FileFormatCSV CSV文件，第一行为标题行
+	FileFormatCSV = "csv"
+	// FileFormatJSON JSON文件，数据为对象数组
+	FileFormatJSON = "json"
+	// FileFormatJSONL JSON-lines文件，每一行为一个对象
+	FileFormatJSONL = "jsonl"
+)
+
+// FileField 文件数据源的字段定义
+type FileField struct {
+	// Name 字段名
+	Name string
+	// Column CSV文件中的列标题或JSON对象中的路径，路径用.分隔，为空时与字段名相同
+	Column string
+	// DataType 字段类型，为空时根据文件中的数据推断
+	DataType string
+	// Caption 显示名
+	Caption string
+	// Key 是否为主键字段
+	Key bool
+}
+
+// FileDataSource 基于CSV、JSON、JSON-lines文件的只读数据源，全部数据读取到内存中，在内存中处理查询条件、排序、分页和聚合
+// 文件内容按数据源名称缓存，文件的修改时间或大小改变时自动重新读取
+type FileDataSource struct {
+	DataSource
+	TableDataSourceCriteria
+	// FilePath 文件路径
+	FilePath string
+	// Format 文件格式，FileFormatCSV、FileFormatJSON或FileFormatJSONL
+	Format string
+	// Comma CSV文件的分隔符，默认为逗号
+	Comma rune
+	// RowsPath JSON文件中数据数组的路径，用.分隔，为空时整个文件为数据数组
+	RowsPath string
+	// Fields 字段定义，为空时CSV文件使用标题行的全部列，JSON文件使用对象的全部属性
+	Fields []*FileField
+
+	rowsLimit  int
+	rowsOffset int
+}
+
+// fileData 从文件中读取的数据
+type fileData struct {
+	sig     string
+	modTime time.Time
+	size    int64
+	fields  []*MyProperty
+	keys    []*MyProperty
+	rs      *DataResultSet
+}
+
+// fileDataCache 按数据源名称缓存的文件数据，数据源每次请求都重新创建，文件数据在请求之间共享
+var fileDataCache = struct {
+	sync.Mutex
+	m map[string]*fileData
+}{m: make(map[string]*fileData)}
+
+// CreateCSVDataSource 根据数据源元数据创建CSV文件数据源，元数据格式为：
+// {"file":"data/org.csv","delimiter":",","fields":[{"name":"ORG_ID","column":"编号","type":"STRING","key":true}]}
+// 扩展名为.tsv的文件默认分隔符为制表符
+func CreateCSVDataSource(name string, meta map[string]interface{}) (*FileDataSource, error) {
+	c, err := createFileDataSource(name, meta)
+	if err != nil {
+		return nil, err
+	}
+	c.Format = FileFormatCSV
+	c.Comma = ','
+	if strings.EqualFold(filepath.Ext(c.FilePath), ".tsv") {
+		c.Comma = '\t'
+	}
+	if d, ok := meta["delimiter"].(string); ok && d != "" {
+		if d == `\t` {
+			d = "\t"
+		}
+		r := []rune(d)
+		if len(r) != 1 {
+			return nil, fmt.Errorf("文件数据源" + name + "的分隔符只能为一个字符")
+		}
+		c.Comma = r[0]
+	}
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreateJSONDataSource 根据数据源元数据创建JSON文件数据源，元数据格式为：
+// {"file":"data/org.json","rowspath":"data.items","jsonlines":false,"fields":[{"name":"ORG_ID","column":"id","key":true}]}
+// 扩展名为.jsonl或.ndjson的文件或者jsonlines为true时按JSON-lines格式读取
+func CreateJSONDataSource(name string, meta map[string]interface{}) (*FileDataSource, error) {
+	c, err := createFileDataSource(name, meta)
+	if err != nil {
+		return nil, err
+	}
+	c.Format = FileFormatJSON
+	c.RowsPath, _ = meta["rowspath"].(string)
+	ext := strings.ToLower(filepath.Ext(c.FilePath))
+	if jl, _ := meta["jsonlines"].(bool); jl || ext == ".jsonl" || ext == ".ndjson" {
+		c.Format = FileFormatJSONL
+	}
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// createFileDataSource 读取文件路径和字段定义
+func createFileDataSource(name string, meta map[string]interface{}) (*FileDataSource, error) {
+	c := &FileDataSource{DataSource: DataSource{Name: name}}
+	c.FilePath, _ = meta["file"].(string)
+	fs, ok := meta["fields"]
+	if !ok {
+		return c, nil
+	}
+	items, ok := fs.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("文件数据源" + name + "的fields节点格式不正确")
+	}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("文件数据源" + name + "的fields节点格式不正确")
+		}
+		f := &FileField{}
+		f.Name, _ = m["name"].(string)
+		f.Column, _ = m["column"].(string)
+		f.DataType, _ = m["type"].(string)
+		f.Caption, _ = m["caption"].(string)
+		f.Key, _ = m["key"].(bool)
+		c.Fields = append(c.Fields, f)
+	}
+	return c, nil
+}
+
+// Init 检查定义并读取文件
+func (c *FileDataSource) Init() error {
+	if c.FilePath == "" {
+		return fmt.Errorf("文件数据源" + c.Name + "没有定义file")
+	}
+	switch c.Format {
+	case FileFormatCSV:
+		if c.Comma == 0 {
+			c.Comma = ','
+		}
+	case FileFormatJSON, FileFormatJSONL:
+	default:
+		return fmt.Errorf("文件数据源%s不支持的文件格式：%s", c.Name, c.Format)
+	}
+	for _, f := range c.Fields {
+		if !IsValidIdentifier(f.Name) {
+			return fmt.Errorf("文件数据源%s的字段名不合法：%s", c.Name, f.Name)
+		}
+	}
+	_, err := c.load()
+	return err
+}
+
+// GetDataSourceType 返回数据源类型
+func (c *FileDataSource) GetDataSourceType() DSType {
+	return DataSourceTypeFile
+}
+
+// GetKeyFields 返回主键字段
+func (c *FileDataSource) GetKeyFields() []*MyProperty {
+	return c.KeyField
+}
+
+// SetRowsLimit 设置返回的数据条数
+func (c *FileDataSource) SetRowsLimit(limit int) {
+	c.rowsLimit = limit
+}
+
+// SetRowsOffset 设置返回数据的偏移量
+func (c *FileDataSource) SetRowsOffset(offset int) {
+	c.rowsOffset = offset
+}
+
+// signature 返回影响读取结果的定义，定义改变时重新读取文件
+func (c *FileDataSource) signature() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s|%s|%c|%s", c.FilePath, c.Format, c.Comma, c.RowsPath)
+	for _, f := range c.Fields {
+		fmt.Fprintf(&sb, "|%s,%s,%s,%s,%v", f.Name, f.Column, f.DataType, f.Caption, f.Key)
+	}
+	return sb.String()
+}
+
+// load 返回文件数据，文件的修改时间或大小与缓存的不一致时重新读取
+func (c *FileDataSource) load() (*fileData, error) {
+	fi, err := os.Stat(c.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件数据源%s的文件时发生错误：%s", c.Name, err.Error())
+	}
+	sig := c.signature()
+	fileDataCache.Lock()
+	defer fileDataCache.Unlock()
+	d := fileDataCache.m[c.Name]
+	if d == nil || d.sig != sig || !d.modTime.Equal(fi.ModTime()) || d.size != fi.Size() {
+		logs.Info("读取文件数据源%s的文件%s", c.Name, c.FilePath)
+		if d, err = c.readFile(); err != nil {
+			return nil, err
+		}
+		d.sig = sig
+		d.modTime = fi.ModTime()
+		d.size = fi.Size()
+		fileDataCache.m[c.Name] = d
+	}
+	c.Field = d.fields
+	c.KeyField = d.keys
+	return d, nil
+}
+
+// readFile 读取文件，生成字段信息和数据
+func (c *FileDataSource) readFile() (*fileData, error) {
+	f, err := os.Open(c.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件数据源%s的文件时发生错误：%s", c.Name, err.Error())
+	}
+	defer f.Close()
+	var columns []string
+	var rows []map[string]interface{}
+	if c.Format == FileFormatCSV {
+		columns, rows, err = c.readCSV(f)
+	} else {
+		columns, rows, err = c.readJSON(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件数据源%s的文件时发生错误：%s", c.Name, err.Error())
+	}
+
+	fields := c.Fields
+	if len(fields) == 0 {
+		fields = make([]*FileField, 0, len(columns))
+		for _, col := range columns {
+			if !IsValidIdentifier(col) {
+				return nil, fmt.Errorf("文件数据源%s的列名不能作为字段名：%s", c.Name, col)
+			}
+			fields = append(fields, &FileField{Name: col})
+		}
+	}
+	raw := make([][]interface{}, len(rows), len(rows))
+	for i, row := range rows {
+		raw[i] = make([]interface{}, len(fields), len(fields))
+		for j, fd := range fields {
+			col := fd.Column
+			if col == "" {
+				col = fd.Name
+			}
+			if c.Format == FileFormatCSV {
+				raw[i][j] = row[col]
+			} else {
+				raw[i][j], _ = getJSONPath(row, col)
+			}
+		}
+	}
+	if c.Format == FileFormatCSV && len(c.Fields) != 0 {
+		has := make(map[string]bool, len(columns))
+		for _, col := range columns {
+			has[col] = true
+		}
+		for _, fd := range c.Fields {
+			col := fd.Column
+			if col == "" {
+				col = fd.Name
+			}
+			if !has[col] {
+				return nil, fmt.Errorf("文件数据源%s的文件中没有列%s", c.Name, col)
+			}
+		}
+	}
+
+	d := &fileData{rs: &DataResultSet{Fields: make(FieldDescType, len(fields)), Data: raw}}
+	for j, fd := range fields {
+		dataType := fd.DataType
+		if dataType == "" {
+			dataType = inferFileType(raw, j)
+		}
+		for i := range raw {
+			v := raw[i][j]
+			if s, ok := v.(string); ok && s == "" && c.Format == FileFormatCSV {
+				raw[i][j] = nil
+				continue
+			}
+			if raw[i][j], err = convertRestValue(v, dataType); err != nil {
+				return nil, fmt.Errorf("文件数据源%s第%d行字段%s的值%v转换失败：%s", c.Name, i+1, fd.Name, v, err.Error())
+			}
+		}
+		p := &MyProperty{Name: fd.Name, DataType: dataType, Caption: fd.Caption}
+		d.fields = append(d.fields, p)
+		if fd.Key {
+			d.keys = append(d.keys, p)
+		}
+		d.rs.Fields[fd.Name] = &FieldDesc{FieldType: dataType, Index: j}
+	}
+	return d, nil
+}
+
+// readCSV 读取CSV文件，第一行为标题行
+func (c *FileDataSource) readCSV(r io.Reader) ([]string, []map[string]interface{}, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = c.Comma
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("文件没有标题行")
+	}
+	header := records[0]
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	seen := make(map[string]bool, len(header))
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		if seen[header[i]] {
+			return nil, nil, fmt.Errorf("标题行中的列%s重复", header[i])
+		}
+		seen[header[i]] = true
+	}
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, h := range header {
+			row[h] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+// readJSON 读取JSON或JSON-lines文件，没有定义字段时返回全部对象的属性名
+func (c *FileDataSource) readJSON(r io.Reader) ([]string, []map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var items []interface{}
+	if c.Format == FileFormatJSONL {
+		for {
+			var v interface{}
+			if err := dec.Decode(&v); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, v)
+		}
+	} else {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		node, ok := getJSONPath(v, c.RowsPath)
+		if !ok {
+			return nil, nil, fmt.Errorf("JSON中没有%s节点", c.RowsPath)
+		}
+		switch n := node.(type) {
+		case []interface{}:
+			items = n
+		case map[string]interface{}:
+			items = []interface{}{n}
+		default:
+			return nil, nil, fmt.Errorf("数据不是数组或对象")
+		}
+	}
+	seen := make(map[string]bool)
+	columns := make([]string, 0)
+	rows := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("第%d条数据不是对象", i+1)
+		}
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Strings(columns)
+	return columns, rows, nil
+}
+
+// inferFileType 根据一列数据推断字段类型，字符串可以推断为整数、浮点数、日期、时间，以0开头的数字串作为字符串
+// JSON中的数值推断为整数或浮点数，全部为空值时为字符串
+func inferFileType(rows [][]interface{}, col int) string {
+	isInt, isDou, isDate, isTime := true, true, true, true
+	count := 0
+	for _, row := range rows {
+		switch v := row[col].(type) {
+		case nil:
+			continue
+		case json.Number:
+			if _, err := v.Int64(); err != nil {
+				isInt = false
+			}
+			isDate, isTime = false, false
+		case string:
+			if v == "" {
+				continue
+			}
+			if len(v) > 1 && v[0] == '0' && v[1] != '.' {
+				isInt, isDou = false, false
+			}
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				isInt = false
+			}
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				isDou = false
+			}
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				isDate = false
+				if _, err := time.Parse("2006-01-02 15:04:05", v); err != nil {
+					if _, err := time.Parse(time.RFC3339, v); err != nil {
+						isTime = false
+					}
+				}
+			}
+		default:
+			return PropertyDatatypeStr
+		}
+		count++
+	}
+	switch {
+	case count == 0:
+		return PropertyDatatypeStr
+	case isInt:
+		return PropertyDatatypeInt
+	case isDou:
+		return PropertyDatatypeDou
+	case isDate:
+		return PropertyDatatypeDate
+	case isTime:
+		return PropertyDatatypeTime
+	}
+	return PropertyDatatypeStr
+}
+
+// newFileResultSet 生成结果集，复制字段描述和每一行数据，避免修改缓存的文件数据
+func newFileResultSet(fields FieldDescType, rows [][]interface{}) *DataResultSet {
+	rs := &DataResultSet{Fields: make(FieldDescType, len(fields)), Data: make([][]interface{}, len(rows), len(rows))}
+	for k, f := range fields {
+		rs.Fields[k] = &FieldDesc{FieldType: f.FieldType, Index: f.Index}
+	}
+	for i, row := range rows {
+		rs.Data[i] = append([]interface{}(nil), row...)
+	}
+	return rs
+}
+
+// GetAllData 返回全部数据，使用排序和分页，不使用查询条件
+func (c *FileDataSource) GetAllData() (*DataResultSet, error) {
+	d, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCriteria(nil, c.orderlist); err != nil {
+		return nil, err
+	}
+	rs, err := ApplyQuery(d.rs, &ResultSetQuery{OrderBy: c.orderlist, Limit: c.rowsLimit, Offset: c.rowsOffset})
+	if err != nil {
+		return nil, err
+	}
+	return newFileResultSet(rs.Fields, rs.Data), nil
+}
+
+// filterQuery 检查查询条件并返回文件数据和内存查询
+func (c *FileDataSource) filterQuery() (*fileData, *ResultSetQuery, error) {
+	d, err := c.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.checkCriteria(c.filter, nil); err != nil {
+		return nil, nil, err
+	}
+	if err := c.checkAggre(c.aggre, c.groupby); err != nil {
+		return nil, nil, err
+	}
+	return d, c.resultSetQuery(c.rowsLimit, c.rowsOffset), nil
+}
+
+// DoFilter 根据查询条件返回数据，依次处理条件、聚合、排序和分页
+func (c *FileDataSource) DoFilter() (*DataResultSet, error) {
+	d, q, err := c.filterQuery()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := ApplyQuery(d.rs, q)
+	if err != nil {
+		return nil, err
+	}
+	return newFileResultSet(rs.Fields, rs.Data), nil
+}
+
+// CountAll 返回全部数据的记录数
+func (c *FileDataSource) CountAll() (int64, error) {
+	d, err := c.load()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(d.rs.Data)), nil
+}
+
+// CountFilter 返回满足查询条件的记录数，有聚合时返回分组的个数
+func (c *FileDataSource) CountFilter() (int64, error) {
+	d, q, err := c.filterQuery()
+	if err != nil {
+		return 0, err
+	}
+	return CountQuery(d.rs, q)
+}
+
+// QueryDataByKey 根据主键返回数据
+func (c *FileDataSource) QueryDataByKey(keyvalues ...interface{}) (*DataResultSet, error) {
+	if _, err := c.load(); err != nil {
+		return nil, err
+	}
+	if len(keyvalues) == 0 || len(keyvalues) != len(c.KeyField) {
+		return nil, fmt.Errorf("文件数据源" + c.Name + "的主键值个数与主键字段个数不一致")
+	}
+	fv := make(map[string]interface{}, len(keyvalues))
+	for i, v := range keyvalues {
+		fv[c.KeyField[i].Name] = v
+	}
+	return c.QueryDataByFieldValues(fv)
+}
+
+// QueryDataByFieldValues 根据字段值返回数据，不使用当前的查询条件
+func (c *FileDataSource) QueryDataByFieldValues(fv map[string]interface{}) (*DataResultSet, error) {
+	d, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkFieldValues(fv); err != nil {
+		return nil, err
+	}
+	criteria := make([]*SQLCriteria, 0, len(fv))
+	for k, v := range fv {
+		criteria = append(criteria, &SQLCriteria{PropertyName: k, Operation: OperEq, Value: v, Complex: CompAnd})
+	}
+	rows, err := filterRows(d.rs.Fields, d.rs.Data, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return newFileResultSet(d.rs.Fields, rows), nil
+}
@@ -0,0 +1,140 @@
+package datasource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSVDataSource(t *testing.T) {
+	dir, clean := createTempDir(t)
+	defer clean()
+	file := filepath.Join(dir, "orders.csv")
+	ioutil.WriteFile(file, []byte("\uFEFFORDER_ID,ORG,AMOUNT,PRICE,CREATED,CODE\n"+
+		"1,A,10,1.5,2020-01-01,001\n2,A,20,2,2020-01-02,002\n3,B,30,,2020-01-03,003\n4,B,,4.5,2020-01-04,004\n5,C,50,5,2020-01-05,005\n"), 0644)
+
+	ds, err := CreateCSVDataSource("csvorders", map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]string)
+	for _, f := range ds.GetFields() {
+		types[f.Name] = f.DataType
+	}
+	if types["ORDER_ID"] != PropertyDatatypeInt || types["PRICE"] != PropertyDatatypeDou || types["CREATED"] != PropertyDatatypeDate ||
+		types["CODE"] != PropertyDatatypeStr || ds.GetDataSourceType() != DataSourceTypeFile {
+		t.Errorf("inferred types %v", types)
+	}
+
+	ds.AddCriteria("ORG", OperIn, []interface{}{"A", "B"})
+	ds.AddCriteriaGroup(CompAnd, true, []*SQLCriteria{{PropertyName: "AMOUNT", Operation: OperIsNull}})
+	ds.Orderby("AMOUNT", "DESC")
+	ds.SetRowsLimit(2)
+	ds.SetRowsOffset(1)
+	rs, err := ds.DoFilter()
+	if err != nil || len(rs.Data) != 2 || rs.Data[0][rs.Fields["ORDER_ID"].Index] != int64(2) || rs.Data[1][rs.Fields["CODE"].Index] != "001" {
+		t.Errorf("filter %v %v", rs, err)
+	}
+	if n, err := ds.CountFilter(); err != nil || n != 3 {
+		t.Errorf("CountFilter %d %v", n, err)
+	}
+	// 修改返回的数据不影响缓存的数据
+	rs.Data[0][0] = "x"
+	rs, err = ds.QueryDataByFieldValues(map[string]interface{}{"ORDER_ID": 2})
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][0] != int64(2) {
+		t.Errorf("QueryDataByFieldValues %v %v", rs, err)
+	}
+
+	gds, _ := CreateCSVDataSource("csvorders", map[string]interface{}{"file": file})
+	gds.AddCriteria("CREATED", OperGtEg, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+	gds.AddAggre("TOTAL", &AggreType{Predicate: AggSum, ColName: "AMOUNT"})
+	gds.AddAggre("AVGPRICE", &AggreType{Predicate: AggAvg, ColName: "PRICE"})
+	gds.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "*"})
+	gds.AddAggre("MAXDAY", &AggreType{Predicate: AggMax, ColName: "CREATED"})
+	gds.SetGroupBy([]string{"ORG"})
+	gds.Orderby("TOTAL", "DESC")
+	rs, err = gds.DoFilter()
+	if err != nil || len(rs.Data) != 3 || len(rs.Fields) != 5 {
+		t.Fatalf("aggregate %v %v", rs, err)
+	}
+	b := rs.Data[1]
+	if rs.Data[0][rs.Fields["ORG"].Index] != "C" || b[rs.Fields["TOTAL"].Index] != int64(30) || b[rs.Fields["AVGPRICE"].Index] != 4.5 ||
+		b[rs.Fields["CNT"].Index] != int64(2) || !b[rs.Fields["MAXDAY"].Index].(time.Time).Equal(time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)) ||
+		rs.Fields["TOTAL"].FieldType != PropertyDatatypeInt {
+		t.Errorf("aggregate %v", rs.Data)
+	}
+	gds.SetGroupBy([]string{})
+	if n, err := gds.CountFilter(); err != nil || n != 1 {
+		t.Errorf("aggregate count %d %v", n, err)
+	}
+
+	// 文件修改后重新读取
+	ads, _ := CreateCSVDataSource("csvorders", map[string]interface{}{"file": file})
+	ioutil.WriteFile(file, []byte("ORDER_ID,ORG\n9,Z\n"), 0644)
+	os.Chtimes(file, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	rs, err = ads.GetAllData()
+	if err != nil || len(rs.Data) != 1 || len(ads.GetFields()) != 2 {
+		t.Errorf("reload %v %v", rs, err)
+	}
+
+	for _, m := range []map[string]interface{}{
+		{"file": filepath.Join(dir, "none.csv")},
+		{"file": file, "fields": []interface{}{map[string]interface{}{"name": "NOTEXIST"}}},
+		{"file": file, "delimiter": ";;"},
+	} {
+		if _, err := CreateCSVDataSource("csvbad", m); err == nil {
+			t.Errorf("invalid meta %v accepted", m)
+		}
+	}
+	ds.AddCriteria("NOTEXIST", OperEq, 1)
+	if _, err := ds.DoFilter(); err == nil {
+		t.Error("invalid field accepted")
+	}
+}
+
+func TestJSONDataSource(t *testing.T) {
+	dir, clean := createTempDir(t)
+	defer clean()
+	file := filepath.Join(dir, "orgs.json")
+	ioutil.WriteFile(file, []byte(`{"data":{"items":[{"id":"A","name":"orgA","order":3,"info":{"created":"2020-01-01T08:00:00Z"}},
+		{"id":"B","name":"orgB","order":1.5},{"id":"C","name":"orgC","order":2}]}}`), 0644)
+	ds, err := CreateJSONDataSource("jsonorgs", map[string]interface{}{"file": file, "rowspath": "data.items",
+		"fields": []interface{}{map[string]interface{}{"name": "ORG_ID", "column": "id", "key": true}, map[string]interface{}{"name": "ORG_ORDER", "column": "order"},
+			map[string]interface{}{"name": "CREATED", "column": "info.created"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := ds.GetFieldByName("ORG_ORDER"); f == nil || f.DataType != PropertyDatatypeDou || ds.GetFieldByName("CREATED").DataType != PropertyDatatypeTime {
+		t.Errorf("inferred types %v", ds.GetFields())
+	}
+	rs, err := ds.QueryDataByKey("A")
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ORDER"].Index] != 3.0 {
+		t.Errorf("QueryDataByKey %v %v", rs, err)
+	}
+	ds.AddCriteria("ORG_ORDER", OperLt, 3)
+	ds.Orderby("ORG_ORDER", "ASC")
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 2 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "B" {
+		t.Errorf("filter %v %v", rs, err)
+	}
+
+	lfile := filepath.Join(dir, "orgs.jsonl")
+	ioutil.WriteFile(lfile, []byte("{\"ORG_ID\":\"A\",\"ORG_ORDER\":1}\n{\"ORG_ID\":\"B\",\"ORG_ORDER\":2,\"REMARK\":\"x\"}\n"), 0644)
+	lds, err := CreateJSONDataSource("jsonlorgs", map[string]interface{}{"file": lfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lds.GetFields()) != 3 || lds.GetFieldByName("ORG_ORDER").DataType != PropertyDatatypeInt {
+		t.Errorf("jsonl fields %v", lds.GetFields())
+	}
+	if n, err := lds.CountAll(); err != nil || n != 2 {
+		t.Errorf("jsonl count %d %v", n, err)
+	}
+	ioutil.WriteFile(lfile, []byte("[1,2]"), 0644)
+	os.Chtimes(lfile, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	if _, err := lds.GetAllData(); err == nil {
+		t.Error("invalid jsonl accepted")
+	}
+}
@@ -0,0 +1,209 @@
+package datasource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identifierPattern 合法的标识符，由字母、数字、下划线、$和#组成，不能以数字开头
+var identifierPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_$#]*$`)
+
+// validOperations 查询条件支持的操作符
+var validOperations = map[string]bool{
+	OperEq:          true,
+	OperNoteq:       true,
+	OperGt:          true,
+	OperLt:          true,
+	OperGtEg:        true,
+	OperLtEg:        true,
+	OperBetween:     true,
+	OperIn:          true,
+	OperNotIn:       true,
+	OperIsNull:      true,
+	OperIsNotNull:   true,
+	OperAlwaysFalse: true,
+	OperAlwaysTrue:  true,
+	OperLike:        true,
+	OperNotLike:     true,
+	OperStartsWith:  true,
+	OperEndsWith:    true,
+	OperContains:    true,
+	OperRegex:       true,
+}
+
+// IsValidIdentifier 判断是否为合法的标识符，允许使用.分隔表名和字段名
+func IsValidIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, s := range strings.Split(name, ".") {
+		if !identifierPattern.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidOperation 判断是否为支持的操作符
+func IsValidOperation(operation string) bool {
+	return validOperations[operation]
+}
+
+// ParseOrderBy 解析“字段名 排序方向”形式的排序字段，排序方向只能为ASC或DESC，省略时为ASC
+func ParseOrderBy(order string) (string, string, error) {
+	ss := strings.Fields(order)
+	switch len(ss) {
+	case 1:
+		return ss[0], "ASC", nil
+	case 2:
+		dir := strings.ToUpper(ss[1])
+		if dir != "ASC" && dir != "DESC" {
+			return "", "", fmt.Errorf("排序方向只能为ASC或DESC：" + ss[1])
+		}
+		return ss[0], dir, nil
+	}
+	return "", "", fmt.Errorf("排序字段格式错误：" + order)
+}
+
+// checkFieldName 检查字段名是否为数据源中定义的字段，数据源没有字段信息时检查是否为合法的标识符
+// 带表名的字段名只能用于连接了其他表的数据表数据源，见TableDataSource的checkFieldName
+func (c *DataSource) checkFieldName(name string) error {
+	if c.GetFieldByName(name) != nil || c.GetKeyFieldByName(name) != nil {
+		return nil
+	}
+	if len(c.Field) == 0 && !strings.Contains(name, ".") && IsValidIdentifier(name) {
+		return nil
+	}
+	return fmt.Errorf("数据源%s中没有字段%s", c.Name, name)
+}
+
+// checkFieldName 检查字段名，“别名.字段名”形式的字段名必须为连接表中定义的字段
+func (c *TableDataSource) checkFieldName(name string) error {
+	if !strings.Contains(name, ".") {
+		return c.DataSource.checkFieldName(name)
+	}
+	for _, p := range c.joinpiece {
+		if !strings.HasPrefix(name, p.alias()+".") {
+			continue
+		}
+		field := strings.TrimPrefix(name, p.alias()+".")
+		if p.source != nil && p.source.GetFieldByName(field) != nil || p.source == nil && IsValidIdentifier(field) {
+			return nil
+		}
+		return fmt.Errorf("连接表%s中没有字段%s", p.alias(), field)
+	}
+	return fmt.Errorf("数据源%s中没有字段%s，表名不是连接表的别名", c.Name, name)
+}
+
+// checkCriteria 检查查询条件和排序中的字段名和操作符
+func (c *DataSource) checkCriteria(filter []*TDFilter, orderlist []string) error {
+	return checkCriteriaFields(c.checkFieldName, filter, orderlist)
+}
+
+// checkCriteria 检查查询条件和排序中的字段名和操作符，可以使用连接表的字段
+func (c *TableDataSource) checkCriteria(filter []*TDFilter, orderlist []string) error {
+	return checkCriteriaFields(c.checkFieldName, filter, orderlist)
+}
+
+// checkSQLCriteria 检查条件列表，包括条件组中的子条件
+func (c *DataSource) checkSQLCriteria(criteria []*SQLCriteria) error {
+	return checkSQLCriteriaFields(c.checkFieldName, criteria)
+}
+
+// checkSQLCriteria 检查条件列表，包括条件组中的子条件，可以使用连接表的字段
+func (c *TableDataSource) checkSQLCriteria(criteria []*SQLCriteria) error {
+	return checkSQLCriteriaFields(c.checkFieldName, criteria)
+}
+
+// checkAggre 检查聚合和分组的字段名，输出字段名为新的字段，只检查是否为合法的标识符
+func (c *DataSource) checkAggre(aggre map[string]*AggreType, groupby []string) error {
+	return checkAggreFields(c.checkFieldName, aggre, groupby)
+}
+
+// checkAggre 检查聚合和分组的字段名，可以使用连接表的字段
+func (c *TableDataSource) checkAggre(aggre map[string]*AggreType, groupby []string) error {
+	return checkAggreFields(c.checkFieldName, aggre, groupby)
+}
+
+// checkCriteriaFields 使用check检查查询条件和排序中的字段名，并检查操作符
+func checkCriteriaFields(check func(string) error, filter []*TDFilter, orderlist []string) error {
+	criteria := make([]*SQLCriteria, len(filter), len(filter))
+	for i, item := range filter {
+		criteria[i] = (*SQLCriteria)(item)
+	}
+	if err := checkSQLCriteriaFields(check, criteria); err != nil {
+		return err
+	}
+	for _, o := range orderlist {
+		f, _, err := ParseOrderBy(o)
+		if err != nil {
+			return err
+		}
+		if err := check(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSQLCriteriaFields 使用check检查条件列表中的字段名，包括条件组中的子条件，并检查操作符
+func checkSQLCriteriaFields(check func(string) error, criteria []*SQLCriteria) error {
+	for _, cr := range criteria {
+		if cr.Children != nil {
+			if err := checkSQLCriteriaFields(check, cr.Children); err != nil {
+				return err
+			}
+			continue
+		}
+		if kv, ok := cr.Value.(*KeysetValue); ok && cr.Operation == OperKeyset {
+			for _, f := range kv.Fields {
+				if err := check(f); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !IsValidOperation(cr.Operation) {
+			return fmt.Errorf("不支持的操作符：" + cr.Operation)
+		}
+		if err := check(cr.PropertyName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAggreFields 使用check检查聚合和分组的字段名，输出字段名为新的字段，只检查是否为合法的标识符
+func checkAggreFields(check func(string) error, aggre map[string]*AggreType, groupby []string) error {
+	for _, f := range groupby {
+		if err := check(f); err != nil {
+			return err
+		}
+	}
+	for outfield, a := range aggre {
+		if !IsValidIdentifier(outfield) {
+			return fmt.Errorf("聚合的输出字段名不合法：" + outfield)
+		}
+		if a.Predicate < AggCount || a.Predicate > AggMin {
+			return fmt.Errorf("不支持的聚合类型：%d", a.Predicate)
+		}
+		if a.ColName == "*" && a.Predicate == AggCount {
+			continue
+		}
+		if err := check(a.ColName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFieldValues 检查添加、更新的字段名
+func (c *DataSource) checkFieldValues(values map[string]interface{}) error {
+	for k := range values {
+		if err := c.checkFieldName(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package datasource
 
 import (
+	"database/sql"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -57,16 +59,106 @@ type IDataSource interface {
 	GetFieldByName(name string) *MyProperty
 }
 
+// WriteResult 写操作的结果
+type WriteResult struct {
+	// RowsAffected 影响的行数
+	RowsAffected int64
+	// LastInsertId 数据库生成的自增主键，数据库或驱动不支持时为0
+	LastInsertId int64
+}
+
 // IWriteableDataSource 可写的数据源接口
 type IWriteableDataSource interface {
-	Delete() error
-	Insert(values map[string]interface{}) error
-	Update(values map[string]interface{}) error
+	Delete() (*WriteResult, error)
+	Insert(values map[string]interface{}) (*WriteResult, error)
+	Update(values map[string]interface{}) (*WriteResult, error)
 	AddCriteria(field, operation string, value interface{}) IFilterAdder
 	AndCriteria(field, operation string, value interface{}) IFilterAdder
 	OrCriteria(field, operation string, value interface{}) IFilterAdder
 }
 
+// ITransactionDataSource 支持事务的数据源接口，同一个数据库别名的数据源可以在一个事务中执行写操作
+type ITransactionDataSource interface {
+	// GetDBAlias 返回数据库别名
+	GetDBAlias() string
+	// BeginTx 开始一个事务
+	BeginTx() (*sql.Tx, error)
+	// SetTx 设定写操作使用的事务，为nil时不使用事务
+	SetTx(tx *sql.Tx)
+}
+
+// IBulkInsertDataSource 支持批量插入的数据源接口
+type IBulkInsertDataSource interface {
+	// BulkInsert 在一个事务中插入多行数据，返回插入的总行数
+	BulkInsert(rows []map[string]interface{}) (*WriteResult, error)
+}
+
+// IVersionDataSource 支持乐观并发控制的数据源接口，更新和删除时检查数据的版本
+type IVersionDataSource interface {
+	// GetVersionField 返回版本字段名，为空时不使用乐观并发控制
+	GetVersionField() string
+	// UpdateVersion 更新版本为version的数据，版本字段自动更新，没有数据被更新时返回ErrVersionConflict
+	UpdateVersion(values map[string]interface{}, version interface{}) (*WriteResult, error)
+	// DeleteVersion 删除版本为version的数据，没有数据被删除时返回ErrVersionConflict
+	DeleteVersion(version interface{}) (*WriteResult, error)
+	// RestoreVersion 恢复版本为version的已经删除的数据，版本字段自动更新，没有数据被恢复时返回ErrVersionConflict
+	RestoreVersion(version interface{}) (*WriteResult, error)
+}
+
+// IKeysetDataSource 支持游标分页的数据源接口
+type IKeysetDataSource interface {
+	// SetKeyset 设定游标分页条件，只返回排序字段的值在values之后的数据，fields为nil时清除条件
+	SetKeyset(fields []string, values []interface{}, desc bool)
+}
+
+// IRowIterator 逐行读取数据的迭代器，使用后必须调用Close释放资源
+type IRowIterator interface {
+	// Fields 返回结果集的字段
+	Fields() FieldDescType
+	// Next 读取下一行数据，没有数据或发生错误时返回false
+	Next() bool
+	// Row 返回当前行的数据
+	Row() []interface{}
+	// Err 返回读取数据时发生的错误
+	Err() error
+	// Close 关闭迭代器
+	Close() error
+}
+
+// IStreamDataSource 支持逐行读取数据的数据源接口，数据不全部加载到内存中
+type IStreamDataSource interface {
+	// IterateAllData 逐行读取全部数据，与GetAllData的条件相同
+	IterateAllData() (IRowIterator, error)
+	// IterateFilter 逐行读取满足查询条件的数据，与DoFilter的条件相同
+	IterateFilter() (IRowIterator, error)
+}
+
+// ICountDataSource 支持返回记录数的数据源接口
+type ICountDataSource interface {
+	// CountAll 返回全部数据的记录数
+	CountAll() (int64, error)
+	// CountFilter 返回满足查询条件的记录数，忽略分页和排序
+	CountFilter() (int64, error)
+}
+
+// ISoftDeleteDataSource 支持软删除的数据源接口
+type ISoftDeleteDataSource interface {
+	// IsSoftDelete 是否使用软删除
+	IsSoftDelete() bool
+	// SetWithDeleted 设定查询时是否包括已经删除的数据
+	SetWithDeleted(withDeleted bool)
+	// IsWithDeleted 查询时是否包括已经删除的数据
+	IsWithDeleted() bool
+	// Restore 恢复满足条件的已经删除的数据，使用乐观并发控制时使用IVersionDataSource的RestoreVersion
+	Restore() (*WriteResult, error)
+}
+
+// IUpsertDataSource 支持按主键插入或更新数据的数据源接口
+type IUpsertDataSource interface {
+	// Upsert 主键不存在时插入数据，存在时更新数据，inserted为true表示插入了新数据
+	Upsert(values map[string]interface{}) (result *WriteResult, inserted bool, err error)
+}
+
 // ICriteriaDataSource 可以过滤的数据源接口
 type ICriteriaDataSource interface {
 	IDataSource
@@ -77,6 +169,12 @@ type ICriteriaDataSource interface {
 type IJoinedDataSource interface {
 	ICriteriaDataSource
 	JoinDataSource(join string, ds ICriteriaDataSource, outfield []string) IAddCriteria
+	// JoinTable 连接另一个数据表数据源，alias为连接表的别名，outalias为输出字段的别名
+	JoinTable(join string, ds ICriteriaDataSource, alias string, outfield, outalias []string) (*PieceJoin, error)
+	// ClearJoin 清除连接
+	ClearJoin()
+	// GetTableName 返回数据库表名，连接条件中引用主表的字段时使用
+	GetTableName() string
 }
 
 // IFilterAdder 过滤条件接口
@@ -84,6 +182,8 @@ type IFilterAdder interface {
 	AddCriteria(field, operation string, value interface{}) IFilterAdder
 	AndCriteria(field, operation string, value interface{}) IFilterAdder
 	OrCriteria(field, operation string, value interface{}) IFilterAdder
+	// AddCriteriaGroup 添加条件组，complex为条件组与之前条件的关系，not为true时条件组取反
+	AddCriteriaGroup(complex string, not bool, children []*SQLCriteria) IFilterAdder
 	Orderby(field string, dir string) IFilterAdder
 }
 
@@ -97,6 +197,13 @@ type IAggregativeAdder interface {
 	AddAggre(outfield string, aggreType *AggreType)
 }
 
+// IGroupByDataSource 可以指定聚合分组字段的数据源接口
+type IGroupByDataSource interface {
+	IAggregativeAdder
+	// SetGroupBy 设定聚合时的分组字段，没有设定时按数据源的全部字段分组
+	SetGroupBy(fields []string)
+}
+
 // DSType 数据源类型
 type DSType int8
 
@@ -111,12 +218,18 @@ const (
 	DataSourceTypeEnmu DSType = 4
 	// DataSourceTypeInner 联接数据源
 	DataSourceTypeInner DSType = 5
+	// DataSourceTypeFile 文件数据源
+	DataSourceTypeFile DSType = 6
 )
 const (
 	// DbTypeMySQL MySQL数据库类型
 	DbTypeMySQL string = "mysql"
 	// DbTypeOracle Oracle数据库类型
 	DbTypeOracle string = "oracle"
+	// DbTypePostgreSQL PostgreSQL数据库类型，与驱动名称一致
+	DbTypePostgreSQL string = "postgres"
+	// DbTypeSQLite SQLite数据库类型，与驱动名称一致
+	DbTypeSQLite string = "sqlite3"
 )
 
 // GetDataSourceTypeStr 根据数据源类型返回数据源类型的String表达
@@ -132,6 +245,8 @@ func GetDataSourceTypeStr(t DSType) string {
 		return "ENMU"
 	case DataSourceTypeInner:
 		return "INNER"
+	case DataSourceTypeFile:
+		return "FILE"
 	}
 	return "UNKNOW"
 }
@@ -142,6 +257,8 @@ type OutFieldProperty struct {
 	JoinField  string
 	ValueField string
 	ValueFunc  func(record []interface{}, field []*MyProperty, Source IDataSource) interface{} `json:"-"`
+	// CacheExpire 查找结果的缓存时间，为0时不缓存，同一个查询中的键值只查找一次
+	CacheExpire time.Duration
 }
 
 // MyProperty 对象属性
@@ -235,6 +352,91 @@ func ConvertMySQLType2CommonType(t string) string {
 	return PropertyDatatypeUnkn
 }
 
+// ConvertPostgreSQLType2CommonType PostgreSQL类型表达形式转换，
+// 同时支持information_schema中的类型名称和驱动返回的类型名称
+func ConvertPostgreSQLType2CommonType(t string) string {
+	switch t {
+	case "CHARACTER VARYING", "VARCHAR", "CHARACTER", "CHAR", "BPCHAR", "TEXT", "NAME", "UUID":
+		return PropertyDatatypeStr
+	case "SMALLINT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "SMALLSERIAL", "SERIAL", "BIGSERIAL":
+		return PropertyDatatypeInt
+	case "REAL", "DOUBLE PRECISION", "NUMERIC", "DECIMAL", "FLOAT4", "FLOAT8", "MONEY":
+		return PropertyDatatypeDou
+	case "DATE":
+		return PropertyDatatypeDate
+	case "TIMESTAMP", "TIMESTAMP WITHOUT TIME ZONE", "TIMESTAMP WITH TIME ZONE", "TIMESTAMPTZ",
+		"TIME", "TIME WITHOUT TIME ZONE", "TIME WITH TIME ZONE", "TIMETZ":
+		return PropertyDatatypeTime
+	}
+	return PropertyDatatypeUnkn
+}
+
+// ConvertSQLiteType2CommonType SQLite类型表达形式转换，SQLite的字段类型是建表时声明的类型，
+// 按照SQLite类型亲和性的规则进行转换，日期和时间类型按照声明的类型名称判断
+func ConvertSQLiteType2CommonType(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	if i := strings.Index(t, "("); i != -1 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch {
+	case t == "DATE":
+		return PropertyDatatypeDate
+	case t == "DATETIME" || strings.HasPrefix(t, "TIMESTAMP") || t == "TIME":
+		return PropertyDatatypeTime
+	case strings.Contains(t, "INT"):
+		return PropertyDatatypeInt
+	case strings.Contains(t, "CHAR") || strings.Contains(t, "CLOB") || strings.Contains(t, "TEXT"):
+		return PropertyDatatypeStr
+	case strings.Contains(t, "REAL") || strings.Contains(t, "FLOA") || strings.Contains(t, "DOUB") ||
+		t == "NUMERIC" || t == "DECIMAL":
+		return PropertyDatatypeDou
+	}
+	return PropertyDatatypeUnkn
+}
+
+// ConvertOracleType2CommonType Oracle类型表达形式转换，
+// 同时支持数据字典ALL_TAB_COLUMNS中的类型名称和驱动返回的SQLT_类型名称
+func ConvertOracleType2CommonType(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	if i := strings.Index(t, "("); i != -1 {
+		//TIMESTAMP(6) WITH TIME ZONE等类型去掉精度，没有右括号时去掉左括号之后的部分
+		rest := ""
+		if j := strings.Index(t[i:], ")"); j != -1 {
+			rest = t[i+j+1:]
+		}
+		t = strings.TrimSpace(t[:i] + rest)
+	}
+	switch t {
+	case "VARCHAR2", "NVARCHAR2", "VARCHAR", "CHAR", "NCHAR", "CLOB", "NCLOB", "ROWID",
+		"SQLT_AFC", "SQLT_CHR", "SQLT_VCS", "SQLT_AVC", "SQLT_STR", "SQLT_CLOB":
+		return PropertyDatatypeStr
+	case "INTEGER", "SMALLINT", "SQLT_INT", "SQLT_UIN":
+		return PropertyDatatypeInt
+	case "NUMBER", "FLOAT", "BINARY_FLOAT", "BINARY_DOUBLE",
+		"SQLT_NUM", "SQLT_VNU", "SQLT_FLT", "SQLT_BFLOAT", "SQLT_BDOUBLE", "SQLT_IBFLOAT", "SQLT_IBDOUBLE":
+		return PropertyDatatypeDou
+	case "DATE", "SQLT_DAT":
+		return PropertyDatatypeDate
+	case "TIMESTAMP", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITH LOCAL TIME ZONE",
+		"SQLT_TIMESTAMP", "SQLT_TIMESTAMP_TZ", "SQLT_TIMESTAMP_LTZ":
+		return PropertyDatatypeTime
+	}
+	return PropertyDatatypeUnkn
+}
+
+// ConvertDBType2CommonType 根据数据库类型选择类型转换函数，将数据库的类型表达形式转换为通用类型
+func ConvertDBType2CommonType(dbType string, t string) string {
+	switch dbType {
+	case DbTypePostgreSQL:
+		return ConvertPostgreSQLType2CommonType(t)
+	case DbTypeSQLite:
+		return ConvertSQLiteType2CommonType(t)
+	case DbTypeOracle:
+		return ConvertOracleType2CommonType(t)
+	}
+	return ConvertMySQLType2CommonType(t)
+}
+
 // SourceCompare 对比连个数据源是否是一个数据源
 func SourceCompare(dsa, dsb *DBDataSource) bool {
 	if dsa == nil && dsb == nil {
@@ -246,7 +448,7 @@ func SourceCompare(dsa, dsb *DBDataSource) bool {
 // CreateWriteableTableDataSource 创建可写的数据表数据源
 func CreateWriteableTableDataSource(name, dbAlias, tablename string, fields ...string) *WriteableTableSource {
 	ids := &WriteableTableSource{
-		TableDataSource{
+		TableDataSource: TableDataSource{
 			DBDataSource: DBDataSource{
 				DataSource: DataSource{
 					Name: name,
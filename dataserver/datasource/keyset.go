@@ -0,0 +1,65 @@
+package datasource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeysetValue 游标分页条件的值，只返回排序字段的值在Values之后的数据
+// 排序字段必须包含全部主键字段，保证排序的唯一性
+type KeysetValue struct {
+	// Fields 排序字段
+	Fields []string
+	// Values 上一页最后一行数据中排序字段的值
+	Values []interface{}
+	// Desc 为true时按降序排列，返回排序字段的值小于Values的数据
+	Desc bool
+}
+
+// createRowValueSubStr 生成(k1,k2) > (?,?)形式的行值比较表达式
+func createRowValueSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	if len(fields) == 1 {
+		return fmt.Sprint(fields[0], op, "?"), values
+	}
+	binds := strings.TrimRight(strings.Repeat("?,", len(fields)), ",")
+	return fmt.Sprint("(", strings.Join(fields, ","), ") ", op, " (", binds, ")"), values
+}
+
+// createExpandedKeysetSubStr 将行值比较展开为(k1 > ? or (k1 = ? and k2 > ?))的形式，用于不支持行值比较的数据库
+func createExpandedKeysetSubStr(fields []string, op string, values []interface{}) (string, []interface{}) {
+	ors := make([]string, 0, len(fields))
+	param := make([]interface{}, 0, len(fields)*(len(fields)+1)/2)
+	for i := range fields {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, fields[j]+"=?")
+			param = append(param, values[j])
+		}
+		ands = append(ands, fields[i]+op+"?")
+		param = append(param, values[i])
+		ors = append(ors, "("+strings.Join(ands, " and ")+")")
+	}
+	return "(" + strings.Join(ors, " or ") + ")", param
+}
+
+// SetKeyset 设定游标分页条件，fields为nil时清除条件
+func (c *TableDataSource) SetKeyset(fields []string, values []interface{}, desc bool) {
+	if fields == nil {
+		c.keyset = nil
+		return
+	}
+	c.keyset = &KeysetValue{Fields: fields, Values: values, Desc: desc}
+}
+
+// keysetCriteria 返回游标分页条件，没有设定时返回nil
+func (c *TableDataSource) keysetCriteria() []*SQLCriteria {
+	if c.keyset == nil {
+		return nil
+	}
+	return []*SQLCriteria{{Operation: OperKeyset, Complex: CompAnd, Value: c.keyset}}
+}
+
+// extraCriteria 返回与查询条件以与的关系组合的附加条件，包括软删除条件和游标分页条件
+func (c *TableDataSource) extraCriteria() []*SQLCriteria {
+	return append(c.notDeletedCriteria(), c.keysetCriteria()...)
+}
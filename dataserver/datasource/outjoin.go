@@ -0,0 +1,250 @@
+package datasource
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"tongserver.dataserver/utils"
+)
+
+// outJoinBatchSize 一次IN查询中键值的最大个数
+const outJoinBatchSize = 500
+
+// outJoinQuerySource 可以通过IN条件批量查找数据的联接数据源
+type outJoinQuerySource interface {
+	IQueryableTableSource
+	// resetQuery 清除查询条件、排序、分页和聚合，返回恢复原来设定的函数
+	resetQuery() func()
+}
+
+// resetQuery 清除查询条件、排序、分页和聚合，返回恢复原来设定的函数
+func (c *DBDataSource) resetQuery() func() {
+	criteria, limit, offset := c.TableDataSourceCriteria, c.RowsLimit, c.RowsOffset
+	c.TableDataSourceCriteria, c.RowsLimit, c.RowsOffset = TableDataSourceCriteria{}, 0, 0
+	return func() {
+		c.TableDataSourceCriteria, c.RowsLimit, c.RowsOffset = criteria, limit, offset
+	}
+}
+
+// resetQuery 清除查询条件、排序、分页、聚合和游标分页条件，返回恢复原来设定的函数
+func (c *TableDataSource) resetQuery() func() {
+	restore, keyset := c.DBDataSource.resetQuery(), c.keyset
+	c.keyset = nil
+	return func() {
+		restore()
+		c.keyset = keyset
+	}
+}
+
+// resetQuery 清除查询条件、排序、分页和聚合，返回恢复原来设定的函数
+func (c *QueryableDataSource) resetQuery() func() {
+	criteria, limit, offset := c.TableDataSourceCriteria, c.rowsLimit, c.rowsOffset
+	c.TableDataSourceCriteria, c.rowsLimit, c.rowsOffset = TableDataSourceCriteria{}, 0, 0
+	return func() {
+		c.TableDataSourceCriteria, c.rowsLimit, c.rowsOffset = criteria, limit, offset
+	}
+}
+
+// outJoinRow 联接数据源中的一行数据
+type outJoinRow struct {
+	fields FieldDescType
+	data   []interface{}
+}
+
+// outJoinGroup 使用同一个联接数据源和联接字段的字段，共用一次查找
+type outJoinGroup struct {
+	source    IDataSource
+	joinField string
+	props     []*MyProperty
+	// expire 查找结果的缓存时间，为字段中最长的缓存时间
+	expire time.Duration
+	// rows 已经查找过的键值，没有找到的键值对应nil
+	rows map[string]*outJoinRow
+}
+
+// outJoinResolver 分两步填充联接字段，先收集不重复的键值，再批量查找联接数据源
+// 查找过的键值保存在resolver中，逐行读取数据时每个键值也只查找一次
+type outJoinResolver struct {
+	fields FieldDescType
+	groups []*outJoinGroup
+}
+
+// newOutJoinResolver 根据联接字段创建resolver，fields为结果集的字段
+func newOutJoinResolver(fields FieldDescType, ofs []*MyProperty) *outJoinResolver {
+	r := &outJoinResolver{fields: fields}
+	for _, f := range ofs {
+		d := f.OutJoinDefine
+		if d == nil || d.Source == nil {
+			continue
+		}
+		var g *outJoinGroup
+		for _, item := range r.groups {
+			if item.source == d.Source && item.joinField == d.JoinField {
+				g = item
+				break
+			}
+		}
+		if g == nil {
+			g = &outJoinGroup{source: d.Source, joinField: d.JoinField, rows: make(map[string]*outJoinRow)}
+			r.groups = append(r.groups, g)
+		}
+		g.props = append(g.props, f)
+		if d.CacheExpire > g.expire {
+			g.expire = d.CacheExpire
+		}
+	}
+	return r
+}
+
+// fill 填充数据中的联接字段
+func (c *outJoinResolver) fill(datas [][]interface{}) {
+	for _, g := range c.groups {
+		jf := c.fields[g.joinField]
+		if jf == nil {
+			logs.Error("JoinField错误没有找到字段" + g.joinField)
+			continue
+		}
+		keys := make([]interface{}, 0, len(datas))
+		for _, item := range datas {
+			kv := item[jf.Index]
+			if kv == nil {
+				continue
+			}
+			ks := fmt.Sprint(kv)
+			if _, ok := g.rows[ks]; !ok {
+				g.rows[ks] = nil
+				keys = append(keys, kv)
+			}
+		}
+		if len(keys) != 0 {
+			if err := g.lookup(keys); err != nil {
+				logs.Error(err)
+			}
+		}
+		for _, p := range g.props {
+			fd := c.fields[p.Name]
+			if fd == nil {
+				continue
+			}
+			for _, item := range datas {
+				if item[jf.Index] == nil {
+					continue
+				}
+				row := g.rows[fmt.Sprint(item[jf.Index])]
+				if row == nil {
+					continue
+				}
+				vf := row.fields[p.OutJoinDefine.ValueField]
+				if vf == nil {
+					logs.Error("ValueField错误没有找到字段" + p.OutJoinDefine.ValueField)
+					break
+				}
+				item[fd.Index] = row.data[vf.Index]
+			}
+		}
+	}
+}
+
+// cacheKey 返回键值在缓存中的名称
+func (c *outJoinGroup) cacheKey(key string) string {
+	k := "OutJoin_" + c.source.GetName() + "_"
+	if t, ok := c.source.(ITransactionDataSource); ok {
+		k += t.GetDBAlias() + "_"
+	}
+	return k + key
+}
+
+// lookup 查找键值对应的数据，先从缓存中查找，其余的键值一次查找
+func (c *outJoinGroup) lookup(keys []interface{}) error {
+	if c.expire > 0 {
+		missed := make([]interface{}, 0, len(keys))
+		for _, kv := range keys {
+			ks := fmt.Sprint(kv)
+			if v, ok := utils.DictDataCache.Get(c.cacheKey(ks)).(*outJoinRow); ok {
+				c.rows[ks] = v
+			} else {
+				missed = append(missed, kv)
+			}
+		}
+		keys = missed
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	found := make(map[string]*outJoinRow, len(keys))
+	var err error
+	switch s := c.source.(type) {
+	case *KeyStringSource:
+		err = c.lookupKeyString(s, keys, found)
+	case outJoinQuerySource:
+		if len(s.GetKeyFields()) == 1 {
+			err = c.lookupIn(s, keys, found)
+		} else {
+			err = c.lookupByKey(keys, found)
+		}
+	default:
+		err = c.lookupByKey(keys, found)
+	}
+	for ks, row := range found {
+		c.rows[ks] = row
+		if c.expire > 0 {
+			utils.DictDataCache.Put(c.cacheKey(ks), row, c.expire)
+		}
+	}
+	return err
+}
+
+// lookupKeyString 在KeyStringSource中查找
+func (c *outJoinGroup) lookupKeyString(s *KeyStringSource, keys []interface{}, found map[string]*outJoinRow) error {
+	vm := s.GetValueMap()
+	for _, kv := range keys {
+		ks := fmt.Sprint(kv)
+		if v, ok := vm[ks]; ok {
+			found[ks] = &outJoinRow{fields: s.fields, data: []interface{}{ks, v}}
+		}
+	}
+	return nil
+}
+
+// lookupIn 使用主键的IN条件查找，键值较多时分多次查询
+// 联接数据源可能被其他数据源共用，查找时不使用数据源原有的查询设定，查找后恢复
+func (c *outJoinGroup) lookupIn(s outJoinQuerySource, keys []interface{}, found map[string]*outJoinRow) error {
+	kf := s.GetKeyFields()[0].Name
+	defer s.resetQuery()()
+	for start := 0; start < len(keys); start += outJoinBatchSize {
+		end := start + outJoinBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		//清除上一次查询的IN条件
+		s.resetQuery()
+		s.AddCriteria(kf, OperIn, keys[start:end])
+		rs, err := s.DoFilter()
+		if err != nil {
+			return err
+		}
+		fd := rs.Fields[kf]
+		if fd == nil {
+			return fmt.Errorf("数据源" + s.GetName() + "的查询结果中没有主键字段" + kf)
+		}
+		for _, item := range rs.Data {
+			found[fmt.Sprint(item[fd.Index])] = &outJoinRow{fields: rs.Fields, data: item}
+		}
+	}
+	return nil
+}
+
+// lookupByKey 不能批量查找的数据源逐个键值查找
+func (c *outJoinGroup) lookupByKey(keys []interface{}, found map[string]*outJoinRow) error {
+	for _, kv := range keys {
+		rs, err := c.source.QueryDataByKey(kv)
+		if err != nil {
+			return err
+		}
+		if len(rs.Data) != 0 {
+			found[fmt.Sprint(kv)] = &outJoinRow{fields: rs.Fields, data: rs.Data[0]}
+		}
+	}
+	return nil
+}
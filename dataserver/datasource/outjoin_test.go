@@ -0,0 +1,175 @@
+package datasource
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingSource 记录查询次数的数据表数据源
+type countingSource struct {
+	*TableDataSource
+	queries int
+}
+
+func (c *countingSource) DoFilter() (*DataResultSet, error) {
+	c.queries++
+	return c.TableDataSource.DoFilter()
+}
+
+func (c *countingSource) QueryDataByKey(keyvalues ...interface{}) (*DataResultSet, error) {
+	c.queries++
+	return c.TableDataSource.QueryDataByKey(keyvalues...)
+}
+
+// createOutJoinDB 创建users个用户和orgs个机构，最后两个用户的机构不存在
+func createOutJoinDB(tb testing.TB, alias string, users, orgs int) func() {
+	var ou, uu strings.Builder
+	for i := 0; i < orgs; i++ {
+		fmt.Fprintf(&ou, ",('O%d','org%d')", i, i)
+	}
+	for i := 0; i < users; i++ {
+		switch i {
+		case users - 1:
+			fmt.Fprintf(&uu, ",('U%d','Y')", i)
+		case users - 2:
+			fmt.Fprintf(&uu, ",('U%d','X')", i)
+		default:
+			fmt.Fprintf(&uu, ",('U%d','O%d')", i, i%orgs)
+		}
+	}
+	_, clean := createTestDB(tb, alias,
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),PRIMARY KEY ("ORG_ID"))`,
+		`CREATE TABLE "JEDA_USER" ("USER_ID" varchar(50) NOT NULL,"ORG_ID" varchar(50),PRIMARY KEY ("USER_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES `+ou.String()[1:],
+		`INSERT INTO "JEDA_USER" VALUES `+uu.String()[1:])
+	return clean
+}
+
+// createOutJoinUsers 创建用户数据源，ORG_NAME字段通过联接机构数据源填充
+func createOutJoinUsers(alias string, orgs IDataSource, expire time.Duration, extra ...*MyProperty) *TableDataSource {
+	ids := &TableDataSource{
+		DBDataSource: DBDataSource{
+			DataSource: DataSource{
+				Name: "JEDA_USER",
+				Field: append([]*MyProperty{{Name: "USER_ID"}, {Name: "ORG_ID"},
+					{Name: "ORG_NAME", OutJoin: true, OutJoinDefine: &OutFieldProperty{
+						Source: orgs, JoinField: "ORG_ID", ValueField: "ORG_NAME", CacheExpire: expire}}}, extra...),
+			},
+			DBAlias: alias,
+		},
+		TableName: "JEDA_USER",
+	}
+	ids.Init()
+	return ids
+}
+
+func TestOutJoin(t *testing.T) {
+	defer createOutJoinDB(t, "outjointest", 100, 10)()
+	orgs := &countingSource{TableDataSource: CreateTableDataSource("JEDA_ORG", "outjointest", "JEDA_ORG")}
+	ks := &KeyStringSource{DataSource: DataSource{Name: "ORGDICT"}}
+	ks.Init()
+	ks.SetValueMap(map[string]string{"O1": "dict1", "O2": "dict2"})
+	users := createOutJoinUsers("outjointest", orgs, 0, &MyProperty{Name: "ORG_DICT", OutJoin: true,
+		OutJoinDefine: &OutFieldProperty{Source: ks, JoinField: "ORG_ID", ValueField: "VALUE"}})
+
+	rs, err := users.GetAllData()
+	if err != nil || len(rs.Data) != 100 {
+		t.Fatalf("GetAllData %v %v", rs, err)
+	}
+	// 不重复的键值通过一次IN查询查找
+	if orgs.queries != 1 {
+		t.Errorf("queries %d", orgs.queries)
+	}
+	name, dict := rs.Fields["ORG_NAME"].Index, rs.Fields["ORG_DICT"].Index
+	for i, r := range rs.Data {
+		switch {
+		case i >= 98:
+			if r[name] != nil || r[dict] != nil {
+				t.Errorf("missing key row %v", r)
+			}
+		case r[name] != fmt.Sprintf("org%d", i%10):
+			t.Errorf("row %v", r)
+		}
+	}
+	if rs.Data[1][dict] != "dict1" || rs.Data[3][dict] != nil {
+		t.Errorf("KeyStringSource rows %v %v", rs.Data[1], rs.Data[3])
+	}
+
+	// 逐行读取时按块批量查找
+	orgs.queries = 0
+	it, err := users.IterateAllData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for it.Next() {
+		if r := it.Row(); n < 98 && r[name] != fmt.Sprintf("org%d", n%10) {
+			t.Errorf("iterate row %v", r)
+		}
+		n++
+	}
+	it.Close()
+	if n != 100 || orgs.queries != 1 {
+		t.Errorf("iterate %d rows %d queries", n, orgs.queries)
+	}
+
+	// 查找时不使用联接数据源原有的查询条件和分页，查找后恢复
+	orgs.AddCriteria("ORG_ID", OperEq, "O1")
+	orgs.Orderby("ORG_NAME", "DESC")
+	orgs.SetRowsLimit(1)
+	orgs.SetRowsOffset(1)
+	if rs, err = createOutJoinUsers("outjointest", orgs, 0).GetAllData(); err != nil || rs.Data[5][name] != "org5" || rs.Data[0][name] != "org0" {
+		t.Errorf("shared source criteria applied %v", err)
+	}
+	orgs.SetRowsOffset(0)
+	if rs, err = orgs.DoFilter(); err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "O1" {
+		t.Errorf("shared source criteria not restored %v %v", rs, err)
+	}
+	orgs.ClearCriteria()
+	orgs.SetRowsLimit(0)
+
+	// 缓存查找结果，没有找到的键值不缓存
+	cusers := createOutJoinUsers("outjointest", orgs, time.Minute)
+	cusers.GetAllData()
+	orgs.queries = 0
+	if rs, err = cusers.GetAllData(); err != nil || rs.Data[5][name] != "org5" || orgs.queries != 1 {
+		t.Errorf("cached %v %d", err, orgs.queries)
+	}
+}
+
+func BenchmarkOutJoin(b *testing.B) {
+	defer createOutJoinDB(b, "outjoinbench", 5000, 100)()
+	orgs := CreateTableDataSource("JEDA_ORG", "outjoinbench", "JEDA_ORG")
+	// perrow 原来的处理方式，每一行查询一次联接数据源
+	b.Run("perrow", func(b *testing.B) {
+		users := CreateTableDataSource("JEDA_USER", "outjoinbench", "JEDA_USER")
+		for i := 0; i < b.N; i++ {
+			rs, err := users.GetAllData()
+			if err != nil {
+				b.Fatal(err)
+			}
+			org := rs.Fields["ORG_ID"].Index
+			for _, r := range rs.Data {
+				orgs.QueryDataByKey(r[org])
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		users := createOutJoinUsers("outjoinbench", orgs, 0)
+		for i := 0; i < b.N; i++ {
+			if _, err := users.GetAllData(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		users := createOutJoinUsers("outjoinbench", orgs, time.Minute)
+		for i := 0; i < b.N; i++ {
+			if _, err := users.GetAllData(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package datasource
+
+// QueryableDataSource 将只实现了IDataSource接口的数据源包装为IQueryableTableSource
+// 通过被包装数据源的GetAllData读取全部数据，在内存中处理查询条件、排序、分页和聚合
+type QueryableDataSource struct {
+	IDataSource
+	TableDataSourceCriteria
+	rowsLimit  int
+	rowsOffset int
+}
+
+// CreateQueryableDataSource 包装数据源
+func CreateQueryableDataSource(ids IDataSource) *QueryableDataSource {
+	return &QueryableDataSource{IDataSource: ids}
+}
+
+// AsQueryable 返回可以查询的数据源，数据源已经实现了IQueryableTableSource接口时直接返回，否则包装为QueryableDataSource
+func AsQueryable(ids IDataSource) IQueryableTableSource {
+	if q, ok := ids.(IQueryableTableSource); ok {
+		return q
+	}
+	return CreateQueryableDataSource(ids)
+}
+
+// Source 返回被包装的数据源
+func (c *QueryableDataSource) Source() IDataSource {
+	return c.IDataSource
+}
+
+// SetRowsLimit 设置返回的数据条数，不传递给被包装的数据源
+func (c *QueryableDataSource) SetRowsLimit(limit int) {
+	c.rowsLimit = limit
+}
+
+// SetRowsOffset 设置返回数据的偏移量，不传递给被包装的数据源
+func (c *QueryableDataSource) SetRowsOffset(offset int) {
+	c.rowsOffset = offset
+}
+
+// GetAllData 返回全部数据，使用排序和分页，不使用查询条件
+func (c *QueryableDataSource) GetAllData() (*DataResultSet, error) {
+	rs, err := c.IDataSource.GetAllData()
+	if err != nil {
+		return nil, err
+	}
+	return ApplyQuery(rs, &ResultSetQuery{OrderBy: c.orderlist, Limit: c.rowsLimit, Offset: c.rowsOffset})
+}
+
+// DoFilter 根据查询条件返回数据，依次处理条件、聚合、排序和分页
+func (c *QueryableDataSource) DoFilter() (*DataResultSet, error) {
+	rs, err := c.IDataSource.GetAllData()
+	if err != nil {
+		return nil, err
+	}
+	return ApplyQuery(rs, c.resultSetQuery(c.rowsLimit, c.rowsOffset))
+}
+
+// CountAll 返回全部数据的记录数
+func (c *QueryableDataSource) CountAll() (int64, error) {
+	rs, err := c.IDataSource.GetAllData()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(rs.Data)), nil
+}
+
+// CountFilter 返回满足查询条件的记录数，有聚合时返回分组的个数
+func (c *QueryableDataSource) CountFilter() (int64, error) {
+	rs, err := c.IDataSource.GetAllData()
+	if err != nil {
+		return 0, err
+	}
+	return CountQuery(rs, c.resultSetQuery(0, 0))
+}
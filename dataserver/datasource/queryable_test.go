@@ -0,0 +1,48 @@
+package datasource
+
+import (
+	"testing"
+)
+
+func TestQueryableDataSource(t *testing.T) {
+	ks := &KeyStringSource{}
+	ks.Init()
+	ks.SetValueMap(map[string]string{"1": "北京", "2": "北海", "3": "上海", "4": "北京"})
+	q := AsQueryable(ks)
+	if _, ok := q.(*QueryableDataSource); !ok || q.GetName() != ks.GetName() || len(q.GetFields()) != 2 {
+		t.Fatalf("AsQueryable %v", q)
+	}
+	q.AddCriteria("VALUE", OperStartsWith, "北").AndCriteria("KEY", OperNotIn, []string{"2"})
+	q.Orderby("KEY", "DESC")
+	q.SetRowsLimit(1)
+	rs, err := q.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][0] != "4" {
+		t.Errorf("DoFilter %v %v", rs, err)
+	}
+	cq := q.(ICountDataSource)
+	if n, err := cq.CountFilter(); err != nil || n != 2 {
+		t.Errorf("CountFilter %d %v", n, err)
+	}
+	if n, err := cq.CountAll(); err != nil || n != 4 {
+		t.Errorf("CountAll %d %v", n, err)
+	}
+	rs, err = q.GetAllData()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][0] != "4" {
+		t.Errorf("GetAllData %v %v", rs, err)
+	}
+
+	g := CreateQueryableDataSource(ks)
+	g.AddAggre("CNT", &AggreType{Predicate: AggCount, ColName: "*"})
+	g.SetGroupBy([]string{"VALUE"})
+	g.Orderby("CNT", "DESC")
+	rs, err = g.DoFilter()
+	if err != nil || len(rs.Data) != 3 || rs.Data[0][rs.Fields["VALUE"].Index] != "北京" || rs.Data[0][rs.Fields["CNT"].Index] != int64(2) {
+		t.Errorf("aggregate %v %v", rs, err)
+	}
+
+	// 已经可以查询的数据源直接返回
+	fds := &FileDataSource{}
+	if AsQueryable(fds) != IQueryableTableSource(fds) {
+		t.Error("queryable datasource wrapped")
+	}
+}
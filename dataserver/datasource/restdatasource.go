@@ -0,0 +1,485 @@
+package datasource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	// restDefaultTimeout 请求REST服务的默认超时时间
+	restDefaultTimeout = 30 * time.Second
+	// restErrorBodyLen 错误信息中返回的响应报文的最大长度
+	restErrorBodyLen = 200
+)
+
+// RestField REST数据源的字段定义
+type RestField struct {
+	// Name 字段名
+	Name string
+	// Path 字段在每行数据中的JSON路径，用.分隔，为空时与字段名相同
+	Path string
+	// DataType 字段类型，为空时保持JSON中的类型
+	DataType string
+	// Caption 显示名
+	Caption string
+	// Param 条件转换为请求参数时使用的参数名，为空时与字段名相同
+	Param string
+	// Key 是否为主键字段
+	Key bool
+}
+
+// RestDataSource 通过HTTP调用REST服务返回数据的数据源，返回的报文必须为JSON格式
+// 字段的等于和in条件转换为请求参数，URL模板中的{字段名}替换为该字段条件的值，其他条件、排序在内存中处理
+type RestDataSource struct {
+	DataSource
+	BaseCriteria
+	// URL 服务地址模板，如http://host/api/orgs/{ORG_ID}
+	URL string
+	// Method 请求方法，GET时参数放在查询字符串中，POST时参数为JSON报文，默认为GET
+	Method string
+	// Headers 请求头，如认证使用的Authorization
+	Headers map[string]string
+	// RowsPath 数据数组在返回的JSON中的路径，用.分隔，为空时返回的JSON就是数据，数据为对象时作为一行数据
+	RowsPath string
+	// Fields 字段定义
+	Fields []*RestField
+	// LimitParam、OffsetParam 分页使用的参数名，没有定义时在内存中分页，只定义了LimitParam时只有偏移量为0的分页由服务处理
+	LimitParam  string
+	OffsetParam string
+	// Client 发送请求使用的客户端，为nil时使用默认超时时间的客户端
+	Client *http.Client
+
+	rowsLimit  int
+	rowsOffset int
+}
+
+// CreateRestDataSource 根据数据源元数据创建REST数据源，元数据格式为：
+// {"url":"http://host/api/orgs","method":"GET","headers":{"Authorization":"Bearer xxx"},"rowspath":"data.items",
+// "fields":[{"name":"ORG_ID","path":"id","type":"STRING","key":true,"param":"id"}],"limitparam":"limit","offsetparam":"offset","timeout":10}
+func CreateRestDataSource(name string, meta map[string]interface{}) (*RestDataSource, error) {
+	c := &RestDataSource{DataSource: DataSource{Name: name}}
+	c.URL, _ = meta["url"].(string)
+	c.Method, _ = meta["method"].(string)
+	c.RowsPath, _ = meta["rowspath"].(string)
+	c.LimitParam, _ = meta["limitparam"].(string)
+	c.OffsetParam, _ = meta["offsetparam"].(string)
+	if hs, ok := meta["headers"].(map[string]interface{}); ok {
+		c.Headers = make(map[string]string, len(hs))
+		for k, v := range hs {
+			c.Headers[k] = fmt.Sprint(v)
+		}
+	}
+	if t, ok := meta["timeout"].(float64); ok && t > 0 {
+		c.Client = &http.Client{Timeout: time.Duration(t * float64(time.Second))}
+	}
+	fs, ok := meta["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("REST数据源" + name + "的fields节点格式不正确")
+	}
+	for _, item := range fs {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("REST数据源" + name + "的fields节点格式不正确")
+		}
+		f := &RestField{}
+		f.Name, _ = m["name"].(string)
+		f.Path, _ = m["path"].(string)
+		f.DataType, _ = m["type"].(string)
+		f.Caption, _ = m["caption"].(string)
+		f.Param, _ = m["param"].(string)
+		f.Key, _ = m["key"].(bool)
+		c.Fields = append(c.Fields, f)
+	}
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Init 检查定义并生成字段信息
+func (c *RestDataSource) Init() error {
+	if c.URL == "" {
+		return fmt.Errorf("REST数据源" + c.Name + "没有定义url")
+	}
+	c.Method = strings.ToUpper(c.Method)
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+	if c.Method != http.MethodGet && c.Method != http.MethodPost {
+		return fmt.Errorf("REST数据源" + c.Name + "的method只能为GET或POST")
+	}
+	if len(c.Fields) == 0 {
+		return fmt.Errorf("REST数据源" + c.Name + "没有定义字段")
+	}
+	c.Field = make([]*MyProperty, 0, len(c.Fields))
+	c.KeyField = make([]*MyProperty, 0, 1)
+	for _, f := range c.Fields {
+		if !IsValidIdentifier(f.Name) {
+			return fmt.Errorf("REST数据源%s的字段名不合法：%s", c.Name, f.Name)
+		}
+		p := &MyProperty{Name: f.Name, DataType: f.DataType, Caption: f.Caption}
+		c.Field = append(c.Field, p)
+		if f.Key {
+			c.KeyField = append(c.KeyField, p)
+		}
+	}
+	return nil
+}
+
+// GetDataSourceType 返回数据源类型
+func (c *RestDataSource) GetDataSourceType() DSType {
+	return DataSourceTypeRest
+}
+
+// GetKeyFields 返回主键字段
+func (c *RestDataSource) GetKeyFields() []*MyProperty {
+	return c.KeyField
+}
+
+// SetRowsLimit 设置返回的数据条数
+func (c *RestDataSource) SetRowsLimit(limit int) {
+	c.rowsLimit = limit
+}
+
+// SetRowsOffset 设置返回数据的偏移量
+func (c *RestDataSource) SetRowsOffset(offset int) {
+	c.rowsOffset = offset
+}
+
+// getRestField 根据字段名返回字段定义
+func (c *RestDataSource) getRestField(name string) *RestField {
+	for _, f := range c.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// GetAllData 返回全部数据，不使用查询条件
+func (c *RestDataSource) GetAllData() (*DataResultSet, error) {
+	return c.query(false)
+}
+
+// DoFilter 根据查询条件返回数据
+func (c *RestDataSource) DoFilter() (*DataResultSet, error) {
+	return c.query(true)
+}
+
+// QueryDataByKey 根据主键返回数据
+func (c *RestDataSource) QueryDataByKey(keyvalues ...interface{}) (*DataResultSet, error) {
+	if len(keyvalues) == 0 || len(keyvalues) != len(c.KeyField) {
+		return nil, fmt.Errorf("REST数据源" + c.Name + "的主键值个数与主键字段个数不一致")
+	}
+	fv := make(map[string]interface{}, len(keyvalues))
+	for i, v := range keyvalues {
+		fv[c.KeyField[i].Name] = v
+	}
+	return c.QueryDataByFieldValues(fv)
+}
+
+// QueryDataByFieldValues 根据字段值返回数据
+func (c *RestDataSource) QueryDataByFieldValues(fv map[string]interface{}) (*DataResultSet, error) {
+	c.ClearCriteria()
+	for pname, value := range fv {
+		c.AndCriteria(pname, OperEq, value)
+	}
+	return c.DoFilter()
+}
+
+// formatRestParam 将条件的值转换为查询字符串中的参数值，数组用逗号连接
+func formatRestParam(v interface{}) string {
+	switch val := v.(type) {
+	case time.Time:
+		if val.Hour() == 0 && val.Minute() == 0 && val.Second() == 0 {
+			return val.Format("2006-01-02")
+		}
+		return val.Format("2006-01-02 15:04:05")
+	case string:
+		return val
+	}
+	vs := criteriaValues(v)
+	if len(vs) == 1 {
+		return fmt.Sprint(vs[0])
+	}
+	ss := make([]string, len(vs), len(vs))
+	for i, item := range vs {
+		ss[i] = formatRestParam(item)
+	}
+	return strings.Join(ss, ",")
+}
+
+// createRestParams 将与关系的等于和in条件转换为请求参数，返回false时还有需要在内存中处理的条件
+func (c *RestDataSource) createRestParams(filter []*TDFilter) (map[string]interface{}, bool, error) {
+	params := make(map[string]interface{})
+	for i, item := range filter {
+		//有或关系的条件时全部在内存中处理
+		if i != 0 && item.Complex == CompOr {
+			return params, false, nil
+		}
+	}
+	remote := true
+	for _, item := range filter {
+		if item.Children != nil || item.Not || (item.Operation != OperEq && item.Operation != OperIn) {
+			remote = false
+			continue
+		}
+		f := c.getRestField(item.PropertyName)
+		if f == nil {
+			return nil, false, fmt.Errorf("REST数据源%s中没有字段%s", c.Name, item.PropertyName)
+		}
+		name := f.Param
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := params[name]; ok {
+			remote = false
+			continue
+		}
+		params[name] = item.Value
+	}
+	return params, remote, nil
+}
+
+// createRestURL 根据地址模板和参数生成请求的地址，模板中使用的参数从params中删除
+func (c *RestDataSource) createRestURL(params map[string]interface{}) (string, error) {
+	u := c.URL
+	for {
+		start := strings.Index(u, "{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(u[start:], "}")
+		if end == -1 {
+			return "", fmt.Errorf("REST数据源" + c.Name + "的url模板格式不正确")
+		}
+		name := u[start+1 : start+end]
+		v, ok := params[name]
+		if !ok {
+			if f := c.getRestField(name); f != nil && f.Param != "" {
+				v, ok = params[f.Param]
+				name = f.Param
+			}
+		}
+		if !ok {
+			return "", fmt.Errorf("REST数据源%s的url中的参数%s没有对应的等于条件", c.Name, name)
+		}
+		delete(params, name)
+		u = u[:start] + url.PathEscape(formatRestParam(v)) + u[start+end+1:]
+	}
+	return u, nil
+}
+
+// doRequest 发送请求并返回解析后的JSON
+func (c *RestDataSource) doRequest(params map[string]interface{}) (interface{}, error) {
+	u, err := c.createRestURL(params)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if c.Method == http.MethodPost {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	} else if len(params) != 0 {
+		q := url.Values{}
+		for k, v := range params {
+			q.Set(k, formatRestParam(v))
+		}
+		if strings.Contains(u, "?") {
+			u += "&" + q.Encode()
+		} else {
+			u += "?" + q.Encode()
+		}
+	}
+	req, err := http.NewRequest(c.Method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	logs.Debug(c.Method + " " + u)
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: restDefaultTimeout}
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求REST数据源%s时发生错误：%s", c.Name, err.Error())
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, restErrorBodyLen))
+		return nil, fmt.Errorf("REST数据源%s返回错误状态%d：%s", c.Name, rsp.StatusCode, string(b))
+	}
+	var result interface{}
+	dec := json.NewDecoder(rsp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析REST数据源%s返回的JSON时发生错误：%s", c.Name, err.Error())
+	}
+	return result, nil
+}
+
+// getJSONPath 返回JSON中指定路径的值，路径用.分隔，数组使用数字下标
+func getJSONPath(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, p := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[p]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// convertRestValue 将JSON中的值转换为字段类型
+func convertRestValue(v interface{}, dataType string) (interface{}, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		switch dataType {
+		case PropertyDatatypeStr:
+			return val.String(), nil
+		case PropertyDatatypeDou:
+			return val.Float64()
+		}
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := val.Float64()
+		if err == nil && dataType == PropertyDatatypeInt {
+			return int64(f), nil
+		}
+		return f, err
+	case string:
+		switch dataType {
+		case PropertyDatatypeInt:
+			return strconv.ParseInt(val, 10, 64)
+		case PropertyDatatypeDou:
+			return ConvertString2Type(val, dataType)
+		case PropertyDatatypeDate, PropertyDatatypeTime:
+			if t, err := time.Parse(time.RFC3339, val); err == nil {
+				return t, nil
+			}
+			return ConvertString2Type(val, dataType)
+		}
+		return val, nil
+	}
+	if dataType == PropertyDatatypeStr {
+		if _, ok := v.(bool); ok {
+			return fmt.Sprint(v), nil
+		}
+	}
+	return v, nil
+}
+
+// createResultSet 将返回的JSON转换为结果集
+func (c *RestDataSource) createResultSet(v interface{}) (*DataResultSet, error) {
+	rows, ok := getJSONPath(v, c.RowsPath)
+	if !ok {
+		return nil, fmt.Errorf("REST数据源%s返回的JSON中没有%s节点", c.Name, c.RowsPath)
+	}
+	var items []interface{}
+	switch r := rows.(type) {
+	case []interface{}:
+		items = r
+	case map[string]interface{}:
+		items = []interface{}{r}
+	case nil:
+		items = []interface{}{}
+	default:
+		return nil, fmt.Errorf("REST数据源%s返回的数据不是数组或对象", c.Name)
+	}
+	rs := &DataResultSet{Fields: make(FieldDescType), Data: make([][]interface{}, 0, len(items))}
+	for i, f := range c.Fields {
+		rs.Fields[f.Name] = &FieldDesc{FieldType: f.DataType, Index: i}
+	}
+	for _, item := range items {
+		row := make([]interface{}, len(c.Fields), len(c.Fields))
+		for i, f := range c.Fields {
+			path := f.Path
+			if path == "" {
+				path = f.Name
+			}
+			fv, _ := getJSONPath(item, path)
+			var err error
+			if row[i], err = convertRestValue(fv, f.DataType); err != nil {
+				return nil, fmt.Errorf("REST数据源%s的字段%s的值%v转换失败：%s", c.Name, f.Name, fv, err.Error())
+			}
+		}
+		rs.Data = append(rs.Data, row)
+	}
+	return rs, nil
+}
+
+// query 查询数据，可以转换为请求参数的条件发送给服务，全部条件、排序和分页在内存中处理
+// 全部条件都转换为请求参数并且没有排序时，定义了分页参数则由服务分页，有偏移量但是没有定义OffsetParam时在内存中分页
+func (c *RestDataSource) query(useCriteria bool) (*DataResultSet, error) {
+	var filter []*TDFilter
+	if useCriteria {
+		filter = c.filter
+	}
+	if err := c.checkCriteria(filter, c.orderlist); err != nil {
+		return nil, err
+	}
+	params, remote, err := c.createRestParams(filter)
+	if err != nil {
+		return nil, err
+	}
+	remotePage := remote && len(c.orderlist) == 0 && c.LimitParam != "" && c.rowsLimit != 0 &&
+		(c.rowsOffset == 0 || c.OffsetParam != "")
+	if remotePage {
+		params[c.LimitParam] = c.rowsLimit
+		if c.rowsOffset != 0 {
+			params[c.OffsetParam] = c.rowsOffset
+		}
+	}
+	v, err := c.doRequest(params)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := c.createResultSet(v)
+	if err != nil {
+		return nil, err
+	}
+	q := &ResultSetQuery{OrderBy: c.orderlist}
+	if len(filter) != 0 {
+		q.Criteria = c.sqlCriteria()
+	}
+	if !remotePage {
+		q.Limit, q.Offset = c.rowsLimit, c.rowsOffset
+	}
+	return ApplyQuery(rs, q)
+}
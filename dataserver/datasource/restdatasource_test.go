@@ -0,0 +1,145 @@
+package datasource
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRestDataSource(t *testing.T) {
+	orgs := []map[string]interface{}{
+		{"id": "A", "name": "orgA", "order": 3, "info": map[string]interface{}{"created": "2020-01-01"}},
+		{"id": "B", "name": "orgB", "order": 1, "info": map[string]interface{}{"created": "2020-01-02T08:00:00Z"}},
+		{"id": "C", "name": "orgC", "order": 2},
+	}
+	var lastQuery string
+	var lastBody map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("unauthorized"))
+			return
+		}
+		lastQuery = r.URL.RawQuery
+		lastBody = nil
+		if r.Method == http.MethodPost {
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &lastBody)
+		}
+		switch r.URL.Path {
+		case "/orgs":
+			rows := orgs
+			if id := r.URL.Query().Get("id"); id != "" {
+				rows = nil
+				for _, o := range orgs {
+					if o["id"] == id {
+						rows = append(rows, o)
+					}
+				}
+			}
+			if l := r.URL.Query().Get("limit"); l != "" {
+				n, _ := strconv.Atoi(l)
+				off, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				rows = rows[off : off+n]
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"items": rows}})
+		case "/orgs/B":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"items": orgs[1]}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	meta := func(url, method string) map[string]interface{} {
+		var m map[string]interface{}
+		json.Unmarshal([]byte(`{"method":"`+method+`","headers":{"Authorization":"Bearer token"},"rowspath":"data.items",
+			"limitparam":"limit","offsetparam":"offset","timeout":5,
+			"fields":[{"name":"ORG_ID","path":"id","key":true,"param":"id"},{"name":"ORG_NAME","path":"name"},
+			{"name":"ORG_ORDER","path":"order","type":"INT"},{"name":"CREATED","path":"info.created","type":"DATE"}]}`), &m)
+		m["url"] = url
+		return m
+	}
+	ds, err := CreateRestDataSource("orgs", meta(srv.URL+"/orgs", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.GetDataSourceType() != DataSourceTypeRest || len(ds.GetKeyFields()) != 1 || len(ds.GetFields()) != 4 {
+		t.Fatalf("fields %v %v", ds.GetKeyFields(), ds.GetFields())
+	}
+
+	rs, err := ds.QueryDataByKey("C")
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ORDER"].Index] != int64(2) || rs.Data[0][rs.Fields["CREATED"].Index] != nil {
+		t.Fatalf("QueryDataByKey %v %v", rs, err)
+	}
+	if lastQuery != "id=C" {
+		t.Errorf("query string %s", lastQuery)
+	}
+
+	// 非等于条件和排序在内存中处理，分页也在内存中处理
+	ds.ClearCriteria()
+	ds.AddCriteria("ORG_ORDER", OperGt, 1)
+	ds.Orderby("ORG_ORDER", "ASC")
+	ds.SetRowsLimit(1)
+	ds.SetRowsOffset(1)
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "A" || lastQuery != "" {
+		t.Errorf("filter %v %v %s", rs, err, lastQuery)
+	}
+	// 全部条件都转换为参数时由服务分页
+	ds, _ = CreateRestDataSource("orgs", meta(srv.URL+"/orgs", ""))
+	ds.SetRowsLimit(1)
+	ds.SetRowsOffset(1)
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "B" || lastQuery != "limit=1&offset=1" {
+		t.Errorf("remote paging %v %v %s", rs, err, lastQuery)
+	}
+	// 没有定义偏移量参数时有偏移量的分页在内存中处理
+	ds.OffsetParam = ""
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "B" || lastQuery != "" {
+		t.Errorf("paging without offset param %v %v %s", rs, err, lastQuery)
+	}
+	ds.SetRowsOffset(0)
+	rs, err = ds.DoFilter()
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["ORG_ID"].Index] != "A" || lastQuery != "limit=1" {
+		t.Errorf("first page without offset param %v %v %s", rs, err, lastQuery)
+	}
+	ds.SetRowsLimit(0)
+	rs, err = ds.GetAllData()
+	if err != nil || len(rs.Data) != 3 {
+		t.Errorf("GetAllData %v %v", rs, err)
+	}
+
+	// url模板中的参数和POST报文
+	pds, err := CreateRestDataSource("org", meta(srv.URL+"/orgs/{ORG_ID}", "post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err = pds.QueryDataByFieldValues(map[string]interface{}{"ORG_ID": "B", "ORG_NAME": "orgB"})
+	if err != nil || len(rs.Data) != 1 || rs.Data[0][rs.Fields["CREATED"].Index] == nil || lastBody["ORG_NAME"] != "orgB" || len(lastBody) != 1 {
+		t.Errorf("url template %v %v %v", rs, err, lastBody)
+	}
+	pds.ClearCriteria()
+	if _, err = pds.DoFilter(); err == nil {
+		t.Error("url template without value accepted")
+	}
+
+	// 错误状态和错误的定义
+	ds.Headers = nil
+	if _, err = ds.GetAllData(); err == nil {
+		t.Error("error status accepted")
+	}
+	for _, m := range []map[string]interface{}{
+		{"url": srv.URL},
+		{"url": srv.URL, "method": "PUT", "fields": []interface{}{map[string]interface{}{"name": "A"}}},
+		{"url": srv.URL, "fields": []interface{}{map[string]interface{}{"name": "A;"}}},
+	} {
+		if _, err := CreateRestDataSource("bad", m); err == nil {
+			t.Errorf("invalid meta %v accepted", m)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package datasource
+
+import "database/sql"
+
+// rowIterator 逐行读取查询结果的迭代器，每次只在内存中保留一行数据
+type rowIterator struct {
+	ds   *DBDataSource
+	rows *sql.Rows
+	cols []string
+	// fm 查询结果中的字段
+	fm FieldDescType
+	// fields 返回的字段，定义了数据源字段时与数据源字段一致
+	fields FieldDescType
+	// extra 查询结果中数据源字段以外的字段
+	extra []string
+	// ofs 通过Join加载其他数据源的字段
+	ofs []*MyProperty
+	// deferOutJoin 为true时不填充联接字段，由调用者读取全部数据后批量填充
+	deferOutJoin bool
+	// outJoin 按块填充联接字段，查找过的键值不再查找
+	outJoin *outJoinResolver
+	// buf 存在联接字段时预先读取的一块数据，整块批量填充联接字段
+	buf  [][]interface{}
+	pos  int
+	refs []interface{}
+	row  []interface{}
+	err  error
+}
+
+// Fields 返回结果集的字段
+func (c *rowIterator) Fields() FieldDescType {
+	return c.fields
+}
+
+// Next 读取下一行数据，没有数据或发生错误时返回false
+// 存在联接字段时每次预先读取outJoinBatchSize行数据，使用一次IN查询填充这些数据的联接字段
+func (c *rowIterator) Next() bool {
+	if c.pos < len(c.buf) {
+		c.row = c.buf[c.pos]
+		c.pos++
+		return true
+	}
+	c.buf, c.pos = c.buf[:0], 0
+	for len(c.buf) < outJoinBatchSize {
+		item := c.readRow()
+		if item == nil {
+			break
+		}
+		c.buf = append(c.buf, item)
+		if len(c.ofs) == 0 || c.deferOutJoin {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return false
+	}
+	if len(c.ofs) != 0 && !c.deferOutJoin {
+		if c.outJoin == nil {
+			c.outJoin = newOutJoinResolver(c.fields, c.ofs)
+		}
+		c.outJoin.fill(c.buf)
+	}
+	c.row = c.buf[0]
+	c.pos = 1
+	return true
+}
+
+// readRow 从查询结果中读取一行数据，没有数据或发生错误时返回nil
+func (c *rowIterator) readRow() []interface{} {
+	if c.err != nil || !c.rows.Next() {
+		return nil
+	}
+	if err := c.rows.Scan(c.refs...); err != nil {
+		c.err = err
+		return nil
+	}
+	item, ofs := c.ds.getRecordByRef(c.refs, c.cols, &c.fm)
+	if len(ofs) != 0 {
+		//存在通过Join加载其他数据源的字段
+		c.ofs = ofs
+	}
+	for _, col := range c.extra {
+		item = append(item, c.ds.convertData(*c.refs[c.fm[col].Index].(*interface{}), c.fm[col].FieldType))
+	}
+	return item
+}
+
+// Row 返回当前行的数据
+func (c *rowIterator) Row() []interface{} {
+	return c.row
+}
+
+// Err 返回读取数据时发生的错误
+func (c *rowIterator) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+// Close 关闭迭代器，释放数据库连接
+func (c *rowIterator) Close() error {
+	return c.rows.Close()
+}
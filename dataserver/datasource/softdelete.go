@@ -0,0 +1,130 @@
+package datasource
+
+import (
+	"fmt"
+)
+
+// SoftDeleteDefine 软删除定义，删除数据时将Field字段更新为Value
+type SoftDeleteDefine struct {
+	// Field 删除标记字段
+	Field string
+	// Value 已经删除的数据的标记值
+	Value interface{}
+	// RestoreValue 恢复数据时删除标记字段的值，为nil时更新为null
+	RestoreValue interface{}
+}
+
+// CreateSoftDeleteDefine 根据数据源元数据中的softdelete节点创建软删除定义
+// {"field":"DELETED","value":1,"restorevalue":0}
+func CreateSoftDeleteDefine(meta interface{}) (*SoftDeleteDefine, error) {
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("softdelete节点格式不正确")
+	}
+	field, _ := m["field"].(string)
+	if !IsValidIdentifier(field) {
+		return nil, fmt.Errorf("softdelete节点的field不是合法的字段名：%v", m["field"])
+	}
+	if m["value"] == nil {
+		return nil, fmt.Errorf("softdelete节点没有定义value")
+	}
+	return &SoftDeleteDefine{Field: field, Value: m["value"], RestoreValue: m["restorevalue"]}, nil
+}
+
+// IsSoftDelete 是否使用软删除
+func (c *TableDataSource) IsSoftDelete() bool {
+	return c.SoftDelete != nil
+}
+
+// SetWithDeleted 设定查询时是否包括已经删除的数据
+func (c *TableDataSource) SetWithDeleted(withDeleted bool) {
+	c.withDeleted = withDeleted
+}
+
+// IsWithDeleted 查询时是否包括已经删除的数据
+func (c *TableDataSource) IsWithDeleted() bool {
+	return c.withDeleted
+}
+
+// deletedCriteria 已经删除的数据的条件
+func (c *TableDataSource) deletedCriteria() *SQLCriteria {
+	return &SQLCriteria{PropertyName: c.SoftDelete.Field, Operation: OperEq, Value: c.SoftDelete.Value}
+}
+
+// notDeletedGroup 没有删除的数据的条件组，删除标记字段为null或者不等于标记值的数据为没有删除的数据
+func (c *TableDataSource) notDeletedGroup() *SQLCriteria {
+	return &SQLCriteria{
+		Complex: CompAnd,
+		Children: []*SQLCriteria{
+			{PropertyName: c.SoftDelete.Field, Operation: OperIsNull, Complex: CompNone},
+			{PropertyName: c.SoftDelete.Field, Operation: OperNoteq, Value: c.SoftDelete.Value, Complex: CompOr},
+		},
+	}
+}
+
+// notDeletedCriteria 返回排除已经删除的数据的条件，没有使用软删除或者设定了包括已经删除的数据时返回nil
+func (c *TableDataSource) notDeletedCriteria() []*SQLCriteria {
+	if c.SoftDelete == nil || c.withDeleted {
+		return nil
+	}
+	return []*SQLCriteria{c.notDeletedGroup()}
+}
+
+// softDelete 将满足条件并且没有删除的数据标记为已经删除，values为同时更新的其他字段
+func (c *WriteableTableSource) softDelete(extra []*SQLCriteria, values map[string]interface{}) (*WriteResult, error) {
+	sqlb, err := c.createWriteSQLBuilderWith(append([]*SQLCriteria{c.notDeletedGroup()}, extra...))
+	if err != nil {
+		return nil, err
+	}
+	vs := map[string]interface{}{c.SoftDelete.Field: c.SoftDelete.Value}
+	for k, v := range values {
+		vs[k] = v
+	}
+	sql, ps := sqlb.CreateUpdateSQL(vs)
+	return c.execSQL(sql, ps...)
+}
+
+// Restore 恢复满足条件的已经删除的数据，返回恢复的行数
+func (c *WriteableTableSource) Restore() (*WriteResult, error) {
+	if c.SoftDelete == nil {
+		return nil, fmt.Errorf("数据源%s没有使用软删除，不能恢复数据", c.Name)
+	}
+	if err := c.checkVersion(); err != nil {
+		return nil, err
+	}
+	return c.restore(nil, nil)
+}
+
+// RestoreVersion 恢复满足条件并且版本为version的已经删除的数据，版本字段更新为新的版本，没有数据被恢复时返回ErrVersionConflict
+func (c *WriteableTableSource) RestoreVersion(version interface{}) (*WriteResult, error) {
+	if c.SoftDelete == nil {
+		return nil, fmt.Errorf("数据源%s没有使用软删除，不能恢复数据", c.Name)
+	}
+	if c.VersionField == "" {
+		return nil, fmt.Errorf("数据源%s没有设定版本字段", c.Name)
+	}
+	next, err := c.nextVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.restore([]*SQLCriteria{{PropertyName: c.VersionField, Operation: OperEq, Value: version}},
+		map[string]interface{}{c.VersionField: next})
+	if err == nil && r.RowsAffected == 0 {
+		return nil, ErrVersionConflict
+	}
+	return r, err
+}
+
+// restore 将满足条件并且已经删除的数据恢复，values为同时更新的其他字段
+func (c *WriteableTableSource) restore(extra []*SQLCriteria, values map[string]interface{}) (*WriteResult, error) {
+	sqlb, err := c.createWriteSQLBuilderWith(append([]*SQLCriteria{c.deletedCriteria()}, extra...))
+	if err != nil {
+		return nil, err
+	}
+	vs := map[string]interface{}{c.SoftDelete.Field: c.SoftDelete.RestoreValue}
+	for k, v := range values {
+		vs[k] = v
+	}
+	sql, ps := sqlb.CreateUpdateSQL(vs)
+	return c.execSQL(sql, ps...)
+}
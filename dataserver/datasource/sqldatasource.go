@@ -40,7 +40,7 @@ func (c *SQLDataSource) Init() error {
 	return nil
 }
 func (c *SQLDataSource) fillFields() error {
-	sqlb, err := CreateSQLBuileder2ObjectTable(DBAlias2DBTypeContainer[c.DBAlias], c.SQL, c.Name, c.convertPropertys2Cols(c.Field), c.orderlist, c.RowsLimit, c.RowsOffset)
+	sqlb, err := CreateSQLBuileder2ObjectTable(DBAlias2DBTypeContainer[c.DBAlias], c.SQL, c.Name, c.selectColumns(c.convertPropertys2Cols(c.Field)), c.orderlist, c.RowsLimit, c.RowsOffset)
 
 	sqlstr, _ := sqlb.CreateSelectSQL()
 	rs, err := c.querySQLData(sqlstr, c.ParamsValues...)
@@ -52,7 +52,7 @@ func (c *SQLDataSource) fillFields() error {
 	for k, v := range fds {
 		c.Field[v.Index] = &MyProperty{
 			Name:     k,
-			DataType: ConvertMySQLType2CommonType(v.FieldType),
+			DataType: v.FieldType,
 		}
 	}
 	return nil
@@ -83,27 +83,85 @@ func (c *SQLDataSource) QueryDataByKey(keyvalues ...interface{}) (*DataResultSet
 }
 
 func (c *SQLDataSource) createSQLBuilder() ISQLBuilder {
-	sqlb, _ := CreateSQLBuileder2ObjectTable(DBAlias2DBTypeContainer[c.DBAlias], c.SQL, c.Name, c.convertPropertys2Cols(c.Field), c.orderlist, c.RowsLimit, c.RowsOffset)
+	sqlb, _ := CreateSQLBuileder2ObjectTable(DBAlias2DBTypeContainer[c.DBAlias], c.SQL, c.Name, c.selectColumns(c.convertPropertys2Cols(c.Field)), c.orderlist, c.RowsLimit, c.RowsOffset)
 	return sqlb
 }
 
 //返回全部数据
 func (c *SQLDataSource) GetAllData() (*DataResultSet, error) {
+	if err := c.checkCriteria(nil, c.orderlist); err != nil {
+		return nil, err
+	}
 	sqlstr, _ := c.createSQLBuilder().CreateSelectSQL()
 	return c.querySQLData(sqlstr, c.ParamsValues...)
 }
 
+// IterateAllData 逐行读取全部数据
+func (c *SQLDataSource) IterateAllData() (IRowIterator, error) {
+	if err := c.checkCriteria(nil, c.orderlist); err != nil {
+		return nil, err
+	}
+	sqlstr, _ := c.createSQLBuilder().CreateSelectSQL()
+	return c.queryRows(sqlstr, c.ParamsValues...)
+}
+
 func (c *SQLDataSource) DoFilter() (*DataResultSet, error) {
+	sqlstr, param, err := c.createFilterSQL()
+	if err != nil {
+		return nil, err
+	}
+	return c.querySQLData(sqlstr, param...)
+}
+
+// IterateFilter 逐行读取满足查询条件的数据
+func (c *SQLDataSource) IterateFilter() (IRowIterator, error) {
+	sqlstr, param, err := c.createFilterSQL()
+	if err != nil {
+		return nil, err
+	}
+	return c.queryRows(sqlstr, param...)
+}
 
+// createFilterSQL 生成根据查询条件返回数据的语句，参数包括SQL语句的参数
+func (c *SQLDataSource) createFilterSQL() (string, []interface{}, error) {
+	if err := c.checkCriteria(c.filter, c.orderlist); err != nil {
+		return "", nil, err
+	}
+	if err := c.checkAggre(c.aggre, c.groupby); err != nil {
+		return "", nil, err
+	}
 	sqlb := c.createSQLBuilder()
 	sqlb.ClearCriteria()
-	for _, item := range c.filter {
-		sqlb.AddCriteria(item.PropertyName, item.Operation, item.Complex, item.Value)
-	}
+	c.fillSQLBuilderCriteria(sqlb)
 	for k, item := range c.aggre {
 		sqlb.AddAggre(k, item)
 	}
 	sqlstr, param := sqlb.CreateSelectSQL()
-	p := append(c.ParamsValues, param...)
-	return c.querySQLData(sqlstr, p...)
+	p := append(append([]interface{}{}, c.ParamsValues...), param...)
+	return sqlstr, p, nil
+}
+
+// CountAll 返回全部数据的记录数
+func (c *SQLDataSource) CountAll() (int64, error) {
+	sqlstr, _ := c.createSQLBuilder().CreateCountSQL()
+	return c.countSQL(sqlstr, c.ParamsValues...)
+}
+
+// CountFilter 返回满足查询条件的记录数，忽略分页和排序，有聚合时返回分组的个数
+func (c *SQLDataSource) CountFilter() (int64, error) {
+	if err := c.checkCriteria(c.filter, nil); err != nil {
+		return 0, err
+	}
+	if err := c.checkAggre(c.aggre, c.groupby); err != nil {
+		return 0, err
+	}
+	sqlb := c.createSQLBuilder()
+	sqlb.ClearCriteria()
+	c.fillSQLBuilderCriteria(sqlb)
+	for k, item := range c.aggre {
+		sqlb.AddAggre(k, item)
+	}
+	sqlstr, param := sqlb.CreateCountSQL()
+	p := append(append([]interface{}{}, c.ParamsValues...), param...)
+	return c.countSQL(sqlstr, p...)
 }
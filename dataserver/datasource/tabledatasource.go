@@ -14,26 +14,118 @@ type TableDataSource struct {
 	DBDataSource
 	TableName string
 	joinpiece []*PieceJoin
+	// SoftDelete 软删除定义，不为nil时删除操作只标记数据，查询时排除已经删除的数据
+	SoftDelete *SoftDeleteDefine
+	// withDeleted 为true时查询包括已经删除的数据
+	withDeleted bool
+	// keyset 游标分页条件
+	keyset *KeysetValue
 }
 
+// joinedTableSource 可以参与连接的数据表数据源
+type joinedTableSource interface {
+	IDataSource
+	GetTableName() string
+	GetDBAlias() string
+}
+
+// GetTableName 返回数据库表名
+func (c *TableDataSource) GetTableName() string {
+	return c.TableName
+}
+
+// JoinDataSource 连接另一个数据表数据源，outfield为输出的连接表字段，返回用于添加连接条件的接口
+// ds必须是使用同一个数据库别名的数据表数据源，否则panic，需要处理错误时使用JoinTable
 func (c *TableDataSource) JoinDataSource(join string, ds ICriteriaDataSource, outfield []string) IAddCriteria {
-	var inf interface{}
-	inf = ds
-	dts, ok := inf.(TableDataSource)
+	p, err := c.JoinTable(join, ds, "", outfield, nil)
+	if err != nil {
+		logs.Error(err.Error())
+		panic(err.Error())
+	}
+	return p
+}
+
+// JoinTable 连接另一个数据表数据源，join为INNER_JOIN或INNER_LEFT，alias为连接表在语句中的别名，为空时使用表名
+// outfield为输出的连接表字段，outalias为对应的输出字段名，为空时使用字段名
+// 连接条件通过返回值的AddCriteria方法添加，引用主表或者之前连接的表的字段时值使用*FieldNameWithTableName
+// 连接后查询条件、排序和聚合中可以使用“别名.字段名”引用连接表的字段
+func (c *TableDataSource) JoinTable(join string, ds ICriteriaDataSource, alias string, outfield, outalias []string) (*PieceJoin, error) {
+	dts, ok := ds.(joinedTableSource)
 	if !ok {
-		logs.Error("'ds ICriteriaDataSource' param must be TableDataSource")
-		panic("'ds ICriteriaDataSource' param must be TableDataSource")
+		return nil, fmt.Errorf("数据源" + ds.GetName() + "不是数据表数据源，不能连接")
+	}
+	if dts.GetDBAlias() != c.DBAlias {
+		return nil, fmt.Errorf("数据源" + ds.GetName() + "与" + c.Name + "使用的数据库不同，不能连接")
+	}
+	if join != INNER_JOIN && join != INNER_LEFT {
+		return nil, fmt.Errorf("不支持的连接类型：" + join)
 	}
-	if c.joinpiece == nil {
-		c.joinpiece = make([]*PieceJoin, 0, 2)
+	if len(outalias) > len(outfield) {
+		return nil, fmt.Errorf("连接的输出字段别名多于输出字段")
 	}
-	i := &PieceJoin{
+	p := &PieceJoin{
 		Join:      join,
-		TableName: dts.TableName,
+		TableName: dts.GetTableName(),
+		Alias:     alias,
 		criteria:  make([]*SQLCriteria, 0, 1),
-		OutField:  outfield}
-	c.joinpiece = append(c.joinpiece, i)
-	return i
+		OutField:  outfield,
+		OutAlias:  outalias,
+		source:    dts}
+	// 连接使用软删除的数据源时排除已经删除的数据
+	if sd, ok := ds.(interface{ notDeletedCriteria() []*SQLCriteria }); ok {
+		p.criteria = append(p.criteria, sd.notDeletedCriteria()...)
+	}
+	if !IsValidIdentifier(p.alias()) {
+		return nil, fmt.Errorf("连接表的别名不合法：" + p.alias())
+	}
+	if p.alias() == c.TableName {
+		return nil, fmt.Errorf("连接表" + p.TableName + "与主表同名，需要指定别名")
+	}
+	names := make(map[string]bool)
+	for _, f := range c.Field {
+		names[f.Name] = true
+	}
+	for _, jp := range c.joinpiece {
+		if jp.alias() == p.alias() {
+			return nil, fmt.Errorf("连接表的别名" + p.alias() + "重复")
+		}
+		for i := range jp.OutField {
+			names[jp.outName(i)] = true
+		}
+	}
+	for i, f := range outfield {
+		if dts.GetFieldByName(f) == nil && (len(dts.GetFields()) != 0 || !IsValidIdentifier(f)) {
+			return nil, fmt.Errorf("数据源%s中没有字段%s", ds.GetName(), f)
+		}
+		name := p.outName(i)
+		if !IsValidIdentifier(name) {
+			return nil, fmt.Errorf("连接的输出字段名不合法：" + name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("连接的输出字段名" + name + "重复，需要指定别名")
+		}
+		names[name] = true
+	}
+	c.joinpiece = append(c.joinpiece, p)
+	return p, nil
+}
+
+// ClearJoin 清除连接
+func (c *TableDataSource) ClearJoin() {
+	c.joinpiece = nil
+}
+
+// GetFieldByName 根据字段名返回字段，“别名.字段名”形式的字段名返回连接表的字段
+func (c *TableDataSource) GetFieldByName(name string) *MyProperty {
+	if f := c.DataSource.GetFieldByName(name); f != nil {
+		return f
+	}
+	for _, p := range c.joinpiece {
+		if p.source != nil && strings.HasPrefix(name, p.alias()+".") {
+			return p.source.GetFieldByName(strings.TrimPrefix(name, p.alias()+"."))
+		}
+	}
+	return nil
 }
 
 // fillColumn 填充列信息
@@ -57,7 +149,7 @@ func (c *TableDataSource) fillColumn() error {
 	for i, item := range rs.Data {
 		c.Field[i] = &MyProperty{
 			Name:     item[0].(string),
-			DataType: ConvertMySQLType2CommonType(strings.ToUpper(item[1].(string))),
+			DataType: ConvertDBType2CommonType(DBAlias2DBTypeContainer[c.DBAlias], strings.ToUpper(item[1].(string))),
 		}
 	}
 	return utils.DataSourceCache.Put(k, c.Field, 10*time.Minute)
@@ -84,7 +176,7 @@ func (c *TableDataSource) fillKeyFields() error {
 	for i, item := range rs.Data {
 		c.KeyField[i] = &MyProperty{
 			Name:     item[0].(string),
-			DataType: ConvertMySQLType2CommonType(strings.ToUpper(item[1].(string))),
+			DataType: ConvertDBType2CommonType(DBAlias2DBTypeContainer[c.DBAlias], strings.ToUpper(item[1].(string))),
 		}
 	}
 
@@ -93,7 +185,7 @@ func (c *TableDataSource) fillKeyFields() error {
 
 // createSQLBuilder 创建SQL构造器
 func (c *TableDataSource) createSQLBuilder() (ISQLBuilder, error) {
-	sqb, err := CreateSQLBuileder2(DBAlias2DBTypeContainer[c.DBAlias], c.TableName, c.convertPropertys2Cols(c.Field), c.orderlist, c.RowsLimit, c.RowsOffset)
+	sqb, err := CreateSQLBuileder2(DBAlias2DBTypeContainer[c.DBAlias], c.TableName, c.selectColumns(c.convertPropertys2Cols(c.Field)), c.orderlist, c.RowsLimit, c.RowsOffset)
 	if err != nil {
 		return nil, err
 	}
@@ -163,30 +255,122 @@ func (c *TableDataSource) QueryDataByKey(keyvalues ...interface{}) (*DataResultS
 
 // GetAllData 返回全部数据
 func (c *TableDataSource) GetAllData() (*DataResultSet, error) {
-	sqlstr, err := c.createSQLBuilder()
+	sqlstr, param, err := c.createAllDataSQL()
 	if err != nil {
 		return nil, err
 	}
+	return c.querySQLData(sqlstr, param...)
+}
+
+// IterateAllData 逐行读取全部数据
+func (c *TableDataSource) IterateAllData() (IRowIterator, error) {
+	sqlstr, param, err := c.createAllDataSQL()
+	if err != nil {
+		return nil, err
+	}
+	return c.queryRows(sqlstr, param...)
+}
+
+// createAllDataSQL 生成返回全部数据的语句
+func (c *TableDataSource) createAllDataSQL() (string, []interface{}, error) {
+	extra := c.extraCriteria()
+	if err := c.checkCriteria(nil, c.orderlist); err != nil {
+		return "", nil, err
+	}
+	if err := c.checkSQLCriteria(extra); err != nil {
+		return "", nil, err
+	}
+	sqlb, err := c.createSQLBuilder()
+	if err != nil {
+		return "", nil, err
+	}
+	(&BaseCriteria{}).fillSQLBuilderCriteriaAnd(sqlb, extra)
 
-	sql, ps := sqlstr.CreateSelectSQL()
-	return c.querySQLData(sql, ps...)
+	sqlstr, param := sqlb.CreateSelectSQL()
+	return sqlstr, param, nil
 }
 
 // DoFilter 根据查询条件返回数据
 func (c *TableDataSource) DoFilter() (*DataResultSet, error) {
-	sqlb, err := c.createSQLBuilder()
+	sqlstr, param, err := c.createFilterSQL()
 	if err != nil {
 		return nil, err
 	}
-	sqlb.ClearCriteria()
-	for _, item := range c.filter {
-		sqlb.AddCriteria(item.PropertyName, item.Operation, item.Complex, item.Value)
+	return c.querySQLData(sqlstr, param...)
+}
+
+// IterateFilter 逐行读取满足查询条件的数据
+func (c *TableDataSource) IterateFilter() (IRowIterator, error) {
+	sqlstr, param, err := c.createFilterSQL()
+	if err != nil {
+		return nil, err
+	}
+	return c.queryRows(sqlstr, param...)
+}
+
+// createFilterSQL 生成根据查询条件返回数据的语句
+func (c *TableDataSource) createFilterSQL() (string, []interface{}, error) {
+	if err := c.checkCriteria(c.filter, c.orderlist); err != nil {
+		return "", nil, err
+	}
+	if err := c.checkAggre(c.aggre, c.groupby); err != nil {
+		return "", nil, err
 	}
+	extra := c.extraCriteria()
+	if err := c.checkSQLCriteria(extra); err != nil {
+		return "", nil, err
+	}
+	sqlb, err := c.createSQLBuilder()
+	if err != nil {
+		return "", nil, err
+	}
+	sqlb.ClearCriteria()
+	c.fillSQLBuilderCriteriaAnd(sqlb, extra)
 	for k, item := range c.aggre {
 		sqlb.AddAggre(k, item)
 	}
 	sqlstr, param := sqlb.CreateSelectSQL()
-	return c.querySQLData(sqlstr, param...)
+	return sqlstr, param, nil
+}
+
+// CountAll 返回全部数据的记录数，不包括已经删除的数据
+func (c *TableDataSource) CountAll() (int64, error) {
+	extra := c.notDeletedCriteria()
+	if err := c.checkSQLCriteria(extra); err != nil {
+		return 0, err
+	}
+	sqlb, err := c.createSQLBuilder()
+	if err != nil {
+		return 0, err
+	}
+	(&BaseCriteria{}).fillSQLBuilderCriteriaAnd(sqlb, extra)
+	sqlstr, param := sqlb.CreateCountSQL()
+	return c.countSQL(sqlstr, param...)
+}
+
+// CountFilter 返回满足查询条件的记录数，忽略分页、排序和游标分页条件，有聚合时返回分组的个数
+func (c *TableDataSource) CountFilter() (int64, error) {
+	if err := c.checkCriteria(c.filter, nil); err != nil {
+		return 0, err
+	}
+	if err := c.checkAggre(c.aggre, c.groupby); err != nil {
+		return 0, err
+	}
+	extra := c.notDeletedCriteria()
+	if err := c.checkSQLCriteria(extra); err != nil {
+		return 0, err
+	}
+	sqlb, err := c.createSQLBuilder()
+	if err != nil {
+		return 0, err
+	}
+	sqlb.ClearCriteria()
+	c.fillSQLBuilderCriteriaAnd(sqlb, extra)
+	for k, item := range c.aggre {
+		sqlb.AddAggre(k, item)
+	}
+	sqlstr, param := sqlb.CreateCountSQL()
+	return c.countSQL(sqlstr, param...)
 }
 
 //
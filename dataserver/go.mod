@@ -6,11 +6,13 @@ require (
 	github.com/antonmedv/expr v1.8.2
 	github.com/astaxie/beego v1.12.0
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/lib/pq v1.3.0
+	github.com/mattn/go-oci8 v0.1.1
+	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/rs/xid v1.2.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/shiena/ansicolor v0.0.0-20151119151921-a422bbe96644 // indirect
 	github.com/skip2/go-qrcode v0.0.0-20191027152451-9434209cb086
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
 	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
-
 )
@@ -21,4 +21,9 @@ func RegisterRoutes() {
 	// 所有服务请求的入口函数
 	beego.Router("/services/?:context/?:action", &service.SController{}, "get,post:DoSrv")
 
+	// OData v4协议的入口函数，服务根地址为/odata/服务上下文/
+	logs.Info("启用OData服务")
+	logs.Info("    /odata/:context/?:action")
+	beego.Router("/odata/:context/?:action", &service.ODataController{}, "get:DoOData")
+
 }
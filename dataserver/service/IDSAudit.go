@@ -0,0 +1,373 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/rs/xid"
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// AuditIds 记录审计信息的可写数据源名称，为空时不记录审计信息，由配置文件中的audit.ids设定
+// 审计数据源需要包含ID、SERVICE、IDS、ACTION、USER_ID、RECORD_KEY、CRITERIA、BEFORE_DATA、AFTER_DATA、CREATE_TIME字段
+var AuditIds string
+
+// auditEnabled 是否记录审计信息
+func auditEnabled() bool {
+	return AuditIds != ""
+}
+
+// auditRecord 一条数据的审计信息
+type auditRecord struct {
+	ids      string
+	action   string
+	key      []interface{}
+	criteria string
+	before   map[string]interface{}
+	after    map[string]interface{}
+}
+
+// formatRecordKey 将主键值转换为JSON数组形式的字符串，用于查询一条数据的审计信息
+func formatRecordKey(key []interface{}) string {
+	ks := make([]string, len(key), len(key))
+	for i, k := range key {
+		ks[i] = formatVersion(k)
+	}
+	b, _ := json.Marshal(ks)
+	return string(b)
+}
+
+// formatAuditJSON 将审计信息中的数据转换为JSON字符串，数据为nil时返回空字符串
+func formatAuditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// formatAuditCriteria 返回报文中条件节点的JSON字符串
+func formatAuditCriteria(rBody *SRequestBody) string {
+	if rBody == nil || (len(rBody.Criteria) == 0 && rBody.Filter == nil) {
+		return ""
+	}
+	return formatAuditJSON(struct {
+		Criteria []CriteriaInRBody `json:",omitempty"`
+		Filter   *CriteriaGroup    `json:",omitempty"`
+	}{rBody.Criteria, rBody.Filter})
+}
+
+// rowToMap 将结果集中的一行数据转换为字段名和值的map
+func rowToMap(rs *datasource.DataResultSet, row []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(rs.Fields))
+	for k, f := range rs.Fields {
+		m[k] = row[f.Index]
+	}
+	return m
+}
+
+// queryAuditRow 根据主键读取一条数据，没有数据时返回nil
+func (c *IDSServiceHandler) queryAuditRow(ids datasource.IDataSource, key []interface{}) (map[string]interface{}, error) {
+	rs, err := ids.QueryDataByKey(key...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs.Data) == 0 {
+		return nil, nil
+	}
+	return rowToMap(rs, rs.Data[0]), nil
+}
+
+// getKeyValues 返回数据中的主键值，数据中没有全部的主键字段时返回nil
+func getKeyValues(ids datasource.IDataSource, values map[string]interface{}) []interface{} {
+	kfs := ids.GetKeyFields()
+	if len(kfs) == 0 {
+		return nil
+	}
+	key := make([]interface{}, len(kfs), len(kfs))
+	for i, k := range kfs {
+		v, ok := values[k.Name]
+		if !ok {
+			return nil
+		}
+		key[i] = v
+	}
+	return key
+}
+
+// createAuditRecords 根据写操作前读取的数据创建更新、删除操作的审计信息
+// keys为写操作后数据的主键，为nil时数据已经被删除，不读取写操作后的数据
+func (c *IDSServiceHandler) createAuditRecords(action string, ids datasource.IDataSource, rBody *SRequestBody, before *datasource.DataResultSet, keys [][]interface{}) ([]*auditRecord, error) {
+	if before == nil {
+		return nil, nil
+	}
+	oldkeys, err := c.getResultSetKeys(ids, before, nil)
+	if err != nil {
+		return nil, err
+	}
+	criteria := formatAuditCriteria(rBody)
+	records := make([]*auditRecord, len(before.Data), len(before.Data))
+	for i, row := range before.Data {
+		records[i] = &auditRecord{
+			ids:      ids.GetName(),
+			action:   action,
+			key:      oldkeys[i],
+			criteria: criteria,
+			before:   rowToMap(before, row),
+		}
+		if keys != nil {
+			if records[i].after, err = c.queryAuditRow(ids, keys[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return records, nil
+}
+
+// createInsertAuditRecords 创建插入操作的审计信息，reread为true并且主键完整时重新读取插入的数据，否则使用插入的值
+func (c *IDSServiceHandler) createInsertAuditRecords(action string, ids datasource.IDataSource, values []map[string]interface{}, keys []map[string]interface{}, reread bool) ([]*auditRecord, error) {
+	records := make([]*auditRecord, len(values), len(values))
+	for i, v := range values {
+		key := getKeyValues(ids, keys[i])
+		records[i] = &auditRecord{ids: ids.GetName(), action: action, key: key, after: v}
+		if reread && key != nil {
+			after, err := c.queryAuditRow(ids, key)
+			if err != nil {
+				return nil, err
+			}
+			if after != nil {
+				records[i].after = after
+			}
+		}
+	}
+	return records, nil
+}
+
+// createAuditDataSource 创建审计数据源
+func createAuditDataSource() (datasource.IWriteableDataSource, error) {
+	obj, err := datasource.CreateIDSFromName(AuditIds)
+	if err != nil {
+		return nil, fmt.Errorf("创建审计数据源" + AuditIds + "时发生错误：" + err.Error())
+	}
+	inf, ok := obj.(datasource.IWriteableDataSource)
+	if !ok {
+		return nil, fmt.Errorf("审计数据源" + AuditIds + "没有实现IWriteableDataSource接口")
+	}
+	return inf, nil
+}
+
+// auditTx 写操作的事务，设定了审计数据源时在提交前写入审计信息
+type auditTx struct {
+	*sql.Tx
+	// dbalias 写操作使用的数据库别名
+	dbalias string
+	// audit 审计数据源，没有设定审计数据源时为nil
+	audit datasource.IWriteableDataSource
+}
+
+// beginAuditTx 开始写操作的事务，设定了审计数据源时先创建审计数据源，避免在事务中初始化数据源
+func (c *IDSServiceHandler) beginAuditTx(tinf datasource.ITransactionDataSource) (*auditTx, error) {
+	r := &auditTx{dbalias: tinf.GetDBAlias()}
+	if auditEnabled() {
+		var err error
+		if r.audit, err = createAuditDataSource(); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := tinf.BeginTx()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务时发生错误：" + err.Error())
+	}
+	r.Tx = tx
+	return r, nil
+}
+
+// commitAuditTx 写入审计信息并提交事务
+// 审计数据源与写操作使用同一个数据库时在写操作的事务中写入，审计信息写入失败时回滚事务并返回错误
+// 否则在写操作的事务提交后在审计数据库的事务中写入，两个数据库的事务不能保证一致，审计信息写入失败时只记录日志
+func (c *IDSServiceHandler) commitAuditTx(sdef *SDefine, tx *auditTx, records []*auditRecord) error {
+	var tinf datasource.ITransactionDataSource
+	if tx.audit != nil && len(records) != 0 {
+		var ok bool
+		if tinf, ok = tx.audit.(datasource.ITransactionDataSource); !ok {
+			tx.Rollback()
+			return fmt.Errorf("审计数据源" + AuditIds + "不支持事务，全部数据已回滚")
+		}
+	}
+	if tinf != nil && tinf.GetDBAlias() == tx.dbalias {
+		tinf.SetTx(tx.Tx)
+		err := c.insertAuditRecords(sdef, tx.audit, records)
+		tinf.SetTx(nil)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("写入审计信息时发生错误，全部数据已回滚：" + err.Error())
+		}
+		tinf = nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务时发生错误：" + err.Error())
+	}
+	if tinf != nil {
+		if err := c.writeAuditRecords(sdef, tinf, tx.audit, records); err != nil {
+			logs.Error("数据已经提交，在审计数据库中写入审计信息时发生错误：%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// writeAuditRecords 在审计数据库的事务中写入审计信息，用于审计数据源与写操作使用不同数据库的情况
+func (c *IDSServiceHandler) writeAuditRecords(sdef *SDefine, tinf datasource.ITransactionDataSource, inf datasource.IWriteableDataSource, records []*auditRecord) error {
+	atx, err := tinf.BeginTx()
+	if err != nil {
+		return err
+	}
+	tinf.SetTx(atx)
+	err = c.insertAuditRecords(sdef, inf, records)
+	tinf.SetTx(nil)
+	if err != nil {
+		atx.Rollback()
+		return err
+	}
+	return atx.Commit()
+}
+
+// insertAuditRecords 将审计信息插入审计数据源
+func (c *IDSServiceHandler) insertAuditRecords(sdef *SDefine, inf datasource.IWriteableDataSource, records []*auditRecord) error {
+	srv := ""
+	if sdef != nil {
+		srv = sdef.Namespace + "." + sdef.Context
+	}
+	now := time.Now()
+	for _, r := range records {
+		_, err := inf.Insert(map[string]interface{}{
+			"ID":          xid.New().String(),
+			"SERVICE":     srv,
+			"IDS":         r.ids,
+			"ACTION":      r.action,
+			"USER_ID":     c.CurrentUserId,
+			"RECORD_KEY":  formatRecordKey(r.key),
+			"CRITERIA":    r.criteria,
+			"BEFORE_DATA": formatAuditJSON(r.before),
+			"AFTER_DATA":  formatAuditJSON(r.after),
+			"CREATE_TIME": now,
+		})
+		if err != nil {
+			logs.Error("写入审计信息时发生错误：%s，审计信息：%s %s %s", err.Error(), r.ids, r.action, formatRecordKey(r.key))
+			return err
+		}
+	}
+	return nil
+}
+
+// execAuditedWriteOperation 在一个事务中执行写操作并写入审计信息，审计信息写入失败时回滚写操作
+func (c *IDSServiceHandler) execAuditedWriteOperation(sdef *SDefine, action string, inf datasource.IWriteableDataSource, ids datasource.IDataSource, rBody *SRequestBody, returning bool) (*writeOperationResult, error) {
+	tinf, ok := ids.(datasource.ITransactionDataSource)
+	if !ok {
+		return nil, fmt.Errorf("请求的服务不支持事务，不能记录审计信息")
+	}
+	tx, err := c.beginAuditTx(tinf)
+	if err != nil {
+		return nil, err
+	}
+	tinf.SetTx(tx.Tx)
+	wr, err := c.execWriteOperation(action, inf, ids, rBody, returning)
+	tinf.SetTx(nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := c.commitAuditTx(sdef, tx, wr.audits); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// 返回一条数据的审计信息，主键值的传递方式与get操作相同，按时间顺序返回
+// 当前用户必须具有服务元数据中auditrole定义的角色，服务定义了userfilter时只能查询当前用户可见的数据
+func (c *IDSServiceHandler) doAuditHistory(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	if !auditEnabled() {
+		c.createErrorResponse("没有设定审计数据源")
+		return
+	}
+	if err := c.checkMetaRole(meta, "auditrole", SrvActionAUDIT+"操作"); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	fs := ids.GetKeyFields()
+	if len(fs) == 0 {
+		c.createErrorResponse("数据源没有主键，不能查询审计信息")
+		return
+	}
+	key := make([]interface{}, len(fs), len(fs))
+	for i, f := range fs {
+		var err error
+		key[i], err = c.ConvertString2Type(c.RRHandler.GetParam(f.Name), f.DataType)
+		if err != nil {
+			c.createErrorResponse("类型转换错误" + c.RRHandler.GetParam(f.Name) + " " + f.DataType + " err:" + err.Error())
+			return
+		}
+	}
+	if err := c.checkAuditUserFilter(sdef, meta, ids, fs, key); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	obj, err := datasource.CreateIDSFromName(AuditIds)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	aids, ok := obj.(datasource.IQueryableTableSource)
+	if !ok {
+		c.createErrorResponse("审计数据源" + AuditIds + "没有实现IQueryableTableSource接口")
+		return
+	}
+	aids.AddCriteria("IDS", datasource.OperEq, ids.GetName()).
+		AndCriteria("RECORD_KEY", datasource.OperEq, formatRecordKey(key)).
+		Orderby("CREATE_TIME", "ASC").Orderby("ID", "ASC")
+	rs, err := aids.DoFilter()
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	r := utils.CreateRestResult(true)
+	r["resultset"] = rs
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// checkAuditUserFilter 服务定义了userfilter时，检查主键对应的数据是否在当前用户可见的范围内
+// 软删除的数据也可以查询审计信息，已经物理删除的数据无法判断可见范围，不能查询
+func (c *IDSServiceHandler) checkAuditUserFilter(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, fs []*datasource.MyProperty, key []interface{}) error {
+	var rBody *SRequestBody
+	evool, err := c.doUserFilter(sdef, meta, ids, &rBody)
+	if err != nil {
+		return err
+	}
+	if !evool {
+		return nil
+	}
+	if err := c.fillCriteriaFromRbody(ids, rBody); err != nil {
+		return err
+	}
+	fc := ids.(datasource.IFilterAdder)
+	for i, f := range fs {
+		fc.AndCriteria(f.Name, datasource.OperEq, key[i])
+	}
+	if sinf, ok := ids.(datasource.ISoftDeleteDataSource); ok && sinf.IsSoftDelete() {
+		sinf.SetWithDeleted(true)
+	}
+	rs, err := ids.(datasource.ICriteriaDataSource).DoFilter()
+	if err != nil {
+		return err
+	}
+	if len(rs.Data) == 0 {
+		return fmt.Errorf("数据不存在或者当前用户没有权限查询该数据的审计信息")
+	}
+	return nil
+}
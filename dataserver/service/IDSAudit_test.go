@@ -0,0 +1,202 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestAudit(t *testing.T) {
+	db, clean := createTestDB(t, "audittest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int,PRIMARY KEY ("ORG_ID"))`,
+		`CREATE TABLE "G_AUDIT" ("ID" varchar(50) NOT NULL,"SERVICE" varchar(150),"IDS" varchar(150),"ACTION" varchar(45),"USER_ID" varchar(50),`+
+			`"RECORD_KEY" varchar(500),"CRITERIA" text,"BEFORE_DATA" text,"AFTER_DATA" text,"CREATE_TIME" datetime,PRIMARY KEY ("ID"))`)
+	defer clean()
+	datasource.AddIdsCreator("CreateAuditTestIds", func(p datasource.IDSContainerParam) interface{} {
+		return datasource.CreateWriteableTableDataSource(p["name"].(string), "audittest", p["tablename"].(string))
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["audit.G_AUDIT"] = datasource.IDSContainerParam{
+		"inf": "CreateAuditTestIds", "name": "G_AUDIT", "tablename": "G_AUDIT"}
+	AuditIds = "audit.G_AUDIT"
+	defer func() { AuditIds = "" }()
+	sdef := &SDefine{ProjectId: "audit", Namespace: "audit", Context: "org"}
+	call := func(params map[string]string, f func(h *IDSServiceHandler, ids datasource.IDataSource)) *testRRHandler {
+		rr := &testRRHandler{params: params}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: "u1"}}
+		f(h, datasource.CreateWriteableTableDataSource("JEDA_ORG", "audittest", "JEDA_ORG"))
+		if !rr.result() {
+			t.Fatalf("call failed %v", rr.response)
+		}
+		return rr
+	}
+
+	call(nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doInsert(sdef, nil, ids, &SRequestBody{Insert: map[string]string{"ORG_ID": "A", "ORG_NAME": "a", "ORG_ORDER": "1"}})
+	})
+	call(nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpdate(sdef, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "b"},
+			Criteria: []CriteriaInRBody{{Field: "ORG_ID", Operation: "=", Value: "A", Relation: "and"}}})
+	})
+	call(nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpsert(sdef, nil, ids, &SRequestBody{Upsert: []map[string]string{{"ORG_ID": "A", "ORG_NAME": "c"}}})
+	})
+	call(nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doDelete(sdef, nil, ids, &SRequestBody{Delete: "true",
+			Criteria: []CriteriaInRBody{{Field: "ORG_ID", Operation: "=", Value: "A", Relation: "and"}}})
+	})
+	var n int
+	db.QueryRow(`SELECT count(*) FROM "G_AUDIT" WHERE "USER_ID"='u1' AND "SERVICE"='audit.org' AND "IDS"='JEDA_ORG'`).Scan(&n)
+	if n != 4 {
+		t.Fatalf("audit records %d", n)
+	}
+
+	// 查询A的审计信息，按时间顺序返回，只有auditrole定义的角色可以查询
+	once.Do(func() {})
+	tokenService = &testSecurityService{roles: map[string]utils.StringSet{"u1": {"AUDITOR": true}, "u2": {"USER": true}}}
+	defer func() { tokenService = &TokenService{} }()
+	meta := map[string]interface{}{"auditrole": "AUDITOR"}
+	history := func(user string, meta map[string]interface{}, key string) *testRRHandler {
+		rr := &testRRHandler{params: map[string]string{"ORG_ID": key}}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: user}}
+		h.doAuditHistory(sdef, meta, datasource.CreateWriteableTableDataSource("JEDA_ORG", "audittest", "JEDA_ORG"), nil)
+		return rr
+	}
+	if history("u1", nil, "A").result() {
+		t.Error("audit history allowed without auditrole")
+	}
+	if history("u2", meta, "A").result() {
+		t.Error("audit history allowed without role")
+	}
+	rr := history("u1", meta, "A")
+	if !rr.result() {
+		t.Fatalf("audit history failed %v", rr.response)
+	}
+	rs := rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet)
+	if len(rs.Data) != 4 {
+		t.Fatalf("audit history %d", len(rs.Data))
+	}
+	field := func(i int, name string) string {
+		return rs.Data[i][rs.Fields[name].Index].(string)
+	}
+	image := func(s string) map[string]interface{} {
+		if s == "" {
+			return nil
+		}
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	steps := []struct{ action, before, after string }{
+		{SrvActionINSERT, "", "a"},
+		{SrvActionUPDATE, "a", "b"},
+		{SrvActionUPSERT, "b", "c"},
+		{SrvActionDELETE, "c", ""},
+	}
+	for i, s := range steps {
+		if field(i, "ACTION") != s.action || field(i, "RECORD_KEY") != `["A"]` {
+			t.Errorf("audit %d action %s key %s", i, field(i, "ACTION"), field(i, "RECORD_KEY"))
+		}
+		before, after := image(field(i, "BEFORE_DATA")), image(field(i, "AFTER_DATA"))
+		if (s.before == "") != (before == nil) || before != nil && before["ORG_NAME"] != s.before {
+			t.Errorf("audit %d before %v", i, before)
+		}
+		if (s.after == "") != (after == nil) || after != nil && after["ORG_NAME"] != s.after {
+			t.Errorf("audit %d after %v", i, after)
+		}
+	}
+	if c := image(field(1, "CRITERIA")); c == nil || c["Criteria"] == nil {
+		t.Errorf("update criteria %s", field(1, "CRITERIA"))
+	}
+
+	// 定义了userfilter时只能查询当前用户可见的数据
+	db.Exec(`INSERT INTO "JEDA_ORG" VALUES ('B','u1',1),('C','u2',2)`)
+	filtered := map[string]interface{}{"auditrole": "AUDITOR", "userfilter": map[string]interface{}{"filterkey": "ORG_NAME", "values": "userid"}}
+	if rr := history("u1", filtered, "B"); !rr.result() {
+		t.Errorf("audit history of visible row %v", rr.response)
+	}
+	if history("u1", filtered, "C").result() {
+		t.Error("audit history of invisible row")
+	}
+	if history("u1", filtered, "A").result() {
+		t.Error("audit history of deleted row with userfilter")
+	}
+}
+
+func TestAuditRestoreAndFailure(t *testing.T) {
+	db, clean := createTestDB(t, "auditrestore", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"DELETED" int,PRIMARY KEY ("ORG_ID"))`,
+		`CREATE TABLE "G_AUDIT" ("ID" varchar(50) NOT NULL,"SERVICE" varchar(150),"IDS" varchar(150),"ACTION" varchar(45),"USER_ID" varchar(50),`+
+			`"RECORD_KEY" varchar(500),"CRITERIA" text,"BEFORE_DATA" text,"AFTER_DATA" text,"CREATE_TIME" datetime,PRIMARY KEY ("ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('A','a',1),('B','b',0)`)
+	defer clean()
+	datasource.AddIdsCreator("CreateAuditRestoreTestIds", func(p datasource.IDSContainerParam) interface{} {
+		return datasource.CreateWriteableTableDataSource(p["name"].(string), "auditrestore", p["tablename"].(string))
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["auditrestore.G_AUDIT"] = datasource.IDSContainerParam{
+		"inf": "CreateAuditRestoreTestIds", "name": "G_AUDIT", "tablename": "G_AUDIT"}
+	datasource.IDSContainer["auditrestore.G_MISSING"] = datasource.IDSContainerParam{
+		"inf": "CreateAuditRestoreTestIds", "name": "G_MISSING", "tablename": "G_MISSING"}
+	defer func() { AuditIds = "" }()
+	sdef := &SDefine{ProjectId: "auditrestore", Namespace: "audit", Context: "org"}
+	call := func(f func(h *IDSServiceHandler, ids datasource.IDataSource)) *testRRHandler {
+		rr := &testRRHandler{}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: "u1"}}
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "auditrestore", "JEDA_ORG")
+		ids.SoftDelete = &datasource.SoftDeleteDefine{Field: "DELETED", Value: 1, RestoreValue: 0}
+		f(h, ids)
+		return rr
+	}
+
+	// 恢复操作只记录恢复的数据
+	AuditIds = "auditrestore.G_AUDIT"
+	rr := call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doRestore(sdef, nil, ids, &SRequestBody{OperationConfirm: "restore"})
+	})
+	if !rr.result() {
+		t.Fatalf("restore failed %v", rr.response)
+	}
+	var key, before, after string
+	var n int
+	db.QueryRow(`SELECT count(*) FROM "G_AUDIT"`).Scan(&n)
+	db.QueryRow(`SELECT "RECORD_KEY","BEFORE_DATA","AFTER_DATA" FROM "G_AUDIT" WHERE "ACTION"=?`, SrvActionRESTORE).Scan(&key, &before, &after)
+	if n != 1 || key != `["A"]` {
+		t.Fatalf("restore audit %d %s", n, key)
+	}
+	b, a := make(map[string]interface{}), make(map[string]interface{})
+	if json.Unmarshal([]byte(before), &b) != nil || json.Unmarshal([]byte(after), &a) != nil || b["DELETED"] != float64(1) || a["DELETED"] != float64(0) {
+		t.Errorf("restore audit before %s after %s", before, after)
+	}
+
+	// 审计信息写入失败时请求失败，数据回滚
+	AuditIds = "auditrestore.G_MISSING"
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpdate(sdef, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "c"}, OperationConfirm: "update"})
+	})
+	if rr.result() {
+		t.Fatalf("update with bad audit ids %v", rr.response)
+	}
+	db.QueryRow(`SELECT count(*) FROM "JEDA_ORG" WHERE "ORG_NAME"='c'`).Scan(&n)
+	if n != 0 {
+		t.Errorf("update not rolled back %d", n)
+	}
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpsert(sdef, nil, ids, &SRequestBody{Upsert: []map[string]string{{"ORG_ID": "C", "ORG_NAME": "c"}}})
+	})
+	if rr.result() {
+		t.Fatalf("upsert with bad audit ids %v", rr.response)
+	}
+	db.QueryRow(`SELECT count(*) FROM "JEDA_ORG"`).Scan(&n)
+	if n != 2 {
+		t.Errorf("upsert not rolled back %d", n)
+	}
+}
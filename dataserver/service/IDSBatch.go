@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// batchItem 批量操作中一个操作对应的数据源
+type batchItem struct {
+	op  *BatchOperation
+	ids datasource.IDataSource
+	inf datasource.IWriteableDataSource
+	tx  datasource.ITransactionDataSource
+}
+
+// getBatchDataSource 返回批量操作中一个操作使用的数据源，没有指定数据源时使用当前服务的数据源
+// 其他数据源必须在服务元数据batchids中列出
+func (c *IDSServiceHandler) getBatchDataSource(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, op *BatchOperation) (datasource.IDataSource, error) {
+	if op.Ids == "" {
+		return ids, nil
+	}
+	obj, err := c.createMetaDataSource(sdef, meta, "batchids", op.Ids)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := obj.(datasource.IDataSource)
+	if !ok {
+		return nil, fmt.Errorf("数据源" + op.Ids + "没有实现IDataSource接口")
+	}
+	return r, nil
+}
+
+// createBatchItems 检查批量操作并创建每个操作使用的数据源，所有数据源必须使用同一个数据库别名
+func (c *IDSServiceHandler) createBatchItems(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, ops []*BatchOperation) ([]*batchItem, error) {
+	items := make([]*batchItem, len(ops), len(ops))
+	dbalias := ""
+	for i, op := range ops {
+		if op == nil {
+			return nil, fmt.Errorf("第%d个操作为空", i+1)
+		}
+		action := strings.ToLower(op.Action)
+		if action != SrvActionINSERT && action != SrvActionUPDATE && action != SrvActionDELETE && action != SrvActionRESTORE {
+			return nil, fmt.Errorf("第%d个操作的类型%s不支持，只能为insert、update、delete或restore", i+1, op.Action)
+		}
+		op.Action = action
+		if op.Batch != nil {
+			return nil, fmt.Errorf("第%d个操作中不能嵌套Batch节点", i+1)
+		}
+		ds, err := c.getBatchDataSource(sdef, meta, ids, op)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个操作的数据源错误：%s", i+1, err.Error())
+		}
+		inf, ok := ds.(datasource.IWriteableDataSource)
+		if !ok {
+			return nil, fmt.Errorf("第%d个操作的数据源没有实现DataSource.IWriteableDataSource接口", i+1)
+		}
+		tx, ok := ds.(datasource.ITransactionDataSource)
+		if !ok {
+			return nil, fmt.Errorf("第%d个操作的数据源不支持事务", i+1)
+		}
+		if i == 0 {
+			dbalias = tx.GetDBAlias()
+		} else if tx.GetDBAlias() != dbalias {
+			return nil, fmt.Errorf("第%d个操作的数据库%s与第1个操作的数据库%s不同，不能在一个事务中执行", i+1, tx.GetDBAlias(), dbalias)
+		}
+		items[i] = &batchItem{op: op, ids: ds, inf: inf, tx: tx}
+	}
+	return items, nil
+}
+
+// 处理批量写操作，Batch节点中的操作在一个事务中按顺序执行，任何一个操作失败都会回滚全部操作
+// 返回每一个操作影响的行数，以及插入操作新数据的主键
+func (c *IDSServiceHandler) doBatch(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	if rBody == nil || len(rBody.Batch) == 0 {
+		c.createErrorResponse("batch操作必须POST方式提交包含Batch节点的rbody信息")
+		return
+	}
+	items, err := c.createBatchItems(sdef, meta, ids, rBody.Batch)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	tx, err := c.beginAuditTx(items[0].tx)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	affected := make([]int64, len(items), len(items))
+	keys := make([]map[string]interface{}, len(items), len(items))
+	audits := make([]*auditRecord, 0)
+	for i, item := range items {
+		//多个操作可能使用同一个数据源，执行前清空上一个操作的条件
+		if cc, ok := item.ids.(interface{ ClearCriteria() }); ok {
+			cc.ClearCriteria()
+		}
+		item.tx.SetTx(tx.Tx)
+		wr, err := c.execWriteOperation(item.op.Action, item.inf, item.ids, &item.op.SRequestBody, false)
+		item.tx.SetTx(nil)
+		if err != nil {
+			if e := tx.Rollback(); e != nil {
+				c.createErrorResponse(fmt.Sprintf("第%d个操作失败：%s，回滚事务时发生错误：%s", i+1, err.Error(), e.Error()))
+				return
+			}
+			c.createErrorResponse(fmt.Sprintf("第%d个操作失败，全部操作已回滚：%s", i+1, err.Error()))
+			return
+		}
+		affected[i] = wr.RowsAffected
+		keys[i] = wr.Keys
+		audits = append(audits, wr.audits...)
+	}
+	if err := c.commitAuditTx(sdef, tx, audits); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	r := utils.CreateRestResult(true)
+	r["msg"] = "处理成功"
+	r["affected"] = affected
+	r["keys"] = keys
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestBatch(t *testing.T) {
+	db, clean := createTestDB(t, "batchtest", "sqlite3",
+		`CREATE TABLE "BILL" ("BILL_ID" varchar(50) NOT NULL,"BILL_NAME" varchar(100),PRIMARY KEY ("BILL_ID"))`,
+		`CREATE TABLE "BILL_ITEM" ("ITEM_ID" varchar(50) NOT NULL,"BILL_ID" varchar(50),"AMOUNT" int,PRIMARY KEY ("ITEM_ID"))`)
+	defer clean()
+	datasource.AddIdsCreator("CreateBatchTestIds", func(p datasource.IDSContainerParam) interface{} {
+		return datasource.CreateWriteableTableDataSource(p["name"].(string), "batchtest", p["tablename"].(string))
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["batch.BILL_ITEM"] = datasource.IDSContainerParam{
+		"inf": "CreateBatchTestIds", "name": "BILL_ITEM", "tablename": "BILL_ITEM"}
+	sdef := &SDefine{ProjectId: "batch"}
+	meta := map[string]interface{}{"ids": "BILL", "batchids": []interface{}{"BILL_ITEM"}}
+	count := func(table string) int {
+		var n int
+		db.QueryRow(`SELECT count(*) FROM "` + table + `"`).Scan(&n)
+		return n
+	}
+
+	// 表头和明细在一个事务中保存
+	rr := &testRRHandler{}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	ids := datasource.CreateWriteableTableDataSource("BILL", "batchtest", "BILL")
+	h.doBatch(sdef, meta, ids, &SRequestBody{Batch: []*BatchOperation{
+		{Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"BILL_ID": "B1", "BILL_NAME": "bill"}}},
+		{Ids: "BILL_ITEM", Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"ITEM_ID": "I1", "BILL_ID": "B1", "AMOUNT": "1"}}},
+		{Ids: "BILL_ITEM", Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"ITEM_ID": "I2", "BILL_ID": "B1", "AMOUNT": "2"}}},
+		{Ids: "BILL_ITEM", Action: "UPDATE", SRequestBody: SRequestBody{Update: map[string]string{"AMOUNT": "5"},
+			Criteria: []CriteriaInRBody{{Field: "BILL_ID", Operation: "=", Value: "B1", Relation: "and"}}}},
+		{Action: "update", SRequestBody: SRequestBody{Update: map[string]string{"BILL_NAME": "bill1"},
+			Criteria: []CriteriaInRBody{{Field: "BILL_ID", Operation: "=", Value: "B1", Relation: "and"}}}},
+	}})
+	if !rr.result() {
+		t.Fatalf("batch failed %v", rr.response)
+	}
+	if got := rr.response.(utils.RestResult)["affected"].([]int64); len(got) != 5 || got[0] != 1 || got[3] != 2 || got[4] != 1 {
+		t.Errorf("affected %v", got)
+	}
+	if count("BILL") != 1 || count("BILL_ITEM") != 2 {
+		t.Errorf("batch not committed")
+	}
+
+	// 任何一个操作失败都回滚全部操作
+	rr = &testRRHandler{}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	ids = datasource.CreateWriteableTableDataSource("BILL", "batchtest", "BILL")
+	h.doBatch(sdef, meta, ids, &SRequestBody{Batch: []*BatchOperation{
+		{Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"BILL_ID": "B2", "BILL_NAME": "bill"}}},
+		{Ids: "BILL_ITEM", Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"ITEM_ID": "I3", "BILL_ID": "B2", "AMOUNT": "1"}}},
+		{Action: "delete", SRequestBody: SRequestBody{Delete: "true", OperationConfirm: "delete"}},
+		{Ids: "BILL_ITEM", Action: "insert", SRequestBody: SRequestBody{Insert: map[string]string{"ITEM_ID": "I1", "BILL_ID": "B2", "AMOUNT": "1"}}},
+	}})
+	if rr.result() {
+		t.Fatal("batch with duplicate key succeeded")
+	}
+	if count("BILL") != 1 || count("BILL_ITEM") != 2 {
+		t.Errorf("batch not rolled back %d %d", count("BILL"), count("BILL_ITEM"))
+	}
+
+	// 只能使用当前项目中服务元数据batchids列出的数据源
+	for _, name := range []string{"batch.BILL_ITEM", "mgr.BILL_ITEM", "BILL_OTHER"} {
+		rr = &testRRHandler{}
+		h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		h.doBatch(sdef, meta, datasource.CreateWriteableTableDataSource("BILL", "batchtest", "BILL"), &SRequestBody{Batch: []*BatchOperation{
+			{Ids: name, Action: "delete", SRequestBody: SRequestBody{Delete: "true", OperationConfirm: "delete"}},
+		}})
+		if rr.result() {
+			t.Errorf("batch ids %s accepted", name)
+		}
+	}
+	rr = &testRRHandler{}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doBatch(sdef, nil, datasource.CreateWriteableTableDataSource("BILL", "batchtest", "BILL"), &SRequestBody{Batch: []*BatchOperation{
+		{Ids: "BILL_ITEM", Action: "delete", SRequestBody: SRequestBody{Delete: "true", OperationConfirm: "delete"}},
+	}})
+	if rr.result() || count("BILL_ITEM") != 2 {
+		t.Errorf("batch without batchids accepted")
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/rs/xid"
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// rowError 多行数据中一行数据的错误
+type rowError struct {
+	// Row 出错的行号，从1开始
+	Row int `json:"row"`
+	// Msg 错误信息
+	Msg string `json:"msg"`
+}
+
+// getRowsValues 转换批量插入、upsert操作的每一行数据，返回转换后的数据和每一行的错误
+func (c *IDSServiceHandler) getRowsValues(ids datasource.IDataSource, rows []map[string]string) ([]map[string]interface{}, []*rowError) {
+	values := make([]map[string]interface{}, len(rows), len(rows))
+	errs := make([]*rowError, 0)
+	for i, row := range rows {
+		if len(row) == 0 {
+			errs = append(errs, &rowError{Row: i + 1, Msg: "数据为空"})
+			continue
+		}
+		v, err := c.getVauleMapFromStringMap(row, ids)
+		if err != nil {
+			errs = append(errs, &rowError{Row: i + 1, Msg: err.Error()})
+			continue
+		}
+		for k, fv := range v {
+			if fv == "newguid()" {
+				v[k] = xid.New().String()
+			}
+		}
+		values[i] = v
+	}
+	return values, errs
+}
+
+// createRowErrorsResponse 返回每一行数据的错误信息
+func (c *IDSServiceHandler) createRowErrorsResponse(errs []*rowError) {
+	r := utils.CreateRestResult(false)
+	r["msg"] = fmt.Sprintf("%d行数据有错误，没有写入任何数据", len(errs))
+	r["errors"] = errs
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// 处理批量插入，BulkInsert节点中的数据在一个事务中插入，每条Insert语句插入多行数据
+// 数据转换失败时不执行插入，errors节点返回每一行的错误信息
+func (c *IDSServiceHandler) doBulkInsert(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	if rBody == nil || len(rBody.BulkInsert) == 0 {
+		c.createErrorResponse("bulkinsert操作必须POST方式提交包含BulkInsert节点的rbody信息")
+		return
+	}
+	inf, ok := ids.(datasource.IBulkInsertDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务没有实现DataSource.IBulkInsertDataSource接口")
+		return
+	}
+	values, errs := c.getRowsValues(ids, rBody.BulkInsert)
+	if len(errs) != 0 {
+		c.createRowErrorsResponse(errs)
+		return
+	}
+	keys := make([]map[string]interface{}, len(values), len(values))
+	for i, v := range values {
+		keys[i] = c.getInsertedKeys(ids, v, nil)
+	}
+	var wr *datasource.WriteResult
+	var err error
+	if auditEnabled() {
+		wr, err = c.bulkInsertWithAudit(sdef, inf, ids, values, keys)
+	} else {
+		wr, err = inf.BulkInsert(values)
+	}
+	if err != nil {
+		c.createErrorResponse("批量插入失败，全部数据已回滚：" + err.Error())
+		return
+	}
+	r := utils.CreateRestResult(true)
+	r["msg"] = "处理成功"
+	r["affected"] = wr.RowsAffected
+	r["keys"] = keys
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// bulkInsertWithAudit 在一个事务中批量插入数据并写入审计信息，批量插入的数据量较大，审计信息直接使用插入的值
+func (c *IDSServiceHandler) bulkInsertWithAudit(sdef *SDefine, inf datasource.IBulkInsertDataSource, ids datasource.IDataSource, values []map[string]interface{}, keys []map[string]interface{}) (*datasource.WriteResult, error) {
+	tinf, ok := ids.(datasource.ITransactionDataSource)
+	if !ok {
+		return nil, fmt.Errorf("请求的服务不支持事务，不能记录审计信息")
+	}
+	audits, err := c.createInsertAuditRecords(SrvActionBULKINSERT, ids, values, keys, false)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.beginAuditTx(tinf)
+	if err != nil {
+		return nil, err
+	}
+	tinf.SetTx(tx.Tx)
+	wr, err := inf.BulkInsert(values)
+	tinf.SetTx(nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := c.commitAuditTx(sdef, tx, audits); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestBulkInsert(t *testing.T) {
+	db, clean := createTestDB(t, "bulktest", "sqlite3",
+		`CREATE TABLE "ITEM" ("ITEM_ID" varchar(50) NOT NULL,"AMOUNT" int,PRIMARY KEY ("ITEM_ID"))`)
+	defer clean()
+	count := func() int {
+		var n int
+		db.QueryRow(`SELECT count(*) FROM "ITEM"`).Scan(&n)
+		return n
+	}
+	bulk := func(rows []map[string]string) *testRRHandler {
+		rr := &testRRHandler{}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource("ITEM", "bulktest", "ITEM")
+		h.doBulkInsert(nil, nil, ids, &SRequestBody{BulkInsert: rows})
+		return rr
+	}
+
+	rows := make([]map[string]string, 0, 1200)
+	for i := 0; i < 1200; i++ {
+		rows = append(rows, map[string]string{"ITEM_ID": fmt.Sprintf("I%d", i), "AMOUNT": fmt.Sprint(i)})
+	}
+	rows = append(rows, map[string]string{"ITEM_ID": "newguid()"})
+	rr := bulk(rows)
+	if !rr.result() {
+		t.Fatalf("bulk insert failed %v", rr.response)
+	}
+	r := rr.response.(utils.RestResult)
+	keys := r["keys"].([]map[string]interface{})
+	if r["affected"] != int64(1201) || len(keys) != 1201 || keys[1]["ITEM_ID"] != "I1" || keys[1200]["ITEM_ID"] == "newguid()" {
+		t.Errorf("bulk insert result %v %v", r["affected"], keys[1200])
+	}
+	if count() != 1201 {
+		t.Errorf("bulk insert count %d", count())
+	}
+
+	// 数据转换错误时返回每一行的错误，不插入任何数据
+	rr = bulk([]map[string]string{
+		{"ITEM_ID": "J1", "AMOUNT": "1"},
+		{"ITEM_ID": "J2", "AMOUNT": "x"},
+		{"ITEM_ID": "J3", "PRICE": "1"},
+	})
+	if rr.result() {
+		t.Fatal("bulk insert with invalid rows succeeded")
+	}
+	errs := rr.response.(utils.RestResult)["errors"].([]*rowError)
+	if len(errs) != 2 || errs[0].Row != 2 || errs[1].Row != 3 {
+		t.Errorf("bulk insert errors %v", rr.response)
+	}
+
+	// 数据库错误时回滚全部插入
+	if rr = bulk([]map[string]string{{"ITEM_ID": "J1"}, {"ITEM_ID": "I1"}}); rr.result() {
+		t.Fatal("bulk insert with duplicate key succeeded")
+	}
+	if count() != 1201 {
+		t.Errorf("bulk insert not rolled back %d", count())
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tongserver.dataserver/datasource"
+)
+
+// CursorStart _cursor参数为该值时从第一页开始游标分页
+const CursorStart = "start"
+
+// cursorToken 游标的内容，Order为生成游标时的排序，Values为上一页最后一行数据中排序字段的值
+type cursorToken struct {
+	Order  string    `json:"o"`
+	Values []*string `json:"v"`
+}
+
+// cursorPaging 一次游标分页查询的排序字段和每页记录数
+type cursorPaging struct {
+	fields   []string
+	desc     bool
+	pagesize int
+}
+
+// order 返回排序的字符串形式，用于检查游标是否由相同排序的查询生成
+func (c *cursorPaging) order() string {
+	dir := " ASC"
+	if c.desc {
+		dir = " DESC"
+	}
+	return strings.Join(c.fields, ",") + dir
+}
+
+// getCursorFields 返回服务元数据cursorfields中定义的可以用于游标分页排序的非主键字段，这些字段的值不能为空
+func getCursorFields(meta map[string]interface{}) map[string]bool {
+	r := make(map[string]bool)
+	switch v := meta["cursorfields"].(type) {
+	case string:
+		for _, name := range strings.Split(v, ",") {
+			r[strings.TrimSpace(name)] = true
+		}
+	case []interface{}:
+		for _, item := range v {
+			r[strings.TrimSpace(fmt.Sprint(item))] = true
+		}
+	}
+	return r
+}
+
+// getCursorOrder 返回游标分页的排序字段和方向，orderby为报文中的OrderBy节点，没有排序的主键字段按相同的方向添加到最后
+// 排序字段必须为主键字段或者服务元数据cursorfields中定义的字段，值为空的数据无法生成游标
+func getCursorOrder(ids datasource.IDataSource, meta map[string]interface{}, orderby string) ([]string, bool, error) {
+	kfs := ids.GetKeyFields()
+	if len(kfs) == 0 {
+		return nil, false, fmt.Errorf("数据源没有主键，不能使用" + RequestParamCursor + "参数")
+	}
+	allowed := getCursorFields(meta)
+	fields := make([]string, 0, len(kfs))
+	exists := make(map[string]bool)
+	desc := false
+	if strings.TrimSpace(orderby) != "" {
+		for i, ov := range strings.Split(orderby, ",") {
+			field, dir, err := datasource.ParseOrderBy(ov)
+			if err != nil {
+				return nil, false, err
+			}
+			if ids.GetFieldByName(field) == nil && getKeyField(ids, field) == nil {
+				return nil, false, fmt.Errorf("OrderBy中的字段" + field + "不存在")
+			}
+			if getKeyField(ids, field) == nil && !allowed[field] {
+				return nil, false, fmt.Errorf("游标分页的排序字段" + field + "必须为主键字段或者服务元数据cursorfields中定义的不能为空的字段")
+			}
+			if i == 0 {
+				desc = dir == "DESC"
+			} else if desc != (dir == "DESC") {
+				return nil, false, fmt.Errorf("游标分页的排序方向必须相同")
+			}
+			if !exists[field] {
+				fields = append(fields, field)
+				exists[field] = true
+			}
+		}
+	}
+	for _, k := range kfs {
+		if !exists[k.Name] {
+			fields = append(fields, k.Name)
+		}
+	}
+	return fields, desc, nil
+}
+
+// getKeyField 返回主键字段的定义
+func getKeyField(ids datasource.IDataSource, name string) *datasource.MyProperty {
+	for _, k := range ids.GetKeyFields() {
+		if k.Name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// formatCursorValue 将排序字段的值转换为字符串，时间类型保留纳秒
+func formatCursorValue(v interface{}) *string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		s = val.Format(time.RFC3339Nano)
+	case []byte:
+		s = string(val)
+	default:
+		s = fmt.Sprint(val)
+	}
+	return &s
+}
+
+// parseCursorValue 按字段类型转换游标中的值
+func parseCursorValue(ids datasource.IDataSource, field string, value string) (interface{}, error) {
+	f := ids.GetFieldByName(field)
+	if f == nil {
+		f = getKeyField(ids, field)
+	}
+	if f == nil {
+		return value, nil
+	}
+	switch f.DataType {
+	case datasource.PropertyDatatypeTime, datasource.PropertyDatatypeDate:
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t, nil
+		}
+	case datasource.PropertyDatatypeInt:
+		//主键可能超出int的范围
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return datasource.ConvertString2Type(value, f.DataType)
+}
+
+// encodeCursor 生成不透明的游标字符串
+func encodeCursor(t *cursorToken) string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor 解析游标字符串
+func decodeCursor(s string) (*cursorToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("游标格式不正确")
+	}
+	t := &cursorToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("游标格式不正确")
+	}
+	return t, nil
+}
+
+// applyCursor 处理_cursor参数，按排序字段排序并设定游标分页条件，没有_cursor参数时返回nil
+// 游标分页必须设定_pagesize参数，忽略_pageindex参数
+func (c *IDSServiceHandler) applyCursor(ids datasource.IDataSource, meta map[string]interface{}, orderby string) (*cursorPaging, error) {
+	cursor := c.RRHandler.GetParam(RequestParamCursor)
+	if cursor == "" {
+		return nil, nil
+	}
+	pagesize, err := strconv.Atoi(c.RRHandler.GetParam(RequestParamPagesize))
+	if err != nil || pagesize <= 0 {
+		return nil, fmt.Errorf("游标分页必须设定" + RequestParamPagesize + "参数")
+	}
+	kinf, ok := ids.(datasource.IKeysetDataSource)
+	if !ok {
+		return nil, fmt.Errorf("请求的服务没有实现IKeysetDataSource接口,不能使用" + RequestParamCursor + "参数")
+	}
+	fc, ok := ids.(datasource.IFilterAdder)
+	if !ok {
+		return nil, fmt.Errorf("请求的服务没有实现IFilterAdder接口,不能使用" + RequestParamCursor + "参数")
+	}
+	fields, desc, err := getCursorOrder(ids, meta, orderby)
+	if err != nil {
+		return nil, err
+	}
+	p := &cursorPaging{fields: fields, desc: desc, pagesize: pagesize}
+	if cursor != CursorStart {
+		t, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if t.Order != p.order() || len(t.Values) != len(fields) {
+			return nil, fmt.Errorf("游标与当前查询的排序不一致")
+		}
+		values := make([]interface{}, len(fields), len(fields))
+		for i, f := range fields {
+			if t.Values[i] == nil {
+				return nil, fmt.Errorf("游标中排序字段" + f + "的值为空")
+			}
+			if values[i], err = parseCursorValue(ids, f, *t.Values[i]); err != nil {
+				return nil, fmt.Errorf("游标中排序字段" + f + "的值不正确：" + err.Error())
+			}
+		}
+		kinf.SetKeyset(fields, values, desc)
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	for _, f := range fields {
+		fc.Orderby(f, dir)
+	}
+	ids.SetRowsLimit(pagesize)
+	ids.SetRowsOffset(0)
+	return p, nil
+}
+
+// createNextCursor 根据结果集的最后一行生成下一页的游标，结果集的行数小于每页记录数时没有下一页，返回空字符串
+func (c *IDSServiceHandler) createNextCursor(p *cursorPaging, rs *datasource.DataResultSet) (string, error) {
+	if rs == nil || len(rs.Data) < p.pagesize || len(rs.Data) == 0 {
+		return "", nil
+	}
+	last := rs.Data[len(rs.Data)-1]
+	t := &cursorToken{Order: p.order(), Values: make([]*string, len(p.fields), len(p.fields))}
+	for i, f := range p.fields {
+		fd, ok := rs.Fields[f]
+		if !ok {
+			return "", fmt.Errorf("结果集中没有排序字段" + f + "，不能生成游标")
+		}
+		if t.Values[i] = formatCursorValue(last[fd.Index]); t.Values[i] == nil {
+			return "", fmt.Errorf("最后一行数据中排序字段" + f + "的值为空，不能生成游标")
+		}
+	}
+	return encodeCursor(t), nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestCursor(t *testing.T) {
+	_, clean := createTestDB(t, "cursortest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int,PRIMARY KEY ("ORG_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('A','a',2),('B','b',1),('C','c',2),('D','d',3),('E','e',1)`)
+	defer clean()
+	meta := map[string]interface{}{"cursorfields": "ORG_ORDER,ORG_NAME"}
+	// page 按游标读取全部数据，返回每一页的主键
+	page := func(action string, rBody *SRequestBody, cursor string) ([]string, string) {
+		rr := &testRRHandler{params: map[string]string{RequestParamCursor: cursor, RequestParamPagesize: "2", RequestParamPageindex: "3"}}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "cursortest", "JEDA_ORG")
+		if action == SrvActionQUERY {
+			h.doQuery(nil, meta, ids, rBody)
+		} else {
+			h.doAllData(nil, meta, ids, rBody)
+		}
+		if !rr.result() {
+			t.Fatalf("cursor page failed %v", rr.response)
+		}
+		r := rr.response.(utils.RestResult)
+		rs := r["resultset"].(*datasource.DataResultSet)
+		keys := make([]string, len(rs.Data))
+		for i, row := range rs.Data {
+			keys[i] = row[rs.Fields["ORG_ID"].Index].(string)
+		}
+		return keys, r["nextcursor"].(string)
+	}
+	readAll := func(action string, rBody *SRequestBody) string {
+		all := make([]string, 0)
+		cursor := CursorStart
+		for i := 0; cursor != ""; i++ {
+			if i > 5 {
+				t.Fatal("cursor does not end")
+			}
+			var keys []string
+			keys, cursor = page(action, rBody, cursor)
+			all = append(all, keys...)
+		}
+		return strings.Join(all, ",")
+	}
+	if got := readAll(SrvActionALLDATA, nil); got != "A,B,C,D,E" {
+		t.Errorf("all by key %s", got)
+	}
+	// 按非主键字段排序时主键作为最后的排序字段，保证排序唯一
+	if got := readAll(SrvActionQUERY, &SRequestBody{OrderBy: "ORG_ORDER desc"}); got != "D,C,A,E,B" {
+		t.Errorf("query by order desc %s", got)
+	}
+	filter := &SRequestBody{OrderBy: "ORG_ORDER", Criteria: []CriteriaInRBody{
+		{Field: "ORG_ID", Operation: "=", Value: "B", Relation: "and"},
+		{Field: "ORG_ORDER", Operation: ">", Value: "1", Relation: "or"}}}
+	if got := readAll(SrvActionQUERY, filter); got != "B,A,C,D" {
+		t.Errorf("query with or criteria %s", got)
+	}
+
+	// 游标与查询的排序不一致
+	_, next := page(SrvActionQUERY, &SRequestBody{OrderBy: "ORG_ORDER"}, CursorStart)
+	rr := &testRRHandler{params: map[string]string{RequestParamCursor: next, RequestParamPagesize: "2"}}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, meta, datasource.CreateWriteableTableDataSource("JEDA_ORG", "cursortest", "JEDA_ORG"), &SRequestBody{OrderBy: "ORG_NAME"})
+	if rr.result() {
+		t.Error("cursor with different order accepted")
+	}
+
+	// 排序字段必须为主键或者cursorfields中定义的字段
+	rr = &testRRHandler{params: map[string]string{RequestParamCursor: CursorStart, RequestParamPagesize: "2"}}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, map[string]interface{}{"cursorfields": []interface{}{"ORG_NAME"}}, datasource.CreateWriteableTableDataSource("JEDA_ORG", "cursortest", "JEDA_ORG"),
+		&SRequestBody{OrderBy: "ORG_ORDER"})
+	if rr.result() {
+		t.Error("cursor order by field not in cursorfields accepted")
+	}
+	// 排序字段的值为空时不生成无法使用的游标
+	p := &cursorPaging{fields: []string{"ORG_ORDER", "ORG_ID"}, pagesize: 1}
+	rs := &datasource.DataResultSet{Fields: datasource.FieldDescType{"ORG_ID": {Index: 0}, "ORG_ORDER": {Index: 1}},
+		Data: [][]interface{}{{"A", nil}}}
+	if next, err := h.createNextCursor(p, rs); err == nil {
+		t.Errorf("cursor with null order value %s", next)
+	}
+}
@@ -0,0 +1,493 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+const (
+	// ImportInsert 只插入数据，主键已经存在时失败
+	ImportInsert string = "insert"
+	// ImportUpsert 主键存在时更新数据，不存在时插入数据
+	ImportUpsert string = "upsert"
+	// ImportReplace 删除全部数据后插入文件中的数据
+	ImportReplace string = "replace"
+
+	// importFileField 上传文件的表单字段名
+	importFileField = "file"
+	// importBatchSize 每批写入的行数
+	importBatchSize = 500
+	// importMaxErrors 错误报告中最多返回的错误数
+	importMaxErrors = 1000
+	// excelMaxSerial Excel支持的最大日期序列号，对应9999-12-31
+	excelMaxSerial = 2958465
+)
+
+// IFileRequestHandler 可以读取上传文件的请求响应句柄，beego.Controller已经实现了该接口
+type IFileRequestHandler interface {
+	GetFile(key string) (multipart.File, *multipart.FileHeader, error)
+}
+
+// importRowReader 逐行读取导入文件
+type importRowReader interface {
+	Read() ([]string, error)
+}
+
+// importNumericReader 可以判断当前行的单元格是否为数字的读取器，xlsx文件的读取器实现了该接口
+type importNumericReader interface {
+	IsNumeric(index int) bool
+}
+
+// importColumn 文件中的一列对应的字段
+type importColumn struct {
+	index int
+	field *datasource.MyProperty
+}
+
+// importBatch 导入时一批待写入的数据
+type importBatch struct {
+	rows   []int
+	values []map[string]interface{}
+}
+
+// importResult 导入的结果
+type importResult struct {
+	// rows 文件中数据的行数，不包括标题行
+	rows     int
+	inserted int64
+	updated  int64
+	deleted  int64
+	errs     []*rowError
+	// errCount 错误总数，超过importMaxErrors的错误不返回
+	errCount int
+	audits   []*auditRecord
+}
+
+// addError 添加一行数据的错误
+func (c *importResult) addError(row int, msg string) {
+	c.errCount++
+	if len(c.errs) < importMaxErrors {
+		c.errs = append(c.errs, &rowError{Row: row, Msg: msg})
+	}
+}
+
+// createImportReader 根据_format参数或文件扩展名创建文件的读取器，返回的函数用于关闭读取器
+func createImportReader(file multipart.File, header *multipart.FileHeader, format string) (importRowReader, func(), error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	switch format {
+	case ExportXLSX:
+		xr, err := utils.NewXLSXReader(file, header.Size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, func() { xr.Close() }, nil
+	case ExportCSV, ExportTSV:
+		cr := csv.NewReader(file)
+		if format == ExportTSV {
+			cr.Comma = '\t'
+		}
+		cr.FieldsPerRecord = -1
+		return cr, func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("导入文件的格式必须为" + ExportCSV + "、" + ExportTSV + "或" + ExportXLSX)
+}
+
+// getImportColumns 根据标题行返回每一列对应的字段，mapping为空时按字段名或字段的显示名匹配，不区分大小写，没有匹配的列被忽略
+// mapping为标题到字段名的映射，只导入mapping中的列
+func getImportColumns(ids datasource.IDataSource, header []string, mapping map[string]string) ([]*importColumn, error) {
+	fields := make(map[string]*datasource.MyProperty)
+	for _, f := range ids.GetFields() {
+		fields[strings.ToUpper(f.Name)] = f
+		if f.Caption != "" {
+			fields[strings.ToUpper(f.Caption)] = f
+		}
+	}
+	cols := make([]*importColumn, 0, len(header))
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if i == 0 {
+			//去掉Excel保存CSV时添加的BOM
+			h = strings.TrimPrefix(h, "\uFEFF")
+		}
+		if mapping != nil {
+			name, ok := mapping[h]
+			if !ok {
+				continue
+			}
+			f := ids.GetFieldByName(name)
+			if f == nil {
+				return nil, fmt.Errorf("映射中的字段" + name + "不存在")
+			}
+			cols = append(cols, &importColumn{index: i, field: f})
+			continue
+		}
+		if f, ok := fields[strings.ToUpper(h)]; ok {
+			cols = append(cols, &importColumn{index: i, field: f})
+		}
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("文件的标题行中没有与数据源字段对应的列")
+	}
+	return cols, nil
+}
+
+// convertImportCell 转换一个单元格的值，numeric为true表示xlsx中的数字单元格，此时日期和时间字段的值为Excel的日期序列号
+func convertImportCell(value string, f *datasource.MyProperty, numeric bool) (interface{}, error) {
+	if value == "newguid()" {
+		return xid.New().String(), nil
+	}
+	if numeric && (f.DataType == datasource.PropertyDatatypeDate || f.DataType == datasource.PropertyDatatypeTime) {
+		serial, err := strconv.ParseFloat(value, 64)
+		if err != nil || serial < 1 || serial >= excelMaxSerial+1 {
+			return nil, fmt.Errorf("字段值不是有效的Excel日期，字段：" + f.Name + ",值：" + value)
+		}
+		t := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).Add(time.Duration(serial * 24 * float64(time.Hour)))
+		return t.Round(time.Second), nil
+	}
+	v, err := datasource.ConvertString2Type(value, f.DataType)
+	if err != nil {
+		return nil, fmt.Errorf("字段值类型转换失败，字段：" + f.Name + ",值：" + value + "，预期类型：" + f.DataType)
+	}
+	return v, nil
+}
+
+// convertImportRow 转换一行数据，空单元格不写入，required中的字段不能为空
+// reader实现了importNumericReader接口时按单元格类型转换日期和时间字段
+func convertImportRow(reader importRowReader, record []string, cols []*importColumn, required []string) (map[string]interface{}, error) {
+	nr, _ := reader.(importNumericReader)
+	values := make(map[string]interface{})
+	for _, col := range cols {
+		if col.index >= len(record) {
+			continue
+		}
+		s := strings.TrimSpace(record[col.index])
+		if s == "" {
+			continue
+		}
+		v, err := convertImportCell(s, col.field, nr != nil && nr.IsNumeric(col.index))
+		if err != nil {
+			return nil, err
+		}
+		values[col.field.Name] = v
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	for _, name := range required {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("字段" + name + "不能为空")
+		}
+	}
+	return values, nil
+}
+
+// getImportRequired 返回不能为空的字段，包括服务元数据中importrequired定义的字段和主键字段
+// insert模式下文件中没有主键列时主键由数据库生成
+func getImportRequired(ids datasource.IDataSource, meta map[string]interface{}, cols []*importColumn, mode string) ([]string, error) {
+	mapped := make(map[string]bool)
+	for _, col := range cols {
+		mapped[col.field.Name] = true
+	}
+	required := make([]string, 0)
+	for _, k := range ids.GetKeyFields() {
+		if mode != ImportInsert || mapped[k.Name] {
+			required = append(required, k.Name)
+		}
+	}
+	var names []string
+	switch v := meta["importrequired"].(type) {
+	case string:
+		names = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			names = append(names, fmt.Sprint(item))
+		}
+	}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if ids.GetFieldByName(name) == nil {
+			return nil, fmt.Errorf("服务元数据importrequired中的字段" + name + "不存在")
+		}
+		required = append(required, name)
+	}
+	for _, name := range required {
+		if !mapped[name] {
+			return nil, fmt.Errorf("文件中没有不能为空的字段" + name + "对应的列")
+		}
+	}
+	return required, nil
+}
+
+// writeImportBatch 写入一批数据，insert和replace模式批量插入，upsert模式逐行插入或更新，写入失败时在result中记录错误
+func (c *IDSServiceHandler) writeImportBatch(ids datasource.IDataSource, mode string, batch *importBatch, result *importResult) {
+	if len(batch.values) == 0 {
+		return
+	}
+	defer func() {
+		batch.rows = batch.rows[:0]
+		batch.values = batch.values[:0]
+	}()
+	if mode == ImportUpsert {
+		inf := ids.(datasource.IUpsertDataSource)
+		for i, v := range batch.values {
+			var before map[string]interface{}
+			var err error
+			key := getKeyValues(ids, v)
+			if auditEnabled() && key != nil {
+				before, err = c.queryAuditRow(ids, key)
+			}
+			inserted := false
+			if err == nil {
+				_, inserted, err = inf.Upsert(v)
+			}
+			if err == nil && auditEnabled() {
+				err = c.appendUpsertAudit(&result.audits, ids, key, before, v)
+			}
+			if err != nil {
+				result.addError(batch.rows[i], "写入数据失败："+err.Error())
+				return
+			}
+			if inserted {
+				result.inserted++
+			} else {
+				result.updated++
+			}
+		}
+		return
+	}
+	wr, err := ids.(datasource.IBulkInsertDataSource).BulkInsert(batch.values)
+	if err != nil {
+		result.addError(batch.rows[0], fmt.Sprintf("第%d行至第%d行数据写入失败：%s", batch.rows[0], batch.rows[len(batch.rows)-1], err.Error()))
+		return
+	}
+	result.inserted += wr.RowsAffected
+	if auditEnabled() {
+		keys := make([]map[string]interface{}, len(batch.values), len(batch.values))
+		for i, v := range batch.values {
+			keys[i] = c.getInsertedKeys(ids, v, nil)
+		}
+		audits, err := c.createInsertAuditRecords(SrvActionIMPORT, ids, batch.values, keys, false)
+		if err != nil {
+			result.addError(batch.rows[0], "创建审计信息时发生错误："+err.Error())
+			return
+		}
+		result.audits = append(result.audits, audits...)
+	}
+}
+
+// importRows 在事务中逐行读取文件并分批写入，出现错误后不再写入，继续读取文件检查其他行的数据
+func (c *IDSServiceHandler) importRows(ids datasource.IDataSource, reader importRowReader, cols []*importColumn, required []string, mode string) (*importResult, error) {
+	result := &importResult{errs: make([]*rowError, 0)}
+	if mode == ImportReplace {
+		//删除满足userfilter条件的原有数据
+		var before *datasource.DataResultSet
+		var err error
+		if auditEnabled() {
+			if before, err = c.getMatchedData(ids); err != nil {
+				return nil, fmt.Errorf("读取原有数据时发生错误：" + err.Error())
+			}
+		}
+		wr, err := ids.(datasource.IWriteableDataSource).Delete()
+		if err != nil {
+			return nil, fmt.Errorf("删除原有数据时发生错误：" + err.Error())
+		}
+		result.deleted = wr.RowsAffected
+		if auditEnabled() {
+			if result.audits, err = c.createAuditRecords(SrvActionIMPORT, ids, nil, before, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	batch := &importBatch{rows: make([]int, 0, importBatchSize), values: make([]map[string]interface{}, 0, importBatchSize)}
+	//标题行为第1行
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, fmt.Errorf(fmt.Sprintf("读取文件第%d行时发生错误：%s", line, err.Error()))
+			}
+			result.rows++
+			result.addError(line, err.Error())
+			continue
+		}
+		values, err := convertImportRow(reader, record, cols, required)
+		if values == nil && err == nil {
+			//忽略空行
+			continue
+		}
+		result.rows++
+		if err != nil {
+			result.addError(line, err.Error())
+			continue
+		}
+		if result.errCount != 0 {
+			continue
+		}
+		batch.rows = append(batch.rows, line)
+		batch.values = append(batch.values, values)
+		if len(batch.values) == importBatchSize {
+			c.writeImportBatch(ids, mode, batch, result)
+		}
+	}
+	if result.errCount == 0 {
+		c.writeImportBatch(ids, mode, batch, result)
+	}
+	return result, nil
+}
+
+// setImportReplaceCriteria 检查服务是否允许replace模式导入，并将userfilter条件设定为删除原有数据的条件
+// replace模式删除全部数据，服务元数据必须设定importreplace为true
+func (c *IDSServiceHandler) setImportReplaceCriteria(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource) error {
+	if enabled, _ := meta["importreplace"].(bool); !enabled {
+		return fmt.Errorf("服务元数据没有设定importreplace为true，不能使用" + ImportReplace + "模式导入")
+	}
+	var rBody *SRequestBody
+	if _, err := c.doUserFilter(sdef, meta, ids, &rBody); err != nil {
+		return err
+	}
+	if rBody == nil {
+		return nil
+	}
+	return c.fillCriteriaFromRbody(ids, rBody)
+}
+
+// doImport 处理导入，multipart请求的file字段为导入的csv、tsv或xlsx文件，第一行为标题行
+// 全部数据在一个事务中分批写入，任何一行有错误时回滚全部数据，errors节点返回每一行的错误信息
+func (c *IDSServiceHandler) doImport(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	fh, ok := c.RRHandler.(IFileRequestHandler)
+	if !ok {
+		c.createErrorResponse("当前的请求不支持上传文件")
+		return
+	}
+	mode := c.RRHandler.GetParam(RequestParamImportMode)
+	if mode == "" {
+		mode = ImportInsert
+	}
+	if mode != ImportInsert && mode != ImportUpsert && mode != ImportReplace {
+		c.createErrorResponse(RequestParamImportMode + "参数必须为" + ImportInsert + "、" + ImportUpsert + "或" + ImportReplace)
+		return
+	}
+	dryrun, _ := strconv.ParseBool(c.RRHandler.GetParam(RequestParamDryRun))
+	if _, ok := ids.(datasource.IWriteableDataSource); !ok {
+		c.createErrorResponse("请求的服务没有实现DataSource.IWriteableDataSource接口")
+		return
+	}
+	if _, ok := ids.(datasource.IBulkInsertDataSource); !ok && mode != ImportUpsert {
+		c.createErrorResponse("请求的服务没有实现DataSource.IBulkInsertDataSource接口")
+		return
+	}
+	if _, ok := ids.(datasource.IUpsertDataSource); !ok && mode == ImportUpsert {
+		c.createErrorResponse("请求的服务没有实现DataSource.IUpsertDataSource接口")
+		return
+	}
+	if sinf, ok := ids.(datasource.ISoftDeleteDataSource); ok && sinf.IsSoftDelete() && mode == ImportReplace {
+		c.createErrorResponse("请求的服务使用了软删除，不能使用" + ImportReplace + "模式导入")
+		return
+	}
+	if mode == ImportReplace {
+		if err := c.setImportReplaceCriteria(sdef, meta, ids); err != nil {
+			c.createErrorResponse(err.Error())
+			return
+		}
+	}
+	tinf, ok := ids.(datasource.ITransactionDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务不支持事务")
+		return
+	}
+	var mapping map[string]string
+	if m := c.RRHandler.GetParam(RequestParamImportMapping); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			c.createErrorResponse(RequestParamImportMapping + "参数必须为标题到字段名映射的JSON对象")
+			return
+		}
+	}
+	file, header, err := fh.GetFile(importFileField)
+	if err != nil {
+		c.createErrorResponse("读取上传的文件时发生错误：" + err.Error())
+		return
+	}
+	defer file.Close()
+	reader, closeReader, err := createImportReader(file, header, c.RRHandler.GetParam(RequestParamFormat))
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	defer closeReader()
+	head, err := reader.Read()
+	if err != nil {
+		c.createErrorResponse("读取文件的标题行时发生错误：" + err.Error())
+		return
+	}
+	cols, err := getImportColumns(ids, head, mapping)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	required, err := getImportRequired(ids, meta, cols, mode)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+
+	tx, err := c.beginAuditTx(tinf)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	tinf.SetTx(tx.Tx)
+	result, err := c.importRows(ids, reader, cols, required, mode)
+	tinf.SetTx(nil)
+	if err != nil || result.errCount != 0 || dryrun {
+		if e := tx.Rollback(); e != nil && err == nil {
+			err = fmt.Errorf("回滚事务时发生错误：" + e.Error())
+		}
+	} else {
+		err = c.commitAuditTx(sdef, tx, result.audits)
+	}
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	if result.errCount != 0 {
+		r := utils.CreateRestResult(false)
+		r["msg"] = fmt.Sprintf("%d行数据有错误，没有写入任何数据", result.errCount)
+		r["errors"] = result.errs
+		r["rows"] = int64(result.rows)
+		c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+		return
+	}
+	r := utils.CreateRestResult(true)
+	r["msg"] = "处理成功"
+	if dryrun {
+		r["msg"] = "检查成功，没有写入任何数据"
+	}
+	r["mode"] = mode
+	r["dryrun"] = dryrun
+	r["rows"] = int64(result.rows)
+	r["inserted"] = result.inserted
+	r["updated"] = result.updated
+	r["deleted"] = result.deleted
+	r["affected"] = result.inserted + result.updated
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// testFile 测试用的上传文件
+type testFile struct {
+	*bytes.Reader
+}
+
+func (c *testFile) Close() error {
+	return nil
+}
+
+// testFileRRHandler 测试用的支持上传文件的请求响应句柄
+type testFileRRHandler struct {
+	testRRHandler
+	name string
+	data []byte
+}
+
+func (c *testFileRRHandler) GetFile(key string) (multipart.File, *multipart.FileHeader, error) {
+	return &testFile{bytes.NewReader(c.data)}, &multipart.FileHeader{Filename: c.name, Size: int64(len(c.data))}, nil
+}
+
+func TestImport(t *testing.T) {
+	db, clean := createTestDB(t, "importtest", "sqlite3",
+		`CREATE TABLE "ITEM" ("ITEM_ID" varchar(50) NOT NULL,"ITEM_NAME" varchar(100),"AMOUNT" int,PRIMARY KEY ("ITEM_ID"))`)
+	defer clean()
+	count := func() int {
+		var n int
+		db.QueryRow(`SELECT count(*) FROM "ITEM"`).Scan(&n)
+		return n
+	}
+	doImport := func(name string, data []byte, params map[string]string) utils.RestResult {
+		rr := &testFileRRHandler{testRRHandler: testRRHandler{params: params}, name: name, data: data}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource("ITEM", "importtest", "ITEM")
+		h.doImport(nil, map[string]interface{}{"importreplace": true}, ids, nil)
+		return rr.response.(utils.RestResult)
+	}
+
+	csv := bytes.NewBufferString("\xEF\xBB\xBFitem_id,ITEM_NAME,AMOUNT,REMARK\n")
+	for i := 0; i < 1200; i++ {
+		csv.WriteString("I" + string(rune('0'+i%10)) + string(rune('A'+i/10%26)) + string(rune('a'+i/260)) + ",name,1,x\n")
+	}
+	csv.WriteString(",,,\n")
+	r := doImport("item.csv", csv.Bytes(), nil)
+	if r["result"] != true || r["rows"] != int64(1200) || r["inserted"] != int64(1200) || count() != 1200 {
+		t.Fatalf("csv import %v %d", r, count())
+	}
+
+	// 任何一行有错误时返回每一行的错误，不写入任何数据
+	r = doImport("item.csv", []byte("ITEM_ID,AMOUNT\nJ1,1\nJ2,x\n,2\nJ4,4\n"), nil)
+	errs, _ := r["errors"].([]*rowError)
+	if r["result"] != false || len(errs) != 2 || errs[0].Row != 3 || errs[1].Row != 4 || count() != 1200 {
+		t.Fatalf("import with invalid rows %v", r)
+	}
+	// 数据库错误时回滚已经写入的数据
+	r = doImport("item.csv", []byte("ITEM_ID,AMOUNT\nJ1,1\nI0Aa,2\n"), nil)
+	if r["result"] != false || count() != 1200 {
+		t.Fatalf("import duplicate key %v %d", r, count())
+	}
+
+	// 只检查不写入
+	r = doImport("item.tsv", []byte("ITEM_ID\tAMOUNT\nJ1\t1\n"), map[string]string{RequestParamDryRun: "true"})
+	if r["result"] != true || r["rows"] != int64(1) || count() != 1200 {
+		t.Fatalf("dryrun import %v", r)
+	}
+
+	// 按映射导入并更新已有数据
+	r = doImport("item.csv", []byte("编号,数量\nI0Aa,9\nJ1,1\n"), map[string]string{
+		RequestParamImportMode: ImportUpsert, RequestParamImportMapping: `{"编号":"ITEM_ID","数量":"AMOUNT"}`})
+	var amount int
+	db.QueryRow(`SELECT AMOUNT FROM "ITEM" WHERE ITEM_ID='I0Aa'`).Scan(&amount)
+	if r["result"] != true || r["inserted"] != int64(1) || r["updated"] != int64(1) || amount != 9 || count() != 1201 {
+		t.Fatalf("upsert import %v %d", r, amount)
+	}
+
+	// xlsx文件删除全部数据后导入
+	buf := &bytes.Buffer{}
+	xw, _ := utils.NewXLSXWriter(buf, "item")
+	xw.WriteRow([]interface{}{"ITEM_ID", "ITEM_NAME", "AMOUNT"})
+	xw.WriteRow([]interface{}{"X1", "名称", 3})
+	xw.WriteRow([]interface{}{"X2", nil, 4.0})
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r = doImport("item.xlsx", buf.Bytes(), map[string]string{RequestParamImportMode: ImportReplace})
+	var name string
+	db.QueryRow(`SELECT ITEM_NAME FROM "ITEM" WHERE ITEM_ID='X1'`).Scan(&name)
+	if r["result"] != true || r["deleted"] != int64(1201) || r["inserted"] != int64(2) || count() != 2 || name != "名称" {
+		t.Fatalf("replace import %v %d %s", r, count(), name)
+	}
+
+	if r = doImport("item.txt", []byte("ITEM_ID\nY1\n"), nil); r["result"] != false {
+		t.Errorf("unsupported format accepted %v", r)
+	}
+	if r = doImport("item.csv", []byte("A,B\n1,2\n"), nil); r["result"] != false {
+		t.Errorf("file without field columns accepted %v", r)
+	}
+}
+
+func TestConvertImportCell(t *testing.T) {
+	f := &datasource.MyProperty{Name: "BIRTHDAY", DataType: datasource.PropertyDatatypeDate}
+	// xlsx的数字单元格为Excel日期序列号
+	v, err := convertImportCell("45292", f, true)
+	if err != nil || v.(time.Time).Format("2006-01-02") != "2024-01-01" {
+		t.Errorf("xlsx serial date %v %v", v, err)
+	}
+	for _, s := range []string{"0", "-1", "2958466", "1e10"} {
+		if v, err := convertImportCell(s, f, true); err == nil {
+			t.Errorf("serial %s accepted as %v", s, v)
+		}
+	}
+	// csv中的数字不按日期序列号转换
+	if v, err := convertImportCell("20240101", f, false); err == nil {
+		t.Errorf("csv number accepted as date %v", v)
+	}
+	v, err = convertImportCell("2024-01-01", f, false)
+	if err != nil || v.(time.Time).Format("2006-01-02") != "2024-01-01" {
+		t.Errorf("csv date %v %v", v, err)
+	}
+}
+
+func TestImportReplace(t *testing.T) {
+	db, clean := createTestDB(t, "importreplace", "sqlite3",
+		`CREATE TABLE "ITEM" ("ITEM_ID" varchar(50) NOT NULL,"ITEM_NAME" varchar(100),"OWNER" varchar(50),"DELETED" int,PRIMARY KEY ("ITEM_ID"))`,
+		`CREATE TABLE "G_AUDIT" ("ID" varchar(50) NOT NULL,"SERVICE" varchar(150),"IDS" varchar(150),"ACTION" varchar(45),"USER_ID" varchar(50),`+
+			`"RECORD_KEY" varchar(500),"CRITERIA" text,"BEFORE_DATA" text,"AFTER_DATA" text,"CREATE_TIME" datetime,PRIMARY KEY ("ID"))`,
+		`INSERT INTO "ITEM" VALUES ('A','a','u1',0),('B','b','u1',0),('O','o','u2',0)`)
+	defer clean()
+	datasource.AddIdsCreator("CreateImportReplaceTestIds", func(p datasource.IDSContainerParam) interface{} {
+		return datasource.CreateWriteableTableDataSource(p["name"].(string), "importreplace", p["tablename"].(string))
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["importreplace.G_AUDIT"] = datasource.IDSContainerParam{
+		"inf": "CreateImportReplaceTestIds", "name": "G_AUDIT", "tablename": "G_AUDIT"}
+	AuditIds = "importreplace.G_AUDIT"
+	defer func() { AuditIds = "" }()
+	meta := map[string]interface{}{"importreplace": true, "userfilter": map[string]interface{}{"filterkey": "OWNER", "values": "userid"}}
+	doImport := func(meta map[string]interface{}, softDelete bool) utils.RestResult {
+		rr := &testFileRRHandler{testRRHandler: testRRHandler{params: map[string]string{RequestParamImportMode: ImportReplace}},
+			name: "item.csv", data: []byte("ITEM_ID,ITEM_NAME,OWNER\nC,c,u1\n")}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: "u1"}}
+		ids := datasource.CreateWriteableTableDataSource("ITEM", "importreplace", "ITEM")
+		if softDelete {
+			ids.SoftDelete = &datasource.SoftDeleteDefine{Field: "DELETED", Value: 1, RestoreValue: 0}
+		}
+		h.doImport(nil, meta, ids, nil)
+		return rr.response.(utils.RestResult)
+	}
+	var n int
+	// 服务元数据没有设定importreplace时不能使用replace模式
+	if r := doImport(nil, false); r["result"] != false {
+		t.Fatalf("replace import without importreplace %v", r)
+	}
+	// 使用软删除的数据源不能使用replace模式
+	if r := doImport(meta, true); r["result"] != false {
+		t.Fatalf("replace import on soft delete source %v", r)
+	}
+	// 只删除满足userfilter条件的数据，删除的数据记录审计信息
+	if r := doImport(meta, false); r["result"] != true || r["deleted"] != int64(2) {
+		t.Fatalf("replace import %v", r)
+	}
+	db.QueryRow(`SELECT count(*) FROM "ITEM" WHERE "ITEM_ID" IN ('O','C')`).Scan(&n)
+	if n != 2 {
+		t.Errorf("replace import outside userfilter %d", n)
+	}
+	db.QueryRow(`SELECT count(*) FROM "G_AUDIT" WHERE "ACTION"=? AND "BEFORE_DATA" IS NOT NULL AND "BEFORE_DATA"<>'' AND "RECORD_KEY" IN ('["A"]','["B"]')`, SrvActionIMPORT).Scan(&n)
+	if n != 2 {
+		t.Errorf("audit of deleted rows %d", n)
+	}
+	db.QueryRow(`SELECT count(*) FROM "G_AUDIT"`).Scan(&n)
+	if n != 3 {
+		t.Errorf("audit records %d", n)
+	}
+}
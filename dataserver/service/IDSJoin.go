@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"tongserver.dataserver/datasource"
+)
+
+// getJoinDataSource 返回连接节点中引用的数据源，数据源必须属于当前服务的项目并且在服务元数据joinids中列出
+func (c *IDSServiceHandler) getJoinDataSource(sdef *SDefine, meta map[string]interface{}, name string) (datasource.ICriteriaDataSource, error) {
+	obj, err := c.createMetaDataSource(sdef, meta, "joinids", name)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := obj.(datasource.ICriteriaDataSource)
+	if !ok {
+		return nil, fmt.Errorf("InnerJoin中的数据源" + name + "没有实现ICriteriaDataSource接口")
+	}
+	return r, nil
+}
+
+// applyJoin 处理rbody中的InnerJoin节点，按顺序连接各个数据源
+// 连接后Criteria、Filter、OrderBy和Aggre中可以使用“别名.字段名”引用连接表的字段
+func (c *IDSServiceHandler) applyJoin(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, joins []*JoinInRBody) error {
+	jds, ok := ids.(datasource.IJoinedDataSource)
+	if !ok {
+		return fmt.Errorf("请求的服务没有实现IJoinedDataSource接口,不能处理InnerJoin节点")
+	}
+	for _, j := range joins {
+		if j == nil || j.Ids == "" {
+			return fmt.Errorf("InnerJoin中没有指定连接的数据源")
+		}
+		if len(j.On) == 0 {
+			return fmt.Errorf("InnerJoin中数据源" + j.Ids + "没有定义连接条件")
+		}
+		join := datasource.INNER_JOIN
+		switch strings.ToLower(j.Join) {
+		case "", "inner":
+		case "left":
+			join = datasource.INNER_LEFT
+		default:
+			return fmt.Errorf("InnerJoin中的连接类型" + j.Join + "不支持")
+		}
+		rds, err := c.getJoinDataSource(sdef, meta, j.Ids)
+		if err != nil {
+			return err
+		}
+		outfield := make([]string, len(j.Fields), len(j.Fields))
+		outalias := make([]string, len(j.Fields), len(j.Fields))
+		for i, f := range j.Fields {
+			outfield[i] = f.Field
+			outalias[i] = f.As
+		}
+		p, err := jds.JoinTable(join, rds, j.Alias, outfield, outalias)
+		if err != nil {
+			return err
+		}
+		for _, on := range j.On {
+			f := rds.GetFieldByName(on.Field)
+			if f == nil {
+				return fmt.Errorf("InnerJoin中数据源" + j.Ids + "没有字段" + on.Field)
+			}
+			op := datasource.NormalizeOperation(on.Operation)
+			if op == "" {
+				op = datasource.OperEq
+			}
+			if !datasource.IsValidOperation(op) || op == datasource.OperKeyset {
+				return fmt.Errorf("InnerJoin中字段" + on.Field + "的操作符" + on.Operation + "不支持")
+			}
+			if on.RefField != "" {
+				//引用字段只能用于比较，其他操作符需要常量值
+				switch op {
+				case datasource.OperEq, datasource.OperNoteq, datasource.OperGt, datasource.OperLt, datasource.OperGtEg, datasource.OperLtEg:
+				default:
+					return fmt.Errorf("InnerJoin中字段" + on.Field + "引用字段时操作符" + on.Operation + "不支持")
+				}
+				v, err := c.createJoinRefField(jds, on.RefField)
+				if err != nil {
+					return err
+				}
+				p.AddCriteria(on.Field, op, datasource.CompAnd, v)
+				continue
+			}
+			v, err := c.convertCriteriaValue(on.Field, op, on.Value, rds)
+			if err != nil {
+				return err
+			}
+			p.AddCriteria(on.Field, op, datasource.CompAnd, v)
+		}
+	}
+	return nil
+}
+
+// createJoinRefField 将连接条件中引用的字段转换为带表名的字段，没有别名的字段为主表的字段
+func (c *IDSServiceHandler) createJoinRefField(jds datasource.IJoinedDataSource, ref string) (*datasource.FieldNameWithTableName, error) {
+	if jds.GetFieldByName(ref) == nil {
+		return nil, fmt.Errorf("InnerJoin中引用的字段" + ref + "不存在")
+	}
+	if i := strings.Index(ref, "."); i != -1 {
+		return &datasource.FieldNameWithTableName{Tablename: ref[:i], Fielname: ref[i+1:]}, nil
+	}
+	return &datasource.FieldNameWithTableName{Tablename: jds.GetTableName(), Fielname: ref}, nil
+}
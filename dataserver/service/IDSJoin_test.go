@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestQueryJoin(t *testing.T) {
+	db, clean := createTestDB(t, "jointest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"PARENT_ID" varchar(50),"ORG_ORDER" int,"DELETED" int,PRIMARY KEY ("ORG_ID"))`,
+		`CREATE TABLE "JEDA_USER" ("USER_ID" varchar(50) NOT NULL,"USER_NAME" varchar(100),"ORG_ID" varchar(50),PRIMARY KEY ("USER_ID"))`)
+	defer clean()
+	for _, s := range []string{
+		`INSERT INTO "JEDA_ORG" VALUES ('R','root',NULL,0,NULL),('A','orgA','R',1,NULL),('B','orgB','R',2,0),('C','orgC','A',3,NULL),('D','orgD',NULL,4,1)`,
+		`INSERT INTO "JEDA_USER" VALUES ('u1','user1','A'),('u2','user2','B'),('u3','user3','C'),('u4','user4','X'),('u5','user5','D')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	datasource.AddIdsCreator("CreateJoinTestIds", func(p datasource.IDSContainerParam) interface{} {
+		ids := datasource.CreateWriteableTableDataSource(p["name"].(string), "jointest", p["tablename"].(string))
+		ids.SoftDelete = &datasource.SoftDeleteDefine{Field: "DELETED", Value: 1}
+		return ids
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["join.JEDA_ORG"] = datasource.IDSContainerParam{
+		"inf": "CreateJoinTestIds", "name": "JEDA_ORG", "tablename": "JEDA_ORG"}
+	sdef := &SDefine{ProjectId: "join"}
+	meta := map[string]interface{}{"joinids": "JEDA_ORG"}
+	query := func(ids datasource.IDataSource, body string) *testRRHandler {
+		rBody := &SRequestBody{}
+		if err := json.Unmarshal([]byte(body), rBody); err != nil {
+			t.Fatal(err)
+		}
+		rr := &testRRHandler{}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		h.doQuery(sdef, meta, ids, rBody)
+		return rr
+	}
+
+	// 用户连接机构，机构再连接上级机构，条件和排序引用连接表的字段，已经删除的机构D不连接
+	rr := query(datasource.CreateWriteableTableDataSource("JEDA_USER", "jointest", "JEDA_USER"), `{
+		"InnerJoin":[
+			{"Ids":"JEDA_ORG","Alias":"O","On":[{"Field":"ORG_ID","RefField":"ORG_ID"}],"Fields":[{"Field":"ORG_NAME"}]},
+			{"Ids":"JEDA_ORG","Alias":"P","Join":"left","On":[{"Field":"ORG_ID","RefField":"O.PARENT_ID"},{"Field":"ORG_ORDER","Operation":">","Value":"0"}],
+				"Fields":[{"Field":"ORG_NAME","As":"PARENT_NAME"}]}],
+		"Criteria":[{"Field":"O.ORG_ORDER","Operation":">","Value":"1","Relation":"and"}],
+		"OrderBy":"O.ORG_ORDER desc"}`)
+	if !rr.result() {
+		t.Fatalf("join query failed %v", rr.response)
+	}
+	rs := rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet)
+	if len(rs.Data) != 2 || len(rs.Fields) != 5 || rs.Fields["PARENT_NAME"].Index != 4 {
+		t.Fatalf("join result %v %v", rs.Fields, rs.Data)
+	}
+	if r := rs.Data[0]; r[rs.Fields["USER_ID"].Index] != "u3" || r[rs.Fields["ORG_NAME"].Index] != "orgC" || r[rs.Fields["PARENT_NAME"].Index] != "orgA" {
+		t.Errorf("join row %v", r)
+	}
+	// ORG_ORDER>0的条件在连接条件中，不满足时只是没有连接上级机构
+	if r := rs.Data[1]; r[rs.Fields["USER_ID"].Index] != "u2" || r[rs.Fields["PARENT_NAME"].Index] == "root" {
+		t.Errorf("left join row %v", r)
+	}
+
+	// 自连接必须指定别名，聚合中可以使用连接表的字段
+	rr = query(datasource.CreateWriteableTableDataSource("JEDA_ORG", "jointest", "JEDA_ORG"), `{
+		"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}]}],
+		"Aggre":[{"Outfield":"MAXORDER","Predicate":"max","ColName":"P.ORG_ORDER"}],"OrderBy":"ORG_ID"}`)
+	if !rr.result() {
+		t.Fatalf("self join failed %v", rr.response)
+	}
+	rs = rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet)
+	if len(rs.Data) != 3 || rs.Data[0][rs.Fields["MAXORDER"].Index] != int64(0) || rs.Data[2][rs.Fields["MAXORDER"].Index] != int64(1) {
+		t.Errorf("self join aggre %v", rs.Data)
+	}
+
+	for name, body := range map[string]string{
+		"self join without alias": `{"InnerJoin":[{"Ids":"JEDA_ORG","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}]}]}`,
+		"unknown ids":             `{"InnerJoin":[{"Ids":"NONE","Alias":"P","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}]}]}`,
+		"ids with project":        `{"InnerJoin":[{"Ids":"join.JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}]}]}`,
+		"ids not in joinids":      `{"InnerJoin":[{"Ids":"JEDA_USER","Alias":"P","On":[{"Field":"USER_ID","RefField":"ORG_ID"}]}]}`,
+		"no on":                   `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P"}]}`,
+		"unknown field":           `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID;","RefField":"PARENT_ID"}]}]}`,
+		"unknown ref":             `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","RefField":"Q.ORG_ID"}]}]}`,
+		"duplicate out field":     `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}],"Fields":[{"Field":"ORG_NAME"}]}]}`,
+		"between with ref":        `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","Operation":"between","RefField":"PARENT_ID"}]}]}`,
+		"like with ref":           `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","On":[{"Field":"ORG_ID","Operation":"like","RefField":"PARENT_ID"}]}]}`,
+		"join type":               `{"InnerJoin":[{"Ids":"JEDA_ORG","Alias":"P","Join":"cross","On":[{"Field":"ORG_ID","RefField":"PARENT_ID"}]}]}`,
+	} {
+		if rr := query(datasource.CreateWriteableTableDataSource("JEDA_ORG", "jointest", "JEDA_ORG"), body); rr.result() {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
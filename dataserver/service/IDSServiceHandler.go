@@ -106,113 +106,453 @@ func (c *IDSServiceHandler) checkWriteableInf(ids interface{}) datasource.IWrite
 
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////
 //从报文中提取字段值并进行转换
-func (c *IDSServiceHandler) getVauleMapFromStringMap(svalue map[string]string, ids datasource.IDataSource) map[string]interface{} {
+func (c *IDSServiceHandler) getVauleMapFromStringMap(svalue map[string]string, ids datasource.IDataSource) (map[string]interface{}, error) {
 	values := make(map[string]interface{})
 	for k, v := range svalue {
 		fs := ids.GetFieldByName(k)
 		if fs == nil {
-			c.createErrorResponse("Insert节点中描述的字段" + k + "不存在")
-			return nil
+			return nil, fmt.Errorf("Insert节点中描述的字段" + k + "不存在")
 		}
 		fv, err := c.ConvertString2Type(v, fs.DataType)
 		if err != nil {
-			c.createErrorResponse("字段值类型转换失败，字段：" + k + ",值：" + v + "，预期类型：" + fs.DataType)
-			return nil
+			return nil, fmt.Errorf("字段值类型转换失败，字段：" + k + ",值：" + v + "，预期类型：" + fs.DataType)
 		}
 		values[k] = fv
 	}
-	return values
+	return values, nil
+}
+
+// writeOperationResult 写操作的处理结果
+type writeOperationResult struct {
+	datasource.WriteResult
+	// Keys 插入数据的主键值，包括newguid()生成的值和数据库生成的自增主键
+	Keys map[string]interface{}
+	// returningKeys 需要重新读取的数据的主键值，只在returning为true时使用
+	returningKeys [][]interface{}
+	// deleted 删除前读取的数据，只在returning为true时使用
+	deleted *datasource.DataResultSet
+	// audits 审计信息，只在设定了审计数据源时使用
+	audits []*auditRecord
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////
-// 处理删除
-func (c *IDSServiceHandler) doDelete(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
-	if inf := c.checkWriteableInf(ids); inf != nil {
+// 执行一个写操作，action为insert、update、delete或restore
+// returning为true时记录写入数据的主键，用于重新读取写入的数据，删除操作在删除前读取数据
+func (c *IDSServiceHandler) execWriteOperation(action string, inf datasource.IWriteableDataSource, ids datasource.IDataSource, rBody *SRequestBody, returning bool) (*writeOperationResult, error) {
+	result := &writeOperationResult{}
+	var wr *datasource.WriteResult
+	var err error
+	switch action {
+	case SrvActionDELETE:
 		if rBody.Delete != "true" {
-			c.createErrorResponse("报文Delete节点的值必须为true")
-			return
+			return nil, fmt.Errorf("报文Delete节点的值必须为true")
 		}
-		if len(rBody.Criteria) == 0 {
+		if len(rBody.Criteria) == 0 && rBody.Filter == nil {
 			if rBody.OperationConfirm != "delete" {
-				c.createErrorResponse("删除操作，但是报文中没有条件节点，此时OperationConfirm节点的值必须为delete")
-				return
+				return nil, fmt.Errorf("删除操作，但是报文中没有条件节点，此时OperationConfirm节点的值必须为delete")
 			}
 		}
 		if err := c.fillCriteriaFromRbody(ids, rBody); err != nil {
-			c.createErrorResponse(err.Error())
-			return
+			return nil, err
 		}
-		if err := inf.Delete(); err != nil {
-			c.createErrorResponse(err.Error())
+		var before *datasource.DataResultSet
+		if returning || auditEnabled() {
+			if before, err = c.getMatchedData(ids); err != nil {
+				return nil, err
+			}
+			if returning {
+				result.deleted = before
+			}
+		}
+		vinf, version, e := c.getExpectedVersion(ids, rBody)
+		if e != nil {
+			return nil, e
+		}
+		if vinf != nil {
+			wr, err = vinf.DeleteVersion(version)
 		} else {
-			r := utils.CreateRestResult(true)
-			r["msg"] = "处理成功"
-			c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+			wr, err = inf.Delete()
 		}
-	}
-}
-
-/////////////////////////////////////////////////////////////////////////////////////////////////////////////
-//处理更新
-func (c *IDSServiceHandler) doUpdate(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
-	if inf := c.checkWriteableInf(ids); inf != nil {
+		if err == nil && auditEnabled() {
+			result.audits, err = c.createAuditRecords(action, ids, rBody, before, nil)
+		}
+	case SrvActionUPDATE:
 		if rBody.Update == nil {
-			c.createErrorResponse("报文没有update节点")
-			return
+			return nil, fmt.Errorf("报文没有update节点")
 		}
-		if len(rBody.Criteria) == 0 {
+		if len(rBody.Criteria) == 0 && rBody.Filter == nil {
 			if rBody.OperationConfirm != "update" {
-				c.createErrorResponse("更新操作，但是报文中没有条件节点，此时OperationConfirm节点的值必须为update")
-				return
+				return nil, fmt.Errorf("更新操作，但是报文中没有条件节点，此时OperationConfirm节点的值必须为update")
 			}
 		}
-		values := c.getVauleMapFromStringMap(rBody.Update, ids)
-		if values == nil {
-			return
+		values, e := c.getVauleMapFromStringMap(rBody.Update, ids)
+		if e != nil {
+			return nil, e
 		}
 		if err := c.fillCriteriaFromRbody(ids, rBody); err != nil {
-			c.createErrorResponse(err.Error())
-			return
+			return nil, err
+		}
+		var before *datasource.DataResultSet
+		var keys [][]interface{}
+		if returning || auditEnabled() {
+			//更新前读取满足条件的数据和主键，更新了主键字段时使用新的主键值
+			if before, err = c.getMatchedData(ids); err != nil {
+				return nil, err
+			}
+			if keys, err = c.getResultSetKeys(ids, before, values); err != nil {
+				return nil, err
+			}
+			if returning {
+				result.returningKeys = keys
+			}
+		}
+		vinf, version, e := c.getExpectedVersion(ids, rBody)
+		if e != nil {
+			return nil, e
+		}
+		if vinf != nil {
+			wr, err = vinf.UpdateVersion(values, version)
+		} else {
+			wr, err = inf.Update(values)
+		}
+		if err == nil && auditEnabled() {
+			result.audits, err = c.createAuditRecords(action, ids, rBody, before, keys)
+		}
+	case SrvActionRESTORE:
+		sinf, ok := ids.(datasource.ISoftDeleteDataSource)
+		if !ok || !sinf.IsSoftDelete() {
+			return nil, fmt.Errorf("请求的服务没有使用软删除，不能恢复数据")
+		}
+		if len(rBody.Criteria) == 0 && rBody.Filter == nil {
+			if rBody.OperationConfirm != "restore" {
+				return nil, fmt.Errorf("恢复操作，但是报文中没有条件节点，此时OperationConfirm节点的值必须为restore")
+			}
+		}
+		if err := c.fillCriteriaFromRbody(ids, rBody); err != nil {
+			return nil, err
+		}
+		//使用乐观并发控制时恢复数据同时更新版本
+		vinf, version, e := c.getExpectedVersion(ids, rBody)
+		if e != nil {
+			return nil, e
+		}
+		restore := sinf.Restore
+		if vinf != nil {
+			restore = func() (*datasource.WriteResult, error) { return vinf.RestoreVersion(version) }
+		}
+		if !auditEnabled() {
+			wr, err = restore()
+			break
+		}
+		//恢复前读取包括已经删除的数据，只记录恢复前后发生变化的数据
+		withDeleted := sinf.IsWithDeleted()
+		sinf.SetWithDeleted(true)
+		defer sinf.SetWithDeleted(withDeleted)
+		before, e := c.getMatchedData(ids)
+		if e != nil {
+			return nil, e
+		}
+		keys, e := c.getResultSetKeys(ids, before, nil)
+		if e != nil {
+			return nil, e
+		}
+		if wr, err = restore(); err != nil {
+			break
+		}
+		audits, e := c.createAuditRecords(action, ids, rBody, before, keys)
+		if e != nil {
+			return nil, e
+		}
+		for _, a := range audits {
+			if formatAuditJSON(a.before) != formatAuditJSON(a.after) {
+				result.audits = append(result.audits, a)
+			}
+		}
+	case SrvActionINSERT:
+		if rBody.Insert == nil {
+			return nil, fmt.Errorf("报文没有insert节点")
+		}
+		values, e := c.getVauleMapFromStringMap(rBody.Insert, ids)
+		if e != nil {
+			return nil, e
+		}
+		for k, v := range values {
+			if v == "newguid()" {
+				values[k] = xid.New().String()
+			}
+		}
+		wr, err = inf.Insert(values)
+		if err == nil {
+			result.Keys = c.getInsertedKeys(ids, values, wr)
+			if auditEnabled() {
+				result.audits, err = c.createInsertAuditRecords(action, ids, []map[string]interface{}{values}, []map[string]interface{}{result.Keys}, true)
+			}
+			if returning && len(result.Keys) == len(ids.GetKeyFields()) && len(result.Keys) != 0 {
+				kv := make([]interface{}, 0, len(result.Keys))
+				for _, k := range ids.GetKeyFields() {
+					kv = append(kv, result.Keys[k.Name])
+				}
+				result.returningKeys = [][]interface{}{kv}
+			}
 		}
+	default:
+		return nil, fmt.Errorf("不支持的写操作" + action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wr != nil {
+		result.WriteResult = *wr
+	}
+	return result, nil
+}
 
-		if err := inf.Update(values); err != nil {
-			c.createErrorResponse(err.Error())
+// getExpectedVersion 数据源使用乐观并发控制时返回报文Version节点中数据的版本，转换为版本字段的类型
+// 数据源没有设定版本字段时返回nil
+func (c *IDSServiceHandler) getExpectedVersion(ids datasource.IDataSource, rBody *SRequestBody) (datasource.IVersionDataSource, interface{}, error) {
+	vinf, ok := ids.(datasource.IVersionDataSource)
+	if !ok || vinf.GetVersionField() == "" {
+		return nil, nil, nil
+	}
+	if rBody.Version == "" {
+		return nil, nil, fmt.Errorf("数据源使用乐观并发控制，必须通过报文的Version节点或者If-Match请求头提交数据的版本")
+	}
+	f := ids.GetFieldByName(vinf.GetVersionField())
+	if f == nil {
+		return nil, nil, fmt.Errorf("数据源中没有版本字段" + vinf.GetVersionField())
+	}
+	version, err := c.ConvertString2Type(rBody.Version, f.DataType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("版本类型转换失败，值：" + rBody.Version + "，预期类型：" + f.DataType)
+	}
+	return vinf, version, nil
+}
+
+// getInsertedKeys 返回插入数据的主键值，没有提交的主键字段使用数据库生成的自增主键
+func (c *IDSServiceHandler) getInsertedKeys(ids datasource.IDataSource, values map[string]interface{}, wr *datasource.WriteResult) map[string]interface{} {
+	keys := make(map[string]interface{})
+	missing := make([]string, 0, 1)
+	for _, k := range ids.GetKeyFields() {
+		if v, ok := values[k.Name]; ok {
+			keys[k.Name] = v
 		} else {
-			r := utils.CreateRestResult(true)
-			r["msg"] = "处理成功"
-			c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+			missing = append(missing, k.Name)
+		}
+	}
+	if len(missing) == 1 && wr != nil && wr.LastInsertId != 0 {
+		keys[missing[0]] = wr.LastInsertId
+	}
+	return keys
+}
+
+// getMatchedData 返回满足当前条件的数据，不会清除数据源的条件
+func (c *IDSServiceHandler) getMatchedData(ids datasource.IDataSource) (*datasource.DataResultSet, error) {
+	fids, ok := ids.(datasource.ICriteriaDataSource)
+	if !ok {
+		return nil, fmt.Errorf("请求的服务没有实现ICriteriaDataSource接口,不能处理" + RequestParamReturning + "参数")
+	}
+	return fids.DoFilter()
+}
+
+// getResultSetKeys 返回结果集中数据的主键值，values中包含主键字段时使用values中的值
+func (c *IDSServiceHandler) getResultSetKeys(ids datasource.IDataSource, rs *datasource.DataResultSet, values map[string]interface{}) ([][]interface{}, error) {
+	kfs := ids.GetKeyFields()
+	if len(kfs) == 0 {
+		return nil, fmt.Errorf("数据源没有主键,不能读取写入前后的数据")
+	}
+	keys := make([][]interface{}, 0, len(rs.Data))
+	for _, row := range rs.Data {
+		kv := make([]interface{}, len(kfs), len(kfs))
+		for i, k := range kfs {
+			if v, ok := values[k.Name]; ok {
+				kv[i] = v
+				continue
+			}
+			f, ok := rs.Fields[k.Name]
+			if !ok {
+				return nil, fmt.Errorf("结果集中没有主键字段" + k.Name)
+			}
+			kv[i] = row[f.Index]
+		}
+		keys = append(keys, kv)
+	}
+	return keys, nil
+}
+
+// returningBatchSize 读取写入的数据时每批读取的行数
+const returningBatchSize = 500
+
+// getReturningData 根据主键重新读取写入的数据，单一主键使用in条件，复合主键使用以或的关系组合的条件组，每批读取returningBatchSize行
+// 数据按keys的顺序返回，数据源不支持条件组时逐行读取
+func (c *IDSServiceHandler) getReturningData(ids datasource.IDataSource, keys [][]interface{}) (*datasource.DataResultSet, error) {
+	fc, ok1 := ids.(datasource.IFilterAdder)
+	fids, ok2 := ids.(datasource.ICriteriaDataSource)
+	cc, ok3 := ids.(interface{ ClearCriteria() })
+	kfs := ids.GetKeyFields()
+	if !ok1 || !ok2 || !ok3 || len(kfs) == 0 {
+		return c.getReturningDataByKey(ids, keys)
+	}
+	result := &datasource.DataResultSet{Fields: make(datasource.FieldDescType), Data: make([][]interface{}, 0, len(keys))}
+	rows := make(map[string][]interface{}, len(keys))
+	for start := 0; start < len(keys); start += returningBatchSize {
+		end := start + returningBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		cc.ClearCriteria()
+		if len(kfs) == 1 {
+			values := make([]interface{}, 0, end-start)
+			for _, kv := range keys[start:end] {
+				values = append(values, kv[0])
+			}
+			fc.AddCriteria(kfs[0].Name, datasource.OperIn, values)
+		} else {
+			groups := make([]*datasource.SQLCriteria, 0, end-start)
+			for _, kv := range keys[start:end] {
+				g := &datasource.SQLCriteria{Complex: datasource.CompOr, Children: make([]*datasource.SQLCriteria, len(kfs), len(kfs))}
+				for i, k := range kfs {
+					g.Children[i] = &datasource.SQLCriteria{PropertyName: k.Name, Operation: datasource.OperEq, Value: kv[i], Complex: datasource.CompAnd}
+				}
+				groups = append(groups, g)
+			}
+			fc.AddCriteriaGroup(datasource.CompAnd, false, groups)
+		}
+		rs, err := fids.DoFilter()
+		if err != nil {
+			return nil, err
+		}
+		result.Fields = rs.Fields
+		rskeys, err := c.getResultSetKeys(ids, rs, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rs.Data {
+			rows[formatReturningKey(rskeys[i])] = row
+		}
+	}
+	for _, kv := range keys {
+		k := formatReturningKey(kv)
+		if row, ok := rows[k]; ok {
+			result.Data = append(result.Data, row)
+			delete(rows, k)
 		}
 	}
+	//主键值的格式与读取的数据不一致时，没有匹配的数据添加到最后
+	for _, row := range rows {
+		result.Data = append(result.Data, row)
+	}
+	return result, nil
+}
+
+// formatReturningKey 将主键值转换为字符串，用于按keys的顺序排列读取的数据
+func formatReturningKey(kv []interface{}) string {
+	ss := make([]string, len(kv), len(kv))
+	for i, v := range kv {
+		ss[i] = strconv.Quote(fmt.Sprint(v))
+	}
+	return strings.Join(ss, ",")
+}
+
+// getReturningDataByKey 逐行根据主键重新读取写入的数据
+func (c *IDSServiceHandler) getReturningDataByKey(ids datasource.IDataSource, keys [][]interface{}) (*datasource.DataResultSet, error) {
+	var result *datasource.DataResultSet
+	for _, kv := range keys {
+		rs, err := ids.QueryDataByKey(kv...)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = rs
+		} else {
+			result.Data = append(result.Data, rs.Data...)
+		}
+	}
+	if result == nil {
+		result = &datasource.DataResultSet{Fields: make(datasource.FieldDescType), Data: make([][]interface{}, 0)}
+	}
+	return result, nil
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////
-// 处理添加
-func (c *IDSServiceHandler) doInsert(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+// 处理写操作并返回处理结果，返回影响的行数，插入操作同时返回新数据的主键
+// 请求参数_returning为true时返回写入的数据，删除操作返回删除前的数据
+func (c *IDSServiceHandler) doWriteOperation(sdef *SDefine, action string, ids datasource.IDataSource, rBody *SRequestBody) {
 	if inf := c.checkWriteableInf(ids); inf != nil {
-		if rBody.Insert == nil {
-			c.createErrorResponse("报文没有insert节点")
+		if rBody == nil {
+			c.createErrorResponse(action + "操作必须POST方式提交rbody信息")
 			return
 		}
-		values := c.getVauleMapFromStringMap(rBody.Insert, ids)
-		for k, v := range values {
-			if v == "newguid()" {
-				values[k] = xid.New().String()
-			}
+		if rBody.Version == "" {
+			rBody.Version = parseETag(c.getHeader(HeaderIfMatch))
+		}
+		returning, _ := strconv.ParseBool(c.RRHandler.GetParam(RequestParamReturning))
+		//恢复操作不返回写入的数据
+		returning = returning && action != SrvActionRESTORE
+		var wr *writeOperationResult
+		var err error
+		if auditEnabled() {
+			wr, err = c.execAuditedWriteOperation(sdef, action, inf, ids, rBody, returning)
+		} else {
+			wr, err = c.execWriteOperation(action, inf, ids, rBody, returning)
 		}
-		if values == nil {
+		if err == datasource.ErrVersionConflict {
+			r := utils.CreateRestResult(false)
+			r["msg"] = err.Error()
+			r["conflict"] = true
+			c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
 			return
 		}
-		err := inf.Insert(values)
 		if err != nil {
 			c.createErrorResponse(err.Error())
-		} else {
-			r := utils.CreateRestResult(true)
-			r["msg"] = "处理成功"
-			c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+			return
+		}
+		r := utils.CreateRestResult(true)
+		r["msg"] = "处理成功"
+		r["affected"] = wr.RowsAffected
+		if action == SrvActionINSERT {
+			r["keys"] = wr.Keys
+			if wr.LastInsertId != 0 {
+				r["lastinsertid"] = wr.LastInsertId
+			}
 		}
+		if returning {
+			rs := wr.deleted
+			if rs == nil {
+				if rs, err = c.getReturningData(ids, wr.returningKeys); err != nil {
+					c.createErrorResponse("数据已经写入，读取写入的数据时发生错误：" + err.Error())
+					return
+				}
+			}
+			r["resultset"] = rs
+		}
+		c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
 	}
 }
 
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 处理删除
+func (c *IDSServiceHandler) doDelete(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	c.doWriteOperation(sdef, SrvActionDELETE, ids, rBody)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//处理更新
+func (c *IDSServiceHandler) doUpdate(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	c.doWriteOperation(sdef, SrvActionUPDATE, ids, rBody)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 恢复软删除的数据
+func (c *IDSServiceHandler) doRestore(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	c.doWriteOperation(sdef, SrvActionRESTORE, ids, rBody)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 处理添加
+func (c *IDSServiceHandler) doInsert(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	c.doWriteOperation(sdef, SrvActionINSERT, ids, rBody)
+}
+
 // 			"values":{
 // 				"outfield": "PROJECTNAME"
 // 				"ids": "default.mgr.G_USERPROJECT",
@@ -277,7 +617,7 @@ func (c *IDSServiceHandler) getUserFilterValues(values interface{}) []string {
 }
 
 // 处理用户过滤器，添加用户过滤器的服务，用户查询只返回当前用户的信息
-// 根据当前的用户信息对数据进行筛选，通过直接在rBody添加相应的查询条件实现
+// 根据当前的用户信息对数据进行筛选，通过在rBody中添加用户过滤条件实现，fillCriteriaFromRbody将其添加在Criteria和Filter的条件组之外
 // 在服务定义元数据中配置过滤的目标列，以及与用户信息的对照操作
 // 操作为in或者=，为=时条件为目标字段值等于当前用户id
 // 操作为in时，定义目标字段的值包含在idsname定义的数据源中根据userfield等于当前用户id，该数据源必须实现ICriteriaDataSource和IFilterAdder接口
@@ -327,14 +667,12 @@ func (c *IDSServiceHandler) doUserFilter(sdef *SDefine, meta map[string]interfac
 
 	if *rBody == nil {
 		*rBody = &SRequestBody{}
-		t := *rBody
-		t.Criteria = make([]CriteriaInRBody, 0, 1)
 	}
 	t := *rBody
 
 	if len(values) == 0 {
 		logs.Error("doUserFilter：定义的values节点返回的数据为空")
-		t.Criteria = append(t.Criteria, CriteriaInRBody{
+		t.userFilter = append(t.userFilter, CriteriaInRBody{
 			Field:     dfieldname,
 			Operation: datasource.OperAlwaysFalse,
 			Value:     "",
@@ -342,7 +680,7 @@ func (c *IDSServiceHandler) doUserFilter(sdef *SDefine, meta map[string]interfac
 		return true, nil
 	}
 	if len(values) == 1 {
-		t.Criteria = append(t.Criteria, CriteriaInRBody{
+		t.userFilter = append(t.userFilter, CriteriaInRBody{
 			Field:     dfieldname,
 			Operation: datasource.OperEq,
 			//OperEq操作值处理values节点返回的第一个值
@@ -351,7 +689,7 @@ func (c *IDSServiceHandler) doUserFilter(sdef *SDefine, meta map[string]interfac
 		return true, nil
 	}
 	if len(values) > 1 {
-		t.Criteria = append(t.Criteria, CriteriaInRBody{
+		t.userFilter = append(t.userFilter, CriteriaInRBody{
 			Field:     dfieldname,
 			Operation: datasource.OperIn,
 			Value:     values,
@@ -374,14 +712,32 @@ func (c *IDSServiceHandler) doAllData(sdef *SDefine, meta map[string]interface{}
 	if evool {
 		c.doQuery(sdef, meta, ids, rBody)
 		return
-	} else {
-		resuleset, err = ids.GetAllData()
 	}
 	c.setPageParams(ids)
+	cursor, err := c.applyCursor(ids, meta, "")
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	if c.streamResult(ids, true, rBody) {
+		return
+	}
+	resuleset, err = ids.GetAllData()
+	if err == nil {
+		err = c.setTotalExtra(ids, true)
+	}
 	if err != nil {
 		c.createErrorResponse(err.Error())
 		return
 	}
+	if cursor != nil {
+		next, err := c.createNextCursor(cursor, resuleset)
+		if err != nil {
+			c.createErrorResponse(err.Error())
+			return
+		}
+		c.setResultExtra("nextcursor", next)
+	}
 	if rBody == nil {
 		c.setResultSet(resuleset)
 
@@ -506,60 +862,180 @@ func (c *IDSServiceHandler) convertParamValues(value string, datatype string) (i
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////
-// 添加一个查询条件
-func (c *IDSServiceHandler) addOneCriteria(v *CriteriaInRBody, ids datasource.IDataSource) error {
-	f := ids.GetFieldByName(v.Field)
+// 根据字段类型转换条件的值，值为数组时逐个转换，匹配类操作的值为字符串，不做转换
+func (c *IDSServiceHandler) convertCriteriaValue(field string, operation string, value interface{}, ids datasource.IDataSource) (interface{}, error) {
+	f := ids.GetFieldByName(field)
 	if f == nil {
-		return fmt.Errorf("没有找到Criteria中定义的字段名" + v.Field)
+		return nil, fmt.Errorf("没有找到Criteria中定义的字段名" + field)
 	}
-	var pv interface{}
-	switch reflect.TypeOf(v.Value).Kind() {
+	if !datasource.IsValidOperation(operation) {
+		return nil, fmt.Errorf("Criteria中字段" + field + "的操作符" + operation + "不支持")
+	}
+	if operation == datasource.OperIsNull || operation == datasource.OperIsNotNull {
+		return nil, nil
+	}
+	if value == nil {
+		return nil, fmt.Errorf("Criteria中字段" + field + "的值不能为空")
+	}
+	if datasource.IsPatternOperation(operation) {
+		return fmt.Sprint(value), nil
+	}
+	switch reflect.TypeOf(value).Kind() {
 	case reflect.Slice, reflect.Array:
 		{
-			s := reflect.ValueOf(v.Value)
+			s := reflect.ValueOf(value)
 			pvs := make([]interface{}, s.Len(), s.Len())
 			for i := 0; i < s.Len(); i++ {
 				var e error
-				pvs[i], e = c.convertParamValues(s.Index(i).Interface().(string), f.DataType)
+				pvs[i], e = c.convertParamValues(fmt.Sprint(s.Index(i).Interface()), f.DataType)
 				if e != nil {
-					return e
+					return nil, e
 				}
 			}
-			pv = pvs
+			return pvs, nil
 		}
 	default:
-		{
-			p, err := c.convertParamValues(v.Value.(string), f.DataType)
-			if err != nil {
-				return err
-			}
-			pv = p
-		}
+		return c.convertParamValues(fmt.Sprint(value), f.DataType)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 添加一个查询条件
+func (c *IDSServiceHandler) addOneCriteria(v *CriteriaInRBody, ids datasource.IDataSource) error {
+	op := datasource.NormalizeOperation(v.Operation)
+	pv, err := c.convertCriteriaValue(v.Field, op, v.Value, ids)
+	if err != nil {
+		return err
 	}
 
 	fc, _ := ids.(datasource.IFilterAdder)
 	if strings.ToUpper(v.Relation) == "AND" {
-		fc.AndCriteria(v.Field, v.Operation, pv)
+		fc.AndCriteria(v.Field, op, pv)
 	}
 	if strings.ToUpper(v.Relation) == "OR" {
-		fc.OrCriteria(v.Field, v.Operation, pv)
+		fc.OrCriteria(v.Field, op, pv)
 	}
 	return nil
 }
 
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 将条件树的一个节点转换为条件列表，列表中的条件之间为与的关系
+func (c *IDSServiceHandler) createCriteriaByGroup(g *CriteriaGroup, ids datasource.IDataSource) ([]*datasource.SQLCriteria, error) {
+	result := make([]*datasource.SQLCriteria, 0, 4)
+	if g.Field != "" {
+		op := datasource.NormalizeOperation(g.Operation)
+		pv, err := c.convertCriteriaValue(g.Field, op, g.Value, ids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &datasource.SQLCriteria{
+			PropertyName: g.Field,
+			Operation:    op,
+			Value:        pv,
+			Complex:      datasource.CompAnd,
+		})
+	}
+	if g.And != nil {
+		children, err := c.createCriteriaByGroupList(g.And, datasource.CompAnd, ids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &datasource.SQLCriteria{Complex: datasource.CompAnd, Children: children})
+	}
+	if g.Or != nil {
+		children, err := c.createCriteriaByGroupList(g.Or, datasource.CompOr, ids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &datasource.SQLCriteria{Complex: datasource.CompAnd, Children: children})
+	}
+	if g.Not != nil {
+		children, err := c.createCriteriaByGroup(g.Not, ids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &datasource.SQLCriteria{Complex: datasource.CompAnd, Not: true, Children: children})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("Filter中存在空的条件节点")
+	}
+	return result, nil
+}
+
+// 将条件树节点数组转换为条件列表，complex为数组中各条件之间的关系
+func (c *IDSServiceHandler) createCriteriaByGroupList(gs []*CriteriaGroup, complex string, ids datasource.IDataSource) ([]*datasource.SQLCriteria, error) {
+	if len(gs) == 0 {
+		return nil, fmt.Errorf("Filter中存在空的" + complex + "节点")
+	}
+	result := make([]*datasource.SQLCriteria, 0, len(gs))
+	for _, g := range gs {
+		if g == nil {
+			return nil, fmt.Errorf("Filter中存在空的条件节点")
+		}
+		items, err := c.createCriteriaByGroup(g, ids)
+		if err != nil {
+			return nil, err
+		}
+		var item *datasource.SQLCriteria
+		if len(items) == 1 {
+			//只有一个条件时不需要再加括号
+			item = items[0]
+		} else {
+			item = &datasource.SQLCriteria{Children: items}
+		}
+		item.Complex = complex
+		result = append(result, item)
+	}
+	return result, nil
+}
+
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////
 //根据请求的报文填充Criteria,ids必须实现DataSource.IFilterAdder接口
 func (c *IDSServiceHandler) fillCriteriaFromRbody(ids datasource.IDataSource, rBody *SRequestBody) error {
-	_, okfc := ids.(datasource.IFilterAdder)
+	fc, okfc := ids.(datasource.IFilterAdder)
 	//处理条件
 	if !okfc {
 		return fmt.Errorf("请求的服务没有实现IFilterAdder接口,不能处理Criteria节点")
 	}
-	for _, v := range rBody.Criteria {
-		err := c.addOneCriteria(&v, ids)
+	//Criteria作为一个条件组，避免其中的或条件与Filter或者userfilter的条件组合错误
+	if err := c.addCriteriaGroupFromRbody(ids, rBody.Criteria); err != nil {
+		return err
+	}
+	if rBody.Filter != nil {
+		children, err := c.createCriteriaByGroup(rBody.Filter, ids)
+		if err != nil {
+			return err
+		}
+		fc.AddCriteriaGroup(datasource.CompAnd, false, children)
+	}
+	//userfilter的条件在条件组之外，与其他全部条件为与的关系
+	for i := range rBody.userFilter {
+		if err := c.addOneCriteria(&rBody.userFilter[i], ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCriteriaGroupFromRbody 将Criteria节点中的条件作为一个条件组添加到数据源，ids必须实现DataSource.IFilterAdder接口
+func (c *IDSServiceHandler) addCriteriaGroupFromRbody(ids datasource.IDataSource, criteria []CriteriaInRBody) error {
+	children := make([]*datasource.SQLCriteria, 0, len(criteria))
+	for _, v := range criteria {
+		complex := strings.ToLower(v.Relation)
+		if complex != datasource.CompAnd && complex != datasource.CompOr {
+			//与addOneCriteria相同，忽略关系不是and或者or的条件
+			continue
+		}
+		op := datasource.NormalizeOperation(v.Operation)
+		pv, err := c.convertCriteriaValue(v.Field, op, v.Value, ids)
 		if err != nil {
 			return err
 		}
+		children = append(children, &datasource.SQLCriteria{PropertyName: v.Field, Operation: op, Value: pv, Complex: complex})
+	}
+	if len(children) != 0 {
+		fc, _ := ids.(datasource.IFilterAdder)
+		fc.AddCriteriaGroup(datasource.CompAnd, false, children)
 	}
 	return nil
 }
@@ -705,21 +1181,43 @@ func (c *IDSServiceHandler) doQuery(sdef *SDefine, meta map[string]interface{},
 		c.createErrorResponse("query操作必须POST方式提交rbody信息")
 		return
 	}
+	//不能查询或者不能聚合的数据源在内存中处理条件、排序、分页和聚合
+	if _, ok := ids.(datasource.IAggregativeAdder); !ok && len(rBody.Aggre) != 0 {
+		ids = datasource.CreateQueryableDataSource(ids)
+	} else {
+		ids = datasource.AsQueryable(ids)
+	}
+	if len(rBody.InnerJoin) != 0 {
+		//连接需要在处理条件之前，条件中可以引用连接表的字段
+		if err := c.applyJoin(sdef, meta, ids, rBody.InnerJoin); err != nil {
+			c.createErrorResponse(err.Error())
+			return
+		}
+	}
 	c.setPageParams(ids)
 	fids, ok := ids.(datasource.ICriteriaDataSource)
 	if !ok {
 		c.createErrorResponse("请求的服务没有实现ICriteriaDataSource接口,不能处理Query请求")
 		return
 	}
-	if len(rBody.Criteria) != 0 {
+	if len(rBody.Criteria) != 0 || rBody.Filter != nil || len(rBody.userFilter) != 0 {
 		err := c.fillCriteriaFromRbody(ids, rBody)
 		if err != nil {
 			c.createErrorResponse(err.Error())
 			return
 		}
 	}
+	cursor, err := c.applyCursor(ids, meta, rBody.OrderBy)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	if cursor != nil && len(rBody.Aggre) != 0 {
+		c.createErrorResponse("游标分页不能与Aggre节点一起使用")
+		return
+	}
 	fc, okfc := ids.(datasource.IFilterAdder)
-	if len(rBody.OrderBy) != 0 {
+	if len(rBody.OrderBy) != 0 && cursor == nil {
 		//处理排序
 		if !okfc {
 			c.createErrorResponse("请求的服务没有实现IFilterAdder接口,不能处理Criteria节点")
@@ -727,10 +1225,16 @@ func (c *IDSServiceHandler) doQuery(sdef *SDefine, meta map[string]interface{},
 		}
 		os := strings.Split(rBody.OrderBy, ",")
 		for _, ov := range os {
-			orders := strings.Split(strings.Trim(ov, " "), " ")
-			if len(orders) == 2 {
-				fc.Orderby(orders[0], orders[1])
+			field, dir, err := datasource.ParseOrderBy(ov)
+			if err != nil {
+				c.createErrorResponse(err.Error())
+				return
 			}
+			if ids.GetFieldByName(field) == nil {
+				c.createErrorResponse("OrderBy中的字段" + field + "不存在")
+				return
+			}
+			fc.Orderby(field, dir)
 		}
 	}
 	if len(rBody.Aggre) != 0 {
@@ -759,6 +1263,17 @@ func (c *IDSServiceHandler) doQuery(sdef *SDefine, meta map[string]interface{},
 				p = datasource.AggMax
 			case "MIN":
 				p = datasource.AggMin
+			default:
+				c.createErrorResponse("Aggre中的聚合类型" + agg.Predicate + "不支持")
+				return
+			}
+			if !datasource.IsValidIdentifier(agg.Outfield) {
+				c.createErrorResponse("Aggre中的输出字段名" + agg.Outfield + "不合法")
+				return
+			}
+			if !(agg.ColName == "*" && p == datasource.AggCount) && ids.GetFieldByName(agg.ColName) == nil {
+				c.createErrorResponse("Aggre中的字段" + agg.ColName + "不存在")
+				return
 			}
 			ag.AddAggre(agg.Outfield, &datasource.AggreType{
 				Predicate: p,
@@ -766,7 +1281,19 @@ func (c *IDSServiceHandler) doQuery(sdef *SDefine, meta map[string]interface{},
 			})
 		}
 	}
+	if c.streamResult(ids, false, rBody) {
+		return
+	}
 	resuleset, err := fids.DoFilter()
+	if err == nil {
+		err = c.setTotalExtra(ids, false)
+	}
+	if err == nil && cursor != nil {
+		var next string
+		if next, err = c.createNextCursor(cursor, resuleset); err == nil {
+			c.setResultExtra("nextcursor", next)
+		}
+	}
 	if err != nil {
 		c.createErrorResponse(err.Error())
 	} else {
@@ -789,6 +1316,12 @@ func (c *IDSServiceHandler) getActionMap() map[string]SerivceActionHandler {
 	r[SrvActionDELETE] = c.doDelete
 	r[SrvActionUPDATE] = c.doUpdate
 	r[SrvActionINSERT] = c.doInsert
+	r[SrvActionBATCH] = c.doBatch
+	r[SrvActionBULKINSERT] = c.doBulkInsert
+	r[SrvActionUPSERT] = c.doUpsert
+	r[SrvActionRESTORE] = c.doRestore
+	r[SrvActionAUDIT] = c.doAuditHistory
+	r[SrvActionIMPORT] = c.doImport
 	r[SrvActionALLDATA] = c.doAllData
 	r[SrvActionGET] = c.doGetValueByKey
 	return r
@@ -811,6 +1344,7 @@ func (c *IDSServiceHandler) doGetValueByKey(sdef *SDefine, meta map[string]inter
 	if err != nil {
 		c.createErrorResponse(err.Error())
 	} else {
+		c.setVersionETag(ids, resuleset)
 		c.setResultSet(c.DoBulldozer(resuleset, rBody.Bulldozer))
 	}
 }
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/mattn/go-sqlite3"
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// recordDriver 记录所有发送到数据库的SQL语句的驱动
+type recordDriver struct {
+	sqlite3.SQLiteDriver
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *recordDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{Conn: conn, d: d}, nil
+}
+
+func (d *recordDriver) reset() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queries
+	d.queries = nil
+	return q
+}
+
+// recordConn 只实现driver.Conn，database/sql会通过Prepare执行所有语句
+type recordConn struct {
+	driver.Conn
+	d *recordDriver
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	c.d.queries = append(c.d.queries, query)
+	c.d.mu.Unlock()
+	return c.Conn.Prepare(query)
+}
+
+// testRRHandler 测试用的请求响应句柄
+type testRRHandler struct {
+	params   map[string]string
+	headers  map[string]string
+	response interface{}
+}
+
+func (c *testRRHandler) GetHeader(name string) string {
+	return c.headers[name]
+}
+
+func (c *testRRHandler) SetHeader(name, value string) {
+	if c.headers == nil {
+		c.headers = make(map[string]string)
+	}
+	c.headers[name] = value
+}
+
+func (c *testRRHandler) CreateResponseData(style int, data interface{}) {
+	c.response = data
+}
+
+func (c *testRRHandler) GetParam(name string) string {
+	return c.params[name]
+}
+
+func (c *testRRHandler) GetRequestBody() (*SRequestBody, error) {
+	return nil, nil
+}
+
+func (c *testRRHandler) result() bool {
+	r, ok := c.response.(utils.RestResult)
+	if !ok {
+		return false
+	}
+	b, _ := r["result"].(bool)
+	return b
+}
+
+var recorder = &recordDriver{}
+
+// createTestDB 创建临时的SQLite数据库并注册数据库别名，返回的函数用于删除临时文件
+func createTestDB(t *testing.T, alias, driverName string, stmts ...string) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "tongserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterDataBase(alias, driverName, filepath.Join(dir, "idb.db"), 1); err != nil {
+		t.Fatal(err)
+	}
+	datasource.DBAlias2DBTypeContainer[alias] = datasource.DbTypeSQLite
+	db, _ := orm.GetDB(alias)
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, func() { os.RemoveAll(dir) }
+}
+
+func TestMaliciousRbody(t *testing.T) {
+	sql.Register("sqlite3_record", recorder)
+	orm.RegisterDriver("sqlite3_record", orm.DRSqlite)
+	_, clean := createTestDB(t, "injecttest", "sqlite3_record",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int(11),PRIMARY KEY ("ORG_ID"))`)
+	defer clean()
+	ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "injecttest", "JEDA_ORG")
+
+	bodies := map[string]*SRequestBody{
+		"criteria field": {Criteria: []CriteriaInRBody{
+			{Field: "ORG_ID=ORG_ID or 1=1 --", Operation: "=", Value: "1", Relation: "and"}}},
+		"criteria operation": {Criteria: []CriteriaInRBody{
+			{Field: "ORG_ID", Operation: "=1 or 1=1 --", Value: "1", Relation: "and"}}},
+		"filter field": {Filter: &CriteriaGroup{Or: []*CriteriaGroup{
+			{Field: "ORG_ID", Operation: "=", Value: "1"},
+			{Field: "1=1); DROP TABLE JEDA_ORG; --", Operation: "=", Value: "1"}}}},
+		"filter operation": {Filter: &CriteriaGroup{Not: &CriteriaGroup{
+			Field: "ORG_ID", Operation: "is null or 1=1", Value: "1"}}},
+		"orderby field":     {OrderBy: "ORG_ID; DROP TABLE JEDA_ORG"},
+		"orderby direction": {OrderBy: "ORG_ID desc; DROP TABLE JEDA_ORG"},
+		"orderby subquery":  {OrderBy: "(SELECT 1) desc"},
+		"aggre column": {Aggre: []AggreStruct{
+			{Outfield: "N", Predicate: "count", ColName: "ORG_ID) FROM sqlite_master --"}}},
+		"aggre outfield": {Aggre: []AggreStruct{
+			{Outfield: "N FROM sqlite_master --", Predicate: "count", ColName: "ORG_ID"}}},
+		"aggre predicate": {Aggre: []AggreStruct{
+			{Outfield: "N", Predicate: "group_concat", ColName: "ORG_ID"}}},
+	}
+	for name, rBody := range bodies {
+		rr := &testRRHandler{}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids.ClearCriteria()
+		recorder.reset()
+		h.doQuery(nil, nil, ids, rBody)
+		if rr.result() {
+			t.Errorf("%s: malicious rbody accepted", name)
+		}
+		if q := recorder.reset(); len(q) != 0 {
+			t.Errorf("%s: reached database %v", name, q)
+		}
+	}
+
+	writes := map[string]func(h *IDSServiceHandler){
+		"insert field": func(h *IDSServiceHandler) {
+			h.doInsert(nil, nil, ids, &SRequestBody{Insert: map[string]string{
+				"ORG_ID": "1", "ORG_NAME) VALUES (1,1); DROP TABLE JEDA_ORG; --": "x"}})
+		},
+		"update field": func(h *IDSServiceHandler) {
+			h.doUpdate(nil, nil, ids, &SRequestBody{OperationConfirm: "update", Update: map[string]string{
+				"ORG_NAME=1, ORG_ID": "x"}})
+		},
+		"update criteria": func(h *IDSServiceHandler) {
+			h.doUpdate(nil, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "x"},
+				Criteria: []CriteriaInRBody{{Field: "ORG_ID", Operation: "<>'' or", Value: "1", Relation: "and"}}})
+		},
+		"delete criteria": func(h *IDSServiceHandler) {
+			h.doDelete(nil, nil, ids, &SRequestBody{Delete: "true",
+				Criteria: []CriteriaInRBody{{Field: "1=1 or ORG_ID", Operation: "=", Value: "1", Relation: "and"}}})
+		},
+	}
+	for name, f := range writes {
+		rr := &testRRHandler{}
+		ids.ClearCriteria()
+		recorder.reset()
+		f(&IDSServiceHandler{SHandlerBase{RRHandler: rr}})
+		if rr.result() {
+			t.Errorf("%s: malicious rbody accepted", name)
+		}
+		if q := recorder.reset(); len(q) != 0 {
+			t.Errorf("%s: reached database %v", name, q)
+		}
+	}
+
+	// 数据源本身也会拒绝不合法的标识符
+	ids.ClearCriteria()
+	ids.AddCriteria("ORG_ID or 1=1", datasource.OperEq, "1")
+	if _, err := ids.DoFilter(); err == nil {
+		t.Error("datasource accepted malicious field")
+	}
+	ids.ClearCriteria()
+	if _, err := ids.Insert(map[string]interface{}{"ORG_ID) --": "1"}); err == nil {
+		t.Error("datasource accepted malicious insert field")
+	}
+	if q := recorder.reset(); len(q) != 0 {
+		t.Errorf("datasource reached database %v", q)
+	}
+
+	// 正常的请求可以执行
+	rr := &testRRHandler{}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, ids, &SRequestBody{OrderBy: "ORG_ID desc,ORG_NAME",
+		Criteria: []CriteriaInRBody{{Field: "ORG_NAME", Operation: "contains", Value: "'", Relation: "and"}}})
+	if !rr.result() {
+		t.Errorf("valid rbody rejected %v", rr.response)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	_, clean := createTestDB(t, "writetest", "sqlite3",
+		`CREATE TABLE "NOTE" ("NOTE_ID" INTEGER PRIMARY KEY AUTOINCREMENT,"TITLE" varchar(100))`,
+		`CREATE TABLE "TAG" ("TAG_ID" varchar(50) NOT NULL,"TITLE" varchar(100),PRIMARY KEY ("TAG_ID"))`,
+		`CREATE TABLE "NOTE_TAG" ("NOTE_ID" int NOT NULL,"TAG_ID" varchar(50) NOT NULL,"TITLE" varchar(100),PRIMARY KEY ("NOTE_ID","TAG_ID"))`,
+		`INSERT INTO "NOTE_TAG" VALUES (1,'a','x'),(1,'b','x'),(2,'a','x'),(2,'b','y')`)
+	defer clean()
+	write := func(table, action string, returning bool, rBody *SRequestBody) utils.RestResult {
+		rr := &testRRHandler{params: map[string]string{}}
+		if returning {
+			rr.params[RequestParamReturning] = "true"
+		}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource(table, "writetest", table)
+		h.doWriteOperation(nil, action, ids, rBody)
+		if !rr.result() {
+			t.Fatalf("%s %s failed %v", table, action, rr.response)
+		}
+		return rr.response.(utils.RestResult)
+	}
+
+	// 自增主键
+	r := write("NOTE", SrvActionINSERT, true, &SRequestBody{Insert: map[string]string{"TITLE": "a"}})
+	if r["affected"] != int64(1) || r["lastinsertid"] != int64(1) || r["keys"].(map[string]interface{})["NOTE_ID"] != int64(1) {
+		t.Errorf("insert result %v", r)
+	}
+	if rs := r["resultset"].(*datasource.DataResultSet); len(rs.Data) != 1 || rs.Data[0][rs.Fields["TITLE"].Index] != "a" {
+		t.Errorf("insert returning %v", rs)
+	}
+	write("NOTE", SrvActionINSERT, false, &SRequestBody{Insert: map[string]string{"TITLE": "b"}})
+
+	// newguid()生成的主键
+	r = write("TAG", SrvActionINSERT, false, &SRequestBody{Insert: map[string]string{"TAG_ID": "newguid()", "TITLE": "t"}})
+	if id, _ := r["keys"].(map[string]interface{})["TAG_ID"].(string); id == "" || id == "newguid()" {
+		t.Errorf("insert guid %v", r)
+	}
+
+	r = write("NOTE", SrvActionUPDATE, true, &SRequestBody{Update: map[string]string{"TITLE": "c"}, OperationConfirm: "update"})
+	if r["affected"] != int64(2) {
+		t.Errorf("update result %v", r)
+	}
+	if rs := r["resultset"].(*datasource.DataResultSet); len(rs.Data) != 2 || rs.Data[1][rs.Fields["TITLE"].Index] != "c" {
+		t.Errorf("update returning %v", rs)
+	}
+
+	r = write("NOTE", SrvActionDELETE, true, &SRequestBody{Delete: "true",
+		Criteria: []CriteriaInRBody{{Field: "NOTE_ID", Operation: "=", Value: "1", Relation: "and"}}})
+	if r["affected"] != int64(1) {
+		t.Errorf("delete result %v", r)
+	}
+	if rs := r["resultset"].(*datasource.DataResultSet); len(rs.Data) != 1 || rs.Data[0][rs.Fields["NOTE_ID"].Index] != int32(1) {
+		t.Errorf("delete returning %v", rs)
+	}
+
+	// 复合主键一次读取写入的数据，按主键的顺序返回
+	r = write("NOTE_TAG", SrvActionUPDATE, true, &SRequestBody{Update: map[string]string{"TITLE": "z"},
+		Criteria: []CriteriaInRBody{{Field: "TITLE", Operation: "=", Value: "x", Relation: "and"}}})
+	rs := r["resultset"].(*datasource.DataResultSet)
+	if r["affected"] != int64(3) || len(rs.Data) != 3 {
+		t.Fatalf("composite key update returning %v", r)
+	}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: &testRRHandler{}}}
+	ids := datasource.CreateWriteableTableDataSource("NOTE_TAG", "writetest", "NOTE_TAG")
+	rs, err := h.getReturningData(ids, [][]interface{}{{int64(2), "b"}, {int64(1), "a"}, {int64(3), "a"}})
+	if err != nil || len(rs.Data) != 2 || rs.Data[0][rs.Fields["TITLE"].Index] != "y" || rs.Data[1][rs.Fields["TAG_ID"].Index] != "a" {
+		t.Errorf("composite key returning %v %v", rs, err)
+	}
+}
+
+// TestQueryInMemory 没有实现查询或聚合接口的数据源在内存中处理query操作
+func TestQueryInMemory(t *testing.T) {
+	ks := &datasource.KeyStringSource{}
+	ks.Init()
+	ks.SetValueMap(map[string]string{"1": "北京", "2": "北海", "3": "上海", "4": "北京"})
+	rr := &testRRHandler{params: map[string]string{RequestParamTotal: "true", RequestParamPagesize: "1"}}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, ks, &SRequestBody{OrderBy: "KEY desc",
+		Criteria: []CriteriaInRBody{{Field: "VALUE", Operation: "startswith", Value: "北", Relation: "and"}}})
+	if !rr.result() {
+		t.Fatalf("query failed %v", rr.response)
+	}
+	r := rr.response.(utils.RestResult)
+	if rs := r["resultset"].(*datasource.DataResultSet); len(rs.Data) != 1 || rs.Data[0][0] != "4" || r["total"] != int64(3) {
+		t.Errorf("query %v", r)
+	}
+
+	rr = &testRRHandler{}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, ks, &SRequestBody{Aggre: []AggreStruct{{Predicate: "count", ColName: "*", Outfield: "CNT"}}, OrderBy: "KEY"})
+	if rs, ok := rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet); !ok || len(rs.Data) != 4 || rs.Data[0][rs.Fields["CNT"].Index] != int64(1) {
+		t.Errorf("aggregate %v", rr.response)
+	}
+}
+
+// TestCriteriaWithFilter 同时有Criteria和Filter时，Criteria作为一个条件组与Filter以与的关系组合
+func TestCriteriaWithFilter(t *testing.T) {
+	_, clean := createTestDB(t, "filtertest", "sqlite3",
+		`CREATE TABLE "T" ("ID" varchar(50) NOT NULL,"A" int,"B" int,"C" int,PRIMARY KEY ("ID"))`,
+		`INSERT INTO "T" VALUES ('1',1,0,0),('2',0,1,1),('3',1,0,1),('4',0,0,1)`)
+	defer clean()
+	rr := &testRRHandler{}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	// (A=1 or B=1) and C=1
+	h.doQuery(nil, nil, datasource.CreateWriteableTableDataSource("T", "filtertest", "T"), &SRequestBody{OrderBy: "ID",
+		Criteria: []CriteriaInRBody{{Field: "A", Operation: "=", Value: "1", Relation: "and"}, {Field: "B", Operation: "=", Value: "1", Relation: "or"}},
+		Filter:   &CriteriaGroup{Field: "C", Operation: "=", Value: "1"}})
+	if !rr.result() {
+		t.Fatalf("query failed %v", rr.response)
+	}
+	if rs := rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet); len(rs.Data) != 2 || rs.Data[0][0] != "2" || rs.Data[1][0] != "3" {
+		t.Errorf("criteria with filter %v", rs.Data)
+	}
+}
+
+// TestCriteriaWithUserFilter Criteria中的或条件作为一个条件组，与userfilter的条件以与的关系组合
+func TestCriteriaWithUserFilter(t *testing.T) {
+	_, clean := createTestDB(t, "userfiltertest", "sqlite3",
+		`CREATE TABLE "T" ("ID" varchar(50) NOT NULL,"A" int,"B" int,"OWNER" varchar(50),PRIMARY KEY ("ID"))`,
+		`INSERT INTO "T" VALUES ('1',1,0,'u1'),('2',0,1,'u2'),('3',1,0,'u2'),('4',0,1,'u1'),('5',0,0,'u1')`)
+	defer clean()
+	rr := &testRRHandler{}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: "u1"}}
+	meta := map[string]interface{}{"userfilter": map[string]interface{}{"filterkey": "OWNER", "values": "userid"}}
+	// (A=1 or B=1) and OWNER='u1'
+	h.doAllData(nil, meta, datasource.CreateWriteableTableDataSource("T", "userfiltertest", "T"), &SRequestBody{OrderBy: "ID",
+		Criteria: []CriteriaInRBody{{Field: "A", Operation: "=", Value: "1", Relation: "and"}, {Field: "B", Operation: "=", Value: "1", Relation: "or"}}})
+	if !rr.result() {
+		t.Fatalf("query failed %v", rr.response)
+	}
+	if rs := rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet); len(rs.Data) != 2 || rs.Data[0][0] != "1" || rs.Data[1][0] != "4" {
+		t.Errorf("criteria with userfilter %v", rs.Data)
+	}
+}
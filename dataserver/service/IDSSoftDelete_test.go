@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// testSecurityService 测试用的安全服务，返回固定的用户角色
+type testSecurityService struct {
+	TokenService
+	roles map[string]utils.StringSet
+}
+
+func (c *testSecurityService) GetRoleByUserid(userid string) (utils.StringSet, error) {
+	return c.roles[userid], nil
+}
+
+func TestSoftDelete(t *testing.T) {
+	db, clean := createTestDB(t, "softdeletetest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"DELETED" int,PRIMARY KEY ("ORG_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('A','a',NULL),('B','b',0),('C','c',NULL)`)
+	defer clean()
+	once.Do(func() {})
+	tokenService = &testSecurityService{roles: map[string]utils.StringSet{"admin": {"ADMIN": true}, "user": {"USER": true}}}
+	defer func() { tokenService = &TokenService{} }()
+	meta := map[string]interface{}{"withdeletedrole": "ADMIN"}
+	call := func(user string, params map[string]string, f func(h *IDSServiceHandler, ids datasource.IDataSource)) *testRRHandler {
+		rr := &testRRHandler{params: params}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr, CurrentUserId: user}}
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "softdeletetest", "JEDA_ORG")
+		ids.SoftDelete = &datasource.SoftDeleteDefine{Field: "DELETED", Value: 1, RestoreValue: 0}
+		if err := h.applyWithDeleted(meta, ids); err != nil {
+			rr.response = utils.RestResult{"result": false, "msg": err.Error()}
+			return rr
+		}
+		f(h, ids)
+		return rr
+	}
+	query := func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doQuery(nil, meta, ids, &SRequestBody{OrderBy: "ORG_ID"})
+	}
+	rows := func(rr *testRRHandler) int {
+		if !rr.result() {
+			t.Fatalf("query failed %v", rr.response)
+		}
+		return len(rr.response.(utils.RestResult)["resultset"].(*datasource.DataResultSet).Data)
+	}
+
+	rr := call("user", nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doDelete(nil, meta, ids, &SRequestBody{Delete: "true",
+			Criteria: []CriteriaInRBody{{Field: "ORG_ID", Operation: "in", Value: []interface{}{"A", "B"}, Relation: "and"}}})
+	})
+	if !rr.result() || rr.response.(utils.RestResult)["affected"] != int64(2) {
+		t.Fatalf("soft delete %v", rr.response)
+	}
+	var n int
+	db.QueryRow(`SELECT count(*) FROM "JEDA_ORG"`).Scan(&n)
+	if n != 3 {
+		t.Errorf("rows physically deleted %d", n)
+	}
+	if got := rows(call("user", nil, query)); got != 1 {
+		t.Errorf("query returned deleted rows %d", got)
+	}
+	rr = call("user", map[string]string{"ORG_ID": "A"}, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doGetValueByKey(nil, meta, ids, &SRequestBody{})
+	})
+	if got := rows(rr); got != 0 {
+		t.Errorf("get returned deleted row")
+	}
+
+	// _withdeleted只有指定的角色可以使用
+	withDeleted := map[string]string{RequestParamWithDeleted: "true"}
+	if rr = call("user", withDeleted, query); rr.result() {
+		t.Error("withdeleted allowed without role")
+	}
+	if got := rows(call("admin", withDeleted, query)); got != 3 {
+		t.Errorf("withdeleted query %d", got)
+	}
+
+	// 恢复删除的数据
+	rr = call("user", nil, func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doRestore(nil, meta, ids, &SRequestBody{OperationConfirm: "restore"})
+	})
+	if !rr.result() || rr.response.(utils.RestResult)["affected"] != int64(2) {
+		t.Fatalf("restore %v", rr.response)
+	}
+	if got := rows(call("user", nil, query)); got != 3 {
+		t.Errorf("restored rows %d", got)
+	}
+}
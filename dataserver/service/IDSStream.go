@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+const (
+	// StreamNDJSON 每行输出一条JSON对象形式的数据
+	StreamNDJSON string = "ndjson"
+	// StreamJSON 输出与非流式输出结构相同的JSON，结果集的数据分块输出
+	StreamJSON string = "json"
+	// streamFlushRows 每输出该行数的数据将缓冲的数据发送给客户端
+	streamFlushRows = 100
+)
+
+// streamWriter 流式输出结果集，每次只输出一行数据
+type streamWriter struct {
+	w       *bufio.Writer
+	flusher http.Flusher
+	mode    string
+	// nofield 为true时不输出字段信息
+	nofield bool
+	// mapStyle 为true时JSON的每行数据输出为对象
+	mapStyle bool
+	rows     int64
+	err      error
+}
+
+// newStreamWriter 创建流式输出
+func newStreamWriter(w io.Writer, mode string, nofield bool, mapStyle bool) *streamWriter {
+	sw := &streamWriter{w: bufio.NewWriter(w), mode: mode, nofield: nofield, mapStyle: mapStyle || mode == StreamNDJSON}
+	sw.flusher, _ = w.(http.Flusher)
+	return sw
+}
+
+// write 输出字符串，发生错误后不再输出
+func (c *streamWriter) write(s string) {
+	if c.err == nil {
+		_, c.err = c.w.WriteString(s)
+	}
+}
+
+// writeJSON 输出JSON格式的值
+func (c *streamWriter) writeJSON(v interface{}) {
+	if c.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.err = err
+		return
+	}
+	_, c.err = c.w.Write(b)
+}
+
+// flush 将缓冲的数据发送给客户端
+func (c *streamWriter) flush() {
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	if c.flusher != nil {
+		c.flusher.Flush()
+	}
+}
+
+// begin 输出结果集的开始部分
+func (c *streamWriter) begin() {
+	if c.mode != StreamJSON {
+		return
+	}
+	if c.nofield {
+		c.write(`{"data":[`)
+	} else {
+		c.write(`{"resultset":{"Data":[`)
+	}
+}
+
+// writeRow 输出一行数据
+func (c *streamWriter) writeRow(fields datasource.FieldDescType, row []interface{}) {
+	if c.mode == StreamJSON && c.rows != 0 {
+		c.write(",")
+	}
+	if c.mapStyle {
+		item := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			item[k] = row[v.Index]
+		}
+		c.writeJSON(item)
+	} else {
+		c.writeJSON(row)
+	}
+	if c.mode == StreamNDJSON {
+		c.write("\n")
+	}
+	c.rows++
+	if c.rows%streamFlushRows == 0 {
+		c.flush()
+	}
+}
+
+// end 输出结果集的结束部分，fields为最后一行数据的字段，extra为附加的响应节点，err不为nil时输出错误信息
+func (c *streamWriter) end(fields datasource.FieldDescType, extra map[string]interface{}, err error) {
+	if c.mode == StreamNDJSON {
+		if err != nil {
+			c.writeJSON(utils.RestResult{"result": false, "msg": err.Error()})
+			c.write("\n")
+		}
+		c.flush()
+		return
+	}
+	c.write("]")
+	if !c.nofield {
+		c.write(`,"Fields":`)
+		c.writeJSON(fields)
+		c.write(`,"Meta":""}`)
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c.write(",")
+		c.writeJSON(k)
+		c.write(":")
+		c.writeJSON(extra[k])
+	}
+	if err != nil {
+		c.write(`,"result":false,"msg":`)
+		c.writeJSON(err.Error())
+	} else {
+		c.write(`,"result":true`)
+	}
+	c.write("}")
+	c.flush()
+}
+
+// doRowBulldozer 对一行数据执行推土机函数，每行使用字段的副本，列过滤等修改字段的函数不影响其他行
+func (c *IDSServiceHandler) doRowBulldozer(rowSet *datasource.DataResultSet, fields datasource.FieldDescType, row []interface{}, bulldozer []*CommonParamsType) (datasource.FieldDescType, []interface{}) {
+	if len(bulldozer) == 0 {
+		return fields, row
+	}
+	rowSet.Fields = fields.Copy()
+	rowSet.Data[0] = row
+	for _, v := range bulldozer {
+		c.doBulldozer(rowSet, 0, v.Name, v.Params)
+	}
+	return rowSet.Fields, rowSet.Data[0]
+}
+
+// bulldozerIterator 逐行执行推土机函数的迭代器，Fields返回当前行执行推土机函数后的字段
+type bulldozerIterator struct {
+	datasource.IRowIterator
+	handler   *IDSServiceHandler
+	bulldozer []*CommonParamsType
+	rowSet    *datasource.DataResultSet
+	fields    datasource.FieldDescType
+	row       []interface{}
+}
+
+// newBulldozerIterator 创建逐行执行推土机函数的迭代器
+func (c *IDSServiceHandler) newBulldozerIterator(it datasource.IRowIterator, bulldozer []*CommonParamsType) *bulldozerIterator {
+	return &bulldozerIterator{IRowIterator: it, handler: c, bulldozer: bulldozer, rowSet: &datasource.DataResultSet{Data: make([][]interface{}, 1, 1)}}
+}
+
+// Next 读取下一行数据并执行推土机函数
+func (c *bulldozerIterator) Next() bool {
+	if !c.IRowIterator.Next() {
+		return false
+	}
+	c.fields, c.row = c.handler.doRowBulldozer(c.rowSet, c.IRowIterator.Fields(), c.IRowIterator.Row(), c.bulldozer)
+	return true
+}
+
+// Fields 返回当前行的字段，没有读取数据时返回结果集的字段
+func (c *bulldozerIterator) Fields() datasource.FieldDescType {
+	if c.fields == nil {
+		return c.IRowIterator.Fields()
+	}
+	return c.fields
+}
+
+// Row 返回当前行执行推土机函数后的数据
+func (c *bulldozerIterator) Row() []interface{} {
+	return c.row
+}
+
+// exportStream 处理没有_stream参数的_format参数，逐行读取数据并导出为文件，内存中只保留一行数据
+// 数据源不支持逐行读取、使用了_cursor参数或者PostAction节点时返回false，由调用者读取全部数据后导出
+func (c *IDSServiceHandler) exportStream(ids datasource.IDataSource, all bool, rBody *SRequestBody) bool {
+	format := c.RRHandler.GetParam(RequestParamFormat)
+	sds, ok := ids.(datasource.IStreamDataSource)
+	if format == "" || !ok || c.RRHandler.GetParam(RequestParamCursor) != "" {
+		return false
+	}
+	var bulldozer []*CommonParamsType
+	if rBody != nil {
+		if len(rBody.PostAction) != 0 {
+			return false
+		}
+		bulldozer = rBody.Bulldozer
+	}
+	var it datasource.IRowIterator
+	var err error
+	if all {
+		it, err = sds.IterateAllData()
+	} else {
+		it, err = sds.IterateFilter()
+	}
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return true
+	}
+	defer it.Close()
+	c.exportRows(format, c.newBulldozerIterator(it, bulldozer))
+	return true
+}
+
+// streamResult 处理_stream参数，逐行读取数据并输出，内存中只保留一行数据，没有_stream参数时返回false
+// all为true时读取全部数据，否则读取满足查询条件的数据，逐行处理的推土机函数在输出每行数据时执行
+// 没有_stream参数时按_format参数逐行导出文件
+func (c *IDSServiceHandler) streamResult(ids datasource.IDataSource, all bool, rBody *SRequestBody) bool {
+	mode := c.RRHandler.GetParam(RequestParamStream)
+	if mode == "" {
+		return c.exportStream(ids, all, rBody)
+	}
+	if mode != StreamNDJSON && mode != StreamJSON {
+		c.createErrorResponse(RequestParamStream + "参数必须为" + StreamNDJSON + "或" + StreamJSON)
+		return true
+	}
+	sh, ok := c.RRHandler.(IStreamResponseHandler)
+	if !ok {
+		c.createErrorResponse("当前的请求不支持流式输出")
+		return true
+	}
+	sds, ok := ids.(datasource.IStreamDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务没有实现IStreamDataSource接口,不能使用" + RequestParamStream + "参数")
+		return true
+	}
+	if c.RRHandler.GetParam(RequestParamCache) != "" || c.RRHandler.GetParam(RequestParamCursor) != "" || c.RRHandler.GetParam(RequestParamFormat) != "" {
+		c.createErrorResponse(RequestParamStream + "参数不能与" + RequestParamCache + "、" + RequestParamCursor + "、" + RequestParamFormat + "参数一起使用")
+		return true
+	}
+	var bulldozer []*CommonParamsType
+	if rBody != nil {
+		if len(rBody.PostAction) != 0 {
+			c.createErrorResponse(RequestParamStream + "参数不能与PostAction节点一起使用")
+			return true
+		}
+		bulldozer = rBody.Bulldozer
+	}
+	if err := c.setTotalExtra(ids, all); err != nil {
+		c.createErrorResponse(err.Error())
+		return true
+	}
+	var it datasource.IRowIterator
+	var err error
+	if all {
+		it, err = sds.IterateAllData()
+	} else {
+		it, err = sds.IterateFilter()
+	}
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return true
+	}
+	defer it.Close()
+	bit := c.newBulldozerIterator(it, bulldozer)
+
+	contentType := "application/json; charset=utf-8"
+	if mode == StreamNDJSON {
+		contentType = "application/x-ndjson; charset=utf-8"
+	}
+	sw := newStreamWriter(sh.GetResponseWriter(contentType), mode,
+		c.RRHandler.GetParam(RequestParamNofieldsinfo) != "", c.RRHandler.GetParam(ResponseStyle) == "map")
+	sw.begin()
+	for sw.err == nil && bit.Next() {
+		sw.writeRow(bit.Fields(), bit.Row())
+	}
+	err = bit.Err()
+	sw.end(bit.Fields(), c.resultExtra, err)
+	if err == nil && sw.err != nil {
+		err = fmt.Errorf("流式输出时发生错误：" + sw.err.Error())
+	}
+	// 响应已经输出，只用于记录消息日志
+	r := utils.CreateRestResult(err == nil)
+	r["rows"] = sw.rows
+	if err != nil {
+		r["msg"] = err.Error()
+	}
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+	return true
+}
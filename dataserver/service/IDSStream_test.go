@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// testStreamRRHandler 测试用的支持流式输出的请求响应句柄
+type testStreamRRHandler struct {
+	testRRHandler
+	contentType string
+	body        bytes.Buffer
+}
+
+func (c *testStreamRRHandler) GetResponseWriter(contentType string) io.Writer {
+	c.contentType = contentType
+	return &c.body
+}
+
+func TestStream(t *testing.T) {
+	db, clean := createTestDB(t, "streamtest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int,PRIMARY KEY ("ORG_ID"))`)
+	defer clean()
+	for i := 0; i < 250; i++ {
+		db.Exec(`INSERT INTO "JEDA_ORG" VALUES (?,?,?)`, string(rune('A'+i/26))+string(rune('a'+i%26)), "org", i)
+	}
+	call := func(params map[string]string, all bool, rBody *SRequestBody) *testStreamRRHandler {
+		rr := &testStreamRRHandler{testRRHandler: testRRHandler{params: params}}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "streamtest", "JEDA_ORG")
+		if all {
+			h.doAllData(nil, nil, ids, rBody)
+		} else {
+			h.doQuery(nil, nil, ids, rBody)
+		}
+		return rr
+	}
+	format := []*CommonParamsType{{Name: "FormatDatafunc", Params: map[string]interface{}{"ORG_NAME": "<%v>"}}}
+
+	rr := call(map[string]string{RequestParamStream: StreamNDJSON}, true, &SRequestBody{Bulldozer: format})
+	if !rr.result() || rr.response.(utils.RestResult)["rows"] != int64(250) {
+		t.Fatalf("ndjson all %v", rr.response)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.body.String()), "\n")
+	if len(lines) != 250 || !strings.HasPrefix(rr.contentType, "application/x-ndjson") {
+		t.Fatalf("ndjson lines %d %s", len(lines), rr.contentType)
+	}
+	row := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil || row["ORG_ID"] != "Aa" || row["ORG_NAME"] != "<org>" {
+		t.Errorf("ndjson row %s %v", lines[0], err)
+	}
+
+	// 列过滤只保留显示的列，与非流式输出的结构相同
+	show := []*CommonParamsType{{Name: "ColumnFilterFunc", Params: map[string]interface{}{"show": []interface{}{"ORG_ORDER", "ORG_ID"}}}}
+	rBody := &SRequestBody{OrderBy: "ORG_ORDER desc", Bulldozer: show,
+		Criteria: []CriteriaInRBody{{Field: "ORG_ORDER", Operation: "<", Value: "3", Relation: "and"}}}
+	rr = call(map[string]string{RequestParamStream: StreamJSON, RequestParamTotal: "true"}, false, rBody)
+	if !rr.result() {
+		t.Fatalf("json query %v", rr.response)
+	}
+	var r struct {
+		Resultset struct {
+			Data   [][]interface{}
+			Fields map[string]*datasource.FieldDesc
+		} `json:"resultset"`
+		Total  int  `json:"total"`
+		Result bool `json:"result"`
+	}
+	if err := json.Unmarshal(rr.body.Bytes(), &r); err != nil {
+		t.Fatalf("json stream %s %v", rr.body.String(), err)
+	}
+	if !r.Result || r.Total != 3 || len(r.Resultset.Data) != 3 || r.Resultset.Data[0][1] != "Ac" ||
+		len(r.Resultset.Fields) != 2 || r.Resultset.Fields["ORG_ID"].Index != 1 {
+		t.Errorf("json stream %s", rr.body.String())
+	}
+
+	// 导出文件时逐行读取数据并执行推土机函数
+	rBody = &SRequestBody{OrderBy: "ORG_ORDER", Bulldozer: append(format, show...),
+		Criteria: []CriteriaInRBody{{Field: "ORG_ORDER", Operation: "<", Value: "2", Relation: "and"}}}
+	rr = call(map[string]string{RequestParamFormat: ExportCSV}, false, rBody)
+	want := "\xEF\xBB\xBFORG_ORDER,ORG_ID\n0,Aa\n1,Ab\n"
+	if !rr.result() || rr.response.(utils.RestResult)["rows"] != int64(2) || rr.body.String() != want {
+		t.Errorf("export stream %v\n got:%q\nwant:%q", rr.response, rr.body.String(), want)
+	}
+	rr = call(map[string]string{RequestParamFormat: ExportTSV}, true, &SRequestBody{Bulldozer: format})
+	if lines := strings.Split(strings.TrimSpace(rr.body.String()), "\n"); !rr.result() || len(lines) != 251 || lines[1] != "Aa\t<org>\t0" {
+		t.Errorf("export all stream %v %d", rr.response, len(lines))
+	}
+
+	// 不支持流式输出的请求响应句柄
+	trr := &testRRHandler{params: map[string]string{RequestParamStream: StreamJSON}}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: trr}}
+	h.doAllData(nil, nil, datasource.CreateWriteableTableDataSource("JEDA_ORG", "streamtest", "JEDA_ORG"), nil)
+	if trr.result() {
+		t.Error("stream without writer accepted")
+	}
+	if rr = call(map[string]string{RequestParamStream: "xml"}, true, nil); rr.result() || rr.body.Len() != 0 {
+		t.Error("invalid stream mode accepted")
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"tongserver.dataserver/datasource"
+)
+
+// setTotalExtra 处理_total参数，查询满足条件的记录数，在响应中附加total、pagesize、pageindex、pagecount节点
+// all为true时返回全部数据的记录数，否则返回满足查询条件的记录数，没有_pagesize参数时全部数据作为一页
+func (c *IDSServiceHandler) setTotalExtra(ids datasource.IDataSource, all bool) error {
+	if total, _ := strconv.ParseBool(c.RRHandler.GetParam(RequestParamTotal)); !total {
+		return nil
+	}
+	cinf, ok := ids.(datasource.ICountDataSource)
+	if !ok {
+		return fmt.Errorf("请求的服务没有实现ICountDataSource接口,不能使用" + RequestParamTotal + "参数")
+	}
+	var count int64
+	var err error
+	if all {
+		count, err = cinf.CountAll()
+	} else {
+		count, err = cinf.CountFilter()
+	}
+	if err != nil {
+		return err
+	}
+	pagesize, err := strconv.Atoi(c.RRHandler.GetParam(RequestParamPagesize))
+	if err != nil || pagesize <= 0 {
+		pagesize = 0
+	}
+	pageindex, err := strconv.Atoi(c.RRHandler.GetParam(RequestParamPageindex))
+	if err != nil || pagesize == 0 {
+		pageindex = 1
+	}
+	var pagecount int64
+	switch {
+	case pagesize == 0 && count > 0:
+		pagecount = 1
+	case pagesize > 0:
+		pagecount = (count + int64(pagesize) - 1) / int64(pagesize)
+	}
+	c.setResultExtra("total", count)
+	c.setResultExtra("pagesize", pagesize)
+	c.setResultExtra("pageindex", pageindex)
+	c.setResultExtra("pagecount", pagecount)
+	return nil
+}
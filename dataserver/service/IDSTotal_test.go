@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestTotal(t *testing.T) {
+	_, clean := createTestDB(t, "totaltest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"ORG_ORDER" int,PRIMARY KEY ("ORG_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('A','a',2),('B','b',1),('C','c',2),('D','d',3),('E','e',1)`)
+	defer clean()
+	filter := func() *SRequestBody {
+		return &SRequestBody{OrderBy: "ORG_ID", Criteria: []CriteriaInRBody{{Field: "ORG_ORDER", Operation: "<", Value: "3", Relation: "and"}}}
+	}
+	// check 检查响应中的记录数和分页信息
+	check := func(name string, rr *testRRHandler, rows int, total int64, pagesize, pageindex int, pagecount int64) {
+		if !rr.result() {
+			t.Fatalf("%s failed %v", name, rr.response)
+		}
+		r := rr.response.(utils.RestResult)
+		if got := len(r["resultset"].(*datasource.DataResultSet).Data); got != rows {
+			t.Errorf("%s rows %d", name, got)
+		}
+		if r["total"] != total || r["pagesize"] != pagesize || r["pageindex"] != pageindex || r["pagecount"] != pagecount {
+			t.Errorf("%s total %v pagesize %v pageindex %v pagecount %v", name, r["total"], r["pagesize"], r["pageindex"], r["pagecount"])
+		}
+	}
+	paged := map[string]string{RequestParamTotal: "true", RequestParamPagesize: "3", RequestParamPageindex: "2"}
+	newIDS := func() datasource.IDataSource {
+		return datasource.CreateWriteableTableDataSource("JEDA_ORG", "totaltest", "JEDA_ORG")
+	}
+
+	rr := &testRRHandler{params: paged}
+	h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, newIDS(), filter())
+	check("query", rr, 1, 4, 3, 2, 2)
+
+	rr = &testRRHandler{params: paged}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doAllData(nil, nil, newIDS(), nil)
+	check("all", rr, 2, 5, 3, 2, 2)
+
+	// 没有_pagesize参数时全部数据作为一页
+	rr = &testRRHandler{params: map[string]string{RequestParamTotal: "true"}}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, newIDS(), &SRequestBody{Aggre: []AggreStruct{{Predicate: "count", ColName: "*", Outfield: "CNT"}}, OrderBy: "ORG_ORDER"})
+	check("aggre", rr, 5, 5, 0, 1, 1)
+
+	rr = &testRRHandler{params: paged}
+	p := &PredefineServiceHandler{IDSServiceHandler: IDSServiceHandler{SHandlerBase{RRHandler: rr}}}
+	p.getActionMap()[SrvActionALLDATA](nil, nil, newIDS(), filter())
+	check("predefine", rr, 1, 4, 3, 2, 2)
+
+	// 没有_total参数时不返回记录数
+	rr = &testRRHandler{}
+	h = &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+	h.doQuery(nil, nil, newIDS(), filter())
+	if _, ok := rr.response.(utils.RestResult)["total"]; ok || !rr.result() {
+		t.Errorf("total without param %v", rr.response)
+	}
+}
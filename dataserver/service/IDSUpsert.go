@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+const (
+	// upsertInserted upsert操作插入了新数据
+	upsertInserted = "inserted"
+	// upsertUpdated upsert操作更新了已有的数据
+	upsertUpdated = "updated"
+)
+
+// 处理插入或更新，Upsert节点中的数据在一个事务中按顺序处理，主键存在时更新数据，不存在时插入数据
+// results节点返回每一行数据是插入还是更新，任何一行失败都会回滚全部操作
+func (c *IDSServiceHandler) doUpsert(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	if rBody == nil || len(rBody.Upsert) == 0 {
+		c.createErrorResponse("upsert操作必须POST方式提交包含Upsert节点的rbody信息")
+		return
+	}
+	inf, ok := ids.(datasource.IUpsertDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务没有实现DataSource.IUpsertDataSource接口")
+		return
+	}
+	tinf, ok := ids.(datasource.ITransactionDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务不支持事务")
+		return
+	}
+	values, errs := c.getRowsValues(ids, rBody.Upsert)
+	if len(errs) != 0 {
+		c.createRowErrorsResponse(errs)
+		return
+	}
+	tx, err := c.beginAuditTx(tinf)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	tinf.SetTx(tx.Tx)
+	results := make([]string, len(values), len(values))
+	keys := make([]map[string]interface{}, len(values), len(values))
+	audits := make([]*auditRecord, 0)
+	for i, v := range values {
+		var before map[string]interface{}
+		key := getKeyValues(ids, v)
+		if auditEnabled() && key != nil {
+			before, err = c.queryAuditRow(ids, key)
+		}
+		inserted := false
+		if err == nil {
+			_, inserted, err = inf.Upsert(v)
+		}
+		if err == nil && auditEnabled() {
+			err = c.appendUpsertAudit(&audits, ids, key, before, v)
+		}
+		if err != nil {
+			tinf.SetTx(nil)
+			if e := tx.Rollback(); e != nil {
+				c.createErrorResponse(fmt.Sprintf("第%d行数据处理失败：%s，回滚事务时发生错误：%s", i+1, err.Error(), e.Error()))
+				return
+			}
+			r := utils.CreateRestResult(false)
+			r["msg"] = fmt.Sprintf("第%d行数据处理失败，全部数据已回滚：%s", i+1, err.Error())
+			if err == datasource.ErrVersionConflict {
+				r["conflict"] = true
+			}
+			c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+			return
+		}
+		results[i] = upsertUpdated
+		if inserted {
+			results[i] = upsertInserted
+		}
+		keys[i] = c.getInsertedKeys(ids, v, nil)
+	}
+	tinf.SetTx(nil)
+	if err := c.commitAuditTx(sdef, tx, audits); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	r := utils.CreateRestResult(true)
+	r["msg"] = "处理成功"
+	r["results"] = results
+	r["keys"] = keys
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// appendUpsertAudit 添加一行upsert数据的审计信息，写入前后的数据都根据主键读取
+func (c *IDSServiceHandler) appendUpsertAudit(audits *[]*auditRecord, ids datasource.IDataSource, key []interface{}, before map[string]interface{}, values map[string]interface{}) error {
+	r := &auditRecord{ids: ids.GetName(), action: SrvActionUPSERT, key: key, before: before, after: values}
+	if key != nil {
+		after, err := c.queryAuditRow(ids, key)
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			r.after = after
+		}
+	}
+	*audits = append(*audits, r)
+	return nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestUpsert(t *testing.T) {
+	db, clean := createTestDB(t, "upserttest", "sqlite3",
+		`CREATE TABLE "DEVICE" ("DEVICE_ID" varchar(50) NOT NULL,"STATE" varchar(10),PRIMARY KEY ("DEVICE_ID"))`,
+		`INSERT INTO "DEVICE" VALUES ('D1','off')`)
+	defer clean()
+	upsert := func(rows []map[string]string) *testRRHandler {
+		rr := &testRRHandler{}
+		h := &IDSServiceHandler{SHandlerBase{RRHandler: rr}}
+		ids := datasource.CreateWriteableTableDataSource("DEVICE", "upserttest", "DEVICE")
+		h.doUpsert(nil, nil, ids, &SRequestBody{Upsert: rows})
+		return rr
+	}
+	state := func(id string) string {
+		var s string
+		db.QueryRow(`SELECT "STATE" FROM "DEVICE" WHERE "DEVICE_ID"=?`, id).Scan(&s)
+		return s
+	}
+
+	rr := upsert([]map[string]string{
+		{"DEVICE_ID": "D1", "STATE": "on"},
+		{"DEVICE_ID": "D2", "STATE": "on"},
+		{"DEVICE_ID": "D2", "STATE": "off"},
+	})
+	if !rr.result() {
+		t.Fatalf("upsert failed %v", rr.response)
+	}
+	if got := rr.response.(utils.RestResult)["results"]; !reflect.DeepEqual(got, []string{"updated", "inserted", "updated"}) {
+		t.Errorf("upsert results %v", got)
+	}
+	if state("D1") != "on" || state("D2") != "off" {
+		t.Errorf("upsert state %s %s", state("D1"), state("D2"))
+	}
+
+	// 没有主键的数据失败时回滚全部操作
+	if rr = upsert([]map[string]string{{"DEVICE_ID": "D3", "STATE": "on"}, {"STATE": "on"}}); rr.result() {
+		t.Fatal("upsert without key succeeded")
+	}
+	if state("D3") != "" {
+		t.Error("upsert not rolled back")
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tongserver.dataserver/datasource"
+)
+
+// formatVersion 将版本字段的值转换为字符串，时间类型的版本使用与ConvertString2Type相同的格式
+func formatVersion(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// parseETag 从If-Match请求头中取出版本，去掉弱校验前缀W/和引号，*不对应具体的版本，返回空字符串
+func parseETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	if etag == "*" {
+		return ""
+	}
+	return strings.Trim(etag, `"`)
+}
+
+// setVersionETag 数据源使用乐观并发控制并且只返回一条数据时，通过ETag响应头返回数据的版本
+func (c *IDSServiceHandler) setVersionETag(ids datasource.IDataSource, rs *datasource.DataResultSet) {
+	vinf, ok := ids.(datasource.IVersionDataSource)
+	if !ok || vinf.GetVersionField() == "" || rs == nil || len(rs.Data) != 1 {
+		return
+	}
+	f, ok := rs.Fields[vinf.GetVersionField()]
+	if !ok || rs.Data[0][f.Index] == nil {
+		return
+	}
+	c.setHeader(HeaderETag, `"`+formatVersion(rs.Data[0][f.Index])+`"`)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"testing"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestVersion(t *testing.T) {
+	db, clean := createTestDB(t, "versiontest", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"VERSION" int,PRIMARY KEY ("ORG_ID"))`)
+	defer clean()
+	newIds := func() *datasource.WriteableTableSource {
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "versiontest", "JEDA_ORG")
+		ids.VersionField = "VERSION"
+		return ids
+	}
+	call := func(f func(h *IDSServiceHandler, ids datasource.IDataSource), params, headers map[string]string) *testRRHandler {
+		rr := &testRRHandler{params: params, headers: headers}
+		f(&IDSServiceHandler{SHandlerBase{RRHandler: rr}}, newIds())
+		return rr
+	}
+	byKey := []CriteriaInRBody{{Field: "ORG_ID", Operation: "=", Value: "A", Relation: "and"}}
+
+	// 插入时版本为1
+	rr := call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doInsert(nil, nil, ids, &SRequestBody{Insert: map[string]string{"ORG_ID": "A", "ORG_NAME": "a"}})
+	}, nil, nil)
+	if !rr.result() {
+		t.Fatalf("insert failed %v", rr.response)
+	}
+
+	// get返回ETag
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doGetValueByKey(nil, nil, ids, &SRequestBody{})
+	}, map[string]string{"ORG_ID": "A"}, nil)
+	if rr.headers[HeaderETag] != `"1"` {
+		t.Fatalf("etag %v %v", rr.headers, rr.response)
+	}
+
+	// 没有版本时拒绝更新
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpdate(nil, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "b"}, Criteria: byKey})
+	}, nil, nil)
+	if rr.result() {
+		t.Error("update without version succeeded")
+	}
+
+	// 使用If-Match更新，版本加1
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpdate(nil, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "b"}, Criteria: byKey})
+	}, nil, map[string]string{HeaderIfMatch: `"1"`})
+	if !rr.result() {
+		t.Fatalf("update failed %v", rr.response)
+	}
+	var name string
+	var version int
+	db.QueryRow(`SELECT "ORG_NAME","VERSION" FROM "JEDA_ORG" WHERE "ORG_ID"='A'`).Scan(&name, &version)
+	if name != "b" || version != 2 {
+		t.Errorf("update result %s %d", name, version)
+	}
+
+	// 旧版本的更新和删除返回冲突
+	conflict := func(rr *testRRHandler) bool {
+		r, _ := rr.response.(utils.RestResult)
+		return !rr.result() && r["conflict"] == true
+	}
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doUpdate(nil, nil, ids, &SRequestBody{Update: map[string]string{"ORG_NAME": "c"}, Criteria: byKey, Version: "1"})
+	}, nil, nil)
+	if !conflict(rr) {
+		t.Errorf("stale update %v", rr.response)
+	}
+	// or条件作为一个条件组与版本条件组合
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doDelete(nil, nil, ids, &SRequestBody{Delete: "true", Version: "1", Criteria: []CriteriaInRBody{
+			{Field: "ORG_ID", Operation: "=", Value: "A", Relation: "and"},
+			{Field: "ORG_ID", Operation: "=", Value: "X", Relation: "or"}}})
+	}, nil, nil)
+	if !conflict(rr) {
+		t.Errorf("stale delete %v", rr.response)
+	}
+	// upsert更新已有数据时版本字段为期望的版本
+	for v, ok := range map[string]bool{"": false, "1": false, "2": true} {
+		rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+			row := map[string]string{"ORG_ID": "A", "ORG_NAME": "u" + v}
+			if v != "" {
+				row["VERSION"] = v
+			}
+			h.doUpsert(nil, nil, ids, &SRequestBody{Upsert: []map[string]string{row}})
+		}, nil, nil)
+		if rr.result() != ok || v == "1" && !conflict(rr) {
+			t.Errorf("upsert version %s %v", v, rr.response)
+		}
+	}
+	db.QueryRow(`SELECT "ORG_NAME","VERSION" FROM "JEDA_ORG" WHERE "ORG_ID"='A'`).Scan(&name, &version)
+	if name != "u2" || version != 3 {
+		t.Errorf("upsert result %s %d", name, version)
+	}
+	rr = call(func(h *IDSServiceHandler, ids datasource.IDataSource) {
+		h.doDelete(nil, nil, ids, &SRequestBody{Delete: "true", Criteria: byKey})
+	}, nil, map[string]string{HeaderIfMatch: `W/"3"`})
+	if !rr.result() || rr.response.(utils.RestResult)["affected"] != int64(1) {
+		t.Errorf("delete failed %v", rr.response)
+	}
+}
+
+// TestVersionRestore 使用乐观并发控制时恢复数据必须提交版本，恢复后版本加1
+func TestVersionRestore(t *testing.T) {
+	db, clean := createTestDB(t, "versionrestore", "sqlite3",
+		`CREATE TABLE "JEDA_ORG" ("ORG_ID" varchar(50) NOT NULL,"ORG_NAME" varchar(100),"DELETED" int,"VERSION" int,PRIMARY KEY ("ORG_ID"))`,
+		`INSERT INTO "JEDA_ORG" VALUES ('A','a',0,1)`)
+	defer clean()
+	call := func(rBody *SRequestBody, headers map[string]string, f func(h *IDSServiceHandler, ids datasource.IDataSource, rBody *SRequestBody)) *testRRHandler {
+		rr := &testRRHandler{headers: headers}
+		ids := datasource.CreateWriteableTableDataSource("JEDA_ORG", "versionrestore", "JEDA_ORG")
+		ids.VersionField = "VERSION"
+		ids.SoftDelete = &datasource.SoftDeleteDefine{Field: "DELETED", Value: 1, RestoreValue: 0}
+		f(&IDSServiceHandler{SHandlerBase{RRHandler: rr}}, ids, rBody)
+		return rr
+	}
+	byKey := []CriteriaInRBody{{Field: "ORG_ID", Operation: "=", Value: "A", Relation: "and"}}
+	restore := func(h *IDSServiceHandler, ids datasource.IDataSource, rBody *SRequestBody) {
+		h.doRestore(nil, nil, ids, rBody)
+	}
+	state := func() (deleted, version int) {
+		db.QueryRow(`SELECT "DELETED","VERSION" FROM "JEDA_ORG" WHERE "ORG_ID"='A'`).Scan(&deleted, &version)
+		return
+	}
+
+	// 软删除同时更新版本
+	rr := call(&SRequestBody{Delete: "true", Criteria: byKey, Version: "1"}, nil, func(h *IDSServiceHandler, ids datasource.IDataSource, rBody *SRequestBody) {
+		h.doDelete(nil, nil, ids, rBody)
+	})
+	if d, v := state(); !rr.result() || d != 1 || v != 2 {
+		t.Fatalf("soft delete %v %d %d", rr.response, d, v)
+	}
+	if rr = call(&SRequestBody{Criteria: byKey}, nil, restore); rr.result() {
+		t.Error("restore without version succeeded")
+	}
+	rr = call(&SRequestBody{Criteria: byKey, Version: "1"}, nil, restore)
+	if r, _ := rr.response.(utils.RestResult); rr.result() || r["conflict"] != true {
+		t.Errorf("stale restore %v", rr.response)
+	}
+	rr = call(&SRequestBody{Criteria: byKey}, map[string]string{HeaderIfMatch: `"2"`}, restore)
+	if d, v := state(); !rr.result() || d != 0 || v != 3 {
+		t.Errorf("restore %v %d %d", rr.response, d, v)
+	}
+}
@@ -40,13 +40,20 @@ func (c *PredefineServiceHandler) DoSrv(sdef *SDefine, inf SHandlerInterface) {
 func (c *PredefineServiceHandler) merageRbody(rBody *SRequestBody) *SRequestBody {
 	b := c.predefine.SRequestBody
 	rBody.Criteria = append(rBody.Criteria, b.Criteria...)
+	if b.Filter != nil {
+		if rBody.Filter == nil {
+			rBody.Filter = b.Filter
+		} else {
+			rBody.Filter = &CriteriaGroup{And: []*CriteriaGroup{rBody.Filter, b.Filter}}
+		}
+	}
 	rBody.Aggre = append(rBody.Aggre, b.Aggre...)
 	rBody.Bulldozer = append(rBody.Bulldozer, b.Bulldozer...)
 	rBody.PostAction = append(rBody.PostAction, b.PostAction...)
 	if rBody.OrderBy == "" {
 		rBody.OrderBy = b.OrderBy
 	}
-	if rBody.InnerJoin == "" {
+	if rBody.InnerJoin == nil {
 		rBody.InnerJoin = b.InnerJoin
 	}
 	return rBody
@@ -66,6 +73,7 @@ func (c *PredefineServiceHandler) getRBody() *SRequestBody {
 				c.predefine.SRequestBody.Criteria[i].Value = c.RRHandler.GetParam(cri.Field)
 			}
 		}
+		c.fillFilterParams(c.predefine.SRequestBody.Filter)
 		return c.merageRbody(rBody)
 	}
 	for i, cri := range c.predefine.SRequestBody.Criteria {
@@ -73,10 +81,28 @@ func (c *PredefineServiceHandler) getRBody() *SRequestBody {
 			c.predefine.SRequestBody.Criteria[i].Value = c.RRHandler.GetParam(cri.Field)
 		}
 	}
+	c.fillFilterParams(c.predefine.SRequestBody.Filter)
 	return &c.predefine.SRequestBody
 
 }
 
+// fillFilterParams 将条件树中值为:?的条件替换为请求参数
+func (c *PredefineServiceHandler) fillFilterParams(g *CriteriaGroup) {
+	if g == nil {
+		return
+	}
+	if g.Field != "" && g.Value == ":?" {
+		g.Value = c.RRHandler.GetParam(g.Field)
+	}
+	for _, item := range g.And {
+		c.fillFilterParams(item)
+	}
+	for _, item := range g.Or {
+		c.fillFilterParams(item)
+	}
+	c.fillFilterParams(g.Not)
+}
+
 // getServiceInterface 返回该服务需要的数据源接口
 func (c *PredefineServiceHandler) getServiceInterface(meta map[string]interface{}, sdef *SDefine) (interface{}, error) {
 	if c.predefine.Definetype == "ids" {
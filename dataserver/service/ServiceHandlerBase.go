@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"github.com/satori/go.uuid"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -31,12 +32,38 @@ const (
 	SrvActionUPDATE string = "update"
 	//插入操作
 	SrvActionINSERT string = "insert"
+	//批量写操作，在一个事务中执行
+	SrvActionBATCH string = "batch"
+	//批量插入操作，在一个事务中执行
+	SrvActionBULKINSERT string = "bulkinsert"
+	//插入或更新操作，主键存在时更新数据，不存在时插入数据
+	SrvActionUPSERT string = "upsert"
+	//恢复软删除的数据
+	SrvActionRESTORE string = "restore"
+	//查询一条数据的审计信息
+	SrvActionAUDIT string = "audit"
+	//从上传的csv、tsv或xlsx文件导入数据
+	SrvActionIMPORT string = "import"
 
 	//以下三个常量均为通过QueryString传入的参数名
 	//针对查询自动分页中每页记录数
 	RequestParamPagesize string = "_pagesize"
 	//针对查询自动分页中的页索引
 	RequestParamPageindex string = "_pageindex"
+	//游标分页的游标，第一页为start，之后为上一页响应中的nextcursor，针对query、all操作
+	RequestParamCursor string = "_cursor"
+	//将结果集导出为文件，值为csv、tsv或xlsx，针对返回结果集的操作
+	RequestParamFormat string = "_format"
+	//导入的模式，值为insert、upsert或replace，默认为insert，针对import操作
+	RequestParamImportMode string = "_importmode"
+	//导入文件的标题到字段名的映射，JSON对象，针对import操作
+	RequestParamImportMapping string = "_mapping"
+	//为true时只检查导入的数据，不写入数据，针对import操作
+	RequestParamDryRun string = "_dryrun"
+	//流式输出结果集，值为ndjson或json，针对query、all操作
+	RequestParamStream string = "_stream"
+	//为true时返回满足条件的记录数和分页信息，针对query、all操作
+	RequestParamTotal string = "_total"
 	//是否返回字段元数据，默认为返回
 	RequestParamNofieldsinfo string = "_nofield"
 	// 响应的风格，默认是数组风格array，可以设定为map风格
@@ -47,6 +74,15 @@ const (
 	//该参数只对query、all两个操作起作用
 	RequestParamCache      string = "_cache"
 	RequestParamCachebykey string = "_cachekey"
+	//写操作完成后重新读取并返回写入的数据，删除操作返回删除前的数据
+	RequestParamReturning string = "_returning"
+
+	//查询时包括已经删除的数据，针对使用软删除的数据源，只有服务元数据中withdeletedrole定义的角色可以使用
+	RequestParamWithDeleted string = "_withdeleted"
+
+	//乐观并发控制使用的HTTP头
+	HeaderETag    string = "ETag"
+	HeaderIfMatch string = "If-Match"
 )
 
 // SHandlerInterface 服务处理接口
@@ -68,6 +104,18 @@ type RequestResponseHandler interface {
 	GetRequestBody() (*SRequestBody, error)
 }
 
+// IHeaderHandler 可以读写HTTP头的请求响应句柄，内部服务调用等没有HTTP头的句柄不需要实现
+type IHeaderHandler interface {
+	GetHeader(name string) string
+	SetHeader(name, value string)
+}
+
+// IStreamResponseHandler 支持流式输出的请求响应句柄，内部服务调用等不需要实现
+type IStreamResponseHandler interface {
+	// GetResponseWriter 设定响应的Content-Type并返回响应的输出流，调用后不再输出CreateResponseData设定的数据
+	GetResponseWriter(contentType string) io.Writer
+}
+
 // SerivceActionHandler 处理请求的方法类型
 type SerivceActionHandler func(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody)
 
@@ -77,6 +125,38 @@ type SHandlerBase struct {
 	RRHandler     RequestResponseHandler
 	ActionMap     map[string]SerivceActionHandler
 	CurrentUserId string
+	// resultExtra 返回结果集时附加的响应节点，如游标分页的nextcursor
+	resultExtra map[string]interface{}
+}
+
+// setResultExtra 设定返回结果集时附加的响应节点
+func (c *SHandlerBase) setResultExtra(name string, value interface{}) {
+	if c.resultExtra == nil {
+		c.resultExtra = make(map[string]interface{})
+	}
+	c.resultExtra[name] = value
+}
+
+// fillResultExtra 将附加的响应节点添加到响应中
+func (c *SHandlerBase) fillResultExtra(r utils.RestResult) {
+	for k, v := range c.resultExtra {
+		r[k] = v
+	}
+}
+
+// getHeader 返回请求头，请求响应句柄不支持HTTP头时返回空字符串
+func (c *SHandlerBase) getHeader(name string) string {
+	if h, ok := c.RRHandler.(IHeaderHandler); ok {
+		return h.GetHeader(name)
+	}
+	return ""
+}
+
+// setHeader 设置响应头，请求响应句柄不支持HTTP头时忽略
+func (c *SHandlerBase) setHeader(name, value string) {
+	if h, ok := c.RRHandler.(IHeaderHandler); ok {
+		h.SetHeader(name, value)
+	}
 }
 
 func (c *SHandlerBase) createErrorResponse(msg string) {
@@ -95,6 +175,32 @@ func (c *SHandlerBase) getServiceInterface(meta map[string]interface{}, sdef *SD
 	return datasource.CreateIDSFromName(idstr)
 }
 
+// createMetaDataSource 创建请求中引用的其他数据源，数据源必须属于当前服务的项目，
+// 并且是当前服务的数据源或者在服务元数据key中列出，名称中不能包含项目名
+func (c *SHandlerBase) createMetaDataSource(sdef *SDefine, meta map[string]interface{}, key string, name string) (interface{}, error) {
+	if strings.Index(name, ".") != -1 {
+		return nil, fmt.Errorf("数据源名称" + name + "中不能包含项目名，只能使用当前服务所在项目中的数据源")
+	}
+	allowed := false
+	if s, ok := meta["ids"].(string); ok && s == name {
+		allowed = true
+	}
+	switch v := meta[key].(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			allowed = allowed || strings.TrimSpace(item) == name
+		}
+	case []interface{}:
+		for _, item := range v {
+			allowed = allowed || fmt.Sprint(item) == name
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("数据源" + name + "没有在服务元数据" + key + "中定义，当前服务不能使用")
+	}
+	return datasource.CreateIDSFromName(sdef.ProjectId + "." + name)
+}
+
 // DoSrv 处理服务请求的入口
 func (c *SHandlerBase) DoSrv(sdef *SDefine, inf SHandlerInterface) {
 	//////////////////////////////////////////////////////////////////////////
@@ -125,9 +231,49 @@ func (c *SHandlerBase) DoSrv(sdef *SDefine, inf SHandlerInterface) {
 		c.createErrorResponse("请求的动作当前服务没有实现")
 		return
 	}
+	if err := c.applyWithDeleted(meta, ids); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
 	f(sdef, meta, ids, rBody)
 }
 
+// checkMetaRole 检查当前用户是否具有服务元数据中key定义的角色，name为需要该角色的参数或操作，用于错误信息
+func (c *SHandlerBase) checkMetaRole(meta map[string]interface{}, key string, name string) error {
+	role, _ := meta[key].(string)
+	if role == "" {
+		return fmt.Errorf("服务元数据中没有定义" + key + "，不能使用" + name)
+	}
+	if c.CurrentUserId == "" {
+		return fmt.Errorf("当前调用者用户id为空，不能使用" + name)
+	}
+	roles, err := GetISevurityServiceInstance().GetRoleByUserid(c.CurrentUserId)
+	if err != nil {
+		return err
+	}
+	if !roles.Exist(role) {
+		return fmt.Errorf("当前用户没有角色" + role + "，不能使用" + name)
+	}
+	return nil
+}
+
+// applyWithDeleted 处理_withdeleted参数，当前用户必须具有服务元数据中withdeletedrole定义的角色
+func (c *SHandlerBase) applyWithDeleted(meta map[string]interface{}, ids datasource.IDataSource) error {
+	withDeleted, _ := strconv.ParseBool(c.RRHandler.GetParam(RequestParamWithDeleted))
+	if !withDeleted {
+		return nil
+	}
+	sinf, ok := ids.(datasource.ISoftDeleteDataSource)
+	if !ok || !sinf.IsSoftDelete() {
+		return fmt.Errorf("请求的服务没有使用软删除，不能使用" + RequestParamWithDeleted + "参数")
+	}
+	if err := c.checkMetaRole(meta, "withdeletedrole", RequestParamWithDeleted+"参数"); err != nil {
+		return err
+	}
+	sinf.SetWithDeleted(true)
+	return nil
+}
+
 func (c *SHandlerBase) getActionMap() map[string]SerivceActionHandler {
 	return map[string]SerivceActionHandler{
 		SrvActionMETA:  c.doGetMeta,
@@ -225,6 +371,9 @@ func (c *SHandlerBase) doGetMeta(sdef *SDefine, meta map[string]interface{}, ids
 
 // setResultSet 设定结果集
 func (c *SHandlerBase) setResultSet(ds *datasource.DataResultSet) {
+	if c.exportResultSet(ds) {
+		return
+	}
 	//c.Ctl.Input().Get(RequestParamCache /**_cache**/)
 	if c.RRHandler.GetParam(RequestParamCache /**_cache**/) != "" {
 		// 处理缓存请求 [缓存时间]_[最大请求次数]  10_1  缓存的结果集请求一次即删除，
@@ -262,6 +411,7 @@ func (c *SHandlerBase) setResultSet(ds *datasource.DataResultSet) {
 		}
 		r["cachetimes"] = t2
 		r["duration"] = t
+		c.fillResultExtra(r)
 		err := utils.DataSetResultCache.Put(keys, r, time.Duration(t)*time.Second)
 		if err != nil {
 			c.createErrorResponse("加入缓存时发生错误：" + err.Error())
@@ -299,6 +449,7 @@ func (c *SHandlerBase) setResultSet(ds *datasource.DataResultSet) {
 			r["resultset"] = rsd
 		}
 	}
+	c.fillResultExtra(r)
 	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
 }
 
@@ -5,6 +5,7 @@ import (
 	"github.com/astaxie/beego/logs"
 	"reflect"
 	"strings"
+	"time"
 	"tongserver.dataserver/activity"
 	"tongserver.dataserver/utils"
 	"tongserver.dataserver/utils/mapstructure"
@@ -42,6 +43,10 @@ func (c *InnerServiceActivity) Execute(flowcontext activity.IContext) error {
 		return fmt.Errorf("请求的服务%s未启用", cnt)
 	}
 	userid := ""
+	start := time.Now()
+	defer func() {
+		logServiceMessage(sdef, c, userid, "", start, c.resultData)
+	}()
 	if sdef.Security {
 		user := flowcontext.GetVarbiableByName("userid")
 		if user == nil {
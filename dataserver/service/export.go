@@ -0,0 +1,262 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+const (
+	// ExportCSV 导出为逗号分隔的CSV文件
+	ExportCSV string = "csv"
+	// ExportTSV 导出为制表符分隔的文本文件
+	ExportTSV string = "tsv"
+	// ExportXLSX 导出为Excel文件
+	ExportXLSX string = "xlsx"
+
+	// exportDateFormat 导出日期类型字段的格式
+	exportDateFormat = "2006-01-02"
+	// exportTimeFormat 导出时间类型字段的格式
+	exportTimeFormat = "2006-01-02 15:04:05"
+)
+
+// exportContentTypes 导出格式对应的Content-Type
+var exportContentTypes = map[string]string{
+	ExportCSV:  "text/csv; charset=utf-8",
+	ExportTSV:  "text/tab-separated-values; charset=utf-8",
+	ExportXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportColumn 导出的一列
+type exportColumn struct {
+	name  string
+	field *datasource.FieldDesc
+}
+
+// getExportColumns 按字段的序号返回导出的列
+func getExportColumns(fields datasource.FieldDescType) []*exportColumn {
+	cols := make([]*exportColumn, 0, len(fields))
+	for k, v := range fields {
+		cols = append(cols, &exportColumn{name: k, field: v})
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].field.Index < cols[j].field.Index
+	})
+	return cols
+}
+
+// resultSetIterator 按IRowIterator接口逐行读取内存中的结果集
+type resultSetIterator struct {
+	ds    *datasource.DataResultSet
+	index int
+}
+
+// Fields 返回结果集的字段
+func (c *resultSetIterator) Fields() datasource.FieldDescType {
+	return c.ds.Fields
+}
+
+// Next 读取下一行数据，没有数据时返回false
+func (c *resultSetIterator) Next() bool {
+	if c.index >= len(c.ds.Data) {
+		return false
+	}
+	c.index++
+	return true
+}
+
+// Row 返回当前行的数据
+func (c *resultSetIterator) Row() []interface{} {
+	return c.ds.Data[c.index-1]
+}
+
+// Err 返回读取数据时发生的错误
+func (c *resultSetIterator) Err() error {
+	return nil
+}
+
+// Close 关闭迭代器
+func (c *resultSetIterator) Close() error {
+	return nil
+}
+
+// caption 返回列标题，有fieldmeta填充的CAP元数据时使用CAP
+func (c *exportColumn) caption() string {
+	if s := c.field.Meta["CAP"]; s != "" {
+		return s
+	}
+	return c.name
+}
+
+// formatExportValue 转换导出的值，时间按字段类型统一格式，xlsx保留数值类型，其他格式转换为字符串
+func formatExportValue(v interface{}, fieldType string, keepNumber bool) interface{} {
+	switch val := v.(type) {
+	case nil:
+		if keepNumber {
+			return nil
+		}
+		return ""
+	case time.Time:
+		if fieldType == datasource.PropertyDatatypeDate {
+			return val.Format(exportDateFormat)
+		}
+		return val.Format(exportTimeFormat)
+	case []byte:
+		return string(val)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		if keepNumber {
+			return val
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// escapeFormula 以=、+、-、@、制表符、回车符开始的字符串前添加单引号，防止电子表格软件将单元格作为公式执行
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// formatDelimitedValue 转换CSV格式导出的值，字符串类型的值防止作为公式执行
+func formatDelimitedValue(v interface{}, fieldType string) string {
+	s := formatExportValue(v, fieldType, false).(string)
+	switch v.(type) {
+	case string, []byte:
+		return escapeFormula(s)
+	}
+	return s
+}
+
+// writeDelimited 按CSV格式逐行写入数据，comma为分隔符，文件以UTF-8 BOM开始，Excel可以正确识别中文
+// 列按读取第一行数据后的字段确定，返回写入的行数
+func writeDelimited(w io.Writer, it datasource.IRowIterator, comma rune) (int64, error) {
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return 0, err
+	}
+	more := it.Next()
+	cols := getExportColumns(it.Fields())
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	record := make([]string, len(cols))
+	for i, col := range cols {
+		record[i] = col.caption()
+	}
+	if err := cw.Write(record); err != nil {
+		return 0, err
+	}
+	var rows int64
+	for ; more; more = it.Next() {
+		row := it.Row()
+		for i, col := range cols {
+			record[i] = ""
+			if col.field.Index < len(row) {
+				record[i] = formatDelimitedValue(row[col.field.Index], col.field.FieldType)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	if err := it.Err(); err != nil {
+		return rows, err
+	}
+	cw.Flush()
+	return rows, cw.Error()
+}
+
+// writeXLSX 按Excel格式逐行写入数据，列按读取第一行数据后的字段确定，返回写入的行数
+func writeXLSX(w io.Writer, it datasource.IRowIterator, sheet string) (int64, error) {
+	xw, err := utils.NewXLSXWriter(w, sheet)
+	if err != nil {
+		return 0, err
+	}
+	more := it.Next()
+	cols := getExportColumns(it.Fields())
+	record := make([]interface{}, len(cols))
+	for i, col := range cols {
+		record[i] = col.caption()
+	}
+	if err := xw.WriteRow(record); err != nil {
+		return 0, err
+	}
+	var rows int64
+	for ; more; more = it.Next() {
+		row := it.Row()
+		for i, col := range cols {
+			record[i] = nil
+			if col.field.Index < len(row) {
+				record[i] = formatExportValue(row[col.field.Index], col.field.FieldType, true)
+			}
+		}
+		if err := xw.WriteRow(record); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	if err := it.Err(); err != nil {
+		return rows, err
+	}
+	return rows, xw.Close()
+}
+
+// exportResultSet 处理_format参数，将结果集导出为文件，没有_format参数时返回false
+func (c *SHandlerBase) exportResultSet(ds *datasource.DataResultSet) bool {
+	format := c.RRHandler.GetParam(RequestParamFormat)
+	if format == "" {
+		return false
+	}
+	c.exportRows(format, &resultSetIterator{ds: ds})
+	return true
+}
+
+// exportRows 将迭代器读取的数据逐行导出为format格式的文件，内存中只保留一行数据
+// 文件名为服务的上下文，内部服务调用等不支持流式输出的请求不能导出
+func (c *SHandlerBase) exportRows(format string, it datasource.IRowIterator) {
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.createErrorResponse(RequestParamFormat + "参数必须为" + ExportCSV + "、" + ExportTSV + "或" + ExportXLSX)
+		return
+	}
+	sh, ok := c.RRHandler.(IStreamResponseHandler)
+	if !ok {
+		c.createErrorResponse("当前的请求不支持导出文件")
+		return
+	}
+	name := c.RRHandler.GetParam(":context")
+	if name == "" {
+		name = "export"
+	}
+	sheet := []rune(name)
+	if len(sheet) > 31 {
+		//Excel工作表的名称最长为31个字符
+		sheet = sheet[:31]
+	}
+	c.setHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w := sh.GetResponseWriter(contentType)
+	var rows int64
+	var err error
+	switch format {
+	case ExportXLSX:
+		rows, err = writeXLSX(w, it, string(sheet))
+	case ExportTSV:
+		rows, err = writeDelimited(w, it, '\t')
+	default:
+		rows, err = writeDelimited(w, it, ',')
+	}
+	// 响应已经输出，只用于记录消息日志
+	r := utils.CreateRestResult(err == nil)
+	r["rows"] = rows
+	if err != nil {
+		r["msg"] = "导出文件时发生错误：" + err.Error()
+	}
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+func TestExport(t *testing.T) {
+	ds := &datasource.DataResultSet{
+		Fields: datasource.FieldDescType{
+			"ORG_ID":   {Index: 0, FieldType: datasource.PropertyDatatypeStr, Meta: map[string]string{"CAP": "编号"}},
+			"ORG_DATE": {Index: 2, FieldType: datasource.PropertyDatatypeDate},
+			"ORG_TIME": {Index: 3, FieldType: datasource.PropertyDatatypeTime},
+			"ORG_NUM":  {Index: 1, FieldType: datasource.PropertyDatatypeInt},
+		},
+		Data: [][]interface{}{
+			{"A,1", int64(12), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{"B<&>", nil, nil, nil},
+			{"=1+1", int64(-5), nil, nil},
+		},
+	}
+	export := func(format string) *testStreamRRHandler {
+		rr := &testStreamRRHandler{testRRHandler: testRRHandler{params: map[string]string{RequestParamFormat: format, ":context": "jeda.org"}}}
+		h := &ValueKeyService{SHandlerBase{RRHandler: rr}}
+		h.setResultSet(ds)
+		if !rr.result() || rr.response.(utils.RestResult)["rows"] != int64(3) {
+			t.Fatalf("export %s %v", format, rr.response)
+		}
+		if rr.headers["Content-Disposition"] != `attachment; filename="jeda.org.`+format+`"` {
+			t.Errorf("export %s headers %v", format, rr.headers)
+		}
+		return rr
+	}
+
+	rr := export(ExportCSV)
+	want := "\xEF\xBB\xBF编号,ORG_NUM,ORG_DATE,ORG_TIME\n\"A,1\",12,2020-01-02,2020-01-02 03:04:05\nB<&>,,,\n'=1+1,-5,,\n"
+	if got := rr.body.String(); got != want || !strings.HasPrefix(rr.contentType, "text/csv") {
+		t.Errorf("csv\n got:%q\nwant:%q", got, want)
+	}
+	for _, v := range []string{"+1", "-x", "@sum", "\t=1+1", "\r=1+1"} {
+		if got := formatDelimitedValue(v, datasource.PropertyDatatypeStr); got != "'"+v {
+			t.Errorf("formatDelimitedValue(%s)=%s", v, got)
+		}
+	}
+	rr = export(ExportTSV)
+	if got := rr.body.String(); !strings.Contains(got, "编号\tORG_NUM\tORG_DATE\tORG_TIME\nA,1\t12\t") {
+		t.Errorf("tsv %q", got)
+	}
+
+	rr = export(ExportXLSX)
+	zr, err := zip.NewReader(bytes.NewReader(rr.body.Bytes()), int64(rr.body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			b, _ := ioutil.ReadAll(r)
+			sheet = string(b)
+		}
+	}
+	for _, s := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">编号</t></is></c>`,
+		`<c r="B2"><v>12</v></c>`,
+		`<c r="C2" t="inlineStr"><is><t xml:space="preserve">2020-01-02</t></is></c>`,
+		`<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">B&lt;&amp;&gt;</t></is></c></row>`,
+		`<c r="B4"><v>-5</v></c>`,
+	} {
+		if !strings.Contains(sheet, s) {
+			t.Errorf("xlsx sheet does not contain %s\n%s", s, sheet)
+		}
+	}
+
+	// 不支持的格式和不支持流式输出的请求
+	if rr := (&testStreamRRHandler{testRRHandler: testRRHandler{params: map[string]string{RequestParamFormat: "pdf"}}}); true {
+		(&SHandlerBase{RRHandler: rr}).setResultSet(ds)
+		if rr.result() || rr.body.Len() != 0 {
+			t.Error("invalid format accepted")
+		}
+	}
+	trr := &testRRHandler{params: map[string]string{RequestParamFormat: ExportCSV}}
+	(&SHandlerBase{RRHandler: trr}).setResultSet(ds)
+	if trr.result() {
+		t.Error("export without writer accepted")
+	}
+}
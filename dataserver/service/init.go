@@ -19,6 +19,61 @@ type CriteriaInRBody struct {
 	Relation  string
 }
 
+// CriteriaGroup 请求的rbody中的条件树，用于表达带括号的组合条件，如 (A or B) and not C
+// 一个节点中的Field条件、And条件组、Or条件组和Not条件之间为与的关系
+type CriteriaGroup struct {
+	// Field 条件字段，与Operation、Value一起构成一个简单条件
+	Field     string
+	Operation string
+	Value     interface{}
+	// And 该节点下的条件之间为与的关系
+	And []*CriteriaGroup
+	// Or 该节点下的条件之间为或的关系
+	Or []*CriteriaGroup
+	// Not 对该条件取反
+	Not *CriteriaGroup
+}
+
+// BatchOperation 批量操作中的一个写操作
+type BatchOperation struct {
+	// Ids 操作的数据源名称，为空时使用当前服务的数据源，必须与当前服务的数据源使用同一个数据库别名
+	Ids string
+	// Action 操作类型，insert、update或delete
+	Action string
+	// SRequestBody 操作的报文，使用Insert、Update、Delete、OperationConfirm、Criteria和Filter节点
+	SRequestBody
+}
+
+// JoinInRBody 请求的rbody中的连接节点，连接一个与当前数据源使用同一个数据库的数据表数据源
+type JoinInRBody struct {
+	// Ids 连接的数据源名称，没有项目名时使用当前服务的项目
+	Ids string
+	// Join 连接类型，inner或left，默认为inner
+	Join string
+	// Alias 连接表的别名，默认为表名，连接与当前数据源相同的表时必须指定
+	Alias string
+	// On 连接条件，条件之间为与的关系
+	On []JoinOnInRBody
+	// Fields 输出的连接表字段
+	Fields []JoinFieldInRBody
+}
+
+// JoinOnInRBody 连接条件，Field为连接表的字段，与RefField引用的字段或者Value比较
+type JoinOnInRBody struct {
+	Field     string
+	Operation string
+	// RefField 引用的字段，为当前数据源的字段或者“别名.字段名”形式的之前连接的表的字段
+	RefField string
+	// Value RefField为空时比较的值
+	Value interface{}
+}
+
+// JoinFieldInRBody 连接表的输出字段，As为结果集中的字段名，为空时使用字段名
+type JoinFieldInRBody struct {
+	Field string
+	As    string
+}
+
 type AggreStruct struct {
 	Outfield  string
 	Predicate string
@@ -37,20 +92,32 @@ type SRequestBody struct {
 	OperationConfirm string
 	// Criteria 条件节点,针对更新、删除、查询操作
 	Criteria []CriteriaInRBody
+	// Filter 条件树节点，与Criteria节点为与的关系，针对更新、删除、查询操作
+	Filter *CriteriaGroup
 	// OrderBy 排序节点，针对查询操作
 	OrderBy string
-	// InnerJoin 内连接节点，针对查询操作
-	InnerJoin string
+	// InnerJoin 连接节点，针对查询操作，按顺序连接其他数据表数据源
+	InnerJoin []*JoinInRBody
 	// Aggre 聚合节点，针对查询操作
 	Aggre []AggreStruct
 	// Bulldozer 推土机节点，针对查询操作
 	Bulldozer []*CommonParamsType
 	// PostAction 后处理节点，针对查询操作
 	PostAction []*CommonParamsType
+	// Batch 批量操作节点，针对batch操作，所有操作在一个事务中按顺序执行
+	Batch []*BatchOperation
+	// BulkInsert 批量插入节点，针对bulkinsert操作，每一个元素为一行数据
+	BulkInsert []map[string]string
+	// Version 数据的版本，针对使用乐观并发控制的数据源的更新、删除、恢复操作，没有时使用If-Match请求头
+	Version string
+	// Upsert 插入或更新节点，针对upsert操作，每一个元素为一行数据，按主键判断插入还是更新
+	Upsert []map[string]string
+	// userFilter 用户过滤器的条件，由doUserFilter根据服务元数据生成，与Criteria和Filter为与的关系
+	userFilter []CriteriaInRBody
 }
 
 func (c *SRequestBody) IsEmpty() bool {
-	return c.Insert == nil && c.Update == nil && c.Delete == "" && c.OperationConfirm == "" && c.Criteria == nil && c.OrderBy == "" && c.InnerJoin == "" && c.Aggre == nil && c.Bulldozer == nil && c.PostAction == nil
+	return c.Insert == nil && c.Update == nil && c.Delete == "" && c.OperationConfirm == "" && c.Criteria == nil && c.Filter == nil && c.OrderBy == "" && c.InnerJoin == nil && c.Aggre == nil && c.Bulldozer == nil && c.PostAction == nil && c.Batch == nil && c.BulkInsert == nil && c.Upsert == nil && c.Version == ""
 }
 
 // init 初始化
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/rs/xid"
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// msgLogMaskValue 消息日志中敏感字段的值替换为该字符串
+const msgLogMaskValue = "******"
+
+// MsgLogRecord 一次服务调用的消息日志
+type MsgLogRecord struct {
+	// Time 请求开始的时间
+	Time time.Time `json:"time"`
+	// ServiceId 服务ID
+	ServiceId string `json:"serviceid"`
+	// Context 服务的上下文，格式为namespace.context
+	Context string `json:"context"`
+	// Action 请求的动作
+	Action string `json:"action"`
+	// Caller 调用者的用户id，服务没有开启安全认证时为空
+	Caller string `json:"caller"`
+	// Remote 调用者的地址，服务流程中调用时为空
+	Remote string `json:"remote,omitempty"`
+	// RBody 请求报文，敏感字段已经替换
+	RBody interface{} `json:"rbody,omitempty"`
+	// Result 响应中的result
+	Result bool `json:"result"`
+	// Msg 响应中的msg
+	Msg string `json:"msg,omitempty"`
+	// Rows 结果集的行数，写操作为影响的行数
+	Rows int64 `json:"rows"`
+	// Latency 处理时间，单位为毫秒
+	Latency int64 `json:"latency"`
+}
+
+// IMsgLogSink 消息日志的输出接口
+type IMsgLogSink interface {
+	// Write 输出一条消息日志
+	Write(r *MsgLogRecord) error
+}
+
+var msgLogSink IMsgLogSink = NewRingMsgLogSink(1000)
+var msgLogSinkMu sync.RWMutex
+
+// SetMsgLogSink 设定消息日志的输出，默认输出到容量为1000的内存环形缓冲区
+func SetMsgLogSink(sink IMsgLogSink) {
+	msgLogSinkMu.Lock()
+	defer msgLogSinkMu.Unlock()
+	msgLogSink = sink
+}
+
+// GetMsgLogSink 返回消息日志的输出
+func GetMsgLogSink() IMsgLogSink {
+	msgLogSinkMu.RLock()
+	defer msgLogSinkMu.RUnlock()
+	return msgLogSink
+}
+
+// FileMsgLogSink 将消息日志按JSON格式输出到文件，使用beego的文件日志按行数、大小或日期切分文件
+type FileMsgLogSink struct {
+	logger *logs.BeeLogger
+}
+
+// NewFileMsgLogSink 创建文件输出，config为beego文件日志的配置，如{"filename":"logs/msg.log","maxlines":100000,"daily":true,"maxdays":7}
+func NewFileMsgLogSink(config string) (*FileMsgLogSink, error) {
+	logger := logs.NewLogger()
+	if err := logger.SetLogger(logs.AdapterFile, config); err != nil {
+		return nil, fmt.Errorf("创建消息日志文件时发生错误：" + err.Error())
+	}
+	return &FileMsgLogSink{logger: logger}, nil
+}
+
+// Write 输出一条消息日志
+func (c *FileMsgLogSink) Write(r *MsgLogRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("%s", b)
+	return nil
+}
+
+// Close 关闭日志文件
+func (c *FileMsgLogSink) Close() {
+	c.logger.Close()
+}
+
+// DBMsgLogSink 将消息日志写入数据库表，Ids为可写数据源的名称
+// 数据源需要包含ID、LOG_TIME、SERVICE_ID、CONTEXT、ACTION、CALLER、REMOTE、RBODY、RESULT、MSG、RESULT_ROWS、LATENCY字段
+type DBMsgLogSink struct {
+	Ids string
+}
+
+// Write 输出一条消息日志
+func (c *DBMsgLogSink) Write(r *MsgLogRecord) error {
+	obj, err := datasource.CreateIDSFromName(c.Ids)
+	if err != nil {
+		return err
+	}
+	inf, ok := obj.(datasource.IWriteableDataSource)
+	if !ok {
+		return fmt.Errorf("消息日志数据源" + c.Ids + "没有实现IWriteableDataSource接口")
+	}
+	result := 0
+	if r.Result {
+		result = 1
+	}
+	_, err = inf.Insert(map[string]interface{}{
+		"ID":          xid.New().String(),
+		"LOG_TIME":    r.Time,
+		"SERVICE_ID":  r.ServiceId,
+		"CONTEXT":     r.Context,
+		"ACTION":      r.Action,
+		"CALLER":      r.Caller,
+		"REMOTE":      r.Remote,
+		"RBODY":       formatAuditJSON(r.RBody),
+		"RESULT":      result,
+		"MSG":         r.Msg,
+		"RESULT_ROWS": r.Rows,
+		"LATENCY":     r.Latency,
+	})
+	return err
+}
+
+// RingMsgLogSink 将消息日志保存在内存中的环形缓冲区，缓冲区满时覆盖最早的日志
+type RingMsgLogSink struct {
+	mu      sync.Mutex
+	records []*MsgLogRecord
+	next    int
+	full    bool
+}
+
+// NewRingMsgLogSink 创建容量为size的环形缓冲区
+func NewRingMsgLogSink(size int) *RingMsgLogSink {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingMsgLogSink{records: make([]*MsgLogRecord, size, size)}
+}
+
+// Write 输出一条消息日志
+func (c *RingMsgLogSink) Write(r *MsgLogRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records[c.next] = r
+	c.next = (c.next + 1) % len(c.records)
+	if c.next == 0 {
+		c.full = true
+	}
+	return nil
+}
+
+// Records 按时间顺序返回缓冲区中的消息日志
+func (c *RingMsgLogSink) Records() []*MsgLogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.full {
+		return append([]*MsgLogRecord{}, c.records[:c.next]...)
+	}
+	return append(append([]*MsgLogRecord{}, c.records[c.next:]...), c.records[:c.next]...)
+}
+
+// getMsgLogMask 返回服务元数据中msglogmask定义的敏感字段，可以为字符串数组或逗号分隔的字符串
+func getMsgLogMask(sdef *SDefine) utils.StringSet {
+	mask := make(utils.StringSet)
+	meta, err := utils.ParseJSONStr2Map(sdef.Meta)
+	if err != nil {
+		return mask
+	}
+	switch v := meta["msglogmask"].(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				mask[strings.ToUpper(s)] = true
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				mask[strings.ToUpper(str)] = true
+			}
+		}
+	}
+	return mask
+}
+
+// maskMsgBody 替换报文中的敏感字段的值，字段名不区分大小写
+// 条件节点中Field为敏感字段时同时替换Value
+func maskMsgBody(v interface{}, mask utils.StringSet) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		masked := false
+		if f, ok := val["Field"].(string); ok && mask.Exist(strings.ToUpper(f)) {
+			masked = true
+		}
+		for k, item := range val {
+			if mask.Exist(strings.ToUpper(k)) || (masked && k == "Value") {
+				val[k] = msgLogMaskValue
+				continue
+			}
+			val[k] = maskMsgBody(item, mask)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = maskMsgBody(item, mask)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// getMsgLogBody 返回请求报文的副本，报文为空时返回nil
+func getMsgLogBody(rr RequestResponseHandler, mask utils.StringSet) interface{} {
+	rBody, err := rr.GetRequestBody()
+	if err != nil {
+		return err.Error()
+	}
+	if rBody == nil || rBody.IsEmpty() {
+		return nil
+	}
+	b, err := json.Marshal(rBody)
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		//去掉没有使用的节点
+		for k, item := range m {
+			if item == nil || item == "" {
+				delete(m, k)
+			}
+		}
+	}
+	return maskMsgBody(v, mask)
+}
+
+// fillMsgLogResult 根据响应数据设定消息日志的结果和行数
+func fillMsgLogResult(r *MsgLogRecord, response interface{}) {
+	rr, ok := response.(utils.RestResult)
+	if !ok {
+		r.Result = response != nil
+		return
+	}
+	r.Result, _ = rr["result"].(bool)
+	r.Msg, _ = rr["msg"].(string)
+	if rs, ok := rr["resultset"].(*datasource.DataResultSet); ok {
+		r.Rows = int64(len(rs.Data))
+	} else if n, ok := rr["affected"].(int64); ok {
+		r.Rows = n
+	} else if n, ok := rr["rows"].(int64); ok {
+		r.Rows = n
+	}
+}
+
+// logServiceMessage 服务开启了消息日志时记录一次调用的消息日志，输出失败时只记录日志
+func logServiceMessage(sdef *SDefine, rr RequestResponseHandler, caller string, remote string, start time.Time, response interface{}) {
+	if sdef == nil || !sdef.MsgLog {
+		return
+	}
+	sink := GetMsgLogSink()
+	if sink == nil {
+		return
+	}
+	latency := time.Since(start)
+	r := &MsgLogRecord{
+		Time:      start,
+		ServiceId: sdef.ServiceId,
+		Context:   sdef.Namespace + "." + sdef.Context,
+		Action:    rr.GetParam(":action"),
+		Caller:    caller,
+		Remote:    remote,
+		RBody:     getMsgLogBody(rr, getMsgLogMask(sdef)),
+		Latency:   int64(latency / time.Millisecond),
+	}
+	fillMsgLogResult(r, response)
+	if err := sink.Write(r); err != nil {
+		logs.Error("记录服务%s的消息日志时发生错误：%s", r.Context, err.Error())
+	}
+}
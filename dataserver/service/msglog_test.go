@@ -0,0 +1,111 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+// msgLogRRHandler 带请求报文的测试请求处理
+type msgLogRRHandler struct {
+	testRRHandler
+	body *SRequestBody
+}
+
+func (c *msgLogRRHandler) GetRequestBody() (*SRequestBody, error) {
+	return c.body, nil
+}
+
+func TestRingMsgLogSink(t *testing.T) {
+	sink := NewRingMsgLogSink(3)
+	for i := 0; i < 5; i++ {
+		sink.Write(&MsgLogRecord{Rows: int64(i)})
+	}
+	rs := sink.Records()
+	if len(rs) != 3 || rs[0].Rows != 2 || rs[2].Rows != 4 {
+		t.Errorf("ring records %v", rs)
+	}
+}
+
+func TestMsgLog(t *testing.T) {
+	sink := NewRingMsgLogSink(10)
+	SetMsgLogSink(sink)
+	defer SetMsgLogSink(NewRingMsgLogSink(1000))
+	sdef := &SDefine{ServiceId: "S1", Namespace: "jeda", Context: "user", MsgLog: true,
+		Meta: `{"ids":"JEDA_USER","msglogmask":["user_password"]}`}
+	rr := &msgLogRRHandler{
+		testRRHandler: testRRHandler{params: map[string]string{":action": "insert"}},
+		body: &SRequestBody{Insert: map[string]string{"USER_ID": "u1", "USER_PASSWORD": "secret"},
+			Criteria: []CriteriaInRBody{{Field: "USER_PASSWORD", Operation: "=", Value: "secret", Relation: "and"}}},
+	}
+	response := utils.CreateRestResult(true)
+	response["affected"] = int64(1)
+	logServiceMessage(sdef, rr, "admin", "127.0.0.1", time.Now(), response)
+	logServiceMessage(&SDefine{MsgLog: false}, rr, "admin", "", time.Now(), response)
+
+	rs := sink.Records()
+	if len(rs) != 1 {
+		t.Fatalf("msglog records %d", len(rs))
+	}
+	r := rs[0]
+	if r.Context != "jeda.user" || r.Action != "insert" || r.Caller != "admin" || !r.Result || r.Rows != 1 {
+		t.Errorf("msglog record %+v", r)
+	}
+	body := formatAuditJSON(r.RBody)
+	if strings.Contains(body, "secret") || !strings.Contains(body, `"u1"`) {
+		t.Errorf("msglog body not masked %s", body)
+	}
+	if rr.body.Insert["USER_PASSWORD"] != "secret" {
+		t.Error("request body changed by mask")
+	}
+
+	dir, err := ioutil.TempDir("", "tongserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "msg.log")
+	fsink, err := NewFileMsgLogSink(`{"filename":"` + filepath.ToSlash(fname) + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsink.Write(r)
+	fsink.Close()
+	b, _ := ioutil.ReadFile(fname)
+	if !strings.Contains(string(b), `"context":"jeda.user"`) {
+		t.Errorf("msglog file %s", b)
+	}
+}
+
+func TestDBMsgLogSink(t *testing.T) {
+	db, clean := createTestDB(t, "msglogtest", "sqlite3",
+		`CREATE TABLE "G_MSGLOG" ("ID" varchar(50) NOT NULL,"LOG_TIME" datetime,"SERVICE_ID" varchar(50),"CONTEXT" varchar(150),"ACTION" varchar(45),"CALLER" varchar(50),`+
+			`"REMOTE" varchar(100),"RBODY" text,"RESULT" int,"MSG" varchar(4000),"RESULT_ROWS" bigint,"LATENCY" bigint,PRIMARY KEY ("ID"))`)
+	defer clean()
+	datasource.AddIdsCreator("CreateMsgLogTestIds", func(p datasource.IDSContainerParam) interface{} {
+		return datasource.CreateWriteableTableDataSource(p["name"].(string), "msglogtest", p["tablename"].(string))
+	})
+	if datasource.IDSContainer == nil {
+		datasource.IDSContainer = make(datasource.IDSContainerType)
+	}
+	datasource.IDSContainer["msglog.G_MSGLOG"] = datasource.IDSContainerParam{
+		"inf": "CreateMsgLogTestIds", "name": "G_MSGLOG", "tablename": "G_MSGLOG"}
+	sink := &DBMsgLogSink{Ids: "msglog.G_MSGLOG"}
+	err := sink.Write(&MsgLogRecord{Time: time.Now(), Context: "jeda.user", Action: "query", Result: true, Rows: 3,
+		RBody: map[string]interface{}{"OrderBy": "USER_ID"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	var rbody string
+	db.QueryRow(`SELECT "RESULT_ROWS","RBODY" FROM "G_MSGLOG" WHERE "CONTEXT"='jeda.user' AND "RESULT"=1`).Scan(&rows, &rbody)
+	if rows != 3 || rbody != `{"OrderBy":"USER_ID"}` {
+		t.Errorf("msglog row %d %s", rows, rbody)
+	}
+}
@@ -0,0 +1,450 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tongserver.dataserver/datasource"
+	"tongserver.dataserver/utils"
+)
+
+const (
+	// ODataMetadata 返回服务元数据文档的资源名
+	ODataMetadata string = "$metadata"
+	// ODataVersion OData协议的版本
+	ODataVersion string = "4.0"
+
+	// OData的查询参数
+	ODataParamFilter  string = "$filter"
+	ODataParamSelect  string = "$select"
+	ODataParamOrderBy string = "$orderby"
+	ODataParamTop     string = "$top"
+	ODataParamSkip    string = "$skip"
+	ODataParamCount   string = "$count"
+	ODataParamApply   string = "$apply"
+	ODataParamFormat  string = "$format"
+
+	// odataDefaultNamespace 服务没有命名空间时元数据使用的命名空间
+	odataDefaultNamespace = "tongserver"
+)
+
+// odataEdmTypes 字段类型对应的EDM类型
+var odataEdmTypes = map[string]string{
+	datasource.PropertyDatatypeInt:  "Edm.Int64",
+	datasource.PropertyDatatypeDou:  "Edm.Double",
+	datasource.PropertyDatatypeDate: "Edm.Date",
+	datasource.PropertyDatatypeTime: "Edm.DateTimeOffset",
+}
+
+// ODataServiceHandler 以OData v4协议访问IDS服务的处理句柄
+// 服务根地址下的资源为服务文档、$metadata和一个实体集，实体集的名称为服务上下文的最后一段
+type ODataServiceHandler struct {
+	IDSServiceHandler
+	// ServiceRoot 服务根地址，以/结尾，用于生成@odata.context，为空时使用相对地址
+	ServiceRoot string
+	// entitySet 实体集的名称
+	entitySet string
+	// namespace 元数据的命名空间
+	namespace string
+}
+
+// odataName 将名称转换为OData的标识符，非法字符替换为下划线
+func odataName(name string) string {
+	rs := []rune(name)
+	for i, r := range rs {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			rs[i] = '_'
+		}
+	}
+	if len(rs) == 0 || rs[0] >= '0' && rs[0] <= '9' {
+		return "_" + string(rs)
+	}
+	return string(rs)
+}
+
+// DoSrv 处理OData请求，只支持IDS类型的服务
+func (c *ODataServiceHandler) DoSrv(sdef *SDefine, inf SHandlerInterface) {
+	if sdef.ServiceType != SrvTypeIds {
+		c.createErrorResponse("OData只支持" + SrvTypeIds + "类型的服务")
+		return
+	}
+	c.setHeader("OData-Version", ODataVersion)
+	c.entitySet = sdef.Context
+	if c.entitySet == "" {
+		c.entitySet = sdef.Namespace
+	}
+	c.entitySet = odataName(c.entitySet)
+	c.namespace = odataDefaultNamespace
+	if sdef.Namespace != "" {
+		c.namespace = odataName(sdef.Namespace)
+	}
+	c.SHandlerBase.DoSrv(sdef, inf)
+}
+
+// getActionMap 返回OData支持的资源，空字符串为服务文档
+func (c *ODataServiceHandler) getActionMap() map[string]SerivceActionHandler {
+	return map[string]SerivceActionHandler{
+		"":            c.doODataServiceDocument,
+		ODataMetadata: c.doODataMetadata,
+		c.entitySet:   c.doODataEntitySet,
+	}
+}
+
+// doODataServiceDocument 返回服务文档
+func (c *ODataServiceHandler) doODataServiceDocument(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, map[string]interface{}{
+		"@odata.context": c.ServiceRoot + ODataMetadata,
+		"value": []map[string]string{
+			{"name": c.entitySet, "kind": "EntitySet", "url": c.entitySet},
+		},
+	})
+}
+
+// edmxProperty 元数据中的属性
+type edmxProperty struct {
+	Name     string `xml:"Name,attr"`
+	Type     string `xml:"Type,attr"`
+	Nullable string `xml:"Nullable,attr,omitempty"`
+}
+
+// edmxPropertyRef 元数据中主键的属性
+type edmxPropertyRef struct {
+	Name string `xml:"Name,attr"`
+}
+
+// edmxEntityType 元数据中的实体类型
+type edmxEntityType struct {
+	Name       string            `xml:"Name,attr"`
+	Key        []edmxPropertyRef `xml:"Key>PropertyRef"`
+	Properties []edmxProperty    `xml:"Property"`
+}
+
+// edmxEntitySet 元数据中的实体集
+type edmxEntitySet struct {
+	Name       string `xml:"Name,attr"`
+	EntityType string `xml:"EntityType,attr"`
+}
+
+// edmxEntityContainer 元数据中的实体容器
+type edmxEntityContainer struct {
+	Name       string          `xml:"Name,attr"`
+	EntitySets []edmxEntitySet `xml:"EntitySet"`
+}
+
+// edmxSchema 元数据中的架构
+type edmxSchema struct {
+	Xmlns      string              `xml:"xmlns,attr"`
+	Namespace  string              `xml:"Namespace,attr"`
+	EntityType edmxEntityType      `xml:"EntityType"`
+	Container  edmxEntityContainer `xml:"EntityContainer"`
+}
+
+// edmxDocument 元数据文档
+type edmxDocument struct {
+	XMLName xml.Name   `xml:"edmx:Edmx"`
+	Xmlns   string     `xml:"xmlns:edmx,attr"`
+	Version string     `xml:"Version,attr"`
+	Schema  edmxSchema `xml:"edmx:DataServices>Schema"`
+}
+
+// createODataMetadata 根据数据源的字段生成元数据文档，没有主键字段时全部字段作为主键
+func createODataMetadata(namespace string, entitySet string, ids datasource.IDataSource) *edmxDocument {
+	keys := ids.GetKeyFields()
+	if len(keys) == 0 {
+		keys = ids.GetFields()
+	}
+	iskey := make(map[string]bool)
+	et := edmxEntityType{Name: entitySet + "Type"}
+	for _, k := range keys {
+		et.Key = append(et.Key, edmxPropertyRef{Name: k.Name})
+		iskey[k.Name] = true
+	}
+	for _, f := range ids.GetFields() {
+		p := edmxProperty{Name: f.Name, Type: "Edm.String"}
+		if t, ok := odataEdmTypes[f.DataType]; ok {
+			p.Type = t
+		}
+		if iskey[f.Name] {
+			p.Nullable = "false"
+		}
+		et.Properties = append(et.Properties, p)
+	}
+	return &edmxDocument{
+		Xmlns:   "http://docs.oasis-open.org/odata/ns/edmx",
+		Version: ODataVersion,
+		Schema: edmxSchema{
+			Xmlns:      "http://docs.oasis-open.org/odata/ns/edm",
+			Namespace:  namespace,
+			EntityType: et,
+			Container: edmxEntityContainer{
+				Name:       "Container",
+				EntitySets: []edmxEntitySet{{Name: entitySet, EntityType: namespace + "." + et.Name}},
+			},
+		},
+	}
+}
+
+// doODataMetadata 输出XML格式的元数据文档
+func (c *ODataServiceHandler) doODataMetadata(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	sh, ok := c.RRHandler.(IStreamResponseHandler)
+	if !ok {
+		c.createErrorResponse("当前的请求不支持输出元数据文档")
+		return
+	}
+	b, err := xml.MarshalIndent(createODataMetadata(c.namespace, c.entitySet, ids), "", "  ")
+	if err != nil {
+		c.createErrorResponse("生成元数据文档时发生错误：" + err.Error())
+		return
+	}
+	w := sh.GetResponseWriter("application/xml; charset=utf-8")
+	if _, err = io.WriteString(w, xml.Header); err == nil {
+		_, err = w.Write(b)
+	}
+	// 响应已经输出，只用于记录消息日志
+	r := utils.CreateRestResult(err == nil)
+	if err != nil {
+		r["msg"] = "输出元数据文档时发生错误：" + err.Error()
+	}
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// getODataInt 读取非负整数参数，没有参数时返回0
+func (c *ODataServiceHandler) getODataInt(name string) (int, error) {
+	s := c.RRHandler.GetParam(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf(name + "参数必须为非负整数")
+	}
+	return v, nil
+}
+
+// containsODataField 判断字段是否在输出的字段中
+func containsODataField(fields []string, name string) bool {
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyODataQuery 将OData的查询参数转换为数据源的条件、排序、分页和聚合，返回输出的字段
+func (c *ODataServiceHandler) applyODataQuery(ids datasource.IDataSource) ([]string, error) {
+	convert := func(field string, operation string, value interface{}) (interface{}, error) {
+		return c.convertCriteriaValue(field, operation, value, ids)
+	}
+	fc, okfc := ids.(datasource.IFilterAdder)
+	criteria := make([]*datasource.SQLCriteria, 0, 2)
+	if s := c.RRHandler.GetParam(ODataParamFilter); s != "" {
+		p, err := newODataParser(s, convert)
+		if err != nil {
+			return nil, err
+		}
+		cr, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, cr)
+	}
+	fields := make([]string, 0, len(ids.GetFields()))
+	for _, f := range ids.GetFields() {
+		fields = append(fields, f.Name)
+	}
+	var apply *odataApply
+	if s := c.RRHandler.GetParam(ODataParamApply); s != "" {
+		p, err := newODataParser(s, convert)
+		if err != nil {
+			return nil, err
+		}
+		if apply, err = p.parseApply(); err != nil {
+			return nil, err
+		}
+		ag, ok := ids.(datasource.IGroupByDataSource)
+		if !ok {
+			return nil, fmt.Errorf("请求的服务没有实现IGroupByDataSource接口,不能使用" + ODataParamApply + "参数")
+		}
+		if apply.filter != nil {
+			criteria = append(criteria, apply.filter)
+		}
+		ag.SetGroupBy(apply.groupby)
+		for _, name := range apply.outfields {
+			ag.AddAggre(name, apply.aggre[name])
+		}
+		fields = append(append([]string{}, apply.groupby...), apply.outfields...)
+	}
+	if len(criteria) != 0 {
+		if !okfc {
+			return nil, fmt.Errorf("请求的服务没有实现IFilterAdder接口,不能使用" + ODataParamFilter + "参数")
+		}
+		fc.AddCriteriaGroup(datasource.CompAnd, false, criteria)
+	}
+	if s := c.RRHandler.GetParam(ODataParamOrderBy); s != "" {
+		if !okfc {
+			return nil, fmt.Errorf("请求的服务没有实现IFilterAdder接口,不能使用" + ODataParamOrderBy + "参数")
+		}
+		for _, ov := range strings.Split(s, ",") {
+			field, dir, err := datasource.ParseOrderBy(ov)
+			if err != nil {
+				return nil, err
+			}
+			if ids.GetFieldByName(field) == nil || apply != nil && !containsODataField(apply.groupby, field) {
+				return nil, fmt.Errorf(ODataParamOrderBy + "中的字段" + field + "不存在")
+			}
+			fc.Orderby(field, dir)
+		}
+	}
+	top, err := c.getODataInt(ODataParamTop)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := c.getODataInt(ODataParamSkip)
+	if err != nil {
+		return nil, err
+	}
+	if skip != 0 && top == 0 {
+		//只有$skip时不限制返回的行数
+		top = math.MaxInt32
+	}
+	ids.SetRowsLimit(top)
+	ids.SetRowsOffset(skip)
+	if s := c.RRHandler.GetParam(ODataParamSelect); s != "" && s != "*" {
+		selected := make([]string, 0, len(fields))
+		for _, name := range strings.Split(s, ",") {
+			name = strings.TrimSpace(name)
+			if len(fields) != 0 && !containsODataField(fields, name) {
+				return nil, fmt.Errorf(ODataParamSelect + "中的字段" + name + "不存在")
+			}
+			selected = append(selected, name)
+		}
+		fields = selected
+	}
+	return fields, nil
+}
+
+// formatODataValue 转换输出的值，日期为2006-01-02格式，时间为RFC3339格式
+func formatODataValue(v interface{}, fieldType string) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		if fieldType == datasource.PropertyDatatypeDate {
+			return val.Format("2006-01-02")
+		}
+		return val.Format(time.RFC3339)
+	case []byte:
+		return string(val)
+	}
+	return v
+}
+
+// createODataValues 将结果集转换为对象数组，只输出fields中的字段，fields为空时输出结果集的全部字段
+func createODataValues(rs *datasource.DataResultSet, fields []string) []map[string]interface{} {
+	if len(fields) == 0 {
+		for k := range rs.Fields {
+			fields = append(fields, k)
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			return rs.Fields[fields[i]].Index < rs.Fields[fields[j]].Index
+		})
+	}
+	values := make([]map[string]interface{}, len(rs.Data), len(rs.Data))
+	for i, row := range rs.Data {
+		item := make(map[string]interface{}, len(fields))
+		for _, name := range fields {
+			if f, ok := rs.Fields[name]; ok && f.Index < len(row) {
+				item[name] = formatODataValue(row[f.Index], f.FieldType)
+			}
+		}
+		values[i] = item
+	}
+	return values
+}
+
+// doODataEntitySet 返回实体集的数据，支持$filter、$select、$orderby、$top、$skip、$count和$apply参数
+// 服务元数据定义了userfilter时与all操作一样只返回当前用户可以访问的数据
+func (c *ODataServiceHandler) doODataEntitySet(sdef *SDefine, meta map[string]interface{}, ids datasource.IDataSource, rBody *SRequestBody) {
+	if f := c.RRHandler.GetParam(ODataParamFormat); f != "" && f != "json" && !strings.HasPrefix(f, "application/json") {
+		c.createErrorResponse(ODataParamFormat + "参数只支持json")
+		return
+	}
+	fids, ok := ids.(datasource.ICriteriaDataSource)
+	if !ok {
+		c.createErrorResponse("请求的服务没有实现ICriteriaDataSource接口,不能使用OData查询")
+		return
+	}
+	userFilter := &SRequestBody{}
+	if _, err := c.doUserFilter(sdef, meta, ids, &userFilter); err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	if len(userFilter.userFilter) != 0 {
+		if _, ok := ids.(datasource.IFilterAdder); !ok {
+			c.createErrorResponse("请求的服务没有实现IFilterAdder接口,不能处理userfilter节点")
+			return
+		}
+		//userfilter的条件作为一个条件组，与$filter的条件组以与的关系组合
+		if err := c.addCriteriaGroupFromRbody(ids, userFilter.userFilter); err != nil {
+			c.createErrorResponse(err.Error())
+			return
+		}
+	}
+	fields, err := c.applyODataQuery(ids)
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	r := map[string]interface{}{
+		"@odata.context": c.ServiceRoot + ODataMetadata + "#" + c.entitySet,
+	}
+	if count, _ := strconv.ParseBool(c.RRHandler.GetParam(ODataParamCount)); count {
+		cds, ok := ids.(datasource.ICountDataSource)
+		if !ok {
+			c.createErrorResponse("请求的服务没有实现ICountDataSource接口,不能使用" + ODataParamCount + "参数")
+			return
+		}
+		total, err := cds.CountFilter()
+		if err != nil {
+			c.createErrorResponse(err.Error())
+			return
+		}
+		r["@odata.count"] = total
+	}
+	rs, err := fids.DoFilter()
+	if err != nil {
+		c.createErrorResponse(err.Error())
+		return
+	}
+	r["value"] = createODataValues(rs, fields)
+	c.RRHandler.CreateResponseData(RSP_DATA_STYLE_JSON, r)
+}
+
+// ODataController OData请求的控制器，服务根地址为/odata/服务上下文/
+type ODataController struct {
+	ServiceControllerBase
+}
+
+// DoOData 处理OData请求，错误信息按OData的格式返回
+func (c *ODataController) DoOData() {
+	c.doService(func(sdef *SDefine, userid string) (SHandlerInterface, error) {
+		root := c.Ctx.Input.Scheme() + "://" + c.Ctx.Request.Host + "/odata/" + c.Ctx.Input.Param(":context") + "/"
+		return &ODataServiceHandler{IDSServiceHandler: IDSServiceHandler{SHandlerBase{RRHandler: c, CurrentUserId: userid}}, ServiceRoot: root}, nil
+	})
+	if c.streamed {
+		return
+	}
+	if r, ok := c.Data["json"].(utils.RestResult); ok && r["result"] == false {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]interface{}{
+			"error": map[string]interface{}{"code": strconv.Itoa(http.StatusBadRequest), "message": r["msg"]},
+		}
+	}
+	c.ServeJSON()
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"tongserver.dataserver/datasource"
+)
+
+func TestODataFilterParser(t *testing.T) {
+	convert := func(field string, operation string, value interface{}) (interface{}, error) {
+		return value, nil
+	}
+	p, err := newODataParser(`(NAME eq 'O''Brien' or contains(NAME,'a b')) and not AMOUNT in (1, 2) and REMARK ne null and CREATED lt 2020-01-02T00:00:00`, convert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := p.parseFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Children) != 4 || len(cr.Children[0].Children) != 2 || cr.Children[0].Children[1].Complex != datasource.CompOr {
+		t.Fatalf("filter tree %+v", cr)
+	}
+	if v := cr.Children[0].Children[0].Value; v != "O'Brien" {
+		t.Errorf("quoted string %v", v)
+	}
+	if c := cr.Children[1]; !c.Not || c.Children[0].Operation != datasource.OperIn || len(c.Children[0].Value.([]interface{})) != 2 {
+		t.Errorf("not in %+v", c)
+	}
+	if c := cr.Children[2]; c.Operation != datasource.OperIsNotNull {
+		t.Errorf("ne null %+v", c)
+	}
+	if c := cr.Children[3]; c.Value != "2020-01-02 00:00:00" {
+		t.Errorf("datetime literal %+v", c)
+	}
+	for _, s := range []string{"NAME eq", "NAME like 'a'", "NAME eq 'a", "(NAME eq 1", "NAME eq 1 AMOUNT", "NAME; eq 1", "AMOUNT gt null"} {
+		p, err := newODataParser(s, convert)
+		if err == nil {
+			_, err = p.parseFilter()
+		}
+		if err == nil {
+			t.Errorf("invalid filter %s accepted", s)
+		}
+	}
+
+	p, _ = newODataParser(`filter(AMOUNT gt 0)/groupby((ORG,YEAR),aggregate(AMOUNT with sum as TOTAL,$count as CNT))`, convert)
+	apply, err := p.parseApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apply.filter == nil || strings.Join(apply.groupby, ",") != "ORG,YEAR" || strings.Join(apply.outfields, ",") != "TOTAL,CNT" ||
+		apply.aggre["TOTAL"].Predicate != datasource.AggSum || apply.aggre["CNT"].ColName != "*" {
+		t.Errorf("apply %+v", apply)
+	}
+	for _, s := range []string{"groupby(ORG)", "aggregate(AMOUNT with median as M)", "compute(AMOUNT)", "groupby((ORG))/filter(AMOUNT gt 0)", "filter(AMOUNT gt 0)"} {
+		p, _ := newODataParser(s, convert)
+		if _, err := p.parseApply(); err == nil {
+			t.Errorf("invalid apply %s accepted", s)
+		}
+	}
+}
+
+func TestOData(t *testing.T) {
+	db, clean := createTestDB(t, "odatatest", "sqlite3",
+		`CREATE TABLE "ORDERS" ("ORDER_ID" varchar(50) NOT NULL,"ORG" varchar(50),"AMOUNT" int,"CREATED" date,PRIMARY KEY ("ORDER_ID"))`)
+	defer clean()
+	for i, org := range []string{"A", "A", "B", "B", "B", "C"} {
+		db.Exec(`INSERT INTO "ORDERS" VALUES (?,?,?,?)`, string(rune('1'+i)), org, (i+1)*10, "2020-01-0"+string(rune('1'+i)))
+	}
+	call := func(params map[string]string) *testStreamRRHandler {
+		rr := &testStreamRRHandler{testRRHandler: testRRHandler{params: params}}
+		h := &ODataServiceHandler{IDSServiceHandler: IDSServiceHandler{SHandlerBase{RRHandler: rr}},
+			ServiceRoot: "http://localhost/odata/sales.orders/", entitySet: "orders", namespace: "sales"}
+		ids := datasource.CreateWriteableTableDataSource("ORDERS", "odatatest", "ORDERS")
+		h.getActionMap()[params[":action"]](nil, nil, ids, nil)
+		return rr
+	}
+	values := func(rr *testStreamRRHandler) []map[string]interface{} {
+		r, ok := rr.response.(map[string]interface{})
+		if !ok {
+			t.Fatalf("odata error %v", rr.response)
+		}
+		return r["value"].([]map[string]interface{})
+	}
+
+	rr := call(map[string]string{":action": "orders", ODataParamFilter: "ORG eq 'B' or startswith(ORG,'C')",
+		ODataParamOrderBy: "AMOUNT desc", ODataParamTop: "2", ODataParamSkip: "1", ODataParamSelect: "ORDER_ID,CREATED", ODataParamCount: "true"})
+	vs := values(rr)
+	r := rr.response.(map[string]interface{})
+	if r["@odata.count"] != int64(4) || r["@odata.context"] != "http://localhost/odata/sales.orders/$metadata#orders" {
+		t.Errorf("odata response %v", r)
+	}
+	if len(vs) != 2 || len(vs[0]) != 2 || vs[0]["ORDER_ID"] != "5" || vs[1]["CREATED"] != "2020-01-04" {
+		t.Errorf("odata values %v", vs)
+	}
+
+	rr = call(map[string]string{":action": "orders", ODataParamApply: "filter(AMOUNT gt 10)/groupby((ORG),aggregate(AMOUNT with sum as TOTAL,$count as CNT))",
+		ODataParamOrderBy: "ORG", ODataParamCount: "true"})
+	vs = values(rr)
+	if rr.response.(map[string]interface{})["@odata.count"] != int64(3) || len(vs) != 3 || len(vs[0]) != 3 ||
+		vs[0]["ORG"] != "A" || vs[0]["TOTAL"] != int64(20) || vs[1]["CNT"] != int64(3) {
+		t.Errorf("odata apply %v", vs)
+	}
+	rr = call(map[string]string{":action": "orders", ODataParamApply: "aggregate(AMOUNT with max as M)"})
+	if vs = values(rr); len(vs) != 1 || vs[0]["M"] != int64(60) {
+		t.Errorf("odata aggregate %v", vs)
+	}
+
+	for _, params := range []map[string]string{
+		{ODataParamFilter: "NOTEXIST eq 1"},
+		{ODataParamFilter: "AMOUNT eq 'x'"},
+		{ODataParamOrderBy: "AMOUNT;"},
+		{ODataParamApply: "groupby((ORG))", ODataParamOrderBy: "AMOUNT"},
+		{ODataParamSelect: "NOTEXIST"},
+		{ODataParamTop: "-1"},
+		{ODataParamFormat: "xml"},
+	} {
+		params[":action"] = "orders"
+		rr = call(params)
+		if rr.result() {
+			t.Errorf("invalid query %v accepted", params)
+		}
+	}
+
+	rr = call(map[string]string{":action": ""})
+	if r := rr.response.(map[string]interface{}); r["@odata.context"] != "http://localhost/odata/sales.orders/$metadata" {
+		t.Errorf("service document %v", r)
+	}
+
+	rr = call(map[string]string{":action": ODataMetadata})
+	if !rr.result() || !strings.HasPrefix(rr.contentType, "application/xml") {
+		t.Fatalf("metadata %v", rr.response)
+	}
+	var doc struct {
+		Schema struct {
+			Namespace  string `xml:"Namespace,attr"`
+			EntityType struct {
+				Name string `xml:"Name,attr"`
+				Key  []struct {
+					Name string `xml:"Name,attr"`
+				} `xml:"Key>PropertyRef"`
+				Properties []struct {
+					Name     string `xml:"Name,attr"`
+					Type     string `xml:"Type,attr"`
+					Nullable string `xml:"Nullable,attr"`
+				} `xml:"Property"`
+			}
+			EntitySet struct {
+				Name       string `xml:"Name,attr"`
+				EntityType string `xml:"EntityType,attr"`
+			} `xml:"EntityContainer>EntitySet"`
+		} `xml:"DataServices>Schema"`
+	}
+	if err := xml.Unmarshal(rr.body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	s := doc.Schema
+	if s.Namespace != "sales" || s.EntitySet.Name != "orders" || s.EntitySet.EntityType != "sales.ordersType" ||
+		len(s.EntityType.Key) != 1 || s.EntityType.Key[0].Name != "ORDER_ID" || len(s.EntityType.Properties) != 4 {
+		t.Fatalf("metadata %s", rr.body.String())
+	}
+	types := make(map[string]string)
+	for _, p := range s.EntityType.Properties {
+		types[p.Name] = p.Type + p.Nullable
+	}
+	if types["ORDER_ID"] != "Edm.Stringfalse" || types["AMOUNT"] != "Edm.Int64" || types["CREATED"] != "Edm.Date" {
+		t.Errorf("metadata types %v", types)
+	}
+
+	// 只支持IDS类型的服务
+	trr := &testRRHandler{params: map[string]string{":action": ""}}
+	h := &ODataServiceHandler{IDSServiceHandler: IDSServiceHandler{SHandlerBase{RRHandler: trr}}}
+	h.DoSrv(&SDefine{ServiceType: SrvTypePredef, Context: "orders"}, h)
+	if trr.result() {
+		t.Error("predefine service accepted")
+	}
+	if odataName("jeda.org-1") != "jeda_org_1" || odataName("1org") != "_1org" {
+		t.Error("odataName")
+	}
+}
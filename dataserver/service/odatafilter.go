@@ -0,0 +1,485 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tongserver.dataserver/datasource"
+)
+
+// odataComparison OData的比较运算符对应的操作符
+var odataComparison = map[string]string{
+	"eq": datasource.OperEq,
+	"ne": datasource.OperNoteq,
+	"gt": datasource.OperGt,
+	"ge": datasource.OperGtEg,
+	"lt": datasource.OperLt,
+	"le": datasource.OperLtEg,
+}
+
+// odataFunctions OData的字符串函数对应的操作符
+var odataFunctions = map[string]string{
+	"contains":   datasource.OperContains,
+	"startswith": datasource.OperStartsWith,
+	"endswith":   datasource.OperEndsWith,
+}
+
+// odataAggregations OData聚合方法对应的聚合类型
+var odataAggregations = map[string]int{
+	"sum":     datasource.AggSum,
+	"average": datasource.AggAvg,
+	"min":     datasource.AggMin,
+	"max":     datasource.AggMax,
+}
+
+// odataToken OData表达式中的一个词
+type odataToken struct {
+	text string
+	// quoted 为true时是用单引号括起来的字符串
+	quoted bool
+}
+
+// odataParser OData表达式的解析器，支持$filter和$apply参数
+type odataParser struct {
+	tokens []*odataToken
+	pos    int
+	// convert 根据字段类型转换条件的值
+	convert func(field string, operation string, value interface{}) (interface{}, error)
+}
+
+// odataApply $apply参数解析的结果
+type odataApply struct {
+	// filter filter转换中的条件
+	filter *datasource.SQLCriteria
+	// groupby 分组字段，只有aggregate转换时为空数组
+	groupby []string
+	// aggre 聚合的输出字段名和聚合类型
+	aggre map[string]*datasource.AggreType
+	// outfields 聚合的输出字段名，按出现的顺序
+	outfields []string
+}
+
+// tokenizeOData 将OData表达式拆分为词，括号、逗号和斜杠为单独的词，字符串中两个单引号表示一个单引号
+func tokenizeOData(s string) ([]*odataToken, error) {
+	tokens := make([]*odataToken, 0, 16)
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		switch ch := rs[i]; {
+		case ch == ' ' || ch == '\t':
+			i++
+		case ch == '(' || ch == ')' || ch == ',' || ch == '/':
+			tokens = append(tokens, &odataToken{text: string(ch)})
+			i++
+		case ch == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, fmt.Errorf("OData表达式中的字符串没有结束：" + s)
+				}
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						b.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(rs[i])
+				i++
+			}
+			tokens = append(tokens, &odataToken{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(rs) && !strings.ContainsRune(" \t(),/'", rs[i]) {
+				i++
+			}
+			tokens = append(tokens, &odataToken{text: string(rs[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+// newODataParser 创建解析器
+func newODataParser(s string, convert func(field string, operation string, value interface{}) (interface{}, error)) (*odataParser, error) {
+	tokens, err := tokenizeOData(s)
+	if err != nil {
+		return nil, err
+	}
+	return &odataParser{tokens: tokens, convert: convert}, nil
+}
+
+// peek 返回当前的词，已经结束时返回nil
+func (c *odataParser) peek() *odataToken {
+	if c.pos >= len(c.tokens) {
+		return nil
+	}
+	return c.tokens[c.pos]
+}
+
+// peekKeyword 判断当前的词是否为指定的关键字，关键字不区分大小写
+func (c *odataParser) peekKeyword(keyword string) bool {
+	t := c.peek()
+	return t != nil && !t.quoted && strings.EqualFold(t.text, keyword)
+}
+
+// next 返回当前的词并移动到下一个词
+func (c *odataParser) next() (*odataToken, error) {
+	t := c.peek()
+	if t == nil {
+		return nil, fmt.Errorf("OData表达式不完整")
+	}
+	c.pos++
+	return t, nil
+}
+
+// expect 读取指定的关键字或符号
+func (c *odataParser) expect(keyword string) error {
+	if !c.peekKeyword(keyword) {
+		if t := c.peek(); t != nil {
+			return fmt.Errorf("OData表达式中应为" + keyword + "，实际为" + t.text)
+		}
+		return fmt.Errorf("OData表达式中缺少" + keyword)
+	}
+	c.pos++
+	return nil
+}
+
+// identifier 读取字段名等标识符
+func (c *odataParser) identifier() (string, error) {
+	t, err := c.next()
+	if err != nil {
+		return "", err
+	}
+	if t.quoted || !datasource.IsValidIdentifier(t.text) {
+		return "", fmt.Errorf("OData表达式中的标识符" + t.text + "不合法")
+	}
+	return t.text, nil
+}
+
+// end 检查表达式是否已经全部解析
+func (c *odataParser) end() error {
+	if t := c.peek(); t != nil {
+		return fmt.Errorf("OData表达式中存在多余的内容：" + t.text)
+	}
+	return nil
+}
+
+// literal 读取一个值，日期时间值转换为2006-01-02 15:04:05格式的本地时间
+func (c *odataParser) literal() (*odataToken, error) {
+	t, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.quoted {
+		return t, nil
+	}
+	if t.text == "(" || t.text == ")" || t.text == "," || t.text == "/" {
+		return nil, fmt.Errorf("OData表达式中应为值，实际为" + t.text)
+	}
+	if strings.Contains(t.text, "T") {
+		if tm, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return &odataToken{text: tm.In(time.Local).Format("2006-01-02 15:04:05")}, nil
+		}
+		if tm, err := time.ParseInLocation("2006-01-02T15:04:05", t.text, time.Local); err == nil {
+			return &odataToken{text: tm.Format("2006-01-02 15:04:05")}, nil
+		}
+	}
+	return t, nil
+}
+
+// parseFilter 解析$filter表达式，返回一个条件或条件组
+func (c *odataParser) parseFilter() (*datasource.SQLCriteria, error) {
+	cr, err := c.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return cr, c.end()
+}
+
+// parseOr 解析or连接的条件
+func (c *odataParser) parseOr() (*datasource.SQLCriteria, error) {
+	return c.parseList(datasource.CompOr, c.parseAnd)
+}
+
+// parseAnd 解析and连接的条件
+func (c *odataParser) parseAnd() (*datasource.SQLCriteria, error) {
+	return c.parseList(datasource.CompAnd, c.parseUnary)
+}
+
+// parseList 解析用complex连接的条件，只有一个条件时直接返回该条件
+func (c *odataParser) parseList(complex string, item func() (*datasource.SQLCriteria, error)) (*datasource.SQLCriteria, error) {
+	cr, err := item()
+	if err != nil {
+		return nil, err
+	}
+	if !c.peekKeyword(complex) {
+		return cr, nil
+	}
+	children := []*datasource.SQLCriteria{cr}
+	for c.peekKeyword(complex) {
+		c.pos++
+		if cr, err = item(); err != nil {
+			return nil, err
+		}
+		children = append(children, cr)
+	}
+	for _, child := range children {
+		child.Complex = complex
+	}
+	return &datasource.SQLCriteria{Complex: datasource.CompAnd, Children: children}, nil
+}
+
+// parseUnary 解析not条件、括号中的条件和简单条件
+func (c *odataParser) parseUnary() (*datasource.SQLCriteria, error) {
+	if c.peekKeyword("not") {
+		c.pos++
+		cr, err := c.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &datasource.SQLCriteria{Complex: datasource.CompAnd, Not: true, Children: []*datasource.SQLCriteria{cr}}, nil
+	}
+	if c.peekKeyword("(") {
+		c.pos++
+		cr, err := c.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cr, c.expect(")")
+	}
+	name, err := c.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := odataFunctions[strings.ToLower(name)]; ok && c.peekKeyword("(") {
+		return c.parseFunction(op)
+	}
+	if c.peekKeyword("in") {
+		c.pos++
+		return c.parseIn(name)
+	}
+	t, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := odataComparison[strings.ToLower(t.text)]
+	if !ok || t.quoted {
+		return nil, fmt.Errorf("OData表达式中的运算符" + t.text + "不支持")
+	}
+	v, err := c.literal()
+	if err != nil {
+		return nil, err
+	}
+	if !v.quoted && v.text == "null" {
+		switch op {
+		case datasource.OperEq:
+			return c.criteria(name, datasource.OperIsNull, nil)
+		case datasource.OperNoteq:
+			return c.criteria(name, datasource.OperIsNotNull, nil)
+		}
+		return nil, fmt.Errorf("null只能使用eq或ne运算符比较")
+	}
+	return c.criteria(name, op, v.text)
+}
+
+// parseFunction 解析contains、startswith、endswith函数
+func (c *odataParser) parseFunction(op string) (*datasource.SQLCriteria, error) {
+	if err := c.expect("("); err != nil {
+		return nil, err
+	}
+	name, err := c.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.expect(","); err != nil {
+		return nil, err
+	}
+	v, err := c.literal()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.expect(")"); err != nil {
+		return nil, err
+	}
+	return c.criteria(name, op, v.text)
+}
+
+// parseIn 解析in运算符，值列表用括号括起来
+func (c *odataParser) parseIn(name string) (*datasource.SQLCriteria, error) {
+	if err := c.expect("("); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, 0, 4)
+	for {
+		v, err := c.literal()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v.text)
+		if !c.peekKeyword(",") {
+			break
+		}
+		c.pos++
+	}
+	if err := c.expect(")"); err != nil {
+		return nil, err
+	}
+	return c.criteria(name, datasource.OperIn, values)
+}
+
+// checkField 检查字段是否存在
+func (c *odataParser) checkField(field string) error {
+	_, err := c.convert(field, datasource.OperIsNull, nil)
+	return err
+}
+
+// criteria 创建一个简单条件，值按字段类型转换
+func (c *odataParser) criteria(field string, op string, value interface{}) (*datasource.SQLCriteria, error) {
+	v, err := c.convert(field, op, value)
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.SQLCriteria{PropertyName: field, Operation: op, Value: v, Complex: datasource.CompAnd}, nil
+}
+
+// parseApply 解析$apply表达式，支持filter、groupby和aggregate转换，filter只能在最前面
+// 如 filter(Amount gt 0)/groupby((Org,Year),aggregate(Amount with sum as Total,$count as Cnt))
+func (c *odataParser) parseApply() (*odataApply, error) {
+	apply := &odataApply{aggre: make(map[string]*datasource.AggreType)}
+	for {
+		name, err := c.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.expect("("); err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(name) {
+		case "filter":
+			if apply.filter != nil || apply.groupby != nil || len(apply.aggre) != 0 {
+				return nil, fmt.Errorf("$apply中的filter只能出现一次并且必须在最前面")
+			}
+			if apply.filter, err = c.parseOr(); err != nil {
+				return nil, err
+			}
+		case "groupby":
+			if apply.groupby != nil || len(apply.aggre) != 0 {
+				return nil, fmt.Errorf("$apply中只能有一个groupby或aggregate")
+			}
+			if err = c.parseGroupBy(apply); err != nil {
+				return nil, err
+			}
+		case "aggregate":
+			if apply.groupby != nil || len(apply.aggre) != 0 {
+				return nil, fmt.Errorf("$apply中只能有一个groupby或aggregate")
+			}
+			apply.groupby = []string{}
+			if err = c.parseAggregate(apply); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("$apply中的转换" + name + "不支持")
+		}
+		if err := c.expect(")"); err != nil {
+			return nil, err
+		}
+		if !c.peekKeyword("/") {
+			break
+		}
+		c.pos++
+	}
+	if apply.groupby == nil {
+		return nil, fmt.Errorf("$apply中必须有groupby或aggregate")
+	}
+	return apply, c.end()
+}
+
+// parseGroupBy 解析groupby转换的参数，分组字段用括号括起来，之后可以有一个aggregate转换
+func (c *odataParser) parseGroupBy(apply *odataApply) error {
+	if err := c.expect("("); err != nil {
+		return err
+	}
+	apply.groupby = make([]string, 0, 4)
+	for {
+		name, err := c.identifier()
+		if err != nil {
+			return err
+		}
+		if err := c.checkField(name); err != nil {
+			return err
+		}
+		apply.groupby = append(apply.groupby, name)
+		if !c.peekKeyword(",") {
+			break
+		}
+		c.pos++
+	}
+	if err := c.expect(")"); err != nil {
+		return err
+	}
+	if !c.peekKeyword(",") {
+		return nil
+	}
+	c.pos++
+	if err := c.expect("aggregate"); err != nil {
+		return err
+	}
+	if err := c.expect("("); err != nil {
+		return err
+	}
+	if err := c.parseAggregate(apply); err != nil {
+		return err
+	}
+	return c.expect(")")
+}
+
+// parseAggregate 解析aggregate转换的参数，格式为“字段 with 聚合方法 as 输出字段”或“$count as 输出字段”
+func (c *odataParser) parseAggregate(apply *odataApply) error {
+	for {
+		t, err := c.next()
+		if err != nil {
+			return err
+		}
+		aggre := &datasource.AggreType{Predicate: datasource.AggCount, ColName: "*"}
+		if t.quoted || t.text != "$count" {
+			c.pos--
+			if aggre.ColName, err = c.identifier(); err != nil {
+				return err
+			}
+			if err := c.expect("with"); err != nil {
+				return err
+			}
+			m, err := c.identifier()
+			if err != nil {
+				return err
+			}
+			p, ok := odataAggregations[strings.ToLower(m)]
+			if !ok {
+				return fmt.Errorf("$apply中的聚合方法" + m + "不支持")
+			}
+			aggre.Predicate = p
+			if err := c.checkField(aggre.ColName); err != nil {
+				return err
+			}
+		}
+		if err := c.expect("as"); err != nil {
+			return err
+		}
+		alias, err := c.identifier()
+		if err != nil {
+			return err
+		}
+		if _, ok := apply.aggre[alias]; ok {
+			return fmt.Errorf("$apply中的输出字段" + alias + "重复")
+		}
+		apply.aggre[alias] = aggre
+		apply.outfields = append(apply.outfields, alias)
+		if !c.peekKeyword(",") {
+			return nil
+		}
+		c.pos++
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/astaxie/beego"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 	"tongserver.dataserver/datasource"
 	"tongserver.dataserver/utils"
 )
@@ -59,6 +62,8 @@ type SDefineContainerType map[string]*SDefine
 
 type ServiceControllerBase struct {
 	beego.Controller
+	// streamed 为true时已经直接输出了响应，不再输出json数据
+	streamed bool
 }
 
 // SController 服务控制器基类
@@ -82,9 +87,23 @@ func (c *ServiceControllerBase) GetParam(name string) string {
 		return c.Input().Get(name)
 	}
 }
+func (c *ServiceControllerBase) GetHeader(name string) string {
+	return c.Ctx.Input.Header(name)
+}
+func (c *ServiceControllerBase) SetHeader(name, value string) {
+	c.Ctx.Output.Header(name, value)
+}
+
+// GetResponseWriter 返回流式输出使用的输出流
+func (c *ServiceControllerBase) GetResponseWriter(contentType string) io.Writer {
+	c.streamed = true
+	c.Ctx.Output.Header("Content-Type", contentType)
+	c.Ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	return c.Ctx.ResponseWriter
+}
 func (c *ServiceControllerBase) GetRequestBody() (*SRequestBody, error) {
 	rBody := &SRequestBody{}
-	if c.Ctx.Request.Method == "POST" {
+	if c.Ctx.Request.Method == "POST" && !strings.HasPrefix(c.Ctx.Input.Header("Content-Type"), "multipart/") {
 		err := json.Unmarshal([]byte(c.Ctx.Input.RequestBody), rBody)
 		if err != nil {
 			return nil, fmt.Errorf("解析报文时发生错误%s", err.Error())
@@ -136,40 +155,64 @@ func GetSrvMetaFromPath(cnt string) (*SDefine, error) {
 	}
 }
 
-// DoSrv 处理请求
-func (c *SController) DoSrv() {
+// setErrorResponse 设定错误信息的响应，由调用者输出
+func (c *ServiceControllerBase) setErrorResponse(msg string) {
+	r := utils.CreateRestResult(false)
+	r["msg"] = msg
+	c.Data["json"] = r
+}
+
+// doService 处理请求的公共流程：根据上下文获取服务定义、验证访问权限，然后调用create创建的服务处理句柄处理请求
+// 响应由调用者输出
+func (c *ServiceControllerBase) doService(create func(sdef *SDefine, userid string) (SHandlerInterface, error)) {
 	//获取上下文
 	cnt := c.Ctx.Input.Param(":context")
 	//根据上下文获取服务定义信息
 	//默认是从数据库获取
 	sdef, err := GetSrvMetaFromPath(cnt)
 	if err != nil {
-		utils.CreateErrorResponse(err.Error(), &c.Controller)
+		c.setErrorResponse(err.Error())
 		return
 	}
 	if !sdef.Enabled {
-		utils.CreateErrorResponse("请求的服务未启用", &c.Controller)
+		c.setErrorResponse("请求的服务未启用")
 		return
 	}
 	userid := ""
+	start := time.Now()
+	defer func() {
+		logServiceMessage(sdef, c, userid, c.Ctx.Input.IP(), start, c.Data["json"])
+	}()
 	if sdef.Security {
 		// 处理访问控制
 		userid, err = GetISevurityServiceInstance().VerifyToken(&c.Controller)
 		if err != nil {
-			utils.CreateErrorResponse(err.Error(), &c.Controller)
+			c.setErrorResponse(err.Error())
 			return
 		}
 		if !GetISevurityServiceInstance().VerifyService(userid, sdef.ServiceId, 0) {
-			utils.CreateErrorResponse("未授权的请求", &c.Controller)
+			c.setErrorResponse("未授权的请求")
 			return
 		}
 	}
-	handler, ok := SHandlerContainer[sdef.ServiceType]
-	if !ok {
-		utils.CreateErrorResponse("没有找到"+sdef.ServiceType+"定义的服务接口处理程序", &c.Controller)
+	h, err := create(sdef, userid)
+	if err != nil {
+		c.setErrorResponse(err.Error())
 		return
 	}
-	h := handler(c, userid)
 	h.DoSrv(sdef, h)
-	c.ServeJSON()
+}
+
+// DoSrv 处理请求
+func (c *SController) DoSrv() {
+	c.doService(func(sdef *SDefine, userid string) (SHandlerInterface, error) {
+		handler, ok := SHandlerContainer[sdef.ServiceType]
+		if !ok {
+			return nil, fmt.Errorf("没有找到" + sdef.ServiceType + "定义的服务接口处理程序")
+		}
+		return handler(c, userid), nil
+	})
+	if !c.streamed {
+		c.ServeJSON()
+	}
 }
@@ -47,7 +47,7 @@ func (c *TokenService) GetRoleByUserid(userid string) (utils.StringSet, error) {
 	var rolemap interface{}
 	rolemap = utils.JedaDataCache.Get(utils.CACHE_PREFIX_SERVICEACCESS + "ROLE" + userid)
 	if rolemap == nil {
-		sqld := datasource.CreateSQLDataSource("", "default", "select * from idb.JEDA_ROLE_USER where USER_ID=?")
+		sqld := datasource.CreateSQLDataSource("", "default", "select * from JEDA_ROLE_USER where USER_ID=?")
 		sqld.ParamsValues = []interface{}{userid}
 		rs, err := sqld.GetAllData()
 		if err != nil {
@@ -80,7 +80,7 @@ func (c *TokenService) VerifyService(userid string, serviceid string, rightmask
 	srvmap = utils.JedaDataCache.Get(utils.CACHE_PREFIX_SERVICEACCESS + serviceid)
 	if srvmap == nil {
 		sqld := datasource.CreateSQLDataSource("", "default",
-			"SELECT * FROM idb.G_USERSERVICE where SERVICEID=?")
+			"SELECT * FROM G_USERSERVICE where SERVICEID=?")
 		sqld.ParamsValues = []interface{}{serviceid}
 		rs, err := sqld.GetAllData()
 		if err != nil {
@@ -17,6 +17,29 @@
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `G_AUDIT`
+--
+
+DROP TABLE IF EXISTS `G_AUDIT`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `G_AUDIT` (
+  `ID` varchar(50) COLLATE utf8_bin NOT NULL,
+  `SERVICE` varchar(150) COLLATE utf8_bin DEFAULT NULL,
+  `IDS` varchar(150) COLLATE utf8_bin DEFAULT NULL,
+  `ACTION` varchar(45) COLLATE utf8_bin DEFAULT NULL,
+  `USER_ID` varchar(50) COLLATE utf8_bin DEFAULT NULL,
+  `RECORD_KEY` varchar(500) COLLATE utf8_bin DEFAULT NULL,
+  `CRITERIA` text COLLATE utf8_bin,
+  `BEFORE_DATA` text COLLATE utf8_bin,
+  `AFTER_DATA` text COLLATE utf8_bin,
+  `CREATE_TIME` datetime DEFAULT NULL,
+  PRIMARY KEY (`ID`),
+  KEY `IDX_G_AUDIT_RECORD` (`IDS`,`RECORD_KEY`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `G_DATABASEURL`
 --
@@ -54,6 +77,30 @@ CREATE TABLE `G_IDS` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `G_MSGLOG`
+--
+
+DROP TABLE IF EXISTS `G_MSGLOG`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `G_MSGLOG` (
+  `ID` varchar(50) COLLATE utf8_bin NOT NULL,
+  `LOG_TIME` datetime DEFAULT NULL,
+  `SERVICE_ID` varchar(50) COLLATE utf8_bin DEFAULT NULL,
+  `CONTEXT` varchar(150) COLLATE utf8_bin DEFAULT NULL,
+  `ACTION` varchar(45) COLLATE utf8_bin DEFAULT NULL,
+  `CALLER` varchar(50) COLLATE utf8_bin DEFAULT NULL,
+  `REMOTE` varchar(100) COLLATE utf8_bin DEFAULT NULL,
+  `RBODY` text COLLATE utf8_bin,
+  `RESULT` int(11) DEFAULT NULL,
+  `MSG` varchar(4000) COLLATE utf8_bin DEFAULT NULL,
+  `RESULT_ROWS` bigint(20) DEFAULT NULL,
+  `LATENCY` bigint(20) DEFAULT NULL,
+  PRIMARY KEY (`ID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `G_META`
 --
@@ -0,0 +1,208 @@
+-- SQLite schema of the tongserver metadata database
+-- Converted from mysql.sql, usage: sqlite3 idb.db < sqlite.sql
+
+DROP TABLE IF EXISTS "G_AUDIT";
+CREATE TABLE "G_AUDIT" (
+  "ID" varchar(50) NOT NULL,
+  "SERVICE" varchar(150) DEFAULT NULL,
+  "IDS" varchar(150) DEFAULT NULL,
+  "ACTION" varchar(45) DEFAULT NULL,
+  "USER_ID" varchar(50) DEFAULT NULL,
+  "RECORD_KEY" varchar(500) DEFAULT NULL,
+  "CRITERIA" text,
+  "BEFORE_DATA" text,
+  "AFTER_DATA" text,
+  "CREATE_TIME" datetime DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+CREATE INDEX "IDX_G_AUDIT_RECORD" ON "G_AUDIT" ("IDS","RECORD_KEY");
+
+DROP TABLE IF EXISTS "G_DATABASEURL";
+CREATE TABLE "G_DATABASEURL" (
+  "ID" varchar(50) NOT NULL,
+  "DBTYPE" varchar(10) DEFAULT NULL,
+  "DBURL" varchar(500) DEFAULT NULL,
+  "USERNAME" varchar(45) DEFAULT NULL,
+  "PWD" varchar(45) DEFAULT NULL,
+  "PROJECTID" varchar(45) DEFAULT NULL,
+  "DBALIAS" varchar(45) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_IDS";
+CREATE TABLE "G_IDS" (
+  "ID" varchar(50) NOT NULL,
+  "META" varchar(4500) DEFAULT NULL,
+  "PROJECTID" varchar(45) DEFAULT NULL,
+  "INF" varchar(100) DEFAULT NULL,
+  "NAME" varchar(100) DEFAULT NULL,
+  "DBALIAS" varchar(45) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_MSGLOG";
+CREATE TABLE "G_MSGLOG" (
+  "ID" varchar(50) NOT NULL,
+  "LOG_TIME" datetime DEFAULT NULL,
+  "SERVICE_ID" varchar(50) DEFAULT NULL,
+  "CONTEXT" varchar(150) DEFAULT NULL,
+  "ACTION" varchar(45) DEFAULT NULL,
+  "CALLER" varchar(50) DEFAULT NULL,
+  "REMOTE" varchar(100) DEFAULT NULL,
+  "RBODY" text,
+  "RESULT" int(11) DEFAULT NULL,
+  "MSG" varchar(4000) DEFAULT NULL,
+  "RESULT_ROWS" bigint(20) DEFAULT NULL,
+  "LATENCY" bigint(20) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_META";
+CREATE TABLE "G_META" (
+  "ID" varchar(45) NOT NULL,
+  "PROJECTID" varchar(145) DEFAULT NULL,
+  "NAMESPACE" varchar(145) DEFAULT NULL,
+  "METANAME" varchar(145) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_META_ITEM";
+CREATE TABLE "G_META_ITEM" (
+  "ID" varchar(45) NOT NULL,
+  "META_ID" varchar(45) DEFAULT NULL,
+  "NAME" varchar(45) DEFAULT NULL,
+  "VALUE" varchar(8000) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_PROJECT";
+CREATE TABLE "G_PROJECT" (
+  "ID" varchar(50) NOT NULL,
+  "PROJECTNAME" varchar(100) DEFAULT NULL,
+  "OWNER" varchar(45) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_SERVICE";
+CREATE TABLE "G_SERVICE" (
+  "ID" varchar(50) NOT NULL,
+  "BODYTYPE" varchar(45) DEFAULT NULL,
+  "SERVICETYPE" varchar(45) DEFAULT NULL,
+  "NAMESPACE" varchar(45) DEFAULT NULL,
+  "ENABLED" int(11) DEFAULT NULL,
+  "MSGLOG" int(11) DEFAULT NULL,
+  "SECURITY" int(11) DEFAULT NULL,
+  "META" varchar(4000) DEFAULT NULL,
+  "PROJECTID" varchar(45) DEFAULT NULL,
+  "CONTEXT" varchar(100) DEFAULT NULL,
+  PRIMARY KEY ("ID")
+);
+
+DROP TABLE IF EXISTS "G_USERPROJECT";
+CREATE TABLE "G_USERPROJECT" (
+  "USERID" varchar(50) NOT NULL,
+  "PROJECTID" varchar(50) NOT NULL,
+  "PROJECTNAME" varchar(45) DEFAULT NULL,
+  PRIMARY KEY ("USERID","PROJECTID")
+);
+
+DROP TABLE IF EXISTS "G_USERSERVICE";
+CREATE TABLE "G_USERSERVICE" (
+  "ROLEID" varchar(50) NOT NULL,
+  "SERVICEID" varchar(50) NOT NULL,
+  PRIMARY KEY ("ROLEID","SERVICEID")
+);
+
+DROP TABLE IF EXISTS "JEDA_MENU";
+CREATE TABLE "JEDA_MENU" (
+  "MENU_ID" varchar(50) NOT NULL,
+  "PARENT_MENU_ID" varchar(50) DEFAULT NULL,
+  "MENU_NAME" varchar(100) DEFAULT NULL,
+  "MENU_URL" varchar(500) DEFAULT NULL,
+  "MENU_DESCRIPTION" varchar(1000) DEFAULT NULL,
+  "MENU_IFRAME" int(11) DEFAULT NULL,
+  "MENU_ICON" varchar(50) DEFAULT NULL,
+  "MENU_ORDER" int(11) DEFAULT '0',
+  "MENU_READ_ONLY" int(11) DEFAULT NULL,
+  "MENU_OPEN_IN_HOME" int(11) DEFAULT '0',
+  "MENU_VERSION" int(11) DEFAULT '0',
+  "MENU_CREATOR" varchar(50) DEFAULT NULL,
+  "MENU_CREATED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "MENU_MODIFIER" varchar(50) DEFAULT NULL,
+  "MENU_MODIFIED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("MENU_ID")
+);
+
+DROP TABLE IF EXISTS "JEDA_ORG";
+CREATE TABLE "JEDA_ORG" (
+  "ORG_ID" varchar(50) NOT NULL,
+  "ORG_NAME" varchar(100) DEFAULT NULL,
+  "PARENT_ORG_ID" varchar(50) DEFAULT NULL,
+  "ORG_DESCRIPTION" varchar(500) DEFAULT NULL,
+  "ORG_TEL" varchar(50) DEFAULT NULL,
+  "ORG_ADDRESS" varchar(500) DEFAULT NULL,
+  "ORG_CONTACT" varchar(50) DEFAULT NULL,
+  "ORG_PATH" varchar(500) DEFAULT NULL,
+  "ORG_LEVEL" varchar(10) DEFAULT NULL,
+  "ORG_ENABLED" int(11) DEFAULT '1',
+  "ORG_TYPE" varchar(1) DEFAULT NULL,
+  "ORG_PROPERTY" varchar(50) DEFAULT NULL,
+  "ORG_ORDER" int(11) DEFAULT '0',
+  "ORG_VERSION" int(11) DEFAULT '0',
+  "ORG_CREATOR" varchar(50) DEFAULT 'admin',
+  "ORG_CREATED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "ORG_MODIFIER" varchar(50) DEFAULT 'admin',
+  "ORG_MODIFIED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("ORG_ID")
+);
+
+DROP TABLE IF EXISTS "JEDA_ROLE";
+CREATE TABLE "JEDA_ROLE" (
+  "ROLE_ID" varchar(50) DEFAULT NULL,
+  "ROLE_NAME" varchar(100) DEFAULT NULL,
+  "ROLE_DESCRIPTION" varchar(500) DEFAULT NULL,
+  "ROLE_TYPE" varchar(50) DEFAULT NULL,
+  "ROLE_ORDER" int(11) DEFAULT NULL,
+  "ROLE_READ_ONLY" int(11) DEFAULT NULL,
+  "ROLE_VERSION" int(11) DEFAULT NULL
+);
+
+DROP TABLE IF EXISTS "JEDA_ROLE_USER";
+CREATE TABLE "JEDA_ROLE_USER" (
+  "USER_ID" varchar(50) DEFAULT NULL,
+  "ROLE_ID" varchar(50) DEFAULT NULL
+);
+
+DROP TABLE IF EXISTS "JEDA_USER";
+CREATE TABLE "JEDA_USER" (
+  "USER_ID" varchar(50) NOT NULL,
+  "POSITION_ID" varchar(50) DEFAULT NULL,
+  "ORG_ID" varchar(50) DEFAULT NULL,
+  "USER_NAME" varchar(100) DEFAULT NULL,
+  "USER_PASSWORD" varchar(100) DEFAULT NULL,
+  "USER_ID_NO" varchar(50) DEFAULT NULL,
+  "USER_GENDER" varchar(8) DEFAULT NULL,
+  "USER_EMAIL" varchar(100) DEFAULT NULL,
+  "USER_BIRTHDAY" date DEFAULT NULL,
+  "USER_ADDRESS" varchar(500) DEFAULT NULL,
+  "USER_POST" varchar(50) DEFAULT NULL,
+  "USER_TEL" varchar(50) DEFAULT NULL,
+  "USER_MOBILE" varchar(50) DEFAULT NULL,
+  "USER_DESCRIPTION" varchar(500) DEFAULT NULL,
+  "USER_ENABLED" int(10) DEFAULT NULL,
+  "USER_LOCKED" int(11) DEFAULT NULL,
+  "USER_ACCOUNT_NONEXPIRED" int(11) DEFAULT NULL,
+  "USER_ACCOUNT_NONLOCKED" int(11) DEFAULT NULL,
+  "USER_CREDENTIALS_NONEXPIRED" int(11) DEFAULT NULL,
+  "USER_ORDER" int(11) DEFAULT NULL,
+  "USER_VERSION" int(11) DEFAULT NULL,
+  "USER_CREATOR" varchar(50) DEFAULT NULL,
+  "USER_CREATED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "USER_MODIFIER" varchar(50) DEFAULT NULL,
+  "USER_MODIFIED" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "ADDVCD" varchar(500) DEFAULT NULL,
+  "VISITS" int(11) DEFAULT '0',
+  "LOGIN_TIME" varchar(50) DEFAULT NULL,
+  "LOGIN_NAME" varchar(60) DEFAULT NULL,
+  PRIMARY KEY ("USER_ID")
+);
@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XLSX文件中除工作表以外的固定内容
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxSheetBegin = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// XLSXWriter 逐行写入只有一个工作表的XLSX文件，数值和布尔值写为对应类型的单元格，其他值写为字符串
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// NewXLSXWriter 创建XLSX文件，sheet为工作表的名称
+func NewXLSXWriter(w io.Writer, sheet string) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheet))
+	files := [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, f[1]); err != nil {
+			return nil, err
+		}
+	}
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	c := &XLSXWriter{zw: zw, sheet: bufio.NewWriter(sw)}
+	_, err = c.sheet.WriteString(xlsxSheetBegin)
+	return c, err
+}
+
+// XLSXColumnName 返回从0开始的列序号对应的列名，如0为A，26为AA
+func XLSXColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// WriteRow 写入一行数据
+func (c *XLSXWriter) WriteRow(row []interface{}) error {
+	c.rows++
+	var sb strings.Builder
+	sb.WriteString(`<row r="` + strconv.Itoa(c.rows) + `">`)
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		ref := XLSXColumnName(i) + strconv.Itoa(c.rows)
+		switch val := v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			sb.WriteString(`<c r="` + ref + `"><v>` + fmt.Sprint(val) + `</v></c>`)
+		case bool:
+			b := "0"
+			if val {
+				b = "1"
+			}
+			sb.WriteString(`<c r="` + ref + `" t="b"><v>` + b + `</v></c>`)
+		default:
+			sb.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&sb, []byte(fmt.Sprint(val)))
+			sb.WriteString(`</t></is></c>`)
+		}
+	}
+	sb.WriteString(`</row>`)
+	_, err := c.sheet.WriteString(sb.String())
+	return err
+}
+
+// Close 结束工作表并完成文件的写入
+func (c *XLSXWriter) Close() error {
+	if _, err := c.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := c.sheet.Flush(); err != nil {
+		return err
+	}
+	return c.zw.Close()
+}
+
+// XLSXReader 逐行读取XLSX文件第一个工作表中的数据，所有单元格的值均返回为字符串
+// 工作表按XML流读取，内存中只保留共享字符串表和当前行
+type XLSXReader struct {
+	shared []string
+	sheet  io.ReadCloser
+	dec    *xml.Decoder
+	// numeric 当前行中每一列是否为数字单元格
+	numeric []bool
+}
+
+// xlsxRelationship 关系文件中的一个关系
+type xlsxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+// NewXLSXReader 打开XLSX文件，size为文件的大小
+func NewXLSXReader(r io.ReaderAt, size int64) (*XLSXReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("文件不是有效的xlsx文件：" + err.Error())
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	path, err := getXLSXFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	c := &XLSXReader{}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if c.shared, err = readXLSXSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := files[path]
+	if !ok {
+		return nil, fmt.Errorf("xlsx文件中没有工作表" + path)
+	}
+	if c.sheet, err = f.Open(); err != nil {
+		return nil, err
+	}
+	c.dec = xml.NewDecoder(c.sheet)
+	return c, nil
+}
+
+// getXLSXFirstSheet 返回第一个工作表在文件中的路径
+func getXLSXFirstSheet(files map[string]*zip.File) (string, error) {
+	var wb struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []xlsxRelationship `xml:"Relationship"`
+	}
+	if err := decodeXLSXPart(files["xl/workbook.xml"], &wb); err != nil {
+		return "", err
+	}
+	if err := decodeXLSXPart(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("xlsx文件中没有工作表")
+	}
+	for _, r := range rels.Relationships {
+		if r.ID != wb.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(r.Target, "/") {
+			return strings.TrimPrefix(r.Target, "/"), nil
+		}
+		return "xl/" + r.Target, nil
+	}
+	return "", fmt.Errorf("xlsx文件中没有找到第一个工作表")
+}
+
+// decodeXLSXPart 解析XLSX文件中的XML文件
+func decodeXLSXPart(f *zip.File, v interface{}) error {
+	if f == nil {
+		return fmt.Errorf("文件不是有效的xlsx文件")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// readXLSXSharedStrings 读取共享字符串表，富文本的多个片段合并为一个字符串，忽略注音
+func readXLSXSharedStrings(f *zip.File) ([]string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	dec := xml.NewDecoder(r)
+	shared := make([]string, 0)
+	var sb strings.Builder
+	inPh := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				sb.Reset()
+			case "rPh":
+				inPh = true
+			case "t":
+				if !inPh {
+					s, err := readXLSXText(dec)
+					if err != nil {
+						return nil, err
+					}
+					sb.WriteString(s)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				shared = append(shared, sb.String())
+			case "rPh":
+				inPh = false
+			}
+		}
+	}
+}
+
+// readXLSXText 读取当前元素的文本直到元素结束
+func readXLSXText(dec *xml.Decoder) (string, error) {
+	var sb strings.Builder
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return sb.String(), nil
+}
+
+// xlsxColumnIndex 返回单元格引用中的列序号，如B3返回1，不是有效的引用时返回-1
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return index - 1
+}
+
+// Read 读取下一行数据，没有数据时返回io.EOF，行中没有值的单元格返回空字符串
+func (c *XLSXReader) Read() ([]string, error) {
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := tok.(xml.StartElement); ok && t.Name.Local == "row" {
+			return c.readRow()
+		}
+	}
+}
+
+// readRow 读取一行中的单元格
+func (c *XLSXReader) readRow() ([]string, error) {
+	row := make([]string, 0)
+	c.numeric = c.numeric[:0]
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return row, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			index, typ := len(row), ""
+			for _, a := range t.Attr {
+				switch a.Name.Local {
+				case "r":
+					if i := xlsxColumnIndex(a.Value); i >= 0 {
+						index = i
+					}
+				case "t":
+					typ = a.Value
+				}
+			}
+			value, err := c.readCell(typ)
+			if err != nil {
+				return nil, err
+			}
+			for len(row) <= index {
+				row = append(row, "")
+				c.numeric = append(c.numeric, false)
+			}
+			row[index] = value
+			c.numeric[index] = value != "" && (typ == "" || typ == "n")
+		}
+	}
+}
+
+// readCell 读取单元格的值，共享字符串转换为字符串表中的值
+func (c *XLSXReader) readCell(typ string) (string, error) {
+	var value string
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			if typ == "s" {
+				i, err := strconv.Atoi(value)
+				if err != nil || i < 0 || i >= len(c.shared) {
+					return "", fmt.Errorf("xlsx文件中的共享字符串序号%s不正确", value)
+				}
+				return c.shared[i], nil
+			}
+			return value, nil
+		case xml.StartElement:
+			if t.Name.Local == "v" || t.Name.Local == "t" {
+				s, err := readXLSXText(c.dec)
+				if err != nil {
+					return "", err
+				}
+				value += s
+			}
+		}
+	}
+}
+
+// IsNumeric 返回当前行中第index列是否为数字单元格，Excel中的日期和时间保存为数字单元格
+func (c *XLSXReader) IsNumeric(index int) bool {
+	return index >= 0 && index < len(c.numeric) && c.numeric[index]
+}
+
+// Close 关闭工作表
+func (c *XLSXReader) Close() error {
+	return c.sheet.Close()
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXLSXColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := XLSXColumnName(i); got != want {
+			t.Errorf("XLSXColumnName(%d)=%s,want %s", i, got, want)
+		}
+	}
+}
+
+func TestXLSXReader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	xw, err := NewXLSXWriter(buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{{"ID", "NAME", "AMOUNT"}, {"A", "<名称>", 1.5}, {"B", nil, 2}}
+	for _, row := range rows {
+		if err := xw.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	xr, err := NewXLSXReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xr.Close()
+	want := [][]string{{"ID", "NAME", "AMOUNT"}, {"A", "<名称>", "1.5"}, {"B", "", "2"}}
+	for _, w := range want {
+		row, err := xr.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(row, "|") != strings.Join(w, "|") {
+			t.Errorf("Read()=%v,want %v", row, w)
+		}
+		if w[0] != "ID" && (xr.IsNumeric(0) || xr.IsNumeric(1) || !xr.IsNumeric(2) || xr.IsNumeric(3)) {
+			t.Errorf("IsNumeric of row %v", row)
+		}
+	}
+	if _, err := xr.Read(); err != io.EOF {
+		t.Errorf("Read() at end returned %v", err)
+	}
+}